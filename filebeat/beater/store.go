@@ -23,6 +23,8 @@ import (
 	"github.com/elastic/beats/v7/filebeat/config"
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/boltstore"
 	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/paths"
@@ -35,16 +37,32 @@ type filebeatStore struct {
 }
 
 func openStateStore(info beat.Info, logger *logp.Logger, cfg config.Registry) (*filebeatStore, error) {
-	memlog, err := memlog.New(logger, memlog.Settings{
-		Root:     paths.Resolve(paths.Data, cfg.Path),
-		FileMode: cfg.Permissions,
-	})
+	var (
+		reg backend.Registry
+		err error
+	)
+	switch cfg.Backend {
+	case config.RegistryBackendBolt:
+		// A registry written by memlog is imported the first time the
+		// bolt backend is used.
+		reg, err = boltstore.New(logger, boltstore.Settings{
+			Root:          paths.Resolve(paths.Data, cfg.Path),
+			FileMode:      cfg.Permissions,
+			MigrateMemlog: true,
+			SyncInterval:  cfg.FlushTimeout,
+		})
+	default:
+		reg, err = memlog.New(logger, memlog.Settings{
+			Root:     paths.Resolve(paths.Data, cfg.Path),
+			FileMode: cfg.Permissions,
+		})
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return &filebeatStore{
-		registry:      statestore.NewRegistry(memlog),
+		registry:      statestore.NewRegistry(reg),
 		storeName:     info.Beat,
 		cleanInterval: cfg.CleanInterval,
 	}, nil
@@ -61,3 +79,22 @@ func (s *filebeatStore) Access() (*statestore.Store, error) {
 func (s *filebeatStore) CleanupInterval() time.Duration {
 	return s.cleanInterval
 }
+
+// OpenRegistryStore opens the registry configured in cfg for tools that
+// inspect or modify it while Filebeat is not running. The returned
+// function closes the store and the registry.
+func OpenRegistryStore(info beat.Info, logger *logp.Logger, cfg config.Registry) (*statestore.Store, func(), error) {
+	stateStore, err := openStateStore(info, logger, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := stateStore.Access()
+	if err != nil {
+		stateStore.Close()
+		return nil, nil, err
+	}
+	return store, func() {
+		store.Close()
+		stateStore.Close()
+	}, nil
+}
@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package channel
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/cfgfile"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// processorsConfig is the configuration of the processors of a runner, it
+// is updated when the configuration of the runner is updated.
+type processorsConfig struct {
+	current atomic.Pointer[versionedProcessorsConfig]
+}
+
+type versionedProcessorsConfig struct {
+	config  processors.PluginConfig
+	version uint64
+}
+
+func newProcessorsConfig(config processors.PluginConfig) *processorsConfig {
+	c := &processorsConfig{}
+	c.current.Store(&versionedProcessorsConfig{config: config})
+	return c
+}
+
+// set replaces the configuration. Concurrent calls are serialized by the
+// reloader of the runner.
+func (c *processorsConfig) set(config processors.PluginConfig) {
+	c.current.Store(&versionedProcessorsConfig{config: config, version: c.version() + 1})
+}
+
+func (c *processorsConfig) get() (processors.PluginConfig, uint64) {
+	current := c.current.Load()
+	return current.config, current.version
+}
+
+func (c *processorsConfig) version() uint64 {
+	return c.current.Load().version
+}
+
+// reloadingProcessors runs the processors created from a processorsConfig.
+// The processors are replaced by new processors before the first event
+// processed after the configuration has been updated. Run is called
+// sequentially by the pipeline client, so it only checks the version of the
+// configuration without locking.
+type reloadingProcessors struct {
+	log    *logp.Logger
+	config *processorsConfig
+
+	version uint64
+	procs   atomic.Pointer[processors.Processors]
+
+	// mu serializes replacing and closing the processors.
+	mu     sync.Mutex
+	closed bool
+}
+
+func newReloadingProcessors(config *processorsConfig) (*reloadingProcessors, error) {
+	cfg, version := config.get()
+	procs, err := processors.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &reloadingProcessors{
+		log:     logp.NewLogger("processors"),
+		config:  config,
+		version: version,
+	}
+	p.procs.Store(procs)
+	return p, nil
+}
+
+func (p *reloadingProcessors) Run(event *beat.Event) (*beat.Event, error) {
+	if p.config.version() != p.version {
+		p.reload()
+	}
+	return p.procs.Load().Run(event)
+}
+
+func (p *reloadingProcessors) reload() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cfg, version := p.config.get()
+	p.version = version
+	if p.closed {
+		return
+	}
+	procs, err := processors.New(cfg)
+	if err != nil {
+		p.log.Errorf("Failed to create the updated processors, the previous processors are kept: %v", err)
+		return
+	}
+	if err := p.procs.Swap(procs).Close(); err != nil {
+		p.log.Errorf("Failed to close the previous processors: %v", err)
+	}
+}
+
+func (p *reloadingProcessors) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return p.procs.Load().Close()
+}
+
+func (p *reloadingProcessors) String() string {
+	return p.procs.Load().String()
+}
+
+// updatableRunner replaces the processors of a runner which implements
+// cfgfile.Updater when the runner is updated. The runner must not be
+// updated if any other common input setting has been changed.
+type updatableRunner struct {
+	cfgfile.Runner
+	processors *processorsConfig
+}
+
+func (r *updatableRunner) Update(cfg *conf.C) (bool, error) {
+	config := commonInputConfig{}
+	if err := cfg.Unpack(&config); err != nil {
+		return false, err
+	}
+
+	// check the processors can be created before updating the runner
+	procs, err := processors.New(config.Processors)
+	if err != nil {
+		return false, err
+	}
+	_ = procs.Close()
+
+	updated, err := r.Runner.(cfgfile.Updater).Update(cfg)
+	if err != nil || !updated {
+		return false, err
+	}
+	r.processors.set(config.Processors)
+	return true, nil
+}
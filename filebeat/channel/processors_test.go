@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package channel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/cfgfile"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type updatableRunnerMock struct {
+	cfgfile.Runner
+	pipeline beat.PipelineConnector
+	client   beat.Client
+	updated  bool
+	configs  []*conf.C
+}
+
+// Start connects to the pipeline like v2 inputs do when they are run.
+func (r *updatableRunnerMock) Start() {
+	r.client, _ = r.pipeline.ConnectWith(beat.ClientConfig{})
+}
+
+func (r *updatableRunnerMock) Update(cfg *conf.C) (bool, error) {
+	r.configs = append(r.configs, cfg)
+	return r.updated, nil
+}
+
+type updatableRunnerFactoryMock struct {
+	runner *updatableRunnerMock
+}
+
+func (f *updatableRunnerFactoryMock) Create(p beat.PipelineConnector, _ *conf.C) (cfgfile.Runner, error) {
+	f.runner.pipeline = p
+	return f.runner, nil
+}
+
+func (*updatableRunnerFactoryMock) CheckConfig(*conf.C) error {
+	return nil
+}
+
+func TestUpdatableRunnerReplacesProcessors(t *testing.T) {
+	newConfig := func(t *testing.T, processorsYAML string) *conf.C {
+		configYAML := "type: filestream\n" + processorsYAML
+		cfg, err := conf.NewConfigWithYAML([]byte(configYAML), configYAML)
+		require.NoError(t, err)
+		return cfg
+	}
+	addVersion := func(version string) string {
+		return `
+processors:
+  - add_fields:
+      target: ""
+      fields.version: ` + version + `
+`
+	}
+
+	cases := map[string]struct {
+		updated         bool
+		processors      string
+		expectedErr     bool
+		expectedVersion string
+	}{
+		"runner updated": {
+			updated:         true,
+			processors:      addVersion("b"),
+			expectedVersion: "b",
+		},
+		"runner not updated": {
+			processors:      addVersion("b"),
+			expectedVersion: "a",
+		},
+		"invalid processors": {
+			updated:         true,
+			processors:      "processors: [{unknown_processor: ~}]",
+			expectedErr:     true,
+			expectedVersion: "a",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := &updatableRunnerFactoryMock{runner: &updatableRunnerMock{updated: tc.updated}}
+			runner, err := RunnerFactoryWithCommonInputSettings(beat.Info{}, f).
+				Create(&pipelineConnectorMock{}, newConfig(t, addVersion("a")))
+			require.NoError(t, err)
+			runner.Start()
+
+			requireVersion := func(t *testing.T, expected string) {
+				t.Helper()
+				processor := f.runner.client.(*clientMock).cfg.Processing.Processor
+				event, err := processor.Run(&beat.Event{Fields: mapstr.M{}})
+				require.NoError(t, err)
+				version, err := event.GetValue("version")
+				require.NoError(t, err)
+				require.Equal(t, expected, version)
+			}
+			requireVersion(t, "a")
+
+			updated, err := runner.(cfgfile.Updater).Update(newConfig(t, tc.processors))
+			if tc.expectedErr {
+				require.Error(t, err)
+				require.Empty(t, f.runner.configs, "the runner must not be updated")
+			} else {
+				require.NoError(t, err)
+				require.Len(t, f.runner.configs, 1)
+			}
+			require.Equal(t, tc.updated && !tc.expectedErr, updated)
+
+			// the existing client uses the new processors
+			requireVersion(t, tc.expectedVersion)
+			require.True(t, hasReloadingProcessors(f.runner.client.(*clientMock).cfg.Processing.Processor))
+		})
+	}
+}
+
+func TestRunnerFactoryWithCommonInputSettingsNotUpdatable(t *testing.T) {
+	cfg, err := conf.NewConfigWithYAML([]byte("type: log"), "")
+	require.NoError(t, err)
+
+	runner, err := RunnerFactoryWithCommonInputSettings(beat.Info{}, &runnerFactoryMock{}).
+		Create(&pipelineConnectorMock{}, cfg)
+	require.NoError(t, err)
+
+	_, ok := runner.(cfgfile.Updater)
+	require.False(t, ok, "runners which cannot be updated must not implement cfgfile.Updater")
+}
+
+func TestRunnerFactoryWithCommonInputSettingsStaticProcessors(t *testing.T) {
+	cfg, err := conf.NewConfigWithYAML([]byte("type: log\nprocessors: [{add_fields: {fields.a: b}}]"), "")
+	require.NoError(t, err)
+
+	factory := &runnerFactoryMock{clientCount: 1}
+	_, err = RunnerFactoryWithCommonInputSettings(beat.Info{}, factory).
+		Create(&pipelineConnectorMock{}, cfg)
+	require.NoError(t, err)
+
+	require.Len(t, factory.cfgs, 1)
+	require.False(t, hasReloadingProcessors(factory.cfgs[0].Processing.Processor),
+		"the processors of runners which cannot be updated must not be reloaded")
+}
+
+func hasReloadingProcessors(p beat.Processor) bool {
+	switch p := p.(type) {
+	case *reloadingProcessors:
+		return true
+	case *processors.Processors:
+		for _, child := range p.List {
+			if hasReloadingProcessors(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -18,6 +18,8 @@
 package channel
 
 import (
+	"sync/atomic"
+
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/cfgfile"
 	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
@@ -92,12 +94,31 @@ func RunnerFactoryWithCommonInputSettings(info beat.Info, f cfgfile.RunnerFactor
 			pipeline beat.PipelineConnector,
 			cfg *conf.C,
 		) (runner cfgfile.Runner, err error) {
-			pipeline, err = withClientConfig(info, pipeline, cfg)
+			config := commonInputConfig{}
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+
+			// The processors of runners that can be updated are replaced
+			// when they are updated. Whether a runner can be updated is
+			// only known once it is created, runners that connect to the
+			// pipeline before that use static processors.
+			var procs atomic.Pointer[processorsConfig]
+			editor, err := newCommonConfigEditorWithProcessors(info, cfg, procs.Load)
 			if err != nil {
 				return nil, err
 			}
 
-			return f.Create(pipeline, cfg)
+			runner, err = f.Create(pipetool.WithClientConfigEdit(pipeline, editor), cfg)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := runner.(cfgfile.Updater); ok {
+				updatable := &updatableRunner{Runner: runner, processors: newProcessorsConfig(config.Processors)}
+				procs.Store(updatable.processors)
+				runner = updatable
+			}
+			return runner, nil
 		})
 }
 
@@ -105,23 +126,22 @@ func wrapRunnerCreate(f cfgfile.RunnerFactory, edit onCreateWrapper) cfgfile.Run
 	return &onCreateFactory{factory: f, create: edit}
 }
 
-// withClientConfig reads common Beat input instance configurations from the
-// configuration object and ensure that the settings are applied to each client.
-func withClientConfig(
+func newCommonConfigEditor(
 	beatInfo beat.Info,
-	pipeline beat.PipelineConnector,
 	cfg *conf.C,
-) (beat.PipelineConnector, error) {
-	editor, err := newCommonConfigEditor(beatInfo, cfg)
-	if err != nil {
-		return nil, err
-	}
-	return pipetool.WithClientConfigEdit(pipeline, editor), nil
+) (pipetool.ConfigEditor, error) {
+	return newCommonConfigEditorWithProcessors(beatInfo, cfg, nil)
 }
 
-func newCommonConfigEditor(
+// newCommonConfigEditorWithProcessors creates the processors configured in
+// the processorsConfig returned by reloadable instead of the processors of
+// cfg, if reloadable is not nil and returns a processorsConfig when a client
+// connects. These processors are replaced when the processorsConfig is
+// updated.
+func newCommonConfigEditorWithProcessors(
 	beatInfo beat.Info,
 	cfg *conf.C,
+	reloadable func() *processorsConfig,
 ) (pipetool.ConfigEditor, error) {
 	config := commonInputConfig{}
 	if err := cfg.Unpack(&config); err != nil {
@@ -144,9 +164,25 @@ func newCommonConfigEditor(
 			indexProcessor = add_formatted_index.New(timestampFormat)
 		}
 
-		userProcessors, err := processors.New(config.Processors)
-		if err != nil {
-			return clientCfg, err
+		var processorsCfg *processorsConfig
+		if reloadable != nil {
+			processorsCfg = reloadable()
+		}
+
+		var userProcessors *processors.Processors
+		if processorsCfg != nil {
+			reloading, err := newReloadingProcessors(processorsCfg)
+			if err != nil {
+				return clientCfg, err
+			}
+			userProcessors = processors.NewList(nil)
+			userProcessors.AddProcessor(reloading)
+		} else {
+			var err error
+			userProcessors, err = processors.New(config.Processors)
+			if err != nil {
+				return clientCfg, err
+			}
 		}
 
 		meta := clientCfg.Processing.Meta.Clone()
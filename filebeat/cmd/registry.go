@@ -0,0 +1,287 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/filebeat/beater"
+	"github.com/elastic/beats/v7/filebeat/config"
+	"github.com/elastic/beats/v7/filebeat/registrar/registrytool"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance/locks"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// genRegistryCmd initializes the registry command to inspect and edit
+// the registry while Filebeat is stopped, with the following subcommands:
+//   - list
+//   - show
+//   - delete
+//   - reset-offset
+//   - export
+//   - import
+func genRegistryCmd(settings instance.Settings) *cobra.Command {
+	registryCmd := cobra.Command{
+		Use:   "registry",
+		Short: "Inspect and edit the registry while Filebeat is stopped",
+	}
+
+	registryCmd.AddCommand(genRegistryListCmd(settings))
+	registryCmd.AddCommand(genRegistryShowCmd(settings))
+	registryCmd.AddCommand(genRegistryDeleteCmd(settings))
+	registryCmd.AddCommand(genRegistryResetOffsetCmd(settings))
+	registryCmd.AddCommand(genRegistryExportCmd(settings))
+	registryCmd.AddCommand(genRegistryImportCmd(settings))
+
+	return &registryCmd
+}
+
+// addFilterFlags registers the flags selecting registry entries.
+func addFilterFlags(command *cobra.Command, filter *registrytool.Filter) {
+	command.Flags().StringVar(&filter.InputType, "input-type", "", "only entries of inputs of this type, e.g. filestream or log")
+	command.Flags().StringVar(&filter.InputID, "input-id", "", "only entries of the input with this ID")
+	command.Flags().StringVar(&filter.Source, "source", "", "only entries of files whose path matches this glob pattern")
+}
+
+func genRegistryListCmd(settings instance.Settings) *cobra.Command {
+	var filter registrytool.Filter
+	command := &cobra.Command{
+		Use:   "list",
+		Short: "List registry entries",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistry(settings, func(store *statestore.Store) error {
+				entries, err := registrytool.List(store, filter)
+				if err != nil {
+					return err
+				}
+				printEntries(os.Stdout, entries)
+				return nil
+			})
+		}),
+	}
+	addFilterFlags(command, &filter)
+	return command
+}
+
+func genRegistryShowCmd(settings instance.Settings) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show KEY...",
+		Short: "Show registry entries as JSON",
+		Args:  cobra.MinimumNArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistry(settings, func(store *statestore.Store) error {
+				filter := registrytool.Filter{Keys: args}
+				n, err := registrytool.Export(store, filter, os.Stdout)
+				if err != nil {
+					return err
+				}
+				if n < len(args) {
+					return fmt.Errorf("found %d of %d entries", n, len(args))
+				}
+				return nil
+			})
+		}),
+	}
+}
+
+func genRegistryDeleteCmd(settings instance.Settings) *cobra.Command {
+	var filter registrytool.Filter
+	var all bool
+	command := &cobra.Command{
+		Use:   "delete [KEY...]",
+		Short: "Delete registry entries",
+		Long: "Delete the given registry entries, or the entries selected by the filter flags.\n" +
+			"The files of deleted entries are read again from the beginning.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			filter.Keys = args
+			if filter.IsEmpty() && !all {
+				return errors.New("no entries selected, pass keys, filter flags or --all")
+			}
+			return withRegistry(settings, func(store *statestore.Store) error {
+				deleted, err := registrytool.Delete(store, filter)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Deleted %d entries\n", len(deleted))
+				return nil
+			})
+		}),
+	}
+	addFilterFlags(command, &filter)
+	command.Flags().BoolVar(&all, "all", false, "delete all entries")
+	return command
+}
+
+func genRegistryResetOffsetCmd(settings instance.Settings) *cobra.Command {
+	var filter registrytool.Filter
+	var offset int64
+	command := &cobra.Command{
+		Use:   "reset-offset [KEY...]",
+		Short: "Set the offset Filebeat resumes reading files from",
+		Long: "Set the offset of the given registry entries, or of the entries selected by the filter flags.\n" +
+			"By default the offset is reset to 0, so the files are read again from the beginning.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			filter.Keys = args
+			if filter.IsEmpty() {
+				return errors.New("no entries selected, pass keys or filter flags")
+			}
+			return withRegistry(settings, func(store *statestore.Store) error {
+				updated, err := registrytool.ResetOffset(store, filter, offset)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Updated %d entries\n", len(updated))
+				return nil
+			})
+		}),
+	}
+	addFilterFlags(command, &filter)
+	command.Flags().Int64Var(&offset, "offset", 0, "the new offset")
+	return command
+}
+
+func genRegistryExportCmd(settings instance.Settings) *cobra.Command {
+	var filter registrytool.Filter
+	var file string
+	command := &cobra.Command{
+		Use:   "export",
+		Short: "Export registry entries as JSON",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return withRegistry(settings, func(store *statestore.Store) error {
+				var out io.Writer = os.Stdout
+				if file != "" && file != "-" {
+					f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					out = f
+				}
+				n, err := registrytool.Export(store, filter, out)
+				if err != nil {
+					return err
+				}
+				if out != os.Stdout {
+					fmt.Printf("Exported %d entries to %s\n", n, file)
+				}
+				return nil
+			})
+		}),
+	}
+	addFilterFlags(command, &filter)
+	command.Flags().StringVar(&file, "file", "", "file to write the entries to, defaults to stdout")
+	return command
+}
+
+func genRegistryImportCmd(settings instance.Settings) *cobra.Command {
+	var file string
+	command := &cobra.Command{
+		Use:   "import",
+		Short: "Import registry entries from a JSON export",
+		Long:  "Import registry entries written by the export command. Existing entries with the same key are overwritten.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = os.Stdin
+			if file != "" && file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			return withRegistry(settings, func(store *statestore.Store) error {
+				n, err := registrytool.Import(store, in)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Imported %d entries\n", n)
+				return nil
+			})
+		}),
+	}
+	command.Flags().StringVar(&file, "file", "", "file to read the entries from, defaults to stdin")
+	return command
+}
+
+// withRegistry opens the registry configured for Filebeat and calls fn
+// with its store. It fails if Filebeat is running with the same data path.
+func withRegistry(settings instance.Settings, fn func(*statestore.Store) error) error {
+	b, err := instance.NewInitializedBeat(settings)
+	if err != nil {
+		return fmt.Errorf("error initializing beat: %w", err)
+	}
+
+	lock := locks.New(b.Info)
+	if err := lock.Lock(); err != nil {
+		return fmt.Errorf("Filebeat must be stopped to access the registry: %w", err)
+	}
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	rawConfig, err := b.BeatConfig()
+	if err != nil {
+		return err
+	}
+	cfg := config.DefaultConfig
+	if err := rawConfig.Unpack(&cfg); err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	store, closeStore, err := beater.OpenRegistryStore(b.Info, logp.NewLogger("registry"), cfg.Registry)
+	if err != nil {
+		return fmt.Errorf("failed to open registry: %w", err)
+	}
+	defer closeStore()
+
+	return fn(store)
+}
+
+func printEntries(out io.Writer, entries []registrytool.Entry) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tINPUT\tID\tSOURCE\tOFFSET\tUPDATED")
+	for _, e := range entries {
+		offset := "-"
+		if n, ok := e.Offset(); ok {
+			offset = fmt.Sprint(n)
+		}
+		updated := "-"
+		if t, ok := e.Updated(); ok {
+			updated = t.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Key, e.InputType(), orDash(e.InputID()), orDash(e.Source()), offset, updated)
+	}
+	w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -56,6 +56,22 @@ type Registry struct {
 	FlushTimeout  time.Duration `config:"flush"`
 	CleanInterval time.Duration `config:"cleanup_interval"`
 	MigrateFile   string        `config:"migrate_file"`
+	Backend       string        `config:"backend"`
+}
+
+// Registry backends that can be selected with registry.backend.
+const (
+	RegistryBackendMemlog = "memlog"
+	RegistryBackendBolt   = "bolt"
+)
+
+func (r *Registry) Validate() error {
+	switch r.Backend {
+	case RegistryBackendMemlog, RegistryBackendBolt:
+		return nil
+	default:
+		return fmt.Errorf("unknown registry backend '%v'", r.Backend)
+	}
 }
 
 var DefaultConfig = Config{
@@ -65,6 +81,7 @@ var DefaultConfig = Config{
 		MigrateFile:   "",
 		CleanInterval: 5 * time.Minute,
 		FlushTimeout:  time.Second,
+		Backend:       RegistryBackendMemlog,
 	},
 	ShutdownTimeout:    0,
 	OverwritePipelines: false,
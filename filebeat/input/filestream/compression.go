@@ -0,0 +1,173 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported values of the compression setting.
+const (
+	compressionNone = "none"
+	compressionAuto = "auto"
+)
+
+// compressionKind is the compression format of a file, detected by the
+// magic bytes at its start.
+type compressionKind int
+
+const (
+	uncompressed compressionKind = iota
+	gzipCompressed
+	zstdCompressed
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// errIncompleteCompressedFile is returned when a compressed file ends in the
+// middle of the compressed stream, usually because it's still being written.
+var errIncompleteCompressedFile = errors.New("compressed file is incomplete")
+
+func (k compressionKind) String() string {
+	switch k {
+	case gzipCompressed:
+		return "gzip"
+	case zstdCompressed:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// detectCompression reads the magic bytes of f without moving its offset.
+// Files that are too short to hold the magic bytes are uncompressed.
+func detectCompression(f *os.File) (compressionKind, error) {
+	magic := make([]byte, len(zstdMagic))
+	n, err := f.ReadAt(magic, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return uncompressed, fmt.Errorf("failed to read magic bytes of %s: %w", f.Name(), err)
+	}
+	magic = magic[:n]
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzipCompressed, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		return zstdCompressed, nil
+	default:
+		return uncompressed, nil
+	}
+}
+
+// isCompressedFile returns true if the file at path is compressed.
+func isCompressedFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	kind, err := detectCompression(f)
+	return err == nil && kind != uncompressed
+}
+
+// newDecompressor returns a reader of the decompressed content of r. Reads
+// fail with errIncompleteCompressedFile if r ends in the middle of the
+// compressed stream.
+func newDecompressor(kind compressionKind, r io.Reader) (io.ReadCloser, error) {
+	switch kind {
+	case gzipCompressed:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, wrapDecompressionError(err)
+		}
+		return &decompressor{Reader: gz, closer: gz}, nil
+	case zstdCompressed:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, err
+		}
+		return &decompressor{Reader: zr, closer: zr.IOReadCloser()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %v", kind)
+	}
+}
+
+type decompressor struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (d *decompressor) Read(p []byte) (int, error) {
+	n, err := d.Reader.Read(p)
+	return n, wrapDecompressionError(err)
+}
+
+func (d *decompressor) Close() error {
+	return d.closer.Close()
+}
+
+func wrapDecompressionError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", errIncompleteCompressedFile, err)
+	}
+	return err
+}
+
+// openDecompressed returns a reader of the decompressed content of f that
+// has skipped the first offset bytes. Offsets of compressed files are
+// offsets into their decompressed content, so the content before offset
+// has to be decompressed again when reading resumes. If the decompressed
+// content is shorter than offset, the reader starts at the beginning and
+// the returned bool is true.
+func openDecompressed(f *os.File, kind compressionKind, offset int64) (io.ReadCloser, bool, error) {
+	dec, err := newDecompressor(kind, f)
+	if err != nil {
+		return nil, false, err
+	}
+	if offset == 0 {
+		return dec, false, nil
+	}
+
+	_, err = io.CopyN(io.Discard, dec, offset)
+	if err == nil {
+		return dec, false, nil
+	}
+	dec.Close()
+	if !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	dec, err = newDecompressor(kind, f)
+	if err != nil {
+		return nil, false, err
+	}
+	return dec, true, nil
+}
@@ -0,0 +1,236 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const compressionTestContent = "first line\nsecond line\nthird line\n"
+
+func TestDetectCompression(t *testing.T) {
+	dir := t.TempDir()
+	testCases := map[string]struct {
+		content  []byte
+		expected compressionKind
+	}{
+		"plain":  {content: []byte(compressionTestContent), expected: uncompressed},
+		"short":  {content: []byte{0x1f}, expected: uncompressed},
+		"empty":  {content: nil, expected: uncompressed},
+		"gzip":   {content: gzipBytes(t, compressionTestContent), expected: gzipCompressed},
+		"zstd":   {content: zstdBytes(t, compressionTestContent), expected: zstdCompressed},
+		"gzipgz": {content: gzipBytes(t, string(gzipBytes(t, "nested"))), expected: gzipCompressed},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := writeTempFile(t, dir, name, tc.content)
+			kind, err := detectCompression(f)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, kind)
+
+			// the offset of the file is not moved
+			offset, err := f.Seek(0, io.SeekCurrent)
+			require.NoError(t, err)
+			assert.Zero(t, offset)
+		})
+	}
+}
+
+func TestOpenDecompressed(t *testing.T) {
+	dir := t.TempDir()
+	files := map[compressionKind][]byte{
+		gzipCompressed: gzipBytes(t, compressionTestContent),
+		zstdCompressed: zstdBytes(t, compressionTestContent),
+	}
+
+	for kind, content := range files {
+		t.Run(kind.String(), func(t *testing.T) {
+			f := writeTempFile(t, dir, kind.String(), content)
+
+			t.Run("from offset", func(t *testing.T) {
+				_, err := f.Seek(0, io.SeekStart)
+				require.NoError(t, err)
+				dec, truncated, err := openDecompressed(f, kind, int64(len("first line\n")))
+				require.NoError(t, err)
+				defer dec.Close()
+				assert.False(t, truncated)
+
+				data, err := io.ReadAll(dec)
+				require.NoError(t, err)
+				assert.Equal(t, "second line\nthird line\n", string(data))
+			})
+
+			t.Run("offset after the end", func(t *testing.T) {
+				_, err := f.Seek(0, io.SeekStart)
+				require.NoError(t, err)
+				dec, truncated, err := openDecompressed(f, kind, 1000)
+				require.NoError(t, err)
+				defer dec.Close()
+				assert.True(t, truncated)
+
+				data, err := io.ReadAll(dec)
+				require.NoError(t, err)
+				assert.Equal(t, compressionTestContent, string(data))
+			})
+		})
+	}
+}
+
+func TestDecompressIncompleteFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[compressionKind][]byte{
+		gzipCompressed: gzipBytes(t, strings.Repeat(compressionTestContent, 100)),
+		zstdCompressed: zstdBytes(t, strings.Repeat(compressionTestContent, 100)),
+	}
+
+	for kind, content := range files {
+		t.Run(kind.String(), func(t *testing.T) {
+			f := writeTempFile(t, dir, kind.String(), content[:len(content)-8])
+			dec, err := newDecompressor(kind, f)
+			require.NoError(t, err)
+			defer dec.Close()
+
+			_, err = io.ReadAll(dec)
+			assert.ErrorIs(t, err, errIncompleteCompressedFile)
+		})
+	}
+}
+
+func TestCompressedLogFileReadsUntilEndOfStream(t *testing.T) {
+	f := writeTempFile(t, t.TempDir(), "test.log.gz", gzipBytes(t, compressionTestContent))
+	dec, err := newDecompressor(gzipCompressed, f)
+	require.NoError(t, err)
+
+	reader, err := newCompressedFileReader(logp.L(), context.TODO(), f, dec, 0, readerConfig{}, closerConfig{})
+	require.NoError(t, err)
+	defer reader.Close()
+
+	buf := make([]byte, 1024)
+	var data []byte
+	for {
+		n, err := reader.Read(buf)
+		data = append(data, buf[:n]...)
+		if err != nil {
+			// close.reader.on_eof is not set, but the end of the
+			// compressed stream ends the reader
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+	}
+	assert.Equal(t, compressionTestContent, string(data))
+	assert.EqualValues(t, len(compressionTestContent), reader.offset)
+}
+
+func TestFingerprintOfCompressedFile(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat(compressionTestContent, 100)
+	plainPath := filepath.Join(dir, "app.log")
+	gzPath := filepath.Join(dir, "app.log.1.gz")
+	zstPath := filepath.Join(dir, "app.log.2.zst")
+	require.NoError(t, os.WriteFile(plainPath, []byte(content), 0o600))
+	require.NoError(t, os.WriteFile(gzPath, gzipBytes(t, content), 0o600))
+	require.NoError(t, os.WriteFile(zstPath, zstdBytes(t, content), 0o600))
+
+	cfg := fileScannerConfig{
+		Fingerprint: fingerprintConfig{Enabled: true, Offset: 10, Length: 1024},
+		decompress:  true,
+	}
+	s, err := newFileScanner(nil, cfg)
+	require.NoError(t, err)
+
+	fingerprint := func(path string) string {
+		it, err := s.getIngestTarget(path)
+		require.NoError(t, err)
+		fd, err := s.toFileDescriptor(&it)
+		require.NoError(t, err)
+		return fd.Fingerprint
+	}
+	expected := fingerprint(plainPath)
+	assert.Equal(t, expected, fingerprint(gzPath))
+	assert.Equal(t, expected, fingerprint(zstPath))
+
+	t.Run("too small", func(t *testing.T) {
+		smallPath := filepath.Join(dir, "small.log.gz")
+		require.NoError(t, os.WriteFile(smallPath, gzipBytes(t, "short"), 0o600))
+		it, err := s.getIngestTarget(smallPath)
+		require.NoError(t, err)
+		_, err = s.toFileDescriptor(&it)
+		assert.ErrorIs(t, err, errFileTooSmall)
+	})
+
+	t.Run("without decompression", func(t *testing.T) {
+		cfg.decompress = false
+		s, err := newFileScanner(nil, cfg)
+		require.NoError(t, err)
+		it, err := s.getIngestTarget(plainPath)
+		require.NoError(t, err)
+		plain, err := s.toFileDescriptor(&it)
+		require.NoError(t, err)
+		assert.Equal(t, expected, plain.Fingerprint)
+
+		it, err = s.getIngestTarget(gzPath)
+		require.NoError(t, err)
+		_, err = s.toFileDescriptor(&it)
+		assert.ErrorIs(t, err, errFileTooSmall)
+	})
+}
+
+func writeTempFile(t *testing.T, dir, name string, content []byte) *os.File {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func gzipBytes(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
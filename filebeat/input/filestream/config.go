@@ -33,18 +33,20 @@ import (
 type config struct {
 	Reader readerConfig `config:",inline"`
 
-	ID             string             `config:"id"`
-	Paths          []string           `config:"paths"`
-	Close          closerConfig       `config:"close"`
-	FileWatcher    *conf.Namespace    `config:"prospector"`
-	FileIdentity   *conf.Namespace    `config:"file_identity"`
-	CleanInactive  time.Duration      `config:"clean_inactive" validate:"min=0"`
-	CleanRemoved   bool               `config:"clean_removed"`
-	HarvesterLimit uint32             `config:"harvester_limit" validate:"min=0"`
-	IgnoreOlder    time.Duration      `config:"ignore_older"`
-	IgnoreInactive ignoreInactiveType `config:"ignore_inactive"`
-	Rotation       *conf.Namespace    `config:"rotation"`
-	TakeOver       bool               `config:"take_over"`
+	ID             string              `config:"id"`
+	Paths          []string            `config:"paths"`
+	Close          closerConfig        `config:"close"`
+	FileWatcher    *conf.Namespace     `config:"prospector"`
+	FileIdentity   *conf.Namespace     `config:"file_identity"`
+	CleanInactive  time.Duration       `config:"clean_inactive" validate:"min=0"`
+	CleanRemoved   bool                `config:"clean_removed"`
+	HarvesterLimit uint32              `config:"harvester_limit" validate:"min=0"`
+	IgnoreOlder    time.Duration       `config:"ignore_older"`
+	IgnoreInactive ignoreInactiveType  `config:"ignore_inactive"`
+	StartPosition  startPositionConfig `config:"start_position"`
+	NetworkFS      networkFSConfig     `config:"network_fs"`
+	Rotation       *conf.Namespace     `config:"rotation"`
+	TakeOver       bool                `config:"take_over"`
 }
 
 type closerConfig struct {
@@ -67,6 +69,7 @@ type stateChangeCloserConfig struct {
 type readerConfig struct {
 	Backoff        backoffConfig           `config:"backoff"`
 	BufferSize     int                     `config:"buffer_size"`
+	Compression    string                  `config:"compression"`
 	Encoding       string                  `config:"encoding"`
 	ExcludeLines   []match.Matcher         `config:"exclude_lines"`
 	IncludeLines   []match.Matcher         `config:"include_lines"`
@@ -102,6 +105,8 @@ func defaultConfig() config {
 		CleanRemoved:   true,
 		HarvesterLimit: 0,
 		IgnoreOlder:    0,
+		StartPosition:  defaultStartPositionConfig(),
+		NetworkFS:      defaultNetworkFSConfig(),
 	}
 }
 
@@ -127,6 +132,7 @@ func defaultReaderConfig() readerConfig {
 			Max:  10 * time.Second,
 		},
 		BufferSize:     16 * humanize.KiByte,
+		Compression:    compressionNone,
 		LineTerminator: readfile.AutoLineTerminator,
 		MaxBytes:       10 * humanize.MiByte,
 		Tail:           false,
@@ -138,5 +144,15 @@ func (c *config) Validate() error {
 		return fmt.Errorf("no path is configured")
 	}
 
+	switch c.Reader.Compression {
+	case compressionNone, compressionAuto:
+	default:
+		return fmt.Errorf("invalid compression %q, must be %s or %s", c.Reader.Compression, compressionNone, compressionAuto)
+	}
+
+	if c.NetworkFS.Enabled && c.FileIdentity != nil && c.FileIdentity.Name() != fingerprintName {
+		return fmt.Errorf("network_fs requires the %s file identity, not %s", fingerprintName, c.FileIdentity.Name())
+	}
+
 	return nil
 }
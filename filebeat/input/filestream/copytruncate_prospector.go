@@ -204,6 +204,8 @@ func (p *copyTruncateFileProspector) Run(ctx input.Context, s loginp.StateMetada
 
 	defer p.stopHarvesterGroup(log, hg)
 
+	registerWatcherMetrics(ctx.MetricsRegistry, p.filewatcher)
+
 	var tg unison.MultiErrGroup
 
 	tg.Go(func() error {
@@ -256,10 +258,14 @@ func (p *copyTruncateFileProspector) onFSEvent(
 		}
 
 		if event.Op == loginp.OpCreate {
+			newState := updater.FindCursorMeta(src, &fileMeta{}) != nil
 			err := updater.UpdateMetadata(src, fileMeta{Source: event.NewPath, IdentifierName: p.identifier.Name()})
 			if err != nil {
 				log.Errorf("Failed to set cursor meta data of entry %s: %v", src.Name(), err)
 			}
+			if newState {
+				p.seekStartPosition(log, event, src, updater)
+			}
 		}
 
 		// check if the event belongs to a rotated file
@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// errEncodingUndetected is returned if the encoding of a file cannot be
+// detected because the file is empty.
+var errEncodingUndetected = errors.New("no data to detect the encoding from")
+
+// fileEncoding returns the factory of the encoding the file at path is
+// read with. If the encoding is auto and it has not been detected yet, it is
+// detected from the beginning of the file and recorded in s. The Byte Order
+// Mark of a file read from the beginning is skipped.
+func (inp *filestream) fileEncoding(log *logp.Logger, path string, s *state) (encoding.EncodingFactory, error) {
+	if !inp.autoEncoding {
+		return inp.encodingFactory, nil
+	}
+
+	if s.Encoding == "" {
+		sample, err := inp.readEncodingSample(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(sample) == 0 {
+			return nil, errEncodingUndetected
+		}
+
+		name, bomLen := encoding.Detect(sample)
+		log.Debugf("Detected encoding %s. Path=%s", name, path)
+		s.Encoding = name
+		if s.Offset == 0 {
+			s.Offset = int64(bomLen)
+		}
+	}
+
+	encodingFactory, ok := encoding.FindEncoding(s.Encoding)
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding('%v') of %s", s.Encoding, path)
+	}
+	return encodingFactory, nil
+}
+
+// readEncodingSample reads the first bytes of the file at path. The sample
+// of compressed files is read from the decompressed content.
+func (inp *filestream) readEncodingSample(path string) ([]byte, error) {
+	f, err := file.ReadOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if inp.readerConfig.Compression == compressionAuto {
+		kind, err := detectCompression(f)
+		if err != nil {
+			return nil, err
+		}
+		if kind != uncompressed {
+			dec, err := newDecompressor(kind, f)
+			if errors.Is(err, errIncompleteCompressedFile) {
+				return nil, errEncodingUndetected
+			}
+			if err != nil {
+				return nil, err
+			}
+			defer dec.Close()
+			r = dec
+		}
+	}
+
+	sample := make([]byte, encoding.DetectSampleSize)
+	n, err := io.ReadFull(r, sample)
+	if err != nil && n == 0 && !errors.Is(err, io.EOF) && !errors.Is(err, errIncompleteCompressedFile) {
+		return nil, fmt.Errorf("failed to read the beginning of %s to detect the encoding: %w", path, err)
+	}
+	return sample[:n], nil
+}
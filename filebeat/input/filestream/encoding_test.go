@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	"github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/beats/v7/libbeat/reader/parser"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestFileEncodingAuto(t *testing.T) {
+	dir := t.TempDir()
+	utf16LE := []byte{0xff, 0xfe, 'l', 0, 'o', 0, 'g', 0, '\n', 0}
+	latin1 := []byte("caf\xe9\n")
+
+	cases := map[string]struct {
+		content          []byte
+		compression      string
+		state            state
+		expectedEncoding string
+		expectedOffset   int64
+		expectedErr      error
+	}{
+		"new file with BOM": {
+			content:          utf16LE,
+			expectedEncoding: "utf-16le",
+			expectedOffset:   2,
+		},
+		"new file without BOM": {
+			content:          latin1,
+			expectedEncoding: "iso8859-1",
+		},
+		"compressed file": {
+			content:          gzipBytes(t, string(utf16LE)),
+			compression:      compressionAuto,
+			expectedEncoding: "utf-16le",
+			expectedOffset:   2,
+		},
+		"encoding from the registry": {
+			content:          latin1,
+			state:            state{Offset: 2, Encoding: "utf-8"},
+			expectedEncoding: "utf-8",
+			expectedOffset:   2,
+		},
+		"file read from an offset keeps the offset": {
+			content:          utf16LE,
+			state:            state{Offset: 4},
+			expectedEncoding: "utf-16le",
+			expectedOffset:   4,
+		},
+		"empty file": {
+			expectedErr: errEncodingUndetected,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := writeTempFile(t, dir, name, tc.content)
+			inp := &filestream{
+				readerConfig: readerConfig{Compression: tc.compression},
+				autoEncoding: true,
+			}
+
+			s := tc.state
+			factory, err := inp.fileEncoding(logp.L(), f.Name(), &s)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+				require.Empty(t, s.Encoding)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, factory)
+			require.Equal(t, tc.expectedEncoding, s.Encoding)
+			require.Equal(t, tc.expectedOffset, s.Offset)
+		})
+	}
+}
+
+func TestOpenTruncatedFileDetectsEncodingAgain(t *testing.T) {
+	dir := t.TempDir()
+	f := writeTempFile(t, dir, "test.log", []byte{0xff, 0xfe, 'l', 0, 'o', 0, 'g', 0, '\n', 0})
+	inp := &filestream{
+		readerConfig: defaultReaderConfig(),
+		closerConfig: defaultCloserConfig(),
+		autoEncoding: true,
+	}
+
+	// the file was read in another encoding before it was truncated
+	s := state{Offset: 100, Encoding: "iso8859-1", Parsers: parser.State{CSVHeader: []string{"a", "b"}}}
+	fi, err := f.Stat()
+	require.NoError(t, err)
+	fs := fileSource{newPath: f.Name(), desc: loginp.FileDescriptor{Info: file.ExtendFileInfo(fi)}}
+	parserState := s.Parsers
+	r, err := inp.open(logp.L(), context.Background(), fs, &s, newParsersConfig(parser.Config{}), &parserState, nil)
+	require.NoError(t, err)
+	defer r.Close()
+
+	require.Equal(t, state{Offset: 2, Encoding: "utf-16le"}, s)
+	require.Empty(t, parserState)
+
+	msg, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "log", string(msg.Content))
+}
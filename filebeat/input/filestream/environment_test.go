@@ -61,7 +61,14 @@ type inputTestingEnvironment struct {
 
 type registryEntry struct {
 	Cursor struct {
-		Offset int `json:"offset"`
+		Offset  int `json:"offset"`
+		Parsers struct {
+			CSVHeader []string `json:"csv_header" struct:"csv_header"`
+		} `json:"parsers"`
+		Encoding string `json:"encoding"`
+		Checksum *struct {
+			Offset int `json:"offset"`
+		} `json:"checksum"`
 	} `json:"cursor"`
 	Meta interface{} `json:"meta,omitempty"`
 }
@@ -124,6 +131,12 @@ func (e *inputTestingEnvironment) getManager() v2.InputManager {
 	return e.plugin.Manager
 }
 
+// resetManager discards the input manager, so the next input is created
+// by a new manager that loads the states from the store, like after a restart.
+func (e *inputTestingEnvironment) resetManager() {
+	e.pluginInitOnce = sync.Once{}
+}
+
 func (e *inputTestingEnvironment) startInput(ctx context.Context, inp v2.Input) {
 	e.wg.Add(1)
 	go func(wg *sync.WaitGroup, grp *unison.TaskGroup) {
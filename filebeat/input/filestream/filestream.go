@@ -41,9 +41,12 @@ var (
 
 // logFile contains all log related data
 type logFile struct {
-	file      *os.File
-	log       *logp.Logger
-	readerCtx ctxtool.CancelContext
+	file *os.File
+	log  *logp.Logger
+	// decompressor reads the decompressed content of compressed files,
+	// it is nil for uncompressed files.
+	decompressor io.ReadCloser
+	readerCtx    ctxtool.CancelContext
 
 	closeAfterInterval time.Duration
 	closeOnEOF         bool
@@ -96,13 +99,40 @@ func newFileReader(
 	return l, nil
 }
 
+// newCompressedFileReader creates a new log instance to read the decompressed
+// content of a compressed file from dec, which has been positioned at offset.
+// Compressed files are read until the end of the compressed stream.
+func newCompressedFileReader(
+	log *logp.Logger,
+	canceler input.Canceler,
+	f *os.File,
+	dec io.ReadCloser,
+	offset int64,
+	config readerConfig,
+	closerConfig closerConfig,
+) (*logFile, error) {
+	l, err := newFileReader(log, canceler, f, config, closerConfig)
+	if err != nil {
+		return nil, err
+	}
+	l.decompressor = dec
+	l.offset = offset
+	return l, nil
+}
+
 // Read reads from the reader and updates the offset
 // The total number of bytes read is returned.
 func (f *logFile) Read(buf []byte) (int, error) {
 	totalN := 0
 
 	for f.readerCtx.Err() == nil {
-		n, err := f.file.Read(buf)
+		var n int
+		var err error
+		if f.decompressor != nil {
+			n, err = f.decompressor.Read(buf)
+		} else {
+			n, err = f.file.Read(buf)
+		}
 		if n > 0 {
 			f.offset += int64(n)
 			f.lastTimeRead = time.Now()
@@ -232,11 +262,20 @@ func isSameFile(path string, info os.FileInfo) bool {
 // errorChecks determines the cause for EOF errors, and how the EOF event should be handled
 // based on the config options.
 func (f *logFile) errorChecks(err error) error {
+	if errors.Is(err, errIncompleteCompressedFile) {
+		return err
+	}
 	if !errors.Is(err, io.EOF) {
 		f.log.Error("Unexpected state reading from %s; error: %s", f.file.Name(), err)
 		return err
 	}
 
+	// the end of a compressed stream is the end of the file, more data
+	// can't be decompressed by the same reader
+	if f.decompressor != nil {
+		return io.EOF
+	}
+
 	return f.handleEOF()
 }
 
@@ -266,6 +305,9 @@ func (f *logFile) handleEOF() error {
 // Close
 func (f *logFile) Close() error {
 	f.readerCtx.Cancel()
+	if f.decompressor != nil {
+		_ = f.decompressor.Close()
+	}
 	err := f.file.Close()
 	_ = f.tg.Stop() // Wait until all resources are released for sure.
 	return err
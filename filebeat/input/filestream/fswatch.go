@@ -19,6 +19,7 @@ package filestream
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/elastic/go-concert/timed"
 	"github.com/elastic/go-concert/unison"
 
@@ -37,6 +39,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/match"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 )
 
 const (
@@ -48,6 +51,15 @@ const (
 
 var (
 	errFileTooSmall = errors.New("file size is too small for ingestion")
+
+	// fingerprintHashers are the hash algorithms available for fingerprinting.
+	// An empty algorithm is the default, sha256.
+	fingerprintHashers = map[string]func() hash.Hash{
+		"":       sha256.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+		"xxhash": func() hash.Hash { return xxhash.New() },
+	}
 )
 
 type fileWatcherConfig struct {
@@ -58,6 +70,10 @@ type fileWatcherConfig struct {
 	ResendOnModTime bool `config:"resend_on_touch"`
 	// Scanner is the configuration of the scanner.
 	Scanner fileScannerConfig `config:",inline"`
+
+	// networkFS is set if the files are on a network file system, it's
+	// not configured in the scanner.
+	networkFS bool
 }
 
 // fileWatcher gets the list of files from a FSWatcher and creates events by
@@ -68,9 +84,17 @@ type fileWatcher struct {
 	scanner loginp.FSScanner
 	log     *logp.Logger
 	events  chan loginp.FSEvent
+
+	// collisions counts the files skipped by the scanner because of a
+	// fingerprint collision.
+	collisions *monitoring.Uint
 }
 
-func newFileWatcher(paths []string, ns *conf.Namespace) (loginp.FSWatcher, error) {
+// newFileWatcher creates the file watcher configured in ns. If decompress is
+// true, fingerprints of compressed files are computed from their
+// decompressed content. If networkFS is true, files are identified by
+// fingerprints which include their paths.
+func newFileWatcher(paths []string, ns *conf.Namespace, decompress, networkFS bool) (loginp.FSWatcher, error) {
 	var config *conf.C
 	if ns == nil {
 		config = conf.NewConfig()
@@ -78,25 +102,33 @@ func newFileWatcher(paths []string, ns *conf.Namespace) (loginp.FSWatcher, error
 		config = ns.Config()
 	}
 
-	return newScannerWatcher(paths, config)
+	return newScannerWatcher(paths, config, decompress, networkFS)
 }
 
-func newScannerWatcher(paths []string, c *conf.C) (loginp.FSWatcher, error) {
+func newScannerWatcher(paths []string, c *conf.C, decompress, networkFS bool) (loginp.FSWatcher, error) {
 	config := defaultFileWatcherConfig()
 	err := c.Unpack(&config)
 	if err != nil {
 		return nil, err
 	}
+	config.Scanner.decompress = decompress
+	if networkFS {
+		// inode and device IDs are not stable on network file systems
+		config.Scanner.Fingerprint.Enabled = true
+		config.Scanner.Fingerprint.IncludePath = true
+		config.networkFS = true
+	}
 	scanner, err := newFileScanner(paths, config.Scanner)
 	if err != nil {
 		return nil, err
 	}
 	return &fileWatcher{
-		log:     logp.NewLogger(watcherDebugKey),
-		cfg:     config,
-		prev:    make(map[string]loginp.FileDescriptor, 0),
-		scanner: scanner,
-		events:  make(chan loginp.FSEvent),
+		log:        logp.NewLogger(watcherDebugKey),
+		cfg:        config,
+		prev:       make(map[string]loginp.FileDescriptor, 0),
+		scanner:    scanner,
+		events:     make(chan loginp.FSEvent),
+		collisions: scanner.collisions,
 	}, nil
 }
 
@@ -160,6 +192,11 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 			if w.cfg.ResendOnModTime {
 				e = truncateEvent(path, fd)
 				truncatedCount++
+			} else if w.cfg.networkFS {
+				// the file may have been rewritten, the harvester
+				// validates its offset when it is started
+				e = writeEvent(path, fd)
+				writtenCount++
 			}
 
 		// the new size is larger, something was written
@@ -263,6 +300,42 @@ type fingerprintConfig struct {
 	Enabled bool  `config:"enabled"`
 	Offset  int64 `config:"offset"`
 	Length  int64 `config:"length"`
+	// Algorithm is the hash algorithm used to compute fingerprints.
+	Algorithm string `config:"algorithm"`
+	// Samples are the offsets of additional byte ranges of Length bytes
+	// hashed into the fingerprint, in ascending order.
+	Samples []int64 `config:"samples"`
+	// IncludePath adds the path of the file to its fingerprint.
+	IncludePath bool `config:"include_path"`
+}
+
+// offsets returns the offsets of all byte ranges hashed into the
+// fingerprint in ascending order.
+func (c fingerprintConfig) offsets() []int64 {
+	return append([]int64{c.Offset}, c.Samples...)
+}
+
+// minSize returns the minimum size of a file that can be fingerprinted.
+func (c fingerprintConfig) minSize() int64 {
+	offsets := c.offsets()
+	return offsets[len(offsets)-1] + c.Length
+}
+
+func (c fingerprintConfig) validate() error {
+	if c.Length < sha256.BlockSize {
+		return fmt.Errorf("fingerprint size %d bytes cannot be smaller than %d bytes", c.Length, sha256.BlockSize)
+	}
+	if _, ok := fingerprintHashers[c.Algorithm]; !ok {
+		return fmt.Errorf("unknown fingerprint algorithm %q", c.Algorithm)
+	}
+	end := c.Offset + c.Length
+	for _, sample := range c.Samples {
+		if sample < end {
+			return fmt.Errorf("fingerprint sample at offset %d overlaps the previous byte range ending at %d", sample, end)
+		}
+		end = sample + c.Length
+	}
+	return nil
 }
 
 type fileScannerConfig struct {
@@ -271,6 +344,10 @@ type fileScannerConfig struct {
 	Symlinks      bool              `config:"symlinks"`
 	RecursiveGlob bool              `config:"recursive_glob"`
 	Fingerprint   fingerprintConfig `config:"fingerprint"`
+
+	// decompress is set if the input reads compressed files, it's not
+	// part of the prospector configuration.
+	decompress bool
 }
 
 func defaultFileScannerConfig() fileScannerConfig {
@@ -278,9 +355,10 @@ func defaultFileScannerConfig() fileScannerConfig {
 		Symlinks:      false,
 		RecursiveGlob: true,
 		Fingerprint: fingerprintConfig{
-			Enabled: false,
-			Offset:  0,
-			Length:  DefaultFingerprintSize,
+			Enabled:   false,
+			Offset:    0,
+			Length:    DefaultFingerprintSize,
+			Algorithm: "sha256",
 		},
 	}
 }
@@ -293,22 +371,49 @@ type fileScanner struct {
 	log        *logp.Logger
 	hasher     hash.Hash
 	readBuffer []byte
+
+	// collisions counts the files skipped because they have the same
+	// fingerprint as a different file.
+	collisions *monitoring.Uint
+	// colliding are the files skipped in the last scan because of a
+	// fingerprint collision, each collision is reported only once.
+	colliding map[string]struct{}
+	// scanned are the files returned by the last scan. They are kept when
+	// they collide with a new file, so that the new file doesn't take over
+	// their state.
+	scanned map[string]struct{}
+	// sizes are the files last seen with each fingerprint and their size.
+	// A smaller file with the same fingerprint at another path is not the
+	// same file, as only files found at the same path can be truncated.
+	sizes map[string]fingerprintedFile
+}
+
+// fingerprintedFile is the path and size a fingerprint was last seen with.
+type fingerprintedFile struct {
+	filename string
+	size     int64
 }
 
 func newFileScanner(paths []string, config fileScannerConfig) (*fileScanner, error) {
 	s := fileScanner{
-		paths:  paths,
-		cfg:    config,
-		log:    logp.NewLogger(scannerDebugKey),
-		hasher: sha256.New(),
+		paths:      paths,
+		cfg:        config,
+		log:        logp.NewLogger(scannerDebugKey),
+		hasher:     sha256.New(),
+		collisions: &monitoring.Uint{},
+		colliding:  map[string]struct{}{},
+		scanned:    map[string]struct{}{},
+		sizes:      map[string]fingerprintedFile{},
 	}
 
 	if s.cfg.Fingerprint.Enabled {
-		if s.cfg.Fingerprint.Length < sha256.BlockSize {
-			err := fmt.Errorf("fingerprint size %d bytes cannot be smaller than %d bytes", config.Fingerprint.Length, sha256.BlockSize)
+		err := s.cfg.Fingerprint.validate()
+		if err != nil {
 			return nil, fmt.Errorf("error while reading configuration of fingerprint: %w", err)
 		}
-		s.log.Debugf("fingerprint mode enabled: offset %d, length %d", s.cfg.Fingerprint.Offset, s.cfg.Fingerprint.Length)
+		s.log.Debugf("fingerprint mode enabled: algorithm %s, offset %d, length %d, samples %v, include path %t",
+			s.cfg.Fingerprint.Algorithm, s.cfg.Fingerprint.Offset, s.cfg.Fingerprint.Length, s.cfg.Fingerprint.Samples, s.cfg.Fingerprint.IncludePath)
+		s.hasher = fingerprintHashers[s.cfg.Fingerprint.Algorithm]()
 		s.readBuffer = make([]byte, s.cfg.Fingerprint.Length)
 	}
 
@@ -369,6 +474,10 @@ func (s *fileScanner) GetFiles() map[string]loginp.FileDescriptor {
 	uniqueIDs := map[string]string{}
 	// used to filter out duplicate matches
 	uniqueFiles := map[string]struct{}{}
+	// used to report each fingerprint collision only once
+	colliding := map[string]struct{}{}
+	// the fingerprints of the files found by this scan
+	sizes := map[string]fingerprintedFile{}
 	for _, path := range s.paths {
 		matches, err := filepath.Glob(path)
 		if err != nil {
@@ -400,7 +509,38 @@ func (s *fileScanner) GetFiles() map[string]loginp.FileDescriptor {
 			}
 
 			fileID := fd.FileID()
+			if last, ok := s.sizes[fileID]; ok && fd.Fingerprint != "" && last.filename != filename && fd.Info.Size() < last.size {
+				// The fingerprint is kept with the size of the known
+				// file, until the new file grows past it.
+				if _, found := sizes[fileID]; !found {
+					sizes[fileID] = last
+				}
+				colliding[filename] = struct{}{}
+				if _, reported := s.colliding[filename]; !reported {
+					s.collisions.Inc()
+					s.log.Warnf("%q has the same fingerprint as %q [%s] but it is smaller (%d < %d bytes), so it is a different file. Skipping, the fingerprint configuration must be changed to ingest it", filename, last.filename, fileID, fd.Info.Size(), last.size)
+				}
+				continue
+			}
 			if knownFilename, exists := uniqueIDs[fileID]; exists {
+				known := fdByName[knownFilename]
+				if fd.Fingerprint != "" && !fd.Info.GetOSState().IsSame(known.Info.GetOSState()) {
+					// The first file matched wins, unless only the new
+					// one was returned by the previous scan.
+					skipped, kept := filename, knownFilename
+					if s.wasScanned(filename) && !s.wasScanned(knownFilename) {
+						skipped, kept = knownFilename, filename
+						delete(fdByName, knownFilename)
+						uniqueIDs[fileID] = fd.Filename
+						fdByName[filename] = fd
+					}
+					colliding[skipped] = struct{}{}
+					if _, reported := s.colliding[skipped]; !reported {
+						s.collisions.Inc()
+						s.log.Warnf("%q has the same fingerprint as %q [%s] but it is a different file. Skipping, the fingerprint configuration must be changed to ingest it", skipped, kept, fileID)
+					}
+					continue
+				}
 				s.log.Warnf("%q points to an already known ingest target %q [%s==%s]. Skipping", fd.Filename, knownFilename, fileID, fileID)
 				continue
 			}
@@ -408,10 +548,25 @@ func (s *fileScanner) GetFiles() map[string]loginp.FileDescriptor {
 			fdByName[filename] = fd
 		}
 	}
+	s.colliding = colliding
+
+	s.scanned = make(map[string]struct{}, len(fdByName))
+	for filename, fd := range fdByName {
+		s.scanned[filename] = struct{}{}
+		if fd.Fingerprint != "" {
+			sizes[fd.FileID()] = fingerprintedFile{filename: filename, size: fd.Info.Size()}
+		}
+	}
+	s.sizes = sizes
 
 	return fdByName
 }
 
+func (s *fileScanner) wasScanned(filename string) bool {
+	_, ok := s.scanned[filename]
+	return ok
+}
+
 type ingestTarget struct {
 	filename         string
 	originalFilename string
@@ -479,9 +634,10 @@ func (s *fileScanner) toFileDescriptor(it *ingestTarget) (fd loginp.FileDescript
 
 	if s.cfg.Fingerprint.Enabled {
 		fileSize := it.info.Size()
-		// we should not open the file if we know it's too small
-		minSize := s.cfg.Fingerprint.Offset + s.cfg.Fingerprint.Length
-		if fileSize < minSize {
+		// we should not open the file if we know it's too small,
+		// unless it may be compressed
+		minSize := s.cfg.Fingerprint.minSize()
+		if fileSize < minSize && !s.cfg.decompress {
 			return fd, fmt.Errorf("filesize of %q is %d bytes, expected at least %d bytes for fingerprinting: %w", fd.Filename, fileSize, minSize, errFileTooSmall)
 		}
 
@@ -491,21 +647,68 @@ func (s *fileScanner) toFileDescriptor(it *ingestTarget) (fd loginp.FileDescript
 		}
 		defer file.Close()
 
-		if s.cfg.Fingerprint.Offset != 0 {
-			_, err = file.Seek(s.cfg.Fingerprint.Offset, io.SeekStart)
+		kind := uncompressed
+		if s.cfg.decompress {
+			kind, err = detectCompression(file)
+			if err != nil {
+				return fd, err
+			}
+			if kind == uncompressed && fileSize < minSize {
+				return fd, fmt.Errorf("filesize of %q is %d bytes, expected at least %d bytes for fingerprinting: %w", fd.Filename, fileSize, minSize, errFileTooSmall)
+			}
+		}
+
+		var r io.Reader = file
+		if kind != uncompressed {
+			// The fingerprint of a compressed file is the fingerprint of its
+			// content, so that it has the same identity as the file it was
+			// compressed from.
+			dec, err := newDecompressor(kind, file)
 			if err != nil {
-				return fd, fmt.Errorf("failed to seek %q for fingerprinting: %w", fd.Filename, err)
+				return fd, fmt.Errorf("failed to decompress %q for fingerprinting: %w", fd.Filename, err)
 			}
+			defer dec.Close()
+			r = dec
 		}
 
 		s.hasher.Reset()
-		lr := io.LimitReader(file, s.cfg.Fingerprint.Length)
-		written, err := io.CopyBuffer(s.hasher, lr, s.readBuffer)
-		if err != nil {
-			return fd, fmt.Errorf("failed to compute hash for first %d bytes of %q: %w", s.cfg.Fingerprint.Length, fd.Filename, err)
+		var pos int64
+		for _, offset := range s.cfg.Fingerprint.offsets() {
+			if kind == uncompressed {
+				_, err = file.Seek(offset, io.SeekStart)
+				if err != nil {
+					return fd, fmt.Errorf("failed to seek %q for fingerprinting: %w", fd.Filename, err)
+				}
+			} else if offset > pos {
+				skipped, err := io.CopyN(io.Discard, r, offset-pos)
+				if skipped != offset-pos {
+					return fd, fmt.Errorf("decompressed content of %q is too small for fingerprinting: %w", fd.Filename, errFileTooSmall)
+				}
+				if err != nil {
+					return fd, fmt.Errorf("failed to skip %d bytes of %q for fingerprinting: %w", offset-pos, fd.Filename, err)
+				}
+			}
+
+			lr := io.LimitReader(r, s.cfg.Fingerprint.Length)
+			written, err := io.CopyBuffer(s.hasher, lr, s.readBuffer)
+			if kind != uncompressed && written < s.cfg.Fingerprint.Length {
+				// the decompressed content is too short, or the file is still
+				// being written and will be fingerprinted again in the next scan
+				return fd, fmt.Errorf("decompressed content of %q is too small for fingerprinting: %w", fd.Filename, errFileTooSmall)
+			}
+			if err != nil {
+				return fd, fmt.Errorf("failed to compute hash for %d bytes at offset %d of %q: %w", s.cfg.Fingerprint.Length, offset, fd.Filename, err)
+			}
+			if written != s.cfg.Fingerprint.Length {
+				return fd, fmt.Errorf("failed to read %d bytes at offset %d from %q to compute fingerprint, read only %d", s.cfg.Fingerprint.Length, offset, fd.Filename, written)
+			}
+			pos = offset + written
 		}
-		if written != s.cfg.Fingerprint.Length {
-			return fd, fmt.Errorf("failed to read %d bytes from %q to compute fingerprint, read only %d", written, fd.Filename, s.cfg.Fingerprint.Length)
+
+		if s.cfg.Fingerprint.IncludePath {
+			// files with the same content in different locations have
+			// different identities, renaming a file changes its identity
+			_, _ = io.WriteString(s.hasher, fd.Filename)
 		}
 
 		fd.Fingerprint = hex.EncodeToString(s.hasher.Sum(nil))
@@ -255,6 +255,45 @@ scanner:
 		require.Equal(t, loginp.OpDone, e.Op)
 	})
 
+	t.Run("emits write on touch and fingerprints paths on network file systems", func(t *testing.T) {
+		dir := t.TempDir()
+		paths := []string{filepath.Join(dir, "*.log")}
+		cfgStr := `
+scanner:
+  check_interval: 10ms
+`
+		cfg, err := conf.NewConfigWithYAML([]byte(cfgStr), cfgStr)
+		require.NoError(t, err)
+		ns := &conf.Namespace{}
+		require.NoError(t, ns.Unpack(cfg))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+		defer cancel()
+
+		fw, err := newFileWatcher(paths, ns, false, true)
+		require.NoError(t, err)
+		go fw.Run(ctx)
+
+		basename := "created.log"
+		filename := filepath.Join(dir, basename)
+		err = os.WriteFile(filename, []byte(strings.Repeat("a", 1024)), 0777)
+		require.NoError(t, err)
+
+		e := fw.Event()
+		require.Equal(t, loginp.OpCreate, e.Op)
+		require.NotEmpty(t, e.Descriptor.Fingerprint)
+		// the fingerprint of the same content without the path
+		require.NotEqual(t, "2edc986847e209b4016e141a6dc8716d3207350f416969382d431539bf292e4a", e.Descriptor.Fingerprint)
+
+		time := time.Now().Local().Add(time.Hour)
+		err = os.Chtimes(filename, time, time)
+		require.NoError(t, err)
+
+		e = fw.Event()
+		require.Equal(t, loginp.OpWrite, e.Op)
+		require.Equal(t, filename, e.NewPath)
+	})
+
 	t.Run("does not emit events for empty files", func(t *testing.T) {
 		dir := t.TempDir()
 		paths := []string{filepath.Join(dir, "*.log")}
@@ -341,8 +380,9 @@ scanner:
 		}
 		requireEqualEvents(t, expEvent, e)
 
-		// collisions are resolved in the alphabetical order, the first filename wins
-		basename = "created_collision.log"
+		// the file that is already known wins, even if the new file
+		// comes first in the alphabetical order
+		basename = "a_collision.log"
 		filename = filepath.Join(dir, basename)
 		err = os.WriteFile(filename, []byte(strings.Repeat("a", 1024)), 0777)
 		require.NoError(t, err)
@@ -834,10 +874,131 @@ scanner:
 		err = ns.Unpack(cfg)
 		require.NoError(t, err)
 
-		_, err = newFileWatcher(paths, ns)
+		_, err = newFileWatcher(paths, ns, false, false)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "fingerprint size 1 bytes cannot be smaller than 64 bytes")
 	})
+
+	t.Run("returns error when creating scanner with an invalid fingerprint configuration", func(t *testing.T) {
+		cases := map[string]string{
+			"fingerprint.algorithm: md5":        `unknown fingerprint algorithm "md5"`,
+			"fingerprint.samples: [512]":        "fingerprint sample at offset 512 overlaps the previous byte range ending at 1024",
+			"fingerprint.samples: [2048, 2100]": "fingerprint sample at offset 2100 overlaps the previous byte range ending at 3072",
+		}
+		for option, expErr := range cases {
+			cfgStr := "scanner:\n  fingerprint.enabled: true\n  " + option
+			cfg, err := conf.NewConfigWithYAML([]byte(cfgStr), cfgStr)
+			require.NoError(t, err)
+
+			ns := &conf.Namespace{}
+			err = ns.Unpack(cfg)
+			require.NoError(t, err)
+
+			_, err = newFileWatcher(paths, ns, false, false)
+			require.ErrorContains(t, err, expErr, option)
+		}
+	})
+}
+
+func TestFileScannerFingerprintIdentity(t *testing.T) {
+	dir := t.TempDir()
+	header := strings.Repeat("a", 1024)
+	firstFilename := filepath.Join(dir, "export-1.csv")
+	secondFilename := filepath.Join(dir, "export-2.csv")
+	growingFilename := filepath.Join(dir, "growing.csv")
+	require.NoError(t, os.WriteFile(firstFilename, []byte(header+strings.Repeat("1", 2048)), 0777))
+	require.NoError(t, os.WriteFile(secondFilename, []byte(header+strings.Repeat("2", 2048)), 0777))
+	require.NoError(t, os.WriteFile(growingFilename, []byte(header+strings.Repeat("3", 512)), 0777))
+	paths := []string{filepath.Join(dir, "*.csv")}
+
+	t.Run("supports different hash algorithms", func(t *testing.T) {
+		for algorithm, size := range map[string]int{"sha256": 64, "sha512": 128, "xxhash": 16} {
+			s := createScannerWithConfig(t, []string{firstFilename}, "scanner.fingerprint:\n  enabled: true\n  algorithm: "+algorithm)
+			files := s.GetFiles()
+			require.Len(t, files, 1, algorithm)
+			require.Len(t, files[firstFilename].Fingerprint, size, algorithm)
+		}
+	})
+
+	t.Run("reports a collision once and skips the colliding file", func(t *testing.T) {
+		logp.DevelopmentSetup(logp.ToObserverOutput())
+
+		fw := createWatcherWithConfig(t, paths, "scanner.fingerprint.enabled: true")
+		w, ok := fw.(*fileWatcher)
+		require.True(t, ok)
+
+		// the growing file collides as well
+		for i := 0; i < 2; i++ {
+			files := w.GetFiles()
+			require.Len(t, files, 1)
+			require.Contains(t, files, firstFilename)
+		}
+		require.EqualValues(t, 2, w.collisions.Get())
+
+		logs := logp.ObserverLogs().FilterMessageSnippet("has the same fingerprint as").TakeAll()
+		require.Len(t, logs, 2)
+		require.Equal(t, logp.WarnLevel.ZapLevel(), logs[0].Level)
+	})
+
+	t.Run("keeps the known file when a new file collides with it", func(t *testing.T) {
+		s, ok := createScannerWithConfig(t, []string{secondFilename}, "scanner.fingerprint.enabled: true").(*fileScanner)
+		require.True(t, ok)
+		files := s.GetFiles()
+		require.Len(t, files, 1)
+		require.Contains(t, files, secondFilename)
+
+		// export-1.csv comes first in the glob order
+		s.paths = paths
+		for i := 0; i < 2; i++ {
+			files = s.GetFiles()
+			require.Len(t, files, 1)
+			require.Contains(t, files, secondFilename)
+		}
+	})
+
+	t.Run("a smaller file at another path is not the known file", func(t *testing.T) {
+		dir := t.TempDir()
+		oldFilename := filepath.Join(dir, "old.csv")
+		newFilename := filepath.Join(dir, "new.csv")
+		require.NoError(t, os.WriteFile(oldFilename, []byte(header+strings.Repeat("1", 2048)), 0777))
+
+		s, ok := createScannerWithConfig(t, []string{filepath.Join(dir, "*.csv")}, "scanner.fingerprint.enabled: true").(*fileScanner)
+		require.True(t, ok)
+		files := s.GetFiles()
+		require.Contains(t, files, oldFilename)
+
+		// the known file is replaced by a smaller file with the same
+		// fingerprint
+		require.NoError(t, os.Remove(oldFilename))
+		require.NoError(t, os.WriteFile(newFilename, []byte(header+strings.Repeat("2", 512)), 0777))
+		for i := 0; i < 2; i++ {
+			files = s.GetFiles()
+			require.Empty(t, files)
+		}
+		require.EqualValues(t, 1, s.collisions.Get())
+
+		// once it has grown past the known file, it is ingested
+		require.NoError(t, os.WriteFile(newFilename, []byte(header+strings.Repeat("2", 4096)), 0777))
+		files = s.GetFiles()
+		require.Contains(t, files, newFilename)
+		require.EqualValues(t, 1, s.collisions.Get())
+	})
+
+	t.Run("samples tell apart files with the same header", func(t *testing.T) {
+		s := createScannerWithConfig(t, paths, "scanner.fingerprint:\n  enabled: true\n  samples: [2048]")
+		files := s.GetFiles()
+		// the growing file is not fingerprinted until it contains all samples
+		require.Len(t, files, 2)
+		require.NotEqual(t, files[firstFilename].Fingerprint, files[secondFilename].Fingerprint)
+		require.NotContains(t, files, growingFilename)
+	})
+
+	t.Run("the path tells apart files with the same content", func(t *testing.T) {
+		s := createScannerWithConfig(t, paths, "scanner.fingerprint:\n  enabled: true\n  include_path: true")
+		files := s.GetFiles()
+		require.Len(t, files, 3)
+		require.NotEqual(t, files[firstFilename].Fingerprint, files[secondFilename].Fingerprint)
+	})
 }
 
 const benchmarkFileCount = 1000
@@ -880,9 +1041,10 @@ func BenchmarkGetFilesWithFingerprint(b *testing.B) {
 	paths := []string{filepath.Join(dir, "*.log")}
 	cfg := fileScannerConfig{
 		Fingerprint: fingerprintConfig{
-			Enabled: true,
-			Offset:  0,
-			Length:  1024,
+			Enabled:   true,
+			Offset:    0,
+			Length:    1024,
+			Algorithm: "sha256",
 		},
 	}
 	s, err := newFileScanner(paths, cfg)
@@ -902,7 +1064,7 @@ func createWatcherWithConfig(t *testing.T, paths []string, cfgStr string) loginp
 	err = ns.Unpack(cfg)
 	require.NoError(t, err)
 
-	fw, err := newFileWatcher(paths, ns)
+	fw, err := newFileWatcher(paths, ns, false, false)
 	require.NoError(t, err)
 
 	return fw
@@ -969,9 +1131,10 @@ func BenchmarkToFileDescriptor(b *testing.B) {
 	paths := []string{filename}
 	cfg := fileScannerConfig{
 		Fingerprint: fingerprintConfig{
-			Enabled: true,
-			Offset:  0,
-			Length:  1024,
+			Enabled:   true,
+			Offset:    0,
+			Length:    1024,
+			Algorithm: "sha256",
 		},
 	}
 	s, err := newFileScanner(paths, cfg)
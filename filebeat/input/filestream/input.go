@@ -22,6 +22,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/text/transform"
@@ -45,8 +48,24 @@ import (
 
 const pluginName = "filestream"
 
+// errParsersUpdated is returned by readFromSource if the parsers have been
+// updated and the file has to be read with the new parsers.
+var errParsersUpdated = errors.New("parsers have been updated")
+
 type state struct {
-	Offset int64 `json:"offset" struct:"offset"`
+	Offset  int64        `json:"offset" struct:"offset"`
+	Parsers parser.State `json:"parsers,omitempty" struct:"parsers,omitempty"`
+	// Encoding is the detected encoding of the file if the encoding
+	// is auto, so that the file is decoded the same way when it is resumed.
+	Encoding string `json:"encoding,omitempty" struct:"encoding,omitempty"`
+	// Checksum validates the offset when the file is resumed if
+	// network_fs is enabled.
+	Checksum *resumeChecksum `json:"checksum,omitempty" struct:"checksum,omitempty"`
+}
+
+// reset resets s to read the file from the beginning.
+func (s *state) reset() {
+	*s = state{}
 }
 
 type fileMeta struct {
@@ -59,8 +78,16 @@ type fileMeta struct {
 type filestream struct {
 	readerConfig    readerConfig
 	encodingFactory encoding.EncodingFactory
+	autoEncoding    bool
 	closerConfig    closerConfig
-	parsers         parser.Config
+	networkFS       networkFSConfig
+
+	// parsers are replaced when the input is updated, the harvesters
+	// open their files again with the new parsers.
+	parsers atomic.Pointer[parsersConfig]
+	// config is the configuration the input has been created or last
+	// updated with.
+	config *conf.C
 }
 
 // Plugin creates a new filestream input plugin for creating a stateful input.
@@ -91,21 +118,72 @@ func configure(cfg *conf.C) (loginp.Prospector, loginp.Harvester, error) {
 		return nil, nil, fmt.Errorf("cannot create prospector: %w", err)
 	}
 
+	autoEncoding := strings.EqualFold(config.Reader.Encoding, encoding.Auto)
 	encodingFactory, ok := encoding.FindEncoding(config.Reader.Encoding)
-	if !ok || encodingFactory == nil {
+	if !autoEncoding && (!ok || encodingFactory == nil) {
 		return nil, nil, fmt.Errorf("unknown encoding('%v')", config.Reader.Encoding)
 	}
 
 	filestream := &filestream{
 		readerConfig:    config.Reader,
 		encodingFactory: encodingFactory,
+		autoEncoding:    autoEncoding,
 		closerConfig:    config.Close,
-		parsers:         config.Reader.Parsers,
+		networkFS:       config.NetworkFS,
+		config:          cfg,
 	}
+	filestream.parsers.Store(newParsersConfig(config.Reader.Parsers))
 
 	return prospector, filestream, nil
 }
 
+// parsersConfig is the parsers configuration the harvesters read with.
+type parsersConfig struct {
+	parser.Config
+	// replaced is closed when the configuration is replaced by Update.
+	replaced chan struct{}
+}
+
+func newParsersConfig(config parser.Config) *parsersConfig {
+	return &parsersConfig{Config: config, replaced: make(chan struct{})}
+}
+
+// Update replaces the parsers of the input if cfg differs from the current
+// configuration only in the parsers and processors. The processors are
+// replaced by the publishing pipeline.
+func (inp *filestream) Update(cfg *conf.C) (bool, error) {
+	equal, err := equalConfigsExcept(inp.config, cfg, "parsers", "processors")
+	if err != nil || !equal {
+		return false, err
+	}
+
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return false, err
+	}
+
+	inp.config = cfg
+	close(inp.parsers.Swap(newParsersConfig(config.Reader.Parsers)).replaced)
+	return true, nil
+}
+
+// equalConfigsExcept returns true if a and b are equal, not considering the
+// settings in keys.
+func equalConfigsExcept(a, b *conf.C, keys ...string) (bool, error) {
+	var settingsA, settingsB map[string]interface{}
+	if err := a.Unpack(&settingsA); err != nil {
+		return false, err
+	}
+	if err := b.Unpack(&settingsB); err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		delete(settingsA, key)
+		delete(settingsB, key)
+	}
+	return reflect.DeepEqual(settingsA, settingsB), nil
+}
+
 func (inp *filestream) Name() string { return pluginName }
 
 func (inp *filestream) Test(src loginp.Source, ctx input.TestContext) error {
@@ -114,7 +192,7 @@ func (inp *filestream) Test(src loginp.Source, ctx input.TestContext) error {
 		return fmt.Errorf("not file source")
 	}
 
-	reader, _, err := inp.open(ctx.Logger, ctx.Cancelation, fs, 0)
+	reader, err := inp.open(ctx.Logger, ctx.Cancelation, fs, &state{}, inp.parsers.Load(), &parser.State{}, nil)
 	if err != nil {
 		return err
 	}
@@ -136,14 +214,44 @@ func (inp *filestream) Run(
 	log := ctx.Logger.With("path", fs.newPath).With("state-id", src.Name())
 	state := initState(log, cursor, fs)
 
-	r, truncated, err := inp.open(log, ctx.Cancelation, fs, state.Offset)
+	var checksums *checksummer
+	if inp.networkFS.Enabled {
+		var err error
+		checksums, err = newChecksummer(log, fs.newPath, int64(inp.networkFS.ChecksumLength), inp.readerConfig.Compression == compressionAuto)
+		if err != nil {
+			log.Errorf("File could not be opened for reading: %v", err)
+			return err
+		}
+		if checksums != nil {
+			defer checksums.Close()
+			if !checksums.verify(state.Checksum) {
+				log.Warnf("The content of the file before offset %d has changed, reading file from the beginning", state.Offset)
+				state.reset()
+			}
+		}
+	}
+
+	// the parsers update the state directly, it is copied into
+	// every published cursor update
+	parserState := state.Parsers
+	parsers := inp.parsers.Load()
+	r, err := inp.open(log, ctx.Cancelation, fs, &state, parsers, &parserState, checksums)
+	if errors.Is(err, errIncompleteCompressedFile) {
+		log.Debugf("Compressed file is shorter than the offset %d, it is read when it is updated: %v", state.Offset, err)
+		return nil
+	}
+	if errors.Is(err, errEncodingUndetected) {
+		log.Debugf("The encoding of the file is detected when it is updated: %v", err)
+		return nil
+	}
 	if err != nil {
 		log.Errorf("File could not be opened for reading: %v", err)
 		return err
 	}
 
-	if truncated {
-		state.Offset = 0
+	if state.Offset == 0 {
+		// the parsers read their state from the beginning of the file again
+		parserState = parser.State{}
 	}
 
 	metrics.FilesActive.Inc()
@@ -151,7 +259,42 @@ func (inp *filestream) Run(
 	defer metrics.FilesActive.Dec()
 	defer metrics.HarvesterRunning.Dec()
 
-	_, streamCancel := ctxtool.WithFunc(ctx.Cancelation, func() {
+	for {
+		err = inp.readWithParsers(ctx, log, r, fs.newPath, &state, parsers, &parserState, checksums, publisher, metrics)
+		if !errors.Is(err, errParsersUpdated) {
+			return err
+		}
+
+		// The file is opened again at the offset of the last line read,
+		// the lines read ahead by the previous parsers are read again.
+		parsers = inp.parsers.Load()
+		log.Infof("Parsers have been updated, reading file from offset %d with the new parsers", state.Offset)
+		r, err = inp.open(log, ctx.Cancelation, fs, &state, parsers, &parserState, checksums)
+		if err != nil {
+			log.Errorf("File could not be opened for reading with the updated parsers: %v", err)
+			return err
+		}
+	}
+}
+
+// readWithParsers reads from r until the parsers are updated or the input is
+// stopped. r is closed when the parsers are updated, so that harvesters
+// waiting for new lines switch to the new parsers.
+func (inp *filestream) readWithParsers(
+	ctx input.Context,
+	log *logp.Logger,
+	r reader.Reader,
+	path string,
+	s *state,
+	parsers *parsersConfig,
+	parserState *parser.State,
+	checksums *checksummer,
+	publisher loginp.Publisher,
+	metrics *loginp.Metrics,
+) error {
+	readCtx, readCancel := ctxtool.WithChannel(ctx.Cancelation, parsers.replaced)
+	defer readCancel()
+	_, streamCancel := ctxtool.WithFunc(readCtx, func() {
 		log.Debug("Closing reader of filestream")
 		err := r.Close()
 		if err != nil {
@@ -160,7 +303,12 @@ func (inp *filestream) Run(
 	})
 	defer streamCancel()
 
-	return inp.readFromSource(ctx, log, r, fs.newPath, state, publisher, metrics)
+	err := inp.readFromSource(ctx, log, r, path, s, parsers, parserState, checksums, publisher, metrics)
+	if err == nil && ctx.Cancelation.Err() == nil && inp.parsers.Load() != parsers {
+		// the reader has been closed because the parsers were replaced
+		return errParsersUpdated
+	}
+	return err
 }
 
 func initState(log *logp.Logger, c loginp.Cursor, s fileSource) state {
@@ -177,24 +325,46 @@ func initState(log *logp.Logger, c loginp.Cursor, s fileSource) state {
 	return state
 }
 
+// open opens the file at the offset in s. If the encoding is detected
+// automatically, the detected encoding is recorded in s.
 func (inp *filestream) open(
 	log *logp.Logger,
 	canceler input.Canceler,
 	fs fileSource,
-	offset int64,
-) (reader.Reader, bool, error) {
+	s *state,
+	parsers *parsersConfig,
+	parserState *parser.State,
+	checksums *checksummer,
+) (reader.Reader, error) {
+	encodingFactory, err := inp.fileEncoding(log, fs.newPath, s)
+	if err != nil {
+		return nil, err
+	}
 
-	f, encoding, truncated, err := inp.openFile(log, fs.newPath, offset)
+	offset := s.Offset
+	f, dec, encoding, truncated, err := inp.openFile(log, fs.newPath, offset, encodingFactory)
 	if err != nil {
-		return nil, truncated, err
+		return nil, err
 	}
 
 	if truncated {
-		offset = 0
+		// The file is read from the beginning with a new state, the
+		// encoding is detected again as the file may have been rewritten
+		// in another one.
+		f.Close()
+		if dec != nil {
+			dec.Close()
+		}
+		s.reset()
+		*parserState = parser.State{}
+		return inp.open(log, canceler, fs, s, parsers, parserState, checksums)
 	}
 
 	ok := false // used for cleanup
 	defer cleanup.IfNot(&ok, cleanup.IgnoreError(f.Close))
+	if dec != nil {
+		defer cleanup.IfNot(&ok, cleanup.IgnoreError(dec.Close))
+	}
 
 	log.Debug("newLogFileReader with config.MaxBytes:", inp.readerConfig.MaxBytes)
 
@@ -213,14 +383,26 @@ func (inp *filestream) open(
 	// NewLineReader uses additional buffering to deal with encoding and testing
 	// for new lines in input stream. Simple 8-bit based encodings, or plain
 	// don't require 'complicated' logic.
-	logReader, err := newFileReader(log, canceler, f, inp.readerConfig, closerCfg)
+	var logReader *logFile
+	if dec != nil {
+		logReader, err = newCompressedFileReader(log, canceler, f, dec, offset, inp.readerConfig, closerCfg)
+	} else {
+		logReader, err = newFileReader(log, canceler, f, inp.readerConfig, closerCfg)
+	}
 	if err != nil {
-		return nil, truncated, err
+		return nil, err
 	}
 
-	dbgReader, err := debug.AppendReaders(logReader)
+	// The checksums of network file systems are computed from the bytes
+	// read by the harvester.
+	var src io.ReadCloser = logReader
+	if checksums != nil {
+		src = checksums.newReader(logReader, offset)
+	}
+
+	dbgReader, err := debug.AppendReaders(src)
 	if err != nil {
-		return nil, truncated, err
+		return nil, err
 	}
 
 	// Configure MaxBytes limit for EncodeReader as multiplied by 4
@@ -237,19 +419,19 @@ func (inp *filestream) open(
 		MaxBytes:   encReaderMaxBytes,
 	})
 	if err != nil {
-		return nil, truncated, err
+		return nil, err
 	}
 
 	r = readfile.NewStripNewline(r, inp.readerConfig.LineTerminator)
 
 	r = readfile.NewFilemeta(r, fs.newPath, fs.desc.Info, fs.desc.Fingerprint, offset)
 
-	r = inp.parsers.Create(r)
+	r = parsers.CreateWithState(r, parserState)
 
 	r = readfile.NewLimitReader(r, inp.readerConfig.MaxBytes)
 
 	ok = true // no need to close the file
-	return r, truncated, nil
+	return r, nil
 }
 
 // openFile opens a file and checks for the encoding. In case the encoding cannot be detected
@@ -257,64 +439,92 @@ func (inp *filestream) open(
 // is returned and the harvester is closed. The file will be picked up again the next time
 // the file system is scanned.
 //
+// If compression is set to auto and the file is compressed, the 2nd return value
+// reads its decompressed content from offset, which is an offset into the
+// decompressed content.
+//
 // openFile will also detect and hadle file truncation. If a file is truncated
-// then the 3rd return value is true.
+// then the 4th return value is true.
 func (inp *filestream) openFile(
 	log *logp.Logger,
 	path string,
 	offset int64,
-) (*os.File, encoding.Encoding, bool, error) {
+	encodingFactory encoding.EncodingFactory,
+) (*os.File, io.ReadCloser, encoding.Encoding, bool, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed to stat source file %s: %w", path, err)
+		return nil, nil, nil, false, fmt.Errorf("failed to stat source file %s: %w", path, err)
 	}
 
 	// it must be checked if the file is not a named pipe before we try to open it
 	// if it is a named pipe os.OpenFile fails, so there is no need to try opening it.
 	if fi.Mode()&os.ModeNamedPipe != 0 {
-		return nil, nil, false, fmt.Errorf("failed to open file %s, named pipes are not supported", fi.Name())
+		return nil, nil, nil, false, fmt.Errorf("failed to open file %s, named pipes are not supported", fi.Name())
 	}
 
 	f, err := file.ReadOpen(path)
 	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed opening %s: %w", path, err)
+		return nil, nil, nil, false, fmt.Errorf("failed opening %s: %w", path, err)
 	}
 	ok := false
 	defer cleanup.IfNot(&ok, cleanup.IgnoreError(f.Close))
 
 	fi, err = f.Stat()
 	if err != nil {
-		return nil, nil, false, fmt.Errorf("failed to stat source file %s: %w", path, err)
+		return nil, nil, nil, false, fmt.Errorf("failed to stat source file %s: %w", path, err)
 	}
 
 	err = checkFileBeforeOpening(fi)
 	if err != nil {
-		return nil, nil, false, err
+		return nil, nil, nil, false, err
+	}
+
+	kind := uncompressed
+	if inp.readerConfig.Compression == compressionAuto {
+		kind, err = detectCompression(f)
+		if err != nil {
+			return nil, nil, nil, false, err
+		}
 	}
 
 	truncated := false
-	if fi.Size() < offset {
-		// if the file was truncated we need to reset the offset and notify
-		// all callers so they can also reset their offsets
-		truncated = true
-		log.Infof("File was truncated. Reading file from offset 0. Path=%s", path)
-		offset = 0
-	}
-	err = inp.initFileOffset(f, offset)
-	if err != nil {
-		return nil, nil, truncated, err
+	var dec io.ReadCloser
+	var r io.Reader = f
+	if kind != uncompressed {
+		log.Debugf("Reading %s compressed file. Path=%s", kind, path)
+		dec, truncated, err = openDecompressed(f, kind, offset)
+		if err != nil {
+			return nil, nil, nil, false, err
+		}
+		if truncated {
+			log.Infof("Decompressed file is shorter than offset %d. Reading file from offset 0. Path=%s", offset, path)
+		}
+		defer cleanup.IfNot(&ok, cleanup.IgnoreError(dec.Close))
+		r = dec
+	} else {
+		if fi.Size() < offset {
+			// if the file was truncated we need to reset the offset and notify
+			// all callers so they can also reset their offsets
+			truncated = true
+			log.Infof("File was truncated. Reading file from offset 0. Path=%s", path)
+			offset = 0
+		}
+		err = inp.initFileOffset(f, offset)
+		if err != nil {
+			return nil, nil, nil, truncated, err
+		}
 	}
 
-	encoding, err := inp.encodingFactory(f)
+	encoding, err := encodingFactory(r)
 	if err != nil {
 		if errors.Is(err, transform.ErrShortSrc) {
-			return nil, nil, truncated, fmt.Errorf("initialising encoding for '%v' failed due to file being too short", f)
+			return nil, nil, nil, truncated, fmt.Errorf("initialising encoding for '%v' failed due to file being too short", f)
 		}
-		return nil, nil, truncated, fmt.Errorf("initialising encoding for '%v' failed: %w", f, err)
+		return nil, nil, nil, truncated, fmt.Errorf("initialising encoding for '%v' failed: %w", f, err)
 	}
 
 	ok = true // no need to close the file
-	return f, encoding, truncated, nil
+	return f, dec, encoding, truncated, nil
 }
 
 func checkFileBeforeOpening(fi os.FileInfo) error {
@@ -341,7 +551,10 @@ func (inp *filestream) readFromSource(
 	log *logp.Logger,
 	r reader.Reader,
 	path string,
-	s state,
+	s *state,
+	parsers *parsersConfig,
+	parserState *parser.State,
+	checksums *checksummer,
 	p loginp.Publisher,
 	metrics *loginp.Metrics,
 ) error {
@@ -353,6 +566,10 @@ func (inp *filestream) readFromSource(
 	defer metrics.HarvesterClosed.Inc()
 
 	for ctx.Cancelation.Err() == nil {
+		if inp.parsers.Load() != parsers {
+			return errParsersUpdated
+		}
+
 		message, err := r.Next()
 		if err != nil {
 			if errors.Is(err, ErrFileTruncate) {
@@ -361,6 +578,8 @@ func (inp *filestream) readFromSource(
 				log.Infof("Reader was closed. Closing. Path='%s'", path)
 			} else if errors.Is(err, io.EOF) {
 				log.Debugf("EOF has been reached. Closing. Path='%s'", path)
+			} else if errors.Is(err, errIncompleteCompressedFile) {
+				log.Debugf("End of incomplete compressed file has been reached, it is read again when it is updated. Closing. Path='%s'", path)
 			} else {
 				log.Errorf("Read line error: %v", err)
 				metrics.ProcessingErrors.Inc()
@@ -378,7 +597,11 @@ func (inp *filestream) readFromSource(
 
 		metrics.BytesProcessed.Add(uint64(message.Bytes))
 
-		if err := p.Publish(message.ToEvent(), s); err != nil {
+		s.Parsers = *parserState
+		if checksums != nil {
+			checksums.update(s)
+		}
+		if err := p.Publish(message.ToEvent(), *s); err != nil {
 			metrics.ProcessingErrors.Inc()
 			return err
 		}
@@ -21,7 +21,10 @@ package filestream
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"runtime"
@@ -34,6 +37,9 @@ import (
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
+
+	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
+	conf "github.com/elastic/elastic-agent-libs/config"
 )
 
 // test_close_renamed from test_harvester.py
@@ -332,6 +338,60 @@ func TestFilestreamUTF16BOMs(t *testing.T) {
 	}
 }
 
+func TestFilestreamAutoEncoding(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.log"
+	config := map[string]interface{}{
+		"id":                                "fake-ID",
+		"paths":                             []string{env.abspath(testlogName)},
+		"prospector.scanner.check_interval": "1ms",
+		"encoding":                          "auto",
+	}
+
+	encode := func(s string) []byte {
+		b, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().Bytes([]byte(s))
+		require.NoError(t, err)
+		return b
+	}
+	testlines := append([]byte{0xff, 0xfe}, encode("first line\nsecond line\n")...)
+	env.mustWriteToFile(testlogName, testlines)
+
+	inp := env.mustCreateInput(config)
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(2)
+	env.requireEventsReceived([]string{"first line", "second line"})
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines))
+
+	cancelInput()
+	env.waitUntilInputStops()
+
+	fi, err := os.Stat(env.abspath(testlogName))
+	require.NoError(t, err)
+	entry, err := env.getRegistryState(getIDFromPath(env.abspath(testlogName), "fake-ID", fi))
+	require.NoError(t, err)
+	require.Equal(t, "utf-16le", entry.Cursor.Encoding)
+
+	// the file is resumed with the encoding from the registry, the
+	// appended data has no BOM
+	morelines := encode("third line\n")
+	env.mustAppendToFile(testlogName, morelines)
+
+	env.resetManager()
+	inp = env.mustCreateInput(config)
+	ctx, cancelInput = context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(3)
+	env.requireEventContents(2, "message", "third line")
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines)+len(morelines))
+
+	cancelInput()
+	env.waitUntilInputStops()
+}
+
 // test_close_timeout from test_harvester.py
 func TestFilestreamCloseTimeout(t *testing.T) {
 	env := newInputTestingEnvironment(t)
@@ -1060,3 +1120,258 @@ func TestRotatingCloseInactiveLowWriteRate(t *testing.T) {
 	cancelInput()
 	env.waitUntilInputStops()
 }
+
+func TestFilestreamReadsCompressedFile(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.log.gz"
+	inp := env.mustCreateInput(map[string]interface{}{
+		"id":                                "fake-ID",
+		"paths":                             []string{env.abspath(testlogName)},
+		"prospector.scanner.check_interval": "1ms",
+		"compression":                       "auto",
+	})
+
+	testlines := []byte("first log line\nsecond log line\n")
+	env.mustWriteToFile(testlogName, gzipContent(t, testlines))
+
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(2)
+	env.requireEventsReceived([]string{"first log line", "second log line"})
+	// the offset is an offset into the decompressed content
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines))
+	env.waitUntilHarvesterIsDone()
+
+	cancelInput()
+	env.waitUntilInputStops()
+}
+
+func TestFilestreamContinuesInCompressedCopy(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.log"
+	inp := env.mustCreateInput(map[string]interface{}{
+		"id":                                   "fake-ID",
+		"paths":                                []string{env.abspath(testlogName) + "*"},
+		"prospector.scanner.check_interval":    "1ms",
+		"prospector.scanner.fingerprint":       map[string]interface{}{"enabled": true, "length": 64},
+		"file_identity.fingerprint":            nil,
+		"close.on_state_change.check_interval": "1ms",
+		"compression":                          "auto",
+	})
+
+	testlines := []byte("first log line of the file, which is long enough to compute its fingerprint\n")
+	env.mustWriteToFile(testlogName, testlines)
+
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(1)
+	hash := sha256.Sum256(testlines[:64])
+	id := "filestream::fake-ID::fingerprint::" + hex.EncodeToString(hash[:])
+	env.requireOffsetInRegistryByID(id, len(testlines))
+
+	// the file is rotated and compressed after lines have been added, which
+	// have not been read yet
+	morelines := []byte("second log line\nthird log line\n")
+	env.mustRemoveFile(testlogName)
+	env.mustWriteToFile(testlogName+".1.gz", gzipContent(t, append(testlines, morelines...)))
+
+	env.waitUntilEventCount(3)
+	env.requireEventsReceived([]string{
+		"first log line of the file, which is long enough to compute its fingerprint",
+		"second log line",
+		"third log line",
+	})
+	env.requireOffsetInRegistryByID(id, len(testlines)+len(morelines))
+
+	cancelInput()
+	env.waitUntilInputStops()
+}
+
+func gzipContent(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestFilestreamStartPositionBackfillsLastLines(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.log"
+	config := map[string]interface{}{
+		"id":                                "fake-ID",
+		"paths":                             []string{env.abspath("*.log")},
+		"prospector.scanner.check_interval": "1ms",
+		"start_position.from":               "end",
+		"start_position.lines":              2,
+	}
+
+	// the file exists when the input starts
+	testlines := []byte("first log line\nsecond log line\nthird log line\n")
+	env.mustWriteToFile(testlogName, testlines)
+	inp := env.mustCreateInput(config)
+
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(2)
+	env.requireEventsReceived([]string{"second log line", "third log line"})
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines))
+
+	// files created after the input started are read from the beginning
+	newlogName := "new.log"
+	newlines := []byte("first new line\nsecond new line\nthird new line\n")
+	env.mustWriteToFile(newlogName, newlines)
+	env.waitUntilEventCount(5)
+	env.requireOffsetInRegistry(newlogName, "fake-ID", len(newlines))
+
+	cancelInput()
+	env.waitUntilInputStops()
+
+	// the files have a state in the registry after the restart
+	morelines := []byte("fourth log line\n")
+	env.mustAppendToFile(testlogName, morelines)
+
+	env.resetManager()
+	inp = env.mustCreateInput(config)
+	ctx, cancelInput = context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(6)
+	env.requireEventContents(5, "message", "fourth log line")
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines)+len(morelines))
+
+	cancelInput()
+	env.waitUntilInputStops()
+}
+
+func TestFilestreamUpdateParsersKeepsOffset(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.log"
+	config := map[string]interface{}{
+		"id":                                "fake-ID",
+		"paths":                             []string{env.abspath(testlogName)},
+		"prospector.scanner.check_interval": "1ms",
+	}
+
+	testlines := []byte("first log line\nsecond log line\n")
+	env.mustWriteToFile(testlogName, testlines)
+	inp := env.mustCreateInput(config)
+
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(2)
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines))
+
+	// the running harvester reads the new lines with the new parsers
+	config["parsers"] = []map[string]interface{}{
+		{
+			"multiline": map[string]interface{}{
+				"type":        "count",
+				"count_lines": 2,
+			},
+		},
+	}
+	updated, err := inp.(v2.Updater).Update(conf.MustNewConfigFrom(config))
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	morelines := []byte("third log line\nfourth log line\n")
+	env.mustAppendToFile(testlogName, morelines)
+
+	env.waitUntilEventCount(3)
+	env.requireEventContents(2, "message", "third log line\nfourth log line")
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines)+len(morelines))
+
+	// changing the paths requires a new input
+	config["paths"] = []string{env.abspath("*.log")}
+	updated, err = inp.(v2.Updater).Update(conf.MustNewConfigFrom(config))
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	cancelInput()
+	env.waitUntilInputStops()
+}
+
+func TestFilestreamNetworkFSValidatesOffsetOnResume(t *testing.T) {
+	firstLine := strings.Repeat("a", 1100) + "\n"
+	testlines := []byte(firstLine + "second line\nthird line\n")
+	morelines := []byte("fourth line\n")
+
+	cases := map[string]struct {
+		rewrite        []byte
+		expectedEvents []string
+	}{
+		"unchanged file is resumed": {
+			expectedEvents: []string{"fourth line"},
+		},
+		"rewritten file is read from the beginning": {
+			rewrite:        []byte(firstLine + "SECOND line\nthird line\n"),
+			expectedEvents: []string{strings.TrimSuffix(firstLine, "\n"), "SECOND line", "third line", "fourth line"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			env := newInputTestingEnvironment(t)
+
+			testlogName := "test.log"
+			config := map[string]interface{}{
+				"id":                                "fake-ID",
+				"paths":                             []string{env.abspath(testlogName)},
+				"prospector.scanner.check_interval": "1ms",
+				"network_fs.enabled":                true,
+			}
+
+			env.mustWriteToFile(testlogName, testlines)
+			inp := env.mustCreateInput(config)
+			ctx, cancelInput := context.WithCancel(context.Background())
+			env.startInput(ctx, inp)
+
+			env.waitUntilEventCount(3)
+
+			// the identity is the fingerprint of the first bytes and the path
+			hasher := sha256.New()
+			hasher.Write(testlines[:1024])
+			hasher.Write([]byte(env.abspath(testlogName)))
+			id := "filestream::fake-ID::fingerprint::" + hex.EncodeToString(hasher.Sum(nil))
+			env.requireOffsetInRegistryByID(id, len(testlines))
+
+			cancelInput()
+			env.waitUntilInputStops()
+
+			entry, err := env.getRegistryState(id)
+			require.NoError(t, err)
+			require.NotNil(t, entry.Cursor.Checksum)
+			require.Equal(t, len(testlines), entry.Cursor.Checksum.Offset)
+
+			// the first bytes are unchanged, the file keeps its identity
+			if tc.rewrite != nil {
+				env.mustWriteToFile(testlogName, tc.rewrite)
+			}
+			env.mustAppendToFile(testlogName, morelines)
+
+			env.resetManager()
+			inp = env.mustCreateInput(config)
+			ctx, cancelInput = context.WithCancel(context.Background())
+			env.startInput(ctx, inp)
+
+			env.waitUntilEventCount(3 + len(tc.expectedEvents))
+			for i, msg := range tc.expectedEvents {
+				env.requireEventContents(3+i, "message", msg)
+			}
+			env.requireOffsetInRegistryByID(id, len(testlines)+len(morelines))
+
+			cancelInput()
+			env.waitUntilInputStops()
+		})
+	}
+}
@@ -119,6 +119,64 @@ paths:
 // `testID` must be unique for each test run
 // `cfg` must be a valid YAML string containing valid filestream configuration
 // `expEventCount` is an expected amount of produced events
+func TestFilestreamUpdate(t *testing.T) {
+	newConfig := func(t *testing.T, cfg string) *conf.C {
+		c, err := conf.NewConfigWithYAML([]byte(cfg), cfg)
+		require.NoError(t, err)
+		return c
+	}
+	initial := `
+id: update-test
+paths: [/var/log/*.log]
+parsers:
+  - ndjson:
+      target: ""
+`
+
+	cases := map[string]struct {
+		config  string
+		updated bool
+	}{
+		"parsers changed": {
+			config: `
+id: update-test
+paths: [/var/log/*.log]
+parsers:
+  - multiline:
+      type: count
+      count_lines: 2
+processors:
+  - drop_fields.fields: [message]
+`,
+			updated: true,
+		},
+		"paths changed": {
+			config: `
+id: update-test
+paths: [/var/log/other/*.log]
+`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, harvester, err := configure(newConfig(t, initial))
+			require.NoError(t, err)
+			inp := harvester.(*filestream)
+			parsers := inp.parsers.Load()
+
+			updated, err := inp.Update(newConfig(t, tc.config))
+			require.NoError(t, err)
+			require.Equal(t, tc.updated, updated)
+			if tc.updated {
+				require.NotSame(t, parsers, inp.parsers.Load())
+			} else {
+				require.Same(t, parsers, inp.parsers.Load())
+			}
+		})
+	}
+}
+
 func runFilestreamBenchmark(b *testing.B, testID string, cfg string, expEventCount int) {
 	b.Helper()
 	// we don't include initialization in the benchmark time
@@ -25,6 +25,7 @@ import (
 	input "github.com/elastic/beats/v7/filebeat/input/v2"
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common/acker"
+	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/go-concert/ctxtool"
 )
 
@@ -48,6 +49,17 @@ func (inp *managedInput) Test(ctx input.TestContext) error {
 	return inp.prospector.Test()
 }
 
+// updatableInput is a managedInput whose Harvester implements
+// input.Updater.
+type updatableInput struct {
+	*managedInput
+}
+
+// Update applies config to the running harvesters.
+func (inp *updatableInput) Update(config *conf.C) (bool, error) {
+	return inp.harvester.(input.Updater).Update(config)
+}
+
 // Run
 func (inp *managedInput) Run(
 	ctx input.Context,
@@ -64,6 +76,7 @@ func (inp *managedInput) Run(
 
 	metrics := NewMetrics(inp.metricsID)
 	defer metrics.Close()
+	ctx.MetricsRegistry = metrics.registry
 
 	hg := &defaultHarvesterGroup{
 		pipeline:     pipeline,
@@ -222,7 +222,7 @@ func (cim *InputManager) Create(config *conf.C) (v2.Input, error) {
 		return nil, err
 	}
 
-	return &managedInput{
+	inp := &managedInput{
 		manager:          cim,
 		ackCH:            cim.ackCH,
 		userID:           settings.ID,
@@ -232,7 +232,11 @@ func (cim *InputManager) Create(config *conf.C) (v2.Input, error) {
 		sourceIdentifier: sourceIdentifier,
 		cleanTimeout:     settings.CleanInactive,
 		harvesterLimit:   settings.HarvesterLimit,
-	}, nil
+	}
+	if _, ok := harvester.(v2.Updater); ok {
+		return &updatableInput{inp}, nil
+	}
+	return inp, nil
 }
 
 func (cim *InputManager) Delete(cfg *conf.C) error {
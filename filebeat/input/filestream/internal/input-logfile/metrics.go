@@ -27,6 +27,7 @@ import (
 
 // Metrics defines a set of metrics for the filestream input.
 type Metrics struct {
+	registry   *monitoring.Registry
 	unregister func()
 
 	FilesOpened      *monitoring.Uint // Number of files that have been opened.
@@ -65,6 +66,7 @@ func NewMetrics(id string) *Metrics {
 
 	reg, unreg := inputmon.NewInputRegistry("filestream", id, nil)
 	m := Metrics{
+		registry:         reg,
 		unregister:       unreg,
 		FilesOpened:      monitoring.NewUint(reg, "files_opened_total"),
 		FilesClosed:      monitoring.NewUint(reg, "files_closed_total"),
@@ -0,0 +1,235 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/common/file"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const defaultChecksumLength = 1024
+
+// networkFSConfig configures the input to read files from network file
+// systems like NFS and FUSE mounts, where inode and device IDs are not stable.
+type networkFSConfig struct {
+	Enabled bool `config:"enabled"`
+	// ChecksumLength is the number of bytes before the offset of a file
+	// hashed into the checksum which validates the offset on resume.
+	ChecksumLength cfgtype.ByteSize `config:"checksum_length"`
+}
+
+func defaultNetworkFSConfig() networkFSConfig {
+	return networkFSConfig{
+		Enabled:        false,
+		ChecksumLength: defaultChecksumLength,
+	}
+}
+
+func (c *networkFSConfig) Validate() error {
+	if c.ChecksumLength == 0 {
+		return errors.New("network_fs.checksum_length must be greater than 0")
+	}
+	return nil
+}
+
+// resumeChecksum is the checksum of the Length bytes before Offset of a
+// file. It is stored in the registry and validated before a file is read
+// from its stored offset.
+type resumeChecksum struct {
+	Offset int64  `json:"offset" struct:"offset"`
+	Length int64  `json:"length" struct:"length"`
+	Sum    string `json:"sum" struct:"sum"`
+}
+
+// checksumReadAhead is the number of bytes read ahead of the offset of the
+// last published line that the checksum window keeps, in addition to the
+// checksum length. It covers the buffering of the line reader and of
+// multiline parsers with short messages.
+const checksumReadAhead = 64 * 1024
+
+// checksummer computes and validates the resume checksums of a file.
+// Checksums are computed from a window of the bytes last read by the
+// harvester, so that publishing a line does not read the file again. This
+// matters on network file systems, where every read is a round trip to the
+// server. The file is only read if the bytes are not in the window anymore,
+// or to validate a checksum before the file is read.
+type checksummer struct {
+	log    *logp.Logger
+	f      *os.File
+	length int64
+	window checksumWindow
+	digest *xxhash.Digest
+	buf    []byte
+}
+
+// newChecksummer opens the file at path to compute its checksums. It returns
+// nil if the file is compressed, the offsets of compressed files are offsets
+// into their decompressed content.
+func newChecksummer(log *logp.Logger, path string, length int64, decompress bool) (*checksummer, error) {
+	f, err := file.ReadOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening %s to compute checksums: %w", path, err)
+	}
+
+	if decompress {
+		kind, err := detectCompression(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if kind != uncompressed {
+			f.Close()
+			return nil, nil
+		}
+	}
+
+	return &checksummer{
+		log:    log,
+		f:      f,
+		length: length,
+		window: checksumWindow{buf: make([]byte, length+checksumReadAhead)},
+		digest: xxhash.New(),
+	}, nil
+}
+
+// newReader returns a reader that adds the bytes read from r to the window.
+// The next byte read from r is at offset in the file.
+func (c *checksummer) newReader(r io.ReadCloser, offset int64) io.ReadCloser {
+	c.window.reset(offset)
+	return &checksumReader{ReadCloser: r, window: &c.window}
+}
+
+// sum returns the checksum of the bytes before offset.
+func (c *checksummer) sum(offset int64, length int64) (*resumeChecksum, error) {
+	length = min(length, offset)
+	c.digest.Reset()
+	if !c.window.hash(c.digest, offset-length, offset) {
+		if err := c.hashFile(offset-length, offset); err != nil {
+			return nil, err
+		}
+	}
+	return &resumeChecksum{
+		Offset: offset,
+		Length: length,
+		Sum:    strconv.FormatUint(c.digest.Sum64(), 16),
+	}, nil
+}
+
+func (c *checksummer) hashFile(from, to int64) error {
+	if int64(cap(c.buf)) < to-from {
+		c.buf = make([]byte, to-from)
+	}
+	buf := c.buf[:to-from]
+	if _, err := c.f.ReadAt(buf, from); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("file is shorter than offset %d", to)
+		}
+		return err
+	}
+	_, _ = c.digest.Write(buf)
+	return nil
+}
+
+// verify returns true if the bytes of the file before the offset of
+// checksum are unchanged. A file without checksum is not verified.
+func (c *checksummer) verify(checksum *resumeChecksum) bool {
+	if checksum == nil {
+		return true
+	}
+
+	length := min(checksum.Length, checksum.Offset)
+	c.digest.Reset()
+	if err := c.hashFile(checksum.Offset-length, checksum.Offset); err != nil {
+		c.log.Debugf("Cannot compute checksum at offset %d: %v", checksum.Offset, err)
+		return false
+	}
+	return strconv.FormatUint(c.digest.Sum64(), 16) == checksum.Sum
+}
+
+// update sets the checksum of the bytes before the offset in s. The
+// previous checksum is kept if the checksum cannot be computed.
+func (c *checksummer) update(s *state) {
+	checksum, err := c.sum(s.Offset, c.length)
+	if err != nil {
+		c.log.Debugf("Cannot compute checksum at offset %d: %v", s.Offset, err)
+		return
+	}
+	s.Checksum = checksum
+}
+
+func (c *checksummer) Close() error {
+	return c.f.Close()
+}
+
+// checksumWindow is a ring buffer of the last bytes read from a file.
+type checksumWindow struct {
+	buf  []byte
+	head int   // index in buf where the next byte is written
+	size int   // number of valid bytes in buf
+	end  int64 // offset in the file after the last byte written
+}
+
+func (w *checksumWindow) reset(offset int64) {
+	w.head, w.size, w.end = 0, 0, offset
+}
+
+func (w *checksumWindow) write(p []byte) {
+	w.end += int64(len(p))
+	if len(p) > len(w.buf) {
+		p = p[len(p)-len(w.buf):]
+	}
+	n := copy(w.buf[w.head:], p)
+	copy(w.buf, p[n:])
+	w.head = (w.head + len(p)) % len(w.buf)
+	w.size = min(w.size+len(p), len(w.buf))
+}
+
+// hash writes the bytes between the offsets from and to to h. It returns
+// false if they are not all in the window.
+func (w *checksumWindow) hash(h io.Writer, from, to int64) bool {
+	if from < w.end-int64(w.size) || to > w.end {
+		return false
+	}
+	i := (w.head - int(w.end-from) + len(w.buf)) % len(w.buf)
+	n := int(to - from)
+	first := min(n, len(w.buf)-i)
+	_, _ = h.Write(w.buf[i : i+first])
+	_, _ = h.Write(w.buf[:n-first])
+	return true
+}
+
+// checksumReader adds the bytes read from a file to a checksum window.
+type checksumReader struct {
+	io.ReadCloser
+	window *checksumWindow
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.window.write(p[:n])
+	return n, err
+}
@@ -0,0 +1,175 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestNetworkFSConfig(t *testing.T) {
+	cases := map[string]struct {
+		config      string
+		expectedErr string
+	}{
+		"defaults": {
+			config: `network_fs.enabled: true`,
+		},
+		"fingerprint file identity": {
+			config: `
+network_fs.enabled: true
+file_identity.fingerprint: ~
+`,
+		},
+		"other file identity": {
+			config: `
+network_fs.enabled: true
+file_identity.native: ~
+`,
+			expectedErr: "network_fs requires the fingerprint file identity",
+		},
+		"checksum length is 0": {
+			config: `
+network_fs.enabled: true
+network_fs.checksum_length: 0
+`,
+			expectedErr: "checksum_length must be greater than 0",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := conf.NewConfigWithYAML([]byte("paths: [/var/log/*.log]\n"+tc.config), "")
+			require.NoError(t, err)
+
+			c := defaultConfig()
+			err = cfg.Unpack(&c)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, c.NetworkFS.Enabled)
+			require.EqualValues(t, defaultChecksumLength, c.NetworkFS.ChecksumLength)
+		})
+	}
+}
+
+func TestChecksummer(t *testing.T) {
+	content := strings.Repeat("log line\n", 10)
+	f := writeTempFile(t, t.TempDir(), "test.log", []byte(content))
+
+	c, err := newChecksummer(logp.L(), f.Name(), 16, false)
+	require.NoError(t, err)
+	defer c.Close()
+
+	t.Run("checksum covers the bytes before the offset", func(t *testing.T) {
+		s := state{Offset: 18}
+		c.update(&s)
+		require.NotNil(t, s.Checksum)
+		require.Equal(t, int64(18), s.Checksum.Offset)
+		require.Equal(t, int64(16), s.Checksum.Length)
+		require.True(t, c.verify(s.Checksum))
+	})
+
+	t.Run("checksum is shorter at the beginning of the file", func(t *testing.T) {
+		s := state{Offset: 9}
+		c.update(&s)
+		require.Equal(t, int64(9), s.Checksum.Length)
+		require.True(t, c.verify(s.Checksum))
+	})
+
+	t.Run("files without checksum are not verified", func(t *testing.T) {
+		require.True(t, c.verify(nil))
+	})
+
+	t.Run("changed content is detected", func(t *testing.T) {
+		s := state{Offset: 27}
+		c.update(&s)
+
+		require.NoError(t, os.WriteFile(f.Name(), []byte(strings.Replace(content, "log line", "LOG LINE", 3)), 0o600))
+		require.False(t, c.verify(s.Checksum))
+	})
+
+	t.Run("truncated file is detected", func(t *testing.T) {
+		s := state{Offset: 27}
+		c.update(&s)
+
+		require.NoError(t, os.Truncate(f.Name(), 10))
+		require.False(t, c.verify(s.Checksum))
+	})
+
+	t.Run("checksum is computed from the bytes read", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(f.Name(), []byte(content), 0o600))
+		r := c.newReader(io.NopCloser(strings.NewReader(content[9:])), 9)
+		_, err := io.ReadAll(r)
+		require.NoError(t, err)
+
+		// The file is not read again, the checksums match the bytes that
+		// were read even though the file has changed.
+		require.NoError(t, os.Truncate(f.Name(), 0))
+		for _, offset := range []int64{25, 90} {
+			s := state{Offset: offset}
+			c.update(&s)
+			require.NotNil(t, s.Checksum)
+			require.Equal(t, strconv.FormatUint(xxhash.Sum64String(content[offset-16:offset]), 16), s.Checksum.Sum)
+		}
+
+		// Bytes before the window are read from the file.
+		s := state{Offset: 12}
+		c.update(&s)
+		require.Nil(t, s.Checksum)
+	})
+
+	t.Run("compressed files have no checksum", func(t *testing.T) {
+		gz := writeTempFile(t, t.TempDir(), "test.log.gz", gzipBytes(t, content))
+		c, err := newChecksummer(logp.L(), gz.Name(), 16, true)
+		require.NoError(t, err)
+		require.Nil(t, c)
+	})
+}
+
+func TestChecksumWindow(t *testing.T) {
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+	w := checksumWindow{buf: make([]byte, 10)}
+	w.reset(5)
+	for _, chunk := range []string{content[5:12], content[12:15], content[15:30]} {
+		w.write([]byte(chunk))
+	}
+	require.Equal(t, int64(30), w.end)
+
+	var sb strings.Builder
+	require.True(t, w.hash(&sb, 20, 30))
+	require.Equal(t, content[20:30], sb.String())
+
+	sb.Reset()
+	require.True(t, w.hash(&sb, 24, 27))
+	require.Equal(t, content[24:27], sb.String())
+
+	require.False(t, w.hash(&sb, 19, 30), "bytes before the window")
+	require.False(t, w.hash(&sb, 25, 31), "bytes after the window")
+}
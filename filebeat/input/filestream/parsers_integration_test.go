@@ -21,7 +21,10 @@ package filestream
 
 import (
 	"context"
+	"os"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestParsersAgentLogs(t *testing.T) {
@@ -565,3 +568,107 @@ SetAdCodeMiddleware.default_ad_code route
 	cancelInput()
 	env.waitUntilInputStops()
 }
+
+func TestParsersCSVHeaderSurvivesRestart(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.csv"
+	config := map[string]interface{}{
+		"id":                                "fake-ID",
+		"paths":                             []string{env.abspath(testlogName)},
+		"prospector.scanner.check_interval": "1ms",
+		"parsers": []map[string]interface{}{
+			{
+				"csv": map[string]interface{}{
+					"target": "csv",
+				},
+			},
+		},
+	}
+	inp := env.mustCreateInput(config)
+
+	testlines := []byte("name,age\nalice,30\n")
+	env.mustWriteToFile(testlogName, testlines)
+
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(1)
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines))
+	env.requireEventContents(0, "csv.name", "alice")
+	env.requireEventContents(0, "csv.age", "30")
+
+	cancelInput()
+	env.waitUntilInputStops()
+
+	fi, err := os.Stat(env.abspath(testlogName))
+	require.NoError(t, err)
+	entry, err := env.getRegistryState(getIDFromPath(env.abspath(testlogName), "fake-ID", fi))
+	require.NoError(t, err)
+	require.Equal(t, []string{"name", "age"}, entry.Cursor.Parsers.CSVHeader)
+
+	// the header is taken from the registry after the restart
+	morelines := []byte("bob,41\n")
+	env.mustAppendToFile(testlogName, morelines)
+
+	env.resetManager()
+	inp = env.mustCreateInput(config)
+	ctx, cancelInput = context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(2)
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines)+len(morelines))
+	env.requireEventContents(1, "csv.name", "bob")
+	env.requireEventContents(1, "csv.age", "41")
+
+	cancelInput()
+	env.waitUntilInputStops()
+}
+
+func TestParsersJSONDocumentsResumeAfterRestart(t *testing.T) {
+	env := newInputTestingEnvironment(t)
+
+	testlogName := "test.json"
+	config := map[string]interface{}{
+		"id":                                "fake-ID",
+		"paths":                             []string{env.abspath(testlogName)},
+		"prospector.scanner.check_interval": "1ms",
+		"parsers": []map[string]interface{}{
+			{
+				"json": map[string]interface{}{
+					"message_key": "msg",
+				},
+			},
+		},
+	}
+	inp := env.mustCreateInput(config)
+
+	testlines := []byte("[\n  {\n    \"msg\": \"first\"\n  },\n  {\"msg\": \"second\"}, {\"msg\": \"third\"},\n")
+	env.mustWriteToFile(testlogName, testlines)
+
+	ctx, cancelInput := context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(3)
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines))
+	env.requireEventsReceived([]string{"first", "second", "third"})
+
+	cancelInput()
+	env.waitUntilInputStops()
+
+	// the array is continued while the input is stopped
+	morelines := []byte("  {\n    \"msg\": \"fourth\"\n  }\n]\n")
+	env.mustAppendToFile(testlogName, morelines)
+
+	env.resetManager()
+	inp = env.mustCreateInput(config)
+	ctx, cancelInput = context.WithCancel(context.Background())
+	env.startInput(ctx, inp)
+
+	env.waitUntilEventCount(4)
+	env.requireOffsetInRegistry(testlogName, "fake-ID", len(testlines)+len(morelines)-len("]\n"))
+	env.requireEventsReceived([]string{"first", "second", "third", "fourth"})
+
+	cancelInput()
+	env.waitUntilInputStops()
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/beat"
 
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 	"github.com/elastic/go-concert/unison"
 )
 
@@ -59,6 +60,14 @@ type fileProspector struct {
 	ignoreInactiveSince ignoreInactiveType
 	cleanRemoved        bool
 	stateChangeCloser   stateChangeCloserConfig
+	// decompress is set if compressed files are read, see onRename
+	decompress bool
+	// startPosition is applied to the files without state found on startup
+	startPosition startPositionConfig
+	startupFiles  map[string]struct{}
+	// encoding is the configured encoding of the files, the start position
+	// is aligned to its line feeds
+	encoding string
 }
 
 func (p *fileProspector) Init(
@@ -68,6 +77,13 @@ func (p *fileProspector) Init(
 ) error {
 	files := p.filewatcher.GetFiles()
 
+	if p.startPosition.From != startFromBeginning {
+		p.startupFiles = make(map[string]struct{}, len(files))
+		for path := range files {
+			p.startupFiles[path] = struct{}{}
+		}
+	}
+
 	// If this fileProspector belongs to an input that did not have an ID
 	// this will find its files in the registry and update them to use the
 	// new ID.
@@ -135,6 +151,8 @@ func (p *fileProspector) Run(ctx input.Context, s loginp.StateMetadataUpdater, h
 
 	defer p.stopHarvesterGroup(log, hg)
 
+	registerWatcherMetrics(ctx.MetricsRegistry, p.filewatcher)
+
 	var tg unison.MultiErrGroup
 
 	tg.Go(func() error {
@@ -164,6 +182,16 @@ func (p *fileProspector) Run(ctx input.Context, s loginp.StateMetadataUpdater, h
 	}
 }
 
+// registerWatcherMetrics adds the metrics of the file watcher to the
+// metrics of the input.
+func registerWatcherMetrics(reg *monitoring.Registry, w loginp.FSWatcher) {
+	fw, ok := w.(*fileWatcher)
+	if !ok || reg == nil {
+		return
+	}
+	reg.Add("fingerprint_collisions_total", fw.collisions, monitoring.Reported)
+}
+
 func (p *fileProspector) onFSEvent(
 	log *logp.Logger,
 	ctx input.Context,
@@ -175,9 +203,11 @@ func (p *fileProspector) onFSEvent(
 ) {
 	switch event.Op {
 	case loginp.OpCreate, loginp.OpWrite:
+		newState := false
 		if event.Op == loginp.OpCreate {
 			log.Debugf("A new file %s has been found", event.NewPath)
 
+			newState = updater.FindCursorMeta(src, &fileMeta{}) != nil
 			err := updater.UpdateMetadata(src, fileMeta{Source: event.NewPath, IdentifierName: p.identifier.Name()})
 			if err != nil {
 				log.Errorf("Failed to set cursor meta data of entry %s: %v", src.Name(), err)
@@ -195,6 +225,10 @@ func (p *fileProspector) onFSEvent(
 			return
 		}
 
+		if newState {
+			p.seekStartPosition(log, event, src, updater)
+		}
+
 		group.Start(ctx, src)
 
 	case loginp.OpTruncate:
@@ -236,6 +270,30 @@ func (p *fileProspector) isFileIgnored(log *logp.Logger, fe loginp.FSEvent, igno
 	return false
 }
 
+// seekStartPosition sets the cursor of a file found on startup without a
+// state in the registry to the configured start position.
+func (p *fileProspector) seekStartPosition(log *logp.Logger, fe loginp.FSEvent, src loginp.Source, s loginp.StateMetadataUpdater) {
+	if _, ok := p.startupFiles[fe.NewPath]; !ok {
+		return
+	}
+	delete(p.startupFiles, fe.NewPath)
+
+	offset, err := p.startPosition.offset(fe.NewPath, fe.Descriptor.Info.Size(), p.decompress, p.encoding)
+	if err != nil {
+		log.Errorf("Failed to find the start position, reading file %s from the beginning: %v", fe.NewPath, err)
+		return
+	}
+	if offset == 0 {
+		return
+	}
+
+	log.Infof("Reading file %s from offset %d according to the start position", fe.NewPath, offset)
+	err = s.ResetCursor(src, state{Offset: offset})
+	if err != nil {
+		log.Errorf("setting cursor to the start position: %v", err)
+	}
+}
+
 func (p *fileProspector) onRemove(log *logp.Logger, fe loginp.FSEvent, src loginp.Source, s loginp.StateMetadataUpdater, hg loginp.HarvesterGroup) {
 	if p.stateChangeCloser.Removed {
 		log.Debugf("Stopping harvester as file %s has been removed and close.on_state_change.removed is enabled.", src.Name())
@@ -281,6 +339,16 @@ func (p *fileProspector) onRename(log *logp.Logger, ctx input.Context, fe loginp
 			log.Errorf("Failed to update cursor meta data of entry %s: %v", src.Name(), err)
 		}
 
+		// A file that has been replaced by a compressed copy has the same
+		// fingerprint, but the current harvester still reads the removed
+		// file. Its replacement is read from the offset that has been
+		// reached, which is an offset into the decompressed content.
+		if p.decompress && isCompressedFile(fe.NewPath) {
+			log.Debugf("File %s has been compressed to %s, continue reading the compressed file", fe.OldPath, fe.NewPath)
+			hg.Restart(ctx, src)
+			return
+		}
+
 		if p.stateChangeCloser.Renamed {
 			log.Debugf("Stopping harvester as file %s has been renamed and close.on_state_change.renamed is enabled.", src.Name())
 
@@ -38,12 +38,15 @@ const (
 var experimentalWarning sync.Once
 
 func newProspector(config config) (loginp.Prospector, error) {
-	err := checkConfigCompatibility(config.FileWatcher, config.FileIdentity)
-	if err != nil {
-		return nil, err
+	// network_fs enables fingerprints in the scanner
+	if !config.NetworkFS.Enabled {
+		err := checkConfigCompatibility(config.FileWatcher, config.FileIdentity)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	filewatcher, err := newFileWatcher(config.Paths, config.FileWatcher)
+	filewatcher, err := newFileWatcher(config.Paths, config.FileWatcher, config.Reader.Compression == compressionAuto, config.NetworkFS.Enabled)
 	if err != nil {
 		return nil, fmt.Errorf("error while creating filewatcher %w", err)
 	}
@@ -52,6 +55,14 @@ func newProspector(config config) (loginp.Prospector, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error while creating file identifier: %w", err)
 	}
+	if config.NetworkFS.Enabled && config.FileIdentity == nil {
+		// the fingerprints include the paths of the files
+		identifier, err = newFingerprintIdentifier(nil)
+		if err != nil {
+			return nil, fmt.Errorf("error while creating file identifier: %w", err)
+		}
+		identifier = withSuffix(identifier, config.Reader.Parsers.Suffix)
+	}
 
 	logp.L().
 		With("filestream_id", config.ID).
@@ -64,6 +75,9 @@ func newProspector(config config) (loginp.Prospector, error) {
 		ignoreInactiveSince: config.IgnoreInactive,
 		cleanRemoved:        config.CleanRemoved,
 		stateChangeCloser:   config.Close.OnStateChange,
+		decompress:          config.Reader.Compression == compressionAuto,
+		startPosition:       config.StartPosition,
+		encoding:            config.Reader.Encoding,
 	}
 	if config.Rotation == nil {
 		return &fileprospector, nil
@@ -24,6 +24,7 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -323,6 +324,41 @@ func TestProspectorHarvesterUpdateIgnoredFiles(t *testing.T) {
 	)
 }
 
+func TestProspectorStartPosition(t *testing.T) {
+	dir := t.TempDir()
+	content := "first\nsecond\nthird\n"
+	existingPath := filepath.Join(dir, "existing.log")
+	createdPath := filepath.Join(dir, "created.log")
+	events := make([]loginp.FSEvent, 0, 2)
+	for _, path := range []string{existingPath, createdPath} {
+		err := os.WriteFile(path, []byte(content), 0o600)
+		assert.NoError(t, err)
+		events = append(events, loginp.FSEvent{
+			Op:         loginp.OpCreate,
+			NewPath:    path,
+			Descriptor: createTestFileDescriptorWithInfo(&testFileInfo{path, int64(len(content)), time.Now(), nil}),
+		})
+	}
+
+	filewatcher := newMockFileWatcher(events, len(events))
+	// only the existing file is found on startup
+	filewatcher.filesOnDisk = map[string]loginp.FileDescriptor{existingPath: events[0].Descriptor}
+	p := fileProspector{
+		filewatcher:   filewatcher,
+		identifier:    mustPathIdentifier(false),
+		startPosition: startPositionConfig{From: startFromEnd, Lines: 2},
+	}
+	err := p.Init(newMockProspectorCleaner(nil), newMockProspectorCleaner(nil), func(loginp.Source) string { return "" })
+	assert.NoError(t, err)
+
+	ctx := input.Context{Logger: logp.L(), Cancelation: context.Background()}
+	testStore := newMockMetadataUpdater()
+	p.Run(ctx, testStore, newTestHarvesterGroup())
+
+	assert.True(t, testStore.checkOffset("path::"+existingPath, int64(len("first\n"))), "the last two lines of the existing file must be read")
+	assert.IsType(t, fileMeta{}, testStore.table["path::"+createdPath], "the created file must be read from the beginning")
+}
+
 func TestProspectorDeletedFile(t *testing.T) {
 	testCases := map[string]struct {
 		events       []loginp.FSEvent
@@ -0,0 +1,203 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/text/transform"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
+)
+
+const (
+	startFromBeginning = "beginning"
+	startFromEnd       = "end"
+
+	// startPositionBufferSize must be a multiple of the length of the
+	// encoded line feed of all encodings.
+	startPositionBufferSize = 4096
+)
+
+// startPositionConfig configures where the files which are found when the
+// input starts and have no state in the registry are read from.
+type startPositionConfig struct {
+	// From is either the beginning or the end of the file.
+	From string `config:"from"`
+	// Lines is the number of lines before the end of the file to read.
+	Lines int `config:"lines" validate:"min=0"`
+	// Bytes is the number of bytes before the end of the file to read.
+	Bytes cfgtype.ByteSize `config:"bytes"`
+}
+
+func defaultStartPositionConfig() startPositionConfig {
+	return startPositionConfig{
+		From: startFromBeginning,
+	}
+}
+
+func (c *startPositionConfig) Validate() error {
+	switch c.From {
+	case startFromBeginning:
+		if c.Lines > 0 || c.Bytes > 0 {
+			return fmt.Errorf("start_position.lines and start_position.bytes require start_position.from: %s", startFromEnd)
+		}
+	case startFromEnd:
+		if c.Lines > 0 && c.Bytes > 0 {
+			return errors.New("only one of start_position.lines and start_position.bytes can be set")
+		}
+	default:
+		return fmt.Errorf("invalid start_position.from %q, must be %s or %s", c.From, startFromBeginning, startFromEnd)
+	}
+	return nil
+}
+
+// offset returns the offset the file at path is read from. The lines are
+// found in the file decoded with the encoding encodingName. Compressed files
+// are always read from the beginning if decompress is set.
+func (c startPositionConfig) offset(path string, size int64, decompress bool, encodingName string) (int64, error) {
+	if c.From == startFromBeginning || size == 0 {
+		return 0, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %q to find the start position: %w", path, err)
+	}
+	defer f.Close()
+
+	if decompress {
+		kind, err := detectCompression(f)
+		if err != nil {
+			return 0, err
+		}
+		if kind != uncompressed {
+			return 0, nil
+		}
+	}
+
+	if c.Lines == 0 && c.Bytes == 0 {
+		return size, nil
+	}
+
+	nl, err := encodedLineFeed(f, encodingName)
+	if err != nil {
+		return 0, err
+	}
+	if c.Lines > 0 {
+		return lastLinesOffset(f, size, c.Lines, nl)
+	}
+	return nextLineOffset(f, size, size-min(int64(c.Bytes), size), nl)
+}
+
+// encodedLineFeed returns the line feed encoded with the encoding name of
+// the file f. The encoding is detected from the beginning of f if name is
+// auto.
+func encodedLineFeed(f *os.File, name string) ([]byte, error) {
+	if strings.EqualFold(name, encoding.Auto) {
+		sample := make([]byte, encoding.DetectSampleSize)
+		n, err := f.ReadAt(sample, 0)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read the encoding sample: %w", err)
+		}
+		name, _ = encoding.Detect(sample[:n])
+	}
+
+	factory, ok := encoding.FindEncoding(name)
+	if !ok || factory == nil {
+		return nil, fmt.Errorf("unknown encoding('%v')", name)
+	}
+	enc, err := factory(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize the encoding %v: %w", name, err)
+	}
+	nl, _, err := transform.Bytes(enc.NewEncoder(), []byte{'\n'})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the line feed with %v: %w", name, err)
+	}
+	return nl, nil
+}
+
+// lastLinesOffset returns the offset of the first of the last n lines of r.
+// A last line without a line feed counts as a line. The line feeds nl are
+// only matched at multiples of the length of nl, so that the line feed is
+// not found inside of the code units of multi-byte encodings.
+func lastLinesOffset(r io.ReaderAt, size int64, n int, nl []byte) (int64, error) {
+	buf := make([]byte, startPositionBufferSize)
+	width := len(nl)
+	// an incomplete code unit at the end of the file is ignored
+	size -= size % int64(width)
+	end := size
+	for end > 0 {
+		start := max(end-int64(len(buf)), 0)
+		read, err := r.ReadAt(buf[:end-start], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("failed to read lines before offset %d: %w", end, err)
+		}
+
+		for i := read - read%width - width; i >= 0; i -= width {
+			pos := start + int64(i)
+			// the line feed at the end of the file ends the last line
+			if !bytes.Equal(buf[i:i+width], nl) || pos+int64(width) == size {
+				continue
+			}
+			n--
+			if n == 0 {
+				return pos + int64(width), nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// nextLineOffset returns the offset of the first line of r starting at or
+// after offset, so that no partial line is read. If there is no line
+// starting after offset, offset aligned to the length of the line feed nl
+// is returned.
+func nextLineOffset(r io.ReaderAt, size, offset int64, nl []byte) (int64, error) {
+	width := len(nl)
+	offset -= offset % int64(width)
+	if offset == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, startPositionBufferSize)
+	// the line feed before offset is included to check if a line starts at offset
+	for pos := offset - int64(width); pos < size; pos += int64(len(buf)) {
+		read, err := r.ReadAt(buf, pos)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("failed to read lines after offset %d: %w", pos, err)
+		}
+		for i := 0; i+width <= read; i += width {
+			if bytes.Equal(buf[i:i+width], nl) {
+				return pos + int64(i+width), nil
+			}
+		}
+		if read == 0 {
+			break
+		}
+	}
+	return offset, nil
+}
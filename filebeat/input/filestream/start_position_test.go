@@ -0,0 +1,200 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	xencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	conf "github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestStartPositionConfigValidate(t *testing.T) {
+	testCases := map[string]string{
+		"from: beginning":                 "",
+		"from: end":                       "",
+		"{from: end, lines: 10}":          "",
+		"{from: end, bytes: 1MiB}":        "",
+		"from: middle":                    `invalid start_position.from "middle"`,
+		"lines: 10":                       "start_position.lines and start_position.bytes require start_position.from: end",
+		"{from: end, lines: -1}":          "requires value >= 0",
+		"{from: end, lines: 1, bytes: 1}": "only one of start_position.lines and start_position.bytes can be set",
+	}
+
+	for cfgStr, expErr := range testCases {
+		t.Run(cfgStr, func(t *testing.T) {
+			c, err := conf.NewConfigWithYAML([]byte(cfgStr), cfgStr)
+			require.NoError(t, err)
+
+			sp := defaultStartPositionConfig()
+			err = c.Unpack(&sp)
+			if expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, expErr)
+		})
+	}
+}
+
+func TestLastLinesOffset(t *testing.T) {
+	longLine := strings.Repeat("a", 2*startPositionBufferSize) + "\n"
+	testCases := map[string]struct {
+		content   string
+		lines     int
+		expOffset int
+	}{
+		"last line":                     {content: "first\nsecond\nthird\n", lines: 1, expOffset: 13},
+		"last two lines":                {content: "first\nsecond\nthird\n", lines: 2, expOffset: 6},
+		"more lines than in the file":   {content: "first\nsecond\nthird\n", lines: 10, expOffset: 0},
+		"last line without a line feed": {content: "first\nsecond\nthird", lines: 1, expOffset: 13},
+		"empty last lines":              {content: "first\n\n\n", lines: 2, expOffset: 6},
+		"lines longer than the buffer":  {content: longLine + longLine + longLine, lines: 2, expOffset: len(longLine)},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			offset, err := lastLinesOffset(strings.NewReader(tc.content), int64(len(tc.content)), tc.lines, []byte("\n"))
+			require.NoError(t, err)
+			require.EqualValues(t, tc.expOffset, offset)
+		})
+	}
+}
+
+func TestNextLineOffset(t *testing.T) {
+	longLine := strings.Repeat("a", 2*startPositionBufferSize) + "\n"
+	testCases := map[string]struct {
+		content   string
+		offset    int
+		expOffset int
+	}{
+		"beginning of the file":         {content: "first\nsecond\n", offset: 0, expOffset: 0},
+		"beginning of a line":           {content: "first\nsecond\n", offset: 6, expOffset: 6},
+		"middle of a line":              {content: "first\nsecond\n", offset: 2, expOffset: 6},
+		"middle of the last line":       {content: "first\nsecond\n", offset: 8, expOffset: 13},
+		"no line feed after the offset": {content: "first\nsecond", offset: 8, expOffset: 8},
+		"line longer than the buffer":   {content: longLine + "second\n", offset: 1, expOffset: len(longLine)},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			offset, err := nextLineOffset(strings.NewReader(tc.content), int64(len(tc.content)), int64(tc.offset), []byte("\n"))
+			require.NoError(t, err)
+			require.EqualValues(t, tc.expOffset, offset)
+		})
+	}
+}
+
+func TestStartPositionOffset(t *testing.T) {
+	dir := t.TempDir()
+	content := "first\nsecond\nthird\n"
+	plainPath := filepath.Join(dir, "app.log")
+	gzPath := filepath.Join(dir, "app.log.1.gz")
+	require.NoError(t, os.WriteFile(plainPath, []byte(content), 0o600))
+	require.NoError(t, os.WriteFile(gzPath, gzipBytes(t, content), 0o600))
+
+	testCases := map[string]struct {
+		cfg       startPositionConfig
+		path      string
+		expOffset int
+	}{
+		"beginning":               {cfg: startPositionConfig{From: startFromBeginning}, path: plainPath, expOffset: 0},
+		"end":                     {cfg: startPositionConfig{From: startFromEnd}, path: plainPath, expOffset: len(content)},
+		"last line":               {cfg: startPositionConfig{From: startFromEnd, Lines: 1}, path: plainPath, expOffset: 13},
+		"last bytes":              {cfg: startPositionConfig{From: startFromEnd, Bytes: 10}, path: plainPath, expOffset: 13},
+		"more bytes than in file": {cfg: startPositionConfig{From: startFromEnd, Bytes: 1024}, path: plainPath, expOffset: 0},
+		"compressed file":         {cfg: startPositionConfig{From: startFromEnd}, path: gzPath, expOffset: 0},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fi, err := os.Stat(tc.path)
+			require.NoError(t, err)
+
+			offset, err := tc.cfg.offset(tc.path, fi.Size(), true, "")
+			require.NoError(t, err)
+			require.EqualValues(t, tc.expOffset, offset)
+		})
+	}
+}
+
+func TestStartPositionOffsetUTF16(t *testing.T) {
+	// the second line contains the bytes of a UTF-8 line feed at odd
+	// offsets: U+0A15 is 0x15 0x0a and U+0100 is 0x00 0x01 in UTF-16LE
+	lines := []string{"first\n", "ab\u0a15\u0100cd\n", "third\n"}
+	encodeLines := func(t *testing.T, enc xencoding.Encoding) ([]byte, []int) {
+		var content []byte
+		var offsets []int
+		for _, line := range lines {
+			b, err := enc.NewEncoder().Bytes([]byte(line))
+			require.NoError(t, err)
+			offsets = append(offsets, len(content))
+			content = append(content, b...)
+		}
+		return content, offsets
+	}
+
+	dir := t.TempDir()
+	le, leOffsets := encodeLines(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM))
+	be, beOffsets := encodeLines(t, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM))
+	lePath := filepath.Join(dir, "le.log")
+	bomPath := filepath.Join(dir, "bom.log")
+	bePath := filepath.Join(dir, "be.log")
+	require.NoError(t, os.WriteFile(lePath, le, 0o600))
+	require.NoError(t, os.WriteFile(bomPath, append([]byte{0xff, 0xfe}, le...), 0o600))
+	require.NoError(t, os.WriteFile(bePath, be, 0o600))
+
+	testCases := map[string]struct {
+		cfg       startPositionConfig
+		path      string
+		encoding  string
+		expOffset int
+	}{
+		"last lines":                 {cfg: startPositionConfig{From: startFromEnd, Lines: 2}, path: lePath, encoding: "utf-16le", expOffset: leOffsets[1]},
+		"last lines big endian":      {cfg: startPositionConfig{From: startFromEnd, Lines: 2}, path: bePath, encoding: "utf-16be", expOffset: beOffsets[1]},
+		"last lines with BOM":        {cfg: startPositionConfig{From: startFromEnd, Lines: 2}, path: bomPath, encoding: "utf-16le-bom", expOffset: 2 + leOffsets[1]},
+		"last lines detected":        {cfg: startPositionConfig{From: startFromEnd, Lines: 2}, path: lePath, encoding: "auto", expOffset: leOffsets[1]},
+		"last lines detected by BOM": {cfg: startPositionConfig{From: startFromEnd, Lines: 2}, path: bomPath, encoding: "auto", expOffset: 2 + leOffsets[1]},
+		"last bytes at an odd offset": {
+			cfg:  startPositionConfig{From: startFromEnd, Bytes: cfgtype.ByteSize(len(le) - leOffsets[1] - 3)},
+			path: lePath, encoding: "utf-16le", expOffset: leOffsets[2],
+		},
+		"last bytes detected": {
+			cfg:  startPositionConfig{From: startFromEnd, Bytes: cfgtype.ByteSize(len(le) - leOffsets[1] - 3)},
+			path: lePath, encoding: "auto", expOffset: leOffsets[2],
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fi, err := os.Stat(tc.path)
+			require.NoError(t, err)
+
+			offset, err := tc.cfg.offset(tc.path, fi.Size(), false, tc.encoding)
+			require.NoError(t, err)
+			require.EqualValues(t, tc.expOffset, offset)
+		})
+	}
+}
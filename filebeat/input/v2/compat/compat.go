@@ -99,14 +99,18 @@ func (f *factory) Create(
 		return nil, err
 	}
 
-	return &runner{
+	r := &runner{
 		id:        id,
 		log:       f.log.Named(input.Name()).With("id", id),
 		agent:     &f.info,
 		sig:       ctxtool.WithCancelContext(context.Background()),
 		input:     input,
 		connector: p,
-	}, nil
+	}
+	if _, ok := input.(v2.Updater); ok {
+		return &updatableRunner{r}, nil
+	}
+	return r, nil
 }
 
 func (r *runner) String() string { return r.input.Name() }
@@ -142,6 +146,28 @@ func (r *runner) Stop() {
 	r.log.Infof("Input '%s' stopped (runner)", r.input.Name())
 }
 
+// updatableRunner is a runner whose input implements v2.Updater.
+type updatableRunner struct {
+	*runner
+}
+
+// Update applies config to the input if the ID of the input is unchanged.
+func (r *updatableRunner) Update(config *conf.C) (bool, error) {
+	id, err := configID(config)
+	if err != nil {
+		return false, err
+	}
+	if id != r.id {
+		return false, nil
+	}
+
+	updated, err := r.input.(v2.Updater).Update(config)
+	if updated {
+		r.log.Infof("Input '%s' updated", r.input.Name())
+	}
+	return updated, err
+}
+
 func configID(config *conf.C) (string, error) {
 	tmp := struct {
 		ID string `config:"id"`
@@ -21,6 +21,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/beat"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
 
 	"github.com/elastic/go-concert/unison"
 )
@@ -75,6 +76,14 @@ type Input interface {
 	Run(Context, beat.PipelineConnector) error
 }
 
+// Updater is implemented by inputs which can apply a new configuration while
+// they are running, without being restarted.
+type Updater interface {
+	// Update applies config to the running input. It returns false if the
+	// input must be restarted to apply the configuration.
+	Update(config *conf.C) (bool, error)
+}
+
 // Context provides the Input Run function with common environmental
 // information and services.
 type Context struct {
@@ -90,6 +99,10 @@ type Context struct {
 
 	// Cancelation is used by Beats to signal the input to shutdown.
 	Cancelation Canceler
+
+	// MetricsRegistry is the registry collecting the metrics of the input.
+	// It is nil if the input does not report metrics.
+	MetricsRegistry *monitoring.Registry
 }
 
 // TestContext provides the Input Test function with common environmental
@@ -0,0 +1,341 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package registrytool implements offline inspection and editing of the
+// Filebeat registry. It works on the statestore used by the registrar for
+// the log input, and by the filestream input and the other inputs based
+// on input-logfile or input-cursor.
+//
+// The registry must not be modified while Filebeat is running, as the
+// running instance keeps its own copy of the states and overwrites the
+// changes.
+package registrytool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// logInputPrefix is the key prefix of the states written by the registrar
+// for the log input.
+const logInputPrefix = "filebeat::logs::"
+
+// keySeparator separates the input type, input ID and source identity in
+// the keys written by input-logfile, e.g.
+// "filestream::my-input::native::1234-66305".
+const keySeparator = "::"
+
+// Entry is a single key-value pair of the registry.
+type Entry struct {
+	Key   string   `json:"key"`
+	Value mapstr.M `json:"value"`
+}
+
+// Filter selects registry entries. Empty fields match all entries.
+type Filter struct {
+	// InputType matches the input type, e.g. "filestream" or "log".
+	InputType string
+
+	// InputID matches the ID of the input the entry belongs to.
+	InputID string
+
+	// Source is a glob pattern matched against the path of the file the
+	// entry tracks.
+	Source string
+
+	// Keys matches entries by their exact key.
+	Keys []string
+}
+
+// InputType returns the type of the input that wrote the entry.
+func (e Entry) InputType() string {
+	if strings.HasPrefix(e.Key, logInputPrefix) {
+		return "log"
+	}
+	if parts := strings.SplitN(e.Key, keySeparator, 3); len(parts) == 3 {
+		return parts[0]
+	}
+	return ""
+}
+
+// InputID returns the ID of the input that wrote the entry. Log input
+// entries have no input ID.
+func (e Entry) InputID() string {
+	if strings.HasPrefix(e.Key, logInputPrefix) {
+		return ""
+	}
+	if parts := strings.SplitN(e.Key, keySeparator, 3); len(parts) == 3 {
+		return parts[1]
+	}
+	return ""
+}
+
+// Source returns the path of the file the entry tracks, if known.
+func (e Entry) Source() string {
+	var source interface{}
+	if e.isLogInput() {
+		source, _ = e.Value.GetValue("source")
+	} else {
+		source, _ = e.Value.GetValue("meta.source")
+	}
+	s, _ := source.(string)
+	return s
+}
+
+// Offset returns the offset the input resumes reading the file from.
+func (e Entry) Offset() (int64, bool) {
+	var offset interface{}
+	var err error
+	if e.isLogInput() {
+		offset, err = e.Value.GetValue("offset")
+	} else {
+		offset, err = e.Value.GetValue("cursor.offset")
+	}
+	if err != nil {
+		return 0, false
+	}
+	return toInt64(offset)
+}
+
+// Updated returns the time the entry was last updated, if known.
+func (e Entry) Updated() (time.Time, bool) {
+	field := "updated"
+	if e.isLogInput() {
+		field = "timestamp"
+	}
+	value, err := e.Value.GetValue(field)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var updated time.Time
+	if err := typeconv.Convert(&updated, value); err != nil {
+		return time.Time{}, false
+	}
+	return updated, true
+}
+
+func (e Entry) isLogInput() bool {
+	return strings.HasPrefix(e.Key, logInputPrefix)
+}
+
+// setOffset changes the offset the input resumes reading the file from.
+func (e Entry) setOffset(offset int64) error {
+	field := "cursor.offset"
+	if e.isLogInput() {
+		field = "offset"
+	}
+	if _, err := e.Value.GetValue(field); err != nil {
+		return fmt.Errorf("entry '%v' has no offset", e.Key)
+	}
+	_, err := e.Value.Put(field, offset)
+	return err
+}
+
+// Match returns true if the entry is selected by the filter.
+func (f Filter) Match(e Entry) bool {
+	if len(f.Keys) > 0 && !containsString(f.Keys, e.Key) {
+		return false
+	}
+	if f.InputType != "" && f.InputType != e.InputType() {
+		return false
+	}
+	if f.InputID != "" && f.InputID != e.InputID() {
+		return false
+	}
+	if f.Source != "" {
+		matched, err := filepath.Match(f.Source, e.Source())
+		if err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// IsEmpty returns true if the filter matches all entries.
+func (f Filter) IsEmpty() bool {
+	return f.InputType == "" && f.InputID == "" && f.Source == "" && len(f.Keys) == 0
+}
+
+// List returns the entries matching the filter, sorted by key.
+func List(store *statestore.Store, filter Filter) ([]Entry, error) {
+	if _, err := filepath.Match(filter.Source, ""); err != nil {
+		return nil, fmt.Errorf("invalid source pattern '%v': %w", filter.Source, err)
+	}
+
+	var entries []Entry
+	err := store.Each(func(key string, dec statestore.ValueDecoder) (bool, error) {
+		var value mapstr.M
+		if err := dec.Decode(&value); err != nil {
+			return false, fmt.Errorf("failed to decode entry '%v': %w", key, err)
+		}
+		entry := Entry{Key: key, Value: value}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+// Delete removes the entries matching the filter and returns them.
+func Delete(store *statestore.Store, filter Filter) ([]Entry, error) {
+	entries, err := List(store, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if err := store.Remove(entry.Key); err != nil {
+			return nil, fmt.Errorf("failed to delete entry '%v': %w", entry.Key, err)
+		}
+	}
+	return entries, nil
+}
+
+// ResetOffset sets the offset of the entries matching the filter and
+// returns the updated entries. All matching entries must track a file
+// offset.
+func ResetOffset(store *statestore.Store, filter Filter, offset int64) ([]Entry, error) {
+	if offset < 0 {
+		return nil, errors.New("offset must not be negative")
+	}
+	entries, err := List(store, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if err := entry.setOffset(offset); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range entries {
+		if err := store.Set(entry.Key, entry.Value); err != nil {
+			return nil, fmt.Errorf("failed to update entry '%v': %w", entry.Key, err)
+		}
+	}
+	return entries, nil
+}
+
+// Export writes the entries matching the filter as a JSON array to w.
+func Export(store *statestore.Store, filter Filter, w io.Writer) (int, error) {
+	entries, err := List(store, filter)
+	if err != nil {
+		return 0, err
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(entries); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// Import reads a JSON array of entries, as written by Export, and stores
+// them. Existing entries with the same key are overwritten. Numbers are
+// imported as integers when possible, so large values like inode numbers
+// and offsets don't lose precision.
+func Import(store *statestore.Store, r io.Reader) (int, error) {
+	var entries []Entry
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&entries); err != nil {
+		return 0, fmt.Errorf("failed to read entries: %w", err)
+	}
+	for i, entry := range entries {
+		if entry.Key == "" || entry.Value == nil {
+			return 0, fmt.Errorf("entry %d has no key or value", i)
+		}
+		convertNumbers(map[string]interface{}(entry.Value))
+	}
+	for _, entry := range entries {
+		if err := store.Set(entry.Key, entry.Value); err != nil {
+			return 0, fmt.Errorf("failed to import entry '%v': %w", entry.Key, err)
+		}
+	}
+	return len(entries), nil
+}
+
+// convertNumbers replaces the json.Number values in v with int64, uint64 or
+// float64 values.
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = convertNumbers(elem)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = convertNumbers(elem)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
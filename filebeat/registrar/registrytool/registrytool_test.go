@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package registrytool
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/storetest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type testState struct {
+	TTL     time.Duration
+	Updated time.Time
+	Cursor  interface{}
+	Meta    interface{}
+}
+
+func newTestStore(t *testing.T) *statestore.Store {
+	t.Helper()
+	registry := statestore.NewRegistry(storetest.NewMemoryStoreBackend())
+	store, err := registry.Get("filebeat")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		store.Close()
+		registry.Close()
+	})
+
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	states := map[string]interface{}{
+		"filestream::app::native::1-1": testState{
+			TTL:     -1,
+			Updated: updated,
+			Cursor:  mapstr.M{"offset": 100},
+			Meta:    mapstr.M{"source": "/var/log/app/a.log", "identifier_name": "native"},
+		},
+		"filestream::app::native::1-2": testState{
+			TTL:     -1,
+			Updated: updated,
+			Cursor:  mapstr.M{"offset": 200},
+			Meta:    mapstr.M{"source": "/var/log/app/b.log", "identifier_name": "native"},
+		},
+		"filestream::sys::fingerprint::abcd": testState{
+			TTL:     -1,
+			Updated: updated,
+			Cursor:  mapstr.M{"offset": 300},
+			Meta:    mapstr.M{"source": "/var/log/syslog", "identifier_name": "fingerprint"},
+		},
+		"filebeat::logs::native::1-3-66305": mapstr.M{
+			"source": "/var/log/old.log",
+			"offset": 400,
+			"type":   "log",
+		},
+	}
+	for key, state := range states {
+		require.NoError(t, store.Set(key, state))
+	}
+	return store
+}
+
+func keys(entries []Entry) []string {
+	var result []string
+	for _, e := range entries {
+		result = append(result, e.Key)
+	}
+	return result
+}
+
+func TestEntryFields(t *testing.T) {
+	store := newTestStore(t)
+	entries, err := List(store, Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	log := entries[0]
+	assert.Equal(t, "filebeat::logs::native::1-3-66305", log.Key)
+	assert.Equal(t, "log", log.InputType())
+	assert.Equal(t, "", log.InputID())
+	assert.Equal(t, "/var/log/old.log", log.Source())
+	offset, ok := log.Offset()
+	assert.True(t, ok)
+	assert.Equal(t, int64(400), offset)
+
+	fs := entries[1]
+	assert.Equal(t, "filestream::app::native::1-1", fs.Key)
+	assert.Equal(t, "filestream", fs.InputType())
+	assert.Equal(t, "app", fs.InputID())
+	assert.Equal(t, "/var/log/app/a.log", fs.Source())
+	offset, ok = fs.Offset()
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), offset)
+	updated, ok := fs.Updated()
+	assert.True(t, ok)
+	assert.True(t, updated.Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestListFilter(t *testing.T) {
+	store := newTestStore(t)
+
+	tests := map[string]struct {
+		filter   Filter
+		expected []string
+	}{
+		"input id": {
+			filter:   Filter{InputID: "app"},
+			expected: []string{"filestream::app::native::1-1", "filestream::app::native::1-2"},
+		},
+		"input type": {
+			filter:   Filter{InputType: "log"},
+			expected: []string{"filebeat::logs::native::1-3-66305"},
+		},
+		"source glob": {
+			filter:   Filter{Source: "/var/log/app/*"},
+			expected: []string{"filestream::app::native::1-1", "filestream::app::native::1-2"},
+		},
+		"source path": {
+			filter:   Filter{Source: "/var/log/syslog"},
+			expected: []string{"filestream::sys::fingerprint::abcd"},
+		},
+		"keys and input id": {
+			filter:   Filter{InputID: "app", Keys: []string{"filestream::app::native::1-2", "filestream::sys::fingerprint::abcd"}},
+			expected: []string{"filestream::app::native::1-2"},
+		},
+		"no match": {
+			filter: Filter{InputID: "unknown"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			entries, err := List(store, tc.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, keys(entries))
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	store := newTestStore(t)
+	deleted, err := Delete(store, Filter{InputID: "app"})
+	require.NoError(t, err)
+	assert.Len(t, deleted, 2)
+
+	entries, err := List(store, Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"filebeat::logs::native::1-3-66305", "filestream::sys::fingerprint::abcd"}, keys(entries))
+}
+
+func TestResetOffset(t *testing.T) {
+	store := newTestStore(t)
+	updated, err := ResetOffset(store, Filter{Source: "/var/log/*"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"filebeat::logs::native::1-3-66305", "filestream::sys::fingerprint::abcd"}, keys(updated))
+
+	entries, err := List(store, Filter{})
+	require.NoError(t, err)
+	offsets := map[string]int64{}
+	for _, e := range entries {
+		offsets[e.Key], _ = e.Offset()
+	}
+	assert.Equal(t, map[string]int64{
+		"filebeat::logs::native::1-3-66305":  0,
+		"filestream::app::native::1-1":       100,
+		"filestream::app::native::1-2":       200,
+		"filestream::sys::fingerprint::abcd": 0,
+	}, offsets)
+
+	// The filestream input must still be able to read the updated cursor.
+	var st testState
+	require.NoError(t, store.Get("filestream::sys::fingerprint::abcd", &st))
+	assert.Equal(t, "/var/log/syslog", st.Meta.(map[string]interface{})["source"])
+}
+
+func TestExportImport(t *testing.T) {
+	store := newTestStore(t)
+	var buf bytes.Buffer
+	n, err := Export(store, Filter{InputID: "app"}, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	_, err = Delete(store, Filter{InputID: "app"})
+	require.NoError(t, err)
+
+	n, err = Import(store, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	entries, err := List(store, Filter{InputID: "app"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	offset, _ := entries[1].Offset()
+	assert.Equal(t, int64(200), offset)
+	assert.Equal(t, "/var/log/app/b.log", entries[1].Source())
+}
+
+func TestExportImportLargeNumbers(t *testing.T) {
+	store := newTestStore(t)
+	key := "filestream::big::native::9007199254740993-66305"
+	require.NoError(t, store.Set(key, testState{
+		TTL:    -1,
+		Cursor: mapstr.M{"offset": int64(1<<53 + 1)},
+		Meta:   mapstr.M{"source": "/var/log/big.log", "identifier_name": "native"},
+	}))
+	require.NoError(t, store.Set("filebeat::logs::native::18446744073709551557-66305", mapstr.M{
+		"source":      "/var/log/old-big.log",
+		"offset":      int64(1<<53 + 1),
+		"FileStateOS": mapstr.M{"inode": uint64(18446744073709551557), "device": uint64(66305)},
+	}))
+
+	var buf bytes.Buffer
+	_, err := Export(store, Filter{}, &buf)
+	require.NoError(t, err)
+	before, err := List(store, Filter{})
+	require.NoError(t, err)
+
+	_, err = Delete(store, Filter{})
+	require.NoError(t, err)
+	_, err = Import(store, &buf)
+	require.NoError(t, err)
+
+	after, err := List(store, Filter{})
+	require.NoError(t, err)
+	require.Equal(t, keys(before), keys(after))
+	for i := range before {
+		offset, _ := after[i].Offset()
+		expected, _ := before[i].Offset()
+		assert.Equal(t, expected, offset, after[i].Key)
+	}
+
+	var st mapstr.M
+	require.NoError(t, store.Get("filebeat::logs::native::18446744073709551557-66305", &st))
+	inode, err := st.GetValue("FileStateOS.inode")
+	require.NoError(t, err)
+	assert.EqualValues(t, uint64(18446744073709551557), inode)
+}
+
+func TestImportInvalid(t *testing.T) {
+	store := newTestStore(t)
+	_, err := Import(store, bytes.NewBufferString(`[{"key": "a"}]`))
+	assert.ErrorContains(t, err, "has no key or value")
+}
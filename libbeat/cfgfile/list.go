@@ -37,6 +37,7 @@ import (
 // RunnerList implements a reloadable.List of Runners
 type RunnerList struct {
 	runners  map[uint64]Runner
+	ids      map[uint64]string
 	mutex    sync.RWMutex
 	factory  RunnerFactory
 	pipeline beat.PipelineConnector
@@ -47,6 +48,7 @@ type RunnerList struct {
 func NewRunnerList(name string, factory RunnerFactory, pipeline beat.PipelineConnector) *RunnerList {
 	return &RunnerList{
 		runners:  map[uint64]Runner{},
+		ids:      map[uint64]string{},
 		factory:  factory,
 		pipeline: pipeline,
 		logger:   logp.NewLogger(name),
@@ -78,6 +80,9 @@ func (r *RunnerList) Runners() []Runner {
 //
 // The starting of runners occurs synchronously, one after the other.
 //
+// Runners implementing Updater are updated in place if their configuration
+// is replaced by a configuration with the same ID.
+//
 // It is recommended not to call this method more than once per second to avoid
 // unnecessary starting and stopping of runners.
 func (r *RunnerList) Reload(configs []*reload.ConfigWithMeta) error {
@@ -107,6 +112,12 @@ func (r *RunnerList) Reload(configs []*reload.ConfigWithMeta) error {
 		}
 	}
 
+	for hash, config := range startList {
+		if r.update(hash, config, stopList) {
+			delete(startList, hash)
+		}
+	}
+
 	r.logger.Debugf("Start list: %d, Stop list: %d", len(startList), len(stopList))
 
 	wg := sync.WaitGroup{}
@@ -115,6 +126,7 @@ func (r *RunnerList) Reload(configs []*reload.ConfigWithMeta) error {
 		wg.Add(1)
 		r.logger.Debugf("Stopping runner: %s", runner)
 		delete(r.runners, hash)
+		delete(r.ids, hash)
 		go func(runner Runner) {
 			defer wg.Done()
 			runner.Stop()
@@ -153,6 +165,7 @@ func (r *RunnerList) Reload(configs []*reload.ConfigWithMeta) error {
 
 		r.logger.Debugf("Starting runner: %s", runner)
 		r.runners[hash] = runner
+		r.ids[hash] = runnerID(config.Config)
 		runner.Start()
 		moduleStarts.Add(1)
 		if config.DiagCallback != nil {
@@ -176,6 +189,48 @@ func (r *RunnerList) Reload(configs []*reload.ConfigWithMeta) error {
 	return errs.Err()
 }
 
+// update applies config to the runner with the same ID in stopList if it
+// implements Updater. An updated runner keeps running and is removed from
+// stopList.
+func (r *RunnerList) update(hash uint64, cfg *reload.ConfigWithMeta, stopList map[uint64]Runner) bool {
+	id := runnerID(cfg.Config)
+	if id == "" {
+		return false
+	}
+
+	for oldHash, runner := range stopList {
+		if r.ids[oldHash] != id {
+			continue
+		}
+
+		updater, ok := runner.(Updater)
+		if !ok {
+			return false
+		}
+
+		// Pass a copy of the config like createRunner does
+		c, _ := config.NewConfigFrom(cfg.Config)
+		updated, err := updater.Update(c)
+		if err != nil {
+			r.logger.Errorf("Error updating runner %s, restarting it: %s", runner, err)
+			return false
+		}
+		if !updated {
+			return false
+		}
+
+		r.logger.Debugf("Runner %s has been updated", runner)
+		delete(stopList, oldHash)
+		delete(r.runners, oldHash)
+		delete(r.ids, oldHash)
+		r.runners[hash] = runner
+		r.ids[hash] = id
+		moduleUpdates.Add(1)
+		return true
+	}
+	return false
+}
+
 // Stop all runners
 func (r *RunnerList) Stop() {
 	r.mutex.Lock()
@@ -192,6 +247,7 @@ func (r *RunnerList) Stop() {
 		wg.Add(1)
 
 		delete(r.runners, hash)
+		delete(r.ids, hash)
 
 		// Stop modules in parallel
 		go func(h uint64, run Runner) {
@@ -222,6 +278,18 @@ func HashConfig(c *config.C) (uint64, error) {
 	return hashstructure.Hash(config, nil)
 }
 
+// runnerID returns the ID from the configuration of a runner, it is empty
+// if no ID is configured.
+func runnerID(c *config.C) string {
+	tmp := struct {
+		ID string `config:"id"`
+	}{}
+	if err := c.Unpack(&tmp); err != nil {
+		return ""
+	}
+	return tmp.ID
+}
+
 func (r *RunnerList) copyRunnerList() map[uint64]Runner {
 	list := make(map[uint64]Runner, len(r.runners))
 	for k, v := range r.runners {
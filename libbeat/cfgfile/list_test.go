@@ -67,6 +67,17 @@ func (r *runner) Diagnostics() []diagnostics.DiagnosticSetup {
 	}
 }
 
+type updatableRunner struct {
+	runner
+	updated bool
+	configs []*conf.C
+}
+
+func (r *updatableRunner) Update(c *conf.C) (bool, error) {
+	r.configs = append(r.configs, c)
+	return r.updated, nil
+}
+
 type runnerFactory struct {
 	CreateRunner func(beat.PipelineConnector, *conf.C) (Runner, error)
 	runners      []Runner
@@ -237,6 +248,67 @@ func TestReloadStartStopConfigs(t *testing.T) {
 	assert.NotEqual(t, state, list.copyRunnerList())
 }
 
+func TestReloadUpdatesRunners(t *testing.T) {
+	createConfigWithValue := func(id int64, value string) *reload.ConfigWithMeta {
+		c := createConfig(id)
+		_ = c.Config.SetString("value", -1, value)
+		return c
+	}
+
+	for name, updated := range map[string]bool{"updated": true, "not updated": false} {
+		t.Run(name, func(t *testing.T) {
+			factory := &runnerFactory{
+				CreateRunner: func(_ beat.PipelineConnector, c *conf.C) (Runner, error) {
+					id, err := c.Int("id", -1)
+					if err != nil {
+						return nil, err
+					}
+					return &updatableRunner{runner: runner{id: id}, updated: updated}, nil
+				},
+			}
+			list := NewRunnerList("", factory, nil)
+
+			err := list.Reload([]*reload.ConfigWithMeta{
+				createConfigWithValue(1, "a"),
+				createConfigWithValue(2, "a"),
+			})
+			require.NoError(t, err)
+			require.Len(t, factory.runners, 2)
+
+			// the runner with ID 1 gets a new configuration
+			newConfig := createConfigWithValue(1, "b")
+			err = list.Reload([]*reload.ConfigWithMeta{
+				newConfig,
+				createConfigWithValue(2, "a"),
+			})
+			require.NoError(t, err)
+
+			runners := map[int64]*updatableRunner{}
+			for _, r := range factory.runners[:2] {
+				runners[r.(*updatableRunner).id] = r.(*updatableRunner)
+			}
+			first := runners[1]
+			require.Len(t, first.configs, 1)
+			value, err := first.configs[0].String("value", -1)
+			require.NoError(t, err)
+			assert.Equal(t, "b", value)
+			assert.Empty(t, runners[2].configs)
+
+			hash, err := HashConfig(newConfig.Config)
+			require.NoError(t, err)
+			assert.True(t, list.Has(hash))
+			assert.Len(t, list.copyRunnerList(), 2)
+			if updated {
+				assert.False(t, first.stopped)
+				assert.Len(t, factory.runners, 2)
+			} else {
+				assert.True(t, first.stopped)
+				assert.Len(t, factory.runners, 3)
+			}
+		})
+	}
+}
+
 func TestStopAll(t *testing.T) {
 	factory := &runnerFactory{}
 	list := NewRunnerList("", factory, nil)
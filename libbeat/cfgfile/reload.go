@@ -51,6 +51,7 @@ var (
 	configReloads = monitoring.NewInt(nil, "libbeat.config.reloads")
 	moduleStarts  = monitoring.NewInt(nil, "libbeat.config.module.starts")
 	moduleStops   = monitoring.NewInt(nil, "libbeat.config.module.stops")
+	moduleUpdates = monitoring.NewInt(nil, "libbeat.config.module.updates")
 	moduleRunning = monitoring.NewInt(nil, "libbeat.config.module.running") // Number of modules in the runner list (not necessarily in the running state).
 )
 
@@ -94,6 +95,14 @@ type Runner interface {
 	Stop()
 }
 
+// Updater is implemented by Runners which can apply a new configuration
+// while they are running, without being stopped and started again.
+type Updater interface {
+	// Update applies config to the running Runner. It returns false if
+	// the configuration can only be applied by restarting the Runner.
+	Update(config *config.C) (bool, error)
+}
+
 // Reloader is used to register and reload modules
 type Reloader struct {
 	pipeline beat.PipelineConnector
@@ -67,6 +67,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
 	"github.com/elastic/beats/v7/libbeat/version"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/file"
@@ -1552,15 +1553,20 @@ func (bc *beatConfig) Validate() error {
 			return fmt.Errorf("top level queue and output level queue settings defined, only one is allowed")
 		}
 		// elastic-agent doesn't support disk queue yet
-		if bc.Management.Enabled() && outputPC.Queue.Config().Enabled() && outputPC.Queue.Name() == diskqueue.QueueType {
-			return fmt.Errorf("disk queue is not supported when management is enabled")
+		if bc.Management.Enabled() && outputPC.Queue.Config().Enabled() && usesDiskQueue(outputPC.Queue.Name()) {
+			return fmt.Errorf("%s queue is not supported when management is enabled", outputPC.Queue.Name())
 		}
 	}
 
 	// elastic-agent doesn't support disk queue yet
-	if bc.Management.Enabled() && bc.Pipeline.Queue.Config().Enabled() && bc.Pipeline.Queue.Name() == diskqueue.QueueType {
-		return fmt.Errorf("disk queue is not supported when management is enabled")
+	if bc.Management.Enabled() && bc.Pipeline.Queue.Config().Enabled() && usesDiskQueue(bc.Pipeline.Queue.Name()) {
+		return fmt.Errorf("%s queue is not supported when management is enabled", bc.Pipeline.Queue.Name())
 	}
 
 	return nil
 }
+
+// usesDiskQueue returns true if the queue type stores events on disk.
+func usesDiskQueue(queueType string) bool {
+	return queueType == diskqueue.QueueType || queueType == hybridqueue.QueueType
+}
@@ -0,0 +1,207 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GenericSchema is the Avro schema used to encode events if no schema has been
+// configured. Event metadata and fields are encoded as maps of a recursive
+// Value record, which can represent any JSON-like document.
+const GenericSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "co.elastic.beats",
+  "fields": [
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "metadata", "type": {"type": "map", "values": {
+      "type": "record",
+      "name": "Value",
+      "fields": [
+        {"name": "value", "type": [
+          "null",
+          "boolean",
+          "long",
+          "double",
+          "string",
+          "bytes",
+          {"type": "array", "items": "Value"},
+          {"type": "map", "values": "Value"}
+        ]}
+      ]
+    }}},
+    {"name": "fields", "type": {"type": "map", "values": "Value"}}
+  ]
+}`
+
+// anyBranches mirrors the union of the Value record in GenericSchema.
+var anyBranches = []*schema{
+	{typ: "null"},
+	{typ: "boolean"},
+	{typ: "long"},
+	{typ: "double"},
+	{typ: "string"},
+	{typ: "bytes"},
+	{typ: "array", items: anyValue},
+	{typ: "map", values: anyValue},
+}
+
+const anyStringBranch = 4
+
+var anyValue = &schema{typ: "any"}
+
+var genericSchema = &schema{
+	typ:  "record",
+	name: "co.elastic.beats.Event",
+	fields: []field{
+		{name: "timestamp", path: "timestamp", typ: &schema{typ: "long", logical: "timestamp-millis"}},
+		{name: "metadata", path: "metadata", typ: &schema{typ: "map", values: anyValue}},
+		{name: "fields", path: "fields", typ: &schema{typ: "map", values: anyValue}},
+	},
+}
+
+// confluentMagicByte prefixes messages using the schema registry wire format.
+const confluentMagicByte = 0
+
+// Encoder serializes a beat.Event using the Avro binary encoding.
+type Encoder struct {
+	enc encoder
+
+	version  string
+	schema   *schema
+	generic  bool
+	schemaID *uint32
+}
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	// Schema is an inline Avro schema in JSON format.
+	Schema string `config:"schema"`
+
+	// SchemaFile points to a file containing the Avro schema in JSON format.
+	SchemaFile string `config:"schema_file"`
+
+	// SchemaID enables the schema registry wire format. Each message is
+	// prefixed with a magic byte and the 4 byte schema ID.
+	SchemaID *uint32 `config:"schema_id"`
+}
+
+func (c *Config) Validate() error {
+	if c.Schema != "" && c.SchemaFile != "" {
+		return errors.New("only one of schema and schema_file can be configured")
+	}
+	return nil
+}
+
+func init() {
+	codec.RegisterType("avro", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := Config{}
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		return New(info.Version, config)
+	})
+}
+
+// New creates a new avro Encoder. If no schema is configured, events are
+// encoded using GenericSchema.
+func New(version string, config Config) (*Encoder, error) {
+	e := &Encoder{version: version, schemaID: config.SchemaID}
+
+	raw := []byte(config.Schema)
+	if config.SchemaFile != "" {
+		var err error
+		if raw, err = os.ReadFile(config.SchemaFile); err != nil {
+			return nil, fmt.Errorf("failed to read avro schema file: %w", err)
+		}
+	}
+
+	if len(raw) == 0 {
+		e.schema, e.generic = genericSchema, true
+		return e, nil
+	}
+
+	s, err := parseSchema(raw)
+	if err != nil {
+		return nil, err
+	}
+	if s.typ != "record" {
+		return nil, fmt.Errorf("avro schema must be a record, got '%v'", s.typ)
+	}
+	e.schema = s
+	return e, nil
+}
+
+// Encode serializes a beat event to Avro. When a schema is configured, record
+// fields are resolved against the event as it would be serialized to JSON,
+// including the `@timestamp` and `@metadata` fields.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	e.enc.buf = e.enc.buf[:0]
+	if e.schemaID != nil {
+		e.enc.buf = append(e.enc.buf, confluentMagicByte)
+		e.enc.buf = binary.BigEndian.AppendUint32(e.enc.buf, *e.schemaID)
+	}
+
+	if err := e.enc.encode(e.schema, e.makeDocument(index, event)); err != nil {
+		return nil, err
+	}
+	return e.enc.buf, nil
+}
+
+func (e *Encoder) makeDocument(index string, event *beat.Event) mapstr.M {
+	meta := mapstr.M{
+		"beat":    index,
+		"type":    "_doc",
+		"version": e.version,
+	}
+	for k, v := range event.Meta {
+		meta[k] = v
+	}
+
+	if e.generic {
+		fields := event.Fields
+		if fields == nil {
+			fields = mapstr.M{}
+		}
+		return mapstr.M{
+			"timestamp": event.Timestamp,
+			"metadata":  meta,
+			"fields":    fields,
+		}
+	}
+
+	doc := make(mapstr.M, len(event.Fields)+2)
+	for k, v := range event.Fields {
+		doc[k] = v
+	}
+	doc["@timestamp"] = event.Timestamp
+	doc["@metadata"] = meta
+	return doc
+}
@@ -0,0 +1,183 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const testSchema = `{
+  "type": "record",
+  "name": "Log",
+  "namespace": "test",
+  "fields": [
+    {"name": "timestamp", "field": "@timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "message", "type": "string"},
+    {"name": "host", "field": "host.name", "type": ["null", "string"]},
+    {"name": "level", "type": {"type": "enum", "name": "Level", "symbols": ["debug", "info", "error"]}, "default": "info"},
+    {"name": "tags", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "size", "type": "int", "default": 0}
+  ]
+}`
+
+func TestAvroCodec(t *testing.T) {
+	ts := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	cases := map[string]struct {
+		fields   mapstr.M
+		expected []byte
+	}{
+		"all fields": {
+			fields: mapstr.M{
+				"message": "hello",
+				"host":    mapstr.M{"name": "h1"},
+				"level":   "error",
+				"tags":    []string{"a", "b"},
+				"size":    uint64(42),
+			},
+			expected: concat(
+				varint(ts.UnixMilli()),
+				str("hello"),
+				varint(1), str("h1"),
+				varint(2),
+				varint(2), str("a"), str("b"), varint(0),
+				varint(42),
+			),
+		},
+		"defaults and nulls": {
+			fields: mapstr.M{"message": "hello"},
+			expected: concat(
+				varint(ts.UnixMilli()),
+				str("hello"),
+				varint(0),
+				varint(1),
+				varint(0),
+				varint(0),
+			),
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			codec, err := New("1.2.3", Config{Schema: testSchema})
+			require.NoError(t, err)
+
+			actual, err := codec.Encode("test", &beat.Event{Timestamp: ts, Fields: test.fields})
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestAvroCodecErrors(t *testing.T) {
+	codec, err := New("1.2.3", Config{Schema: testSchema})
+	require.NoError(t, err)
+
+	cases := map[string]mapstr.M{
+		"missing required field": {"host": mapstr.M{"name": "h1"}},
+		"wrong type":             {"message": 42},
+		"unknown enum symbol":    {"message": "hello", "level": "fatal"},
+		"int overflow":           {"message": "hello", "size": int64(1) << 40},
+	}
+
+	for name, fields := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := codec.Encode("test", &beat.Event{Fields: fields})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAvroSchemaRegistryFraming(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "schema.avsc")
+	require.NoError(t, os.WriteFile(path, []byte(testSchema), 0o600))
+
+	id := uint32(7)
+	codec, err := New("1.2.3", Config{SchemaFile: path, SchemaID: &id})
+	require.NoError(t, err)
+
+	actual, err := codec.Encode("test", &beat.Event{Fields: mapstr.M{"message": "hello"}})
+	require.NoError(t, err)
+	require.Greater(t, len(actual), 5)
+	assert.Equal(t, byte(0), actual[0])
+	assert.Equal(t, id, binary.BigEndian.Uint32(actual[1:5]))
+}
+
+func TestAvroGenericSchema(t *testing.T) {
+	_, err := parseSchema([]byte(GenericSchema))
+	require.NoError(t, err)
+
+	codec, err := New("1.2.3", Config{})
+	require.NoError(t, err)
+
+	ts := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	actual, err := codec.Encode("test", &beat.Event{
+		Timestamp: ts,
+		Fields:    mapstr.M{"n": 1, "list": []interface{}{true, 1.5}},
+		Meta:      mapstr.M{"pipeline": "p"},
+	})
+	require.NoError(t, err)
+
+	// Only the timestamp can be checked byte-wise, as map iteration order
+	// is random.
+	assert.Equal(t, varint(ts.UnixMilli()), actual[:len(varint(ts.UnixMilli()))])
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	cases := map[string]string{
+		"invalid json":     `{`,
+		"unknown type":     `{"type": "record", "name": "r", "fields": [{"name": "a", "type": "foo"}]}`,
+		"nested union":     `["null", ["string"]]`,
+		"duplicate name":   `{"type": "record", "name": "r", "fields": [{"name": "a", "type": {"type": "record", "name": "r", "fields": []}}]}`,
+		"enum w/o symbols": `{"type": "enum", "name": "e", "symbols": []}`,
+	}
+
+	for name, raw := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSchema([]byte(raw))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func varint(i int64) []byte {
+	return binary.AppendVarint(nil, i)
+}
+
+func str(s string) []byte {
+	return append(varint(int64(len(s))), s...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
@@ -0,0 +1,374 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// encoder appends the Avro binary encoding of event values to a buffer.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) encode(s *schema, v interface{}) error {
+	v = normalize(v)
+
+	switch s.typ {
+	case "null":
+		if v != nil {
+			return typeError(s, v)
+		}
+		return nil
+
+	case "boolean":
+		b, ok := v.(bool)
+		if !ok {
+			return typeError(s, v)
+		}
+		if b {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+		return nil
+
+	case "int", "long":
+		i, ok := toLong(s, v)
+		if !ok {
+			return typeError(s, v)
+		}
+		if s.typ == "int" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return fmt.Errorf("value %v overflows avro int", i)
+		}
+		e.writeLong(i)
+		return nil
+
+	case "float":
+		f, ok := toDouble(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(float32(f)))
+		return nil
+
+	case "double":
+		f, ok := toDouble(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+		return nil
+
+	case "string", "bytes":
+		b, ok := toBytes(v)
+		if !ok {
+			return typeError(s, v)
+		}
+		e.writeLong(int64(len(b)))
+		e.buf = append(e.buf, b...)
+		return nil
+
+	case "fixed":
+		b, ok := toBytes(v)
+		if !ok || len(b) != s.size {
+			return typeError(s, v)
+		}
+		e.buf = append(e.buf, b...)
+		return nil
+
+	case "enum":
+		str, ok := v.(string)
+		if !ok {
+			return typeError(s, v)
+		}
+		for i, sym := range s.symbols {
+			if sym == str {
+				e.writeLong(int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("'%v' is not a symbol of enum '%v'", str, s.name)
+
+	case "array":
+		return e.encodeArray(s, v)
+
+	case "map":
+		m, ok := v.(mapstr.M)
+		if !ok {
+			return typeError(s, v)
+		}
+		if len(m) > 0 {
+			e.writeLong(int64(len(m)))
+			for k, val := range m {
+				e.writeLong(int64(len(k)))
+				e.buf = append(e.buf, k...)
+				if err := e.encode(s.values, val); err != nil {
+					return fmt.Errorf("%v: %w", k, err)
+				}
+			}
+		}
+		e.writeLong(0)
+		return nil
+
+	case "record":
+		m, ok := v.(mapstr.M)
+		if !ok {
+			return typeError(s, v)
+		}
+		return e.encodeRecord(s, m)
+
+	case "any":
+		return e.encodeAny(v)
+
+	case "union":
+		for i, branch := range s.union {
+			if matches(branch, v) {
+				e.writeLong(int64(i))
+				return e.encode(branch, v)
+			}
+		}
+		return typeError(s, v)
+	}
+
+	return fmt.Errorf("unsupported avro type '%v'", s.typ)
+}
+
+func (e *encoder) encodeRecord(s *schema, m mapstr.M) error {
+	for _, f := range s.fields {
+		val, err := m.GetValue(f.path)
+		if err != nil {
+			switch {
+			case f.hasDefault:
+				val = f.def
+			case matches(f.typ, nil):
+				val = nil
+			default:
+				return fmt.Errorf("missing required field '%v' in record '%v'", f.path, s.name)
+			}
+		}
+		if err := e.encode(f.typ, val); err != nil {
+			return fmt.Errorf("%v: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+func (e *encoder) encodeArray(s *schema, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if v == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+		return typeError(s, v)
+	}
+
+	if n := rv.Len(); n > 0 {
+		e.writeLong(int64(n))
+		for i := 0; i < n; i++ {
+			if err := e.encode(s.items, rv.Index(i).Interface()); err != nil {
+				return fmt.Errorf("[%v]: %w", i, err)
+			}
+		}
+	}
+	e.writeLong(0)
+	return nil
+}
+
+// encodeAny encodes a value of unknown type. The encoding is compatible with
+// the recursive Value record defined in GenericSchema.
+func (e *encoder) encodeAny(v interface{}) error {
+	v = normalize(v)
+	for i, branch := range anyBranches {
+		if matches(branch, v) {
+			e.writeLong(int64(i))
+			return e.encode(branch, v)
+		}
+	}
+
+	// Fall back to the string representation for types not supported by
+	// the generic schema.
+	e.writeLong(anyStringBranch)
+	return e.encode(anyBranches[anyStringBranch], fmt.Sprint(v))
+}
+
+func (e *encoder) writeLong(i int64) {
+	e.buf = binary.AppendVarint(e.buf, i)
+}
+
+// matches checks if the value can be encoded using the given schema. It is
+// used to select the branch when encoding unions.
+func matches(s *schema, v interface{}) bool {
+	v = normalize(v)
+
+	switch s.typ {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "int", "long":
+		_, ok := toLong(s, v)
+		if _, isFloat := v.(float64); isFloat {
+			return false
+		}
+		return ok
+	case "float", "double":
+		_, ok := toDouble(v)
+		return ok
+	case "string":
+		switch v.(type) {
+		case string, time.Time:
+			return true
+		}
+		return false
+	case "bytes":
+		_, ok := v.([]byte)
+		return ok
+	case "fixed":
+		b, ok := v.([]byte)
+		return ok && len(b) == s.size
+	case "enum":
+		str, ok := v.(string)
+		if !ok {
+			return false
+		}
+		for _, sym := range s.symbols {
+			if sym == str {
+				return true
+			}
+		}
+		return false
+	case "array":
+		if v == nil {
+			return false
+		}
+		if _, isBytes := v.([]byte); isBytes {
+			return false
+		}
+		k := reflect.TypeOf(v).Kind()
+		return k == reflect.Slice || k == reflect.Array
+	case "map", "record":
+		_, ok := v.(mapstr.M)
+		return ok
+	case "union":
+		for _, branch := range s.union {
+			if matches(branch, v) {
+				return true
+			}
+		}
+		return false
+	case "any":
+		return true
+	}
+	return false
+}
+
+// normalize converts event values to the small set of types handled by the
+// encoder.
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case mapstr.M, time.Time:
+		return v
+	case map[string]interface{}:
+		return mapstr.M(val)
+	case common.Time:
+		return time.Time(val)
+	case *time.Time:
+		if val == nil {
+			return nil
+		}
+		return *val
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case fmt.Stringer:
+		return val.String()
+	}
+	return v
+}
+
+func toLong(s *schema, v interface{}) (int64, bool) {
+	if t, ok := v.(time.Time); ok {
+		switch s.logical {
+		case "timestamp-millis":
+			return t.UnixMilli(), true
+		case "timestamp-micros":
+			return t.UnixMicro(), true
+		case "date":
+			return t.Unix() / 86400, true
+		}
+		return 0, false
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(u), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) {
+			return 0, false
+		}
+		return int64(f), true
+	}
+	return 0, false
+}
+
+func toDouble(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func toBytes(v interface{}) ([]byte, bool) {
+	switch val := v.(type) {
+	case string:
+		return []byte(val), true
+	case []byte:
+		return val, true
+	case time.Time:
+		return []byte(val.UTC().Format(time.RFC3339Nano)), true
+	}
+	return nil, false
+}
+
+func typeError(s *schema, v interface{}) error {
+	return fmt.Errorf("value of type %T can not be encoded as avro %v", v, s.typ)
+}
@@ -0,0 +1,255 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// schema is a parsed Avro schema node. Only the attributes relevant for
+// binary encoding are kept.
+type schema struct {
+	typ     string
+	name    string
+	logical string
+
+	fields  []field   // record
+	symbols []string  // enum
+	size    int       // fixed
+	items   *schema   // array
+	values  *schema   // map
+	union   []*schema // union
+}
+
+// field is a single record field. The event value is looked up by path, which
+// defaults to the field name, but can be overwritten via the non-standard
+// `field` attribute. This allows Avro compliant field names to be mapped to
+// event keys like `@timestamp` or `host.name`.
+type field struct {
+	name       string
+	path       string
+	typ        *schema
+	hasDefault bool
+	def        interface{}
+}
+
+var primitiveTypes = map[string]bool{
+	"null":    true,
+	"boolean": true,
+	"int":     true,
+	"long":    true,
+	"float":   true,
+	"double":  true,
+	"bytes":   true,
+	"string":  true,
+}
+
+type schemaParser struct {
+	named map[string]*schema
+}
+
+// parseSchema parses an Avro schema in its JSON representation.
+func parseSchema(raw []byte) (*schema, error) {
+	var def interface{}
+	if err := json.Unmarshal(raw, &def); err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+
+	p := &schemaParser{named: map[string]*schema{}}
+	s, err := p.parse(def, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parse(def interface{}, namespace string) (*schema, error) {
+	switch v := def.(type) {
+	case string:
+		if primitiveTypes[v] {
+			return &schema{typ: v}, nil
+		}
+		if s := p.lookup(v, namespace); s != nil {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type '%v'", v)
+
+	case []interface{}:
+		s := &schema{typ: "union"}
+		for _, branch := range v {
+			b, err := p.parse(branch, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if b.typ == "union" {
+				return nil, errors.New("unions must not contain other unions")
+			}
+			s.union = append(s.union, b)
+		}
+		return s, nil
+
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+
+	default:
+		return nil, fmt.Errorf("unexpected schema definition %v", def)
+	}
+}
+
+func (p *schemaParser) parseComplex(def map[string]interface{}, namespace string) (*schema, error) {
+	typ, _ := def["type"].(string)
+	logical, _ := def["logicalType"].(string)
+
+	switch typ {
+	case "record", "error":
+		s := &schema{typ: "record"}
+		if err := p.register(s, def, namespace); err != nil {
+			return nil, err
+		}
+		namespace = namespaceOf(s.name)
+
+		fields, ok := def["fields"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record '%v' is missing fields", s.name)
+		}
+		for _, raw := range fields {
+			fdef, ok := raw.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid field definition in record '%v'", s.name)
+			}
+			f, err := p.parseField(fdef, namespace)
+			if err != nil {
+				return nil, fmt.Errorf("record '%v': %w", s.name, err)
+			}
+			s.fields = append(s.fields, f)
+		}
+		return s, nil
+
+	case "enum":
+		s := &schema{typ: "enum"}
+		if err := p.register(s, def, namespace); err != nil {
+			return nil, err
+		}
+		symbols, _ := def["symbols"].([]interface{})
+		for _, sym := range symbols {
+			str, ok := sym.(string)
+			if !ok {
+				return nil, fmt.Errorf("enum '%v' has invalid symbol %v", s.name, sym)
+			}
+			s.symbols = append(s.symbols, str)
+		}
+		if len(s.symbols) == 0 {
+			return nil, fmt.Errorf("enum '%v' has no symbols", s.name)
+		}
+		return s, nil
+
+	case "fixed":
+		s := &schema{typ: "fixed", logical: logical}
+		if err := p.register(s, def, namespace); err != nil {
+			return nil, err
+		}
+		size, ok := def["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed '%v' has invalid size", s.name)
+		}
+		s.size = int(size)
+		return s, nil
+
+	case "array":
+		items, err := p.parse(def["items"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("array items: %w", err)
+		}
+		return &schema{typ: "array", items: items}, nil
+
+	case "map":
+		values, err := p.parse(def["values"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("map values: %w", err)
+		}
+		return &schema{typ: "map", values: values}, nil
+
+	default:
+		s, err := p.parse(def["type"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		if logical == "" || !primitiveTypes[s.typ] {
+			return s, nil
+		}
+		return &schema{typ: s.typ, logical: logical}, nil
+	}
+}
+
+func (p *schemaParser) parseField(def map[string]interface{}, namespace string) (field, error) {
+	name, _ := def["name"].(string)
+	if name == "" {
+		return field{}, errors.New("field without name")
+	}
+
+	typ, err := p.parse(def["type"], namespace)
+	if err != nil {
+		return field{}, fmt.Errorf("field '%v': %w", name, err)
+	}
+
+	f := field{name: name, path: name, typ: typ}
+	if path, ok := def["field"].(string); ok && path != "" {
+		f.path = path
+	}
+	f.def, f.hasDefault = def["default"]
+	return f, nil
+}
+
+func (p *schemaParser) register(s *schema, def map[string]interface{}, namespace string) error {
+	name, _ := def["name"].(string)
+	if name == "" {
+		return fmt.Errorf("%v type without name", s.typ)
+	}
+	if ns, ok := def["namespace"].(string); ok {
+		namespace = ns
+	}
+	if !strings.Contains(name, ".") && namespace != "" {
+		name = namespace + "." + name
+	}
+
+	if _, exists := p.named[name]; exists {
+		return fmt.Errorf("type '%v' defined multiple times", name)
+	}
+	s.name = name
+	p.named[name] = s
+	return nil
+}
+
+func (p *schemaParser) lookup(name, namespace string) *schema {
+	if !strings.Contains(name, ".") && namespace != "" {
+		if s := p.named[namespace+"."+name]; s != nil {
+			return s
+		}
+	}
+	return p.named[name]
+}
+
+func namespaceOf(fullname string) string {
+	if idx := strings.LastIndexByte(fullname, '.'); idx >= 0 {
+		return fullname[:idx]
+	}
+	return ""
+}
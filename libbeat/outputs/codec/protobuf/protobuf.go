@@ -0,0 +1,210 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Field numbers of the Event message defined in event.proto.
+const (
+	timestampField protowire.Number = 1
+	metadataField  protowire.Number = 2
+	fieldsField    protowire.Number = 3
+)
+
+// Encoder serializes a beat.Event to the Event protobuf message defined in
+// event.proto.
+type Encoder struct {
+	buf []byte
+	msg []byte
+
+	version string
+	config  Config
+}
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	// LengthDelimited prefixes each message with its varint encoded size, so
+	// multiple messages can be written to a single stream.
+	LengthDelimited bool `config:"length_delimited"`
+}
+
+var marshalOptions = proto.MarshalOptions{Deterministic: true}
+
+func init() {
+	codec.RegisterType("protobuf", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := Config{}
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		return New(info.Version, config), nil
+	})
+}
+
+// New creates a new protobuf Encoder.
+func New(version string, config Config) *Encoder {
+	return &Encoder{version: version, config: config}
+}
+
+// Encode serializes a beat event to protobuf. The `@metadata` fields are
+// stored in the metadata field of the message.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	meta := map[string]interface{}{
+		"beat":    index,
+		"type":    "_doc",
+		"version": e.version,
+	}
+	for k, v := range event.Meta {
+		meta[k] = v
+	}
+
+	metadata, err := toStruct(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event metadata: %w", err)
+	}
+	fields, err := toStruct(event.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event fields: %w", err)
+	}
+
+	e.msg = e.msg[:0]
+	for _, part := range []struct {
+		num protowire.Number
+		msg proto.Message
+	}{
+		{timestampField, timestamppb.New(event.Timestamp)},
+		{metadataField, metadata},
+		{fieldsField, fields},
+	} {
+		if e.msg, err = appendMessage(e.msg, part.num, part.msg); err != nil {
+			return nil, err
+		}
+	}
+
+	if !e.config.LengthDelimited {
+		return e.msg, nil
+	}
+	e.buf = protowire.AppendBytes(e.buf[:0], e.msg)
+	return e.buf, nil
+}
+
+func appendMessage(b []byte, num protowire.Number, msg proto.Message) ([]byte, error) {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	b = protowire.AppendVarint(b, uint64(marshalOptions.Size(msg)))
+	return marshalOptions.MarshalAppend(b, msg)
+}
+
+func toStruct(m map[string]interface{}) (*structpb.Struct, error) {
+	s := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(m))}
+	for k, v := range m {
+		val, err := toValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", k, err)
+		}
+		s.Fields[k] = val
+	}
+	return s, nil
+}
+
+// toValue converts an event value to a protobuf Value. Timestamps are encoded
+// as RFC3339 strings, the same way the json codec does.
+func toValue(v interface{}) (*structpb.Value, error) {
+	switch val := v.(type) {
+	case nil:
+		return structpb.NewNullValue(), nil
+	case mapstr.M:
+		return structValue(val)
+	case map[string]interface{}:
+		return structValue(val)
+	case time.Time:
+		return structpb.NewStringValue(val.UTC().Format(time.RFC3339Nano)), nil
+	case common.Time:
+		return structpb.NewStringValue(time.Time(val).UTC().Format(time.RFC3339Nano)), nil
+	case string:
+		return structpb.NewStringValue(val), nil
+	case bool:
+		return structpb.NewBoolValue(val), nil
+	case []byte:
+		return structpb.NewValue(val)
+	case fmt.Stringer:
+		return structpb.NewStringValue(val.String()), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return structpb.NewNumberValue(float64(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return structpb.NewNumberValue(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return structpb.NewNumberValue(rv.Float()), nil
+	case reflect.Slice, reflect.Array:
+		list := &structpb.ListValue{Values: make([]*structpb.Value, rv.Len())}
+		for i := range list.Values {
+			item, err := toValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list.Values[i] = item
+		}
+		return structpb.NewListValue(list), nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return structpb.NewNullValue(), nil
+		}
+		return toValue(rv.Elem().Interface())
+	}
+
+	// Fall back to the JSON representation for all other types, e.g. structs
+	// and typed maps.
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(generic)
+}
+
+func structValue(m map[string]interface{}) (*structpb.Value, error) {
+	s, err := toStruct(m)
+	if err != nil {
+		return nil, err
+	}
+	return structpb.NewStructValue(s), nil
+}
@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProtobufCodec(t *testing.T) {
+	ts := time.Date(2021, 1, 2, 3, 4, 5, 6, time.UTC)
+	event := &beat.Event{
+		Timestamp: ts,
+		Meta:      mapstr.M{"pipeline": "p"},
+		Fields: mapstr.M{
+			"message": "hello",
+			"count":   uint8(3),
+			"host":    mapstr.M{"name": "h1"},
+			"tags":    []string{"a", "b"},
+			"when":    ts,
+			"nothing": nil,
+		},
+	}
+
+	for name, config := range map[string]Config{
+		"default":          {},
+		"length delimited": {LengthDelimited: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			codec := New("1.2.3", config)
+			out, err := codec.Encode("test", event)
+			require.NoError(t, err)
+
+			if config.LengthDelimited {
+				var n int
+				out, n = protowire.ConsumeBytes(out)
+				require.Greater(t, n, 0)
+			}
+
+			timestamp, metadata, fields := decode(t, out)
+			assert.Equal(t, ts, timestamp.AsTime())
+			assert.Equal(t, map[string]interface{}{
+				"beat":     "test",
+				"type":     "_doc",
+				"version":  "1.2.3",
+				"pipeline": "p",
+			}, metadata.AsMap())
+			assert.Equal(t, map[string]interface{}{
+				"message": "hello",
+				"count":   float64(3),
+				"host":    map[string]interface{}{"name": "h1"},
+				"tags":    []interface{}{"a", "b"},
+				"when":    "2021-01-02T03:04:05.000000006Z",
+				"nothing": nil,
+			}, fields.AsMap())
+		})
+	}
+}
+
+func TestProtobufCodecStructFallback(t *testing.T) {
+	type custom struct {
+		Name string `json:"name"`
+	}
+
+	codec := New("1.2.3", Config{})
+	out, err := codec.Encode("test", &beat.Event{Fields: mapstr.M{"custom": custom{Name: "x"}}})
+	require.NoError(t, err)
+
+	_, _, fields := decode(t, out)
+	assert.Equal(t, map[string]interface{}{
+		"custom": map[string]interface{}{"name": "x"},
+	}, fields.AsMap())
+}
+
+func decode(t *testing.T, b []byte) (*timestamppb.Timestamp, *structpb.Struct, *structpb.Struct) {
+	t.Helper()
+
+	timestamp := &timestamppb.Timestamp{}
+	metadata, fields := &structpb.Struct{}, &structpb.Struct{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.Greater(t, n, 0)
+		require.Equal(t, protowire.BytesType, typ)
+		b = b[n:]
+
+		msg, n := protowire.ConsumeBytes(b)
+		require.Greater(t, n, 0)
+		b = b[n:]
+
+		var target proto.Message
+		switch num {
+		case timestampField:
+			target = timestamp
+		case metadataField:
+			target = metadata
+		case fieldsField:
+			target = fields
+		default:
+			t.Fatalf("unexpected field %v", num)
+		}
+		require.NoError(t, proto.Unmarshal(msg, target))
+	}
+	return timestamp, metadata, fields
+}
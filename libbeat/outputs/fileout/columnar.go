@@ -0,0 +1,419 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/compress"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// recordEncoder writes records to a file of one of the columnar formats.
+type recordEncoder interface {
+	Write(rec arrow.Record) error
+	// Buffered returns the number of bytes held in memory that are not
+	// yet written to the file.
+	Buffered() int64
+	// Close writes the footer of the file. It does not close the file.
+	Close() error
+}
+
+// encoderFactory returns a function that creates an encoder of the given
+// format and compression.
+func encoderFactory(format, compression string) (func(*os.File, *arrow.Schema, int) (recordEncoder, error), error) {
+	switch format {
+	case formatParquet:
+		codecs := map[string]compress.Compression{
+			"":       compress.Codecs.Snappy,
+			"snappy": compress.Codecs.Snappy,
+			"none":   compress.Codecs.Uncompressed,
+			"gzip":   compress.Codecs.Gzip,
+			"zstd":   compress.Codecs.Zstd,
+		}
+		codec, ok := codecs[compression]
+		if !ok {
+			return nil, fmt.Errorf("unknown compression %q for the parquet format, must be one of none, snappy, gzip or zstd", compression)
+		}
+		return func(f *os.File, schema *arrow.Schema, rowGroupEvents int) (recordEncoder, error) {
+			props := parquet.NewWriterProperties(
+				parquet.WithCompression(codec),
+				parquet.WithMaxRowGroupLength(int64(rowGroupEvents)),
+			)
+			// Hide Close from the parquet writer, the file is closed by the
+			// columnar writer after syncing it.
+			w, err := pqarrow.NewFileWriter(schema, struct{ io.Writer }{f}, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+			if err != nil {
+				return nil, err
+			}
+			return &parquetEncoder{w: w}, nil
+		}, nil
+
+	case formatArrow:
+		var opts []ipc.Option
+		switch compression {
+		case "", "none":
+		case "lz4":
+			opts = append(opts, ipc.WithLZ4())
+		case "zstd":
+			opts = append(opts, ipc.WithZstd())
+		default:
+			return nil, fmt.Errorf("unknown compression %q for the arrow format, must be one of none, lz4 or zstd", compression)
+		}
+		return func(f *os.File, schema *arrow.Schema, _ int) (recordEncoder, error) {
+			w, err := ipc.NewFileWriter(f, append(opts, ipc.WithSchema(schema))...)
+			if err != nil {
+				return nil, err
+			}
+			return &arrowEncoder{w}, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown columnar format %q", format)
+}
+
+type parquetEncoder struct {
+	w *pqarrow.FileWriter
+}
+
+func (e *parquetEncoder) Write(rec arrow.Record) error {
+	return e.w.WriteBuffered(rec)
+}
+
+func (e *parquetEncoder) Buffered() int64 {
+	return e.w.RowGroupTotalCompressedBytes()
+}
+
+func (e *parquetEncoder) Close() error {
+	return e.w.Close()
+}
+
+type arrowEncoder struct {
+	*ipc.FileWriter
+}
+
+func (e *arrowEncoder) Buffered() int64 {
+	return 0
+}
+
+// columnarWriter writes events to files of a columnar format. Files are
+// written under a hidden temporary name and renamed when they are complete,
+// so that readers never see partial files. A file is complete when it
+// exceeds the configured size or number of events, when it has been open
+// for the rotation interval or when the output is closed.
+type columnarWriter struct {
+	log         *logp.Logger
+	dir         string
+	filename    *fmtstr.TimestampFormatString
+	extension   string
+	permissions os.FileMode
+
+	maxSize        int64
+	maxEvents      uint
+	interval       time.Duration
+	rowGroupEvents int
+
+	mem        memory.Allocator
+	schema     *arrow.Schema
+	columns    []column
+	newEncoder func(*os.File, *arrow.Schema, int) (recordEncoder, error)
+
+	mu      sync.Mutex
+	current *columnarFile
+}
+
+type columnarFile struct {
+	file    *os.File
+	path    string
+	tmpPath string
+	encoder recordEncoder
+	events  uint
+	timer   *time.Timer
+}
+
+func newColumnarWriter(log *logp.Logger, beat beat.Info, dir string, c fileOutConfig) (*columnarWriter, error) {
+	name := c.Filename
+	if name == "" {
+		name = beat.Beat
+	}
+	efs, err := fmtstr.CompileEvent(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename: %w", err)
+	}
+	filename, err := fmtstr.NewTimestampFormatString(efs, fmtstr.FieldsForBeat(beat.Beat, beat.Version))
+	if err != nil {
+		return nil, err
+	}
+
+	extension := "." + c.Format
+	if err := removeIncompleteFiles(log, dir, name, extension); err != nil {
+		return nil, err
+	}
+
+	newEncoder, err := encoderFactory(c.Format, c.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := buildColumns(beat.Beat, c.Schema)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("the schema has no columns")
+	}
+
+	return &columnarWriter{
+		log:            log,
+		dir:            dir,
+		filename:       filename,
+		extension:      extension,
+		permissions:    os.FileMode(c.Permissions),
+		maxSize:        int64(c.RotateEveryKb) * 1024,
+		maxEvents:      c.RotateEveryEvents,
+		interval:       c.RotateInterval,
+		rowGroupEvents: c.RowGroupEvents,
+		mem:            memory.NewGoAllocator(),
+		schema:         arrowSchema(columns),
+		columns:        columns,
+		newEncoder:     newEncoder,
+	}, nil
+}
+
+// Write appends the events to the current file, starting new files as the
+// rotation limits are reached. It returns the number of events written
+// before an error, the events in the file that failed are not counted.
+func (w *columnarWriter) Write(events []*beat.Event) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	written := 0
+	for len(events) > 0 {
+		if w.current == nil {
+			if err := w.open(); err != nil {
+				return written, err
+			}
+		}
+
+		n := len(events)
+		if w.maxEvents > 0 && uint(n) > w.maxEvents-w.current.events {
+			n = int(w.maxEvents - w.current.events)
+		}
+
+		rec := buildRecord(w.mem, w.schema, w.columns, events[:n])
+		err := w.current.encoder.Write(rec)
+		rec.Release()
+		if err != nil {
+			// Don't write more events to a file that may be corrupt.
+			if closeErr := w.closeCurrent(); closeErr != nil {
+				w.log.Errorf("Failed to close file after write error: %+v", closeErr)
+			}
+			return written, err
+		}
+		w.current.events += uint(n)
+		events = events[n:]
+
+		if w.full() {
+			if err := w.closeCurrent(); err != nil {
+				return written, err
+			}
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close completes the current file.
+func (w *columnarWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeCurrent()
+}
+
+func (w *columnarWriter) full() bool {
+	if w.maxEvents > 0 && w.current.events >= w.maxEvents {
+		return true
+	}
+	size, err := w.current.file.Seek(0, io.SeekCurrent)
+	return err == nil && size+w.current.encoder.Buffered() >= w.maxSize
+}
+
+func (w *columnarWriter) open() error {
+	if err := os.MkdirAll(w.dir, dirMode(w.permissions)); err != nil {
+		return fmt.Errorf("failed to make directories for new file: %w", err)
+	}
+
+	path, tmpPath, err := w.nextPath(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, w.permissions)
+	if err != nil {
+		return err
+	}
+	encoder, err := w.newEncoder(f, w.schema, w.rowGroupEvents)
+	if err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	current := &columnarFile{file: f, path: path, tmpPath: tmpPath, encoder: encoder}
+	if w.interval > 0 {
+		current.timer = time.AfterFunc(w.interval, func() {
+			w.rotateExpired(current)
+		})
+	}
+	w.current = current
+	w.log.Debugf("Opened file %s", tmpPath)
+	return nil
+}
+
+// nextPath returns the path of a new file named after the filename format,
+// followed by a counter if a file of that name exists already, and the path
+// of its temporary file.
+func (w *columnarWriter) nextPath(now time.Time) (string, string, error) {
+	name, err := w.filename.Run(now)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to format filename: %w", err)
+	}
+	name = strings.TrimSuffix(name, w.extension)
+
+	for i := 0; ; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s-%d", name, i)
+		}
+		path := filepath.Join(w.dir, candidate+w.extension)
+		tmpPath := filepath.Join(w.dir, "."+candidate+w.extension+".tmp")
+		if exists(path) || exists(tmpPath) {
+			continue
+		}
+		return path, tmpPath, nil
+	}
+}
+
+func (w *columnarWriter) rotateExpired(f *columnarFile) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.current != f {
+		return
+	}
+	if err := w.closeCurrent(); err != nil {
+		w.log.Errorf("Failed to rotate file: %+v", err)
+	}
+}
+
+// closeCurrent completes the current file and moves it to its final name.
+func (w *columnarWriter) closeCurrent() error {
+	current := w.current
+	if current == nil {
+		return nil
+	}
+	w.current = nil
+	if current.timer != nil {
+		current.timer.Stop()
+	}
+
+	err := current.encoder.Close()
+	if err == nil {
+		err = current.file.Sync()
+	}
+	if closeErr := current.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to complete file %s: %w", current.tmpPath, err)
+	}
+	if err := os.Rename(current.tmpPath, current.path); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", current.tmpPath, err)
+	}
+	w.log.Debugf("Completed file %s with %d events", current.path, current.events)
+	return nil
+}
+
+// removeIncompleteFiles deletes the temporary files of a previous run that
+// stopped before completing them. They can't be completed because the footer
+// that makes them readable is missing. Only the files whose name starts with
+// the literal prefix of the filename format are considered.
+func removeIncompleteFiles(log *logp.Logger, dir, filename, extension string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to list incomplete files: %w", err)
+	}
+
+	prefix := "."
+	if i := strings.Index(filename, "%{"); i >= 0 {
+		prefix += filename[:i]
+	} else {
+		prefix += filename
+	}
+	suffix := extension + ".tmp"
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove incomplete file: %w", err)
+		}
+		log.Warnf("Removed incomplete file %s left by a previous run, the events it contained are lost", path)
+	}
+	return nil
+}
+
+func (w *columnarWriter) String() string {
+	return filepath.Join(w.dir, w.filename.String()+w.extension)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// dirMode returns the permissions of directories created for files with the
+// given permissions, readable by everyone who can read the files.
+func dirMode(perm os.FileMode) os.FileMode {
+	mode := os.FileMode(0700)
+	if perm&0070 > 0 {
+		mode |= 0050
+	}
+	if perm&0007 > 0 {
+		mode |= 0005
+	}
+	return mode
+}
@@ -0,0 +1,384 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package fileout
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const testFieldsYml = `
+- key: base
+  title: Base
+  fields:
+    - name: "@timestamp"
+      type: date
+    - name: message
+      type: match_only_text
+    - name: log
+      type: group
+      fields:
+        - name: offset
+          type: long
+        - name: file.path
+          type: keyword
+    - name: host
+      type: group
+      fields:
+        - name: name
+          type: keyword
+        - name: hostname
+          type: alias
+          path: host.name
+`
+
+func TestBuildColumns(t *testing.T) {
+	fieldsYml := filepath.Join(t.TempDir(), "fields.yml")
+	require.NoError(t, os.WriteFile(fieldsYml, []byte(testFieldsYml), 0600))
+
+	columns, err := buildColumns("testbeat", schemaConfig{
+		FieldsYml:     fieldsYml,
+		IncludeFields: []string{"@timestamp", "log.*", "host.*"},
+		Fields: []columnField{
+			{Name: "log.offset", Type: "keyword"},
+			{Name: "labels.ratio", Type: "double"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []column{
+		{name: "@timestamp", typ: columnDate},
+		{name: "log.offset", typ: columnString},
+		{name: "log.file.path", typ: columnString},
+		{name: "host.name", typ: columnString},
+		{name: "labels.ratio", typ: columnDouble},
+	}, columns)
+
+	_, err = buildColumns("testbeat", schemaConfig{
+		FieldsYml:     fieldsYml,
+		IncludeFields: []string{"process.*"},
+	})
+	assert.ErrorContains(t, err, `include_fields pattern "process.*" does not match any field`)
+}
+
+func TestBuildRecord(t *testing.T) {
+	columns := []column{
+		{name: "@timestamp", typ: columnDate},
+		{name: "message", typ: columnString},
+		{name: "count", typ: columnLong},
+		{name: "ratio", typ: columnDouble},
+		{name: "ok", typ: columnBoolean},
+		{name: "labels", typ: columnString},
+	}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	events := []*beat.Event{
+		{Timestamp: ts, Fields: mapstr.M{
+			"message": "hello",
+			"count":   uint8(3),
+			"ratio":   1,
+			"ok":      "true",
+			"labels":  mapstr.M{"a": "b"},
+		}},
+		{Timestamp: ts, Fields: mapstr.M{
+			"message": 42,
+			"count":   "not a number",
+			"ok":      1,
+		}},
+	}
+
+	schema := arrowSchema(columns)
+	rec := buildRecord(memory.DefaultAllocator, schema, columns, events)
+	defer rec.Release()
+
+	require.EqualValues(t, 2, rec.NumRows())
+	assert.Equal(t, arrow.Timestamp(ts.UnixMicro()), rec.Column(0).(*array.Timestamp).Value(0))
+	assert.Equal(t, "hello", rec.Column(1).(*array.String).Value(0))
+	assert.Equal(t, "42", rec.Column(1).(*array.String).Value(1))
+	assert.Equal(t, int64(3), rec.Column(2).(*array.Int64).Value(0))
+	assert.True(t, rec.Column(2).IsNull(1))
+	assert.Equal(t, 1.0, rec.Column(3).(*array.Float64).Value(0))
+	assert.True(t, rec.Column(3).IsNull(1))
+	assert.True(t, rec.Column(4).(*array.Boolean).Value(0))
+	assert.True(t, rec.Column(4).IsNull(1))
+	assert.JSONEq(t, `{"a":"b"}`, rec.Column(5).(*array.String).Value(0))
+	assert.True(t, rec.Column(5).IsNull(1))
+}
+
+func TestToInt64(t *testing.T) {
+	tests := map[string]struct {
+		value    interface{}
+		expected int64
+		ok       bool
+	}{
+		"int":                  {value: -3, expected: -3, ok: true},
+		"max uint64 in range":  {value: uint64(math.MaxInt64), expected: math.MaxInt64, ok: true},
+		"uint64 out of range":  {value: uint64(math.MaxInt64 + 1)},
+		"max uint64":           {value: uint64(math.MaxUint64)},
+		"uint out of range":    {value: uint(math.MaxUint64)},
+		"float64":              {value: 2.5, expected: 2, ok: true},
+		"float64 out of range": {value: float64(math.MaxInt64)},
+		"float64 NaN":          {value: math.NaN()},
+		"string out of range":  {value: "18446744073709551615"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			n, ok := toInt64(test.value)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, n)
+		})
+	}
+
+	// Unsigned integers out of the range of long are still valid doubles.
+	f, ok := toFloat64(uint64(math.MaxUint64))
+	assert.True(t, ok)
+	assert.Equal(t, float64(math.MaxUint64), f)
+}
+
+func TestColumnarOutput(t *testing.T) {
+	for _, format := range []string{formatParquet, formatArrow} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			out := newTestColumnarOutput(t, mapstr.M{
+				"path":                dir,
+				"filename":            "events-%{[agent.name]}",
+				"format":              format,
+				"rotate_every_events": 5,
+				"compression":         "zstd",
+				"schema.fields": []mapstr.M{
+					{"name": "@timestamp", "type": "date"},
+					{"name": "message", "type": "keyword"},
+					{"name": "n", "type": "long"},
+				},
+			})
+
+			publishTestEvents(t, out, 0, 7)
+			publishTestEvents(t, out, 7, 5)
+
+			// The third file is still in progress and hidden.
+			files := listFiles(t, dir)
+			assert.Equal(t, []string{
+				".events-testbeat-2." + format + ".tmp",
+				"events-testbeat-1." + format,
+				"events-testbeat." + format,
+			}, files)
+
+			require.NoError(t, out.Close())
+			files = listFiles(t, dir)
+			assert.Equal(t, []string{
+				"events-testbeat-1." + format,
+				"events-testbeat-2." + format,
+				"events-testbeat." + format,
+			}, files)
+
+			var values []int64
+			for _, name := range []string{"events-testbeat", "events-testbeat-1", "events-testbeat-2"} {
+				values = append(values, readColumn(t, format, filepath.Join(dir, name+"."+format), "n")...)
+			}
+			expected := make([]int64, 12)
+			for i := range expected {
+				expected[i] = int64(i)
+			}
+			assert.Equal(t, expected, values)
+		})
+	}
+}
+
+func TestColumnarOutputRotateInterval(t *testing.T) {
+	dir := t.TempDir()
+	out := newTestColumnarOutput(t, mapstr.M{
+		"path":            dir,
+		"format":          formatParquet,
+		"rotate_interval": "50ms",
+		"schema.fields":   []mapstr.M{{"name": "n", "type": "long"}},
+	})
+	defer out.Close()
+
+	publishTestEvents(t, out, 0, 3)
+	require.Eventually(t, func() bool {
+		files := listFiles(t, dir)
+		return len(files) == 1 && files[0] == "testbeat.parquet"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int64{0, 1, 2}, readColumn(t, formatParquet, filepath.Join(dir, "testbeat.parquet"), "n"))
+}
+
+func TestColumnarOutputRemovesIncompleteFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{".testbeat.parquet.tmp", ".testbeat-1.parquet.tmp", ".other.parquet.tmp", ".testbeat.arrow.tmp"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("PAR1"), 0600))
+	}
+
+	out := newTestColumnarOutput(t, mapstr.M{
+		"path":          dir,
+		"format":        formatParquet,
+		"schema.fields": []mapstr.M{{"name": "n", "type": "long"}},
+	})
+	defer out.Close()
+
+	assert.Equal(t, []string{".other.parquet.tmp", ".testbeat.arrow.tmp"}, listFiles(t, dir))
+}
+
+func TestColumnarOutputWriteError(t *testing.T) {
+	dir := t.TempDir()
+	observer := &countingObserver{Observer: outputs.NewNilObserver()}
+	group, err := makeFileout(nil, beat.Info{Beat: "testbeat", Version: "1.2.3"}, observer, config.MustNewConfigFrom(mapstr.M{
+		"path":                dir,
+		"format":              formatParquet,
+		"rotate_every_events": 5,
+		"schema.fields":       []mapstr.M{{"name": "n", "type": "long"}},
+	}))
+	require.NoError(t, err)
+	out := group.Clients[0].(*fileOutput)
+	defer out.Close()
+
+	// Fail the writes to the third file.
+	files := 0
+	newEncoder := out.columnar.newEncoder
+	out.columnar.newEncoder = func(f *os.File, schema *arrow.Schema, rowGroupEvents int) (recordEncoder, error) {
+		enc, err := newEncoder(f, schema, rowGroupEvents)
+		files++
+		if files == 3 {
+			return failingEncoder{enc}, err
+		}
+		return enc, err
+	}
+
+	publishTestEvents(t, out, 0, 12)
+	assert.Equal(t, 10, observer.acked)
+	assert.Equal(t, 2, observer.dropped)
+	assert.Equal(t, []string{"testbeat-1.parquet", "testbeat-2.parquet", "testbeat.parquet"}, listFiles(t, dir))
+}
+
+type countingObserver struct {
+	outputs.Observer
+	acked, dropped int
+}
+
+func (o *countingObserver) Acked(n int)   { o.acked += n }
+func (o *countingObserver) Dropped(n int) { o.dropped += n }
+
+type failingEncoder struct {
+	recordEncoder
+}
+
+func (failingEncoder) Write(arrow.Record) error {
+	return errors.New("write failed")
+}
+
+func newTestColumnarOutput(t *testing.T, settings mapstr.M) outputs.Client {
+	t.Helper()
+	group, err := makeFileout(nil, beat.Info{Beat: "testbeat", Version: "1.2.3"}, outputs.NewNilObserver(), config.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 1)
+	return group.Clients[0]
+}
+
+func publishTestEvents(t *testing.T, out outputs.Client, start, n int) {
+	t.Helper()
+	events := make([]beat.Event, n)
+	for i := range events {
+		events[i] = beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"message": "event", "n": start + i},
+		}
+	}
+	batch := outest.NewBatch(events...)
+	require.NoError(t, out.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readColumn(t *testing.T, format, path, name string) []int64 {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []arrow.Record
+	switch format {
+	case formatParquet:
+		pf, err := file.NewParquetReader(f)
+		require.NoError(t, err)
+		defer pf.Close()
+		reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 1024}, memory.DefaultAllocator)
+		require.NoError(t, err)
+		rr, err := reader.GetRecordReader(context.Background(), nil, nil)
+		require.NoError(t, err)
+		defer rr.Release()
+		for rr.Next() {
+			rec := rr.Record()
+			rec.Retain()
+			records = append(records, rec)
+		}
+	case formatArrow:
+		reader, err := ipc.NewFileReader(f)
+		require.NoError(t, err)
+		defer reader.Close()
+		for i := 0; i < reader.NumRecords(); i++ {
+			rec, err := reader.Record(i)
+			require.NoError(t, err)
+			rec.Retain()
+			records = append(records, rec)
+		}
+	}
+
+	var values []int64
+	for _, rec := range records {
+		idx := rec.Schema().FieldIndices(name)
+		require.Len(t, idx, 1)
+		col := rec.Column(idx[0]).(*array.Int64)
+		for i := 0; i < col.Len(); i++ {
+			values = append(values, col.Value(i))
+		}
+		rec.Release()
+	}
+	return values
+}
@@ -18,30 +18,62 @@
 package fileout
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/file"
 )
 
+// Supported values of the format setting.
+const (
+	formatNDJSON  = "ndjson"
+	formatParquet = "parquet"
+	formatArrow   = "arrow"
+)
+
 type fileOutConfig struct {
-	Path            *PathFormatString `config:"path"`
-	Filename        string            `config:"filename"`
-	RotateEveryKb   uint              `config:"rotate_every_kb" validate:"min=1"`
-	NumberOfFiles   uint              `config:"number_of_files"`
-	Codec           codec.Config      `config:"codec"`
-	Permissions     uint32            `config:"permissions"`
-	RotateOnStartup bool              `config:"rotate_on_startup"`
-	Queue           config.Namespace  `config:"queue"`
+	Path              *PathFormatString `config:"path"`
+	Filename          string            `config:"filename"`
+	Format            string            `config:"format"`
+	RotateEveryKb     uint              `config:"rotate_every_kb" validate:"min=1"`
+	RotateEveryEvents uint              `config:"rotate_every_events"`
+	RotateInterval    time.Duration     `config:"rotate_interval" validate:"min=0"`
+	NumberOfFiles     uint              `config:"number_of_files"`
+	Codec             codec.Config      `config:"codec"`
+	Permissions       uint32            `config:"permissions"`
+	RotateOnStartup   bool              `config:"rotate_on_startup"`
+	Compression       string            `config:"compression"`
+	RowGroupEvents    int               `config:"row_group_events" validate:"min=1"`
+	Schema            schemaConfig      `config:"schema"`
+	Queue             config.Namespace  `config:"queue"`
+}
+
+// schemaConfig selects the columns written in the parquet and arrow formats.
+type schemaConfig struct {
+	// FieldsYml is the path of a fields.yml file to look up the types of
+	// IncludeFields in. If it is empty the fields of the Beat are used.
+	FieldsYml     string        `config:"fields_yml"`
+	IncludeFields []string      `config:"include_fields"`
+	Fields        []columnField `config:"fields"`
+}
+
+// columnField is a column given explicitly in the schema configuration.
+type columnField struct {
+	Name string `config:"name" validate:"required"`
+	Type string `config:"type" validate:"required"`
 }
 
 func defaultConfig() fileOutConfig {
 	return fileOutConfig{
+		Format:          formatNDJSON,
 		NumberOfFiles:   7,
 		RotateEveryKb:   10 * 1024,
 		Permissions:     0600,
 		RotateOnStartup: true,
+		RowGroupEvents:  10000,
 	}
 }
 
@@ -50,6 +82,13 @@ func readConfig(cfg *config.C) (*fileOutConfig, error) {
 	if err := cfg.Unpack(&foConfig); err != nil {
 		return nil, err
 	}
+	if foConfig.Format != formatNDJSON {
+		for _, name := range []string{"number_of_files", "rotate_on_startup"} {
+			if cfg.HasField(name) {
+				return nil, fmt.Errorf("%s is not supported by the %s format", name, foConfig.Format)
+			}
+		}
+	}
 
 	// disable bulk support in publisher pipeline
 	_ = cfg.SetInt("bulk_max_size", -1, -1)
@@ -63,5 +102,33 @@ func (c *fileOutConfig) Validate() error {
 			file.MaxBackupsLimit)
 	}
 
+	switch c.Format {
+	case formatNDJSON:
+		if c.RotateEveryEvents > 0 || c.RotateInterval > 0 {
+			return errors.New("rotate_every_events and rotate_interval are only supported by the parquet and arrow formats")
+		}
+		if c.Compression != "" {
+			return errors.New("compression is only supported by the parquet and arrow formats")
+		}
+	case formatParquet, formatArrow:
+		if c.Codec.Namespace.IsSet() {
+			return fmt.Errorf("codec is not supported by the %s format", c.Format)
+		}
+		if _, err := encoderFactory(c.Format, c.Compression); err != nil {
+			return err
+		}
+		if len(c.Schema.IncludeFields) == 0 && len(c.Schema.Fields) == 0 {
+			return fmt.Errorf("the %s format requires schema.include_fields or schema.fields", c.Format)
+		}
+		for _, f := range c.Schema.Fields {
+			if _, err := columnTypeOf(f.Type); err != nil {
+				return fmt.Errorf("invalid type of schema field %q: %w", f.Name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format %q, must be one of %s, %s or %s",
+			c.Format, formatNDJSON, formatParquet, formatArrow)
+	}
+
 	return nil
 }
@@ -37,10 +37,12 @@ func TestConfig(t *testing.T) {
 			config: config.MustNewConfigFrom([]byte(`{ }`)),
 			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
 				expectedConfig := &fileOutConfig{
+					Format:          formatNDJSON,
 					NumberOfFiles:   7,
 					RotateEveryKb:   10 * 1024,
 					Permissions:     0600,
 					RotateOnStartup: true,
+					RowGroupEvents:  10000,
 				}
 
 				assert.Equal(t, expectedConfig, actual)
@@ -90,6 +92,80 @@ func TestConfig(t *testing.T) {
 				assert.Nil(t, err)
 			},
 		},
+		"parquet config": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"format":              "parquet",
+				"rotate_every_events": 1000,
+				"rotate_interval":     "5m",
+				"compression":         "zstd",
+				"schema.fields": []mapstr.M{
+					{"name": "message", "type": "keyword"},
+				},
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, formatParquet, actual.Format)
+				assert.Equal(t, uint(1000), actual.RotateEveryEvents)
+				assert.Equal(t, 5*time.Minute, actual.RotateInterval)
+				assert.Equal(t, []columnField{{Name: "message", Type: "keyword"}}, actual.Schema.Fields)
+			},
+		},
+		"parquet config without schema": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"format": "parquet",
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "the parquet format requires schema.include_fields or schema.fields")
+			},
+		},
+		"arrow config with unsupported compression": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"format":        "arrow",
+				"compression":   "snappy",
+				"schema.fields": []mapstr.M{{"name": "message", "type": "keyword"}},
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, `unknown compression "snappy" for the arrow format`)
+			},
+		},
+		"parquet config with codec": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"format":        "parquet",
+				"codec.json":    mapstr.M{"pretty": true},
+				"schema.fields": []mapstr.M{{"name": "message", "type": "keyword"}},
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "codec is not supported by the parquet format")
+			},
+		},
+		"parquet config with number_of_files": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"format":          "parquet",
+				"number_of_files": 10,
+				"schema.fields":   []mapstr.M{{"name": "message", "type": "keyword"}},
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "number_of_files is not supported by the parquet format")
+			},
+		},
+		"arrow config with rotate_on_startup": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"format":            "arrow",
+				"rotate_on_startup": false,
+				"schema.fields":     []mapstr.M{{"name": "message", "type": "keyword"}},
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "rotate_on_startup is not supported by the arrow format")
+			},
+		},
+		"ndjson config with event rotation": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"rotate_every_events": 1000,
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.ErrorContains(t, err, "rotate_every_events and rotate_interval are only supported by the parquet and arrow formats")
+			},
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			isWindowsPath = test.useWindowsPath
@@ -43,6 +43,10 @@ type fileOutput struct {
 	observer outputs.Observer
 	rotator  *file.Rotator
 	codec    codec.Codec
+
+	// columnar writes the events if the format is parquet or arrow,
+	// rotator and codec are not used then.
+	columnar *columnarWriter
 }
 
 // makeFileout instantiates a new file output instance.
@@ -75,6 +79,25 @@ func (out *fileOutput) init(beat beat.Info, c fileOutConfig) error {
 	if runErr != nil {
 		return runErr
 	}
+
+	if c.Format != formatNDJSON {
+		var err error
+		out.columnar, err = newColumnarWriter(out.log, beat, configPath, c)
+		if err != nil {
+			return err
+		}
+		out.filePath = out.columnar.String()
+
+		out.log.Warnf("The %v format acknowledges events before the file they are written to is "+
+			"complete. Events in an incomplete file are lost if the Beat stops unexpectedly.", c.Format)
+
+		out.log.Infof("Initialized file output. "+
+			"path=%v format=%v columns=%v max_size_bytes=%v max_events=%v interval=%v permissions=%v",
+			out.filePath, c.Format, len(out.columnar.columns), c.RotateEveryKb*1024,
+			c.RotateEveryEvents, c.RotateInterval, os.FileMode(c.Permissions))
+		return nil
+	}
+
 	if c.Filename != "" {
 		path = filepath.Join(configPath, c.Filename)
 	} else {
@@ -110,6 +133,9 @@ func (out *fileOutput) init(beat beat.Info, c fileOutConfig) error {
 
 // Implement Outputer
 func (out *fileOutput) Close() error {
+	if out.columnar != nil {
+		return out.columnar.Close()
+	}
 	return out.rotator.Close()
 }
 
@@ -120,6 +146,11 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 	events := batch.Events()
 	st.NewBatch(len(events))
 
+	if out.columnar != nil {
+		out.publishColumnar(events)
+		return nil
+	}
+
 	dropped := 0
 
 	for i := range events {
@@ -164,6 +195,31 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 	return nil
 }
 
+// publishColumnar writes all events of a batch as one record. Events that
+// are written are only stored durably once their file is complete. If a
+// write fails, only the events of the file that failed are dropped.
+func (out *fileOutput) publishColumnar(events []publisher.Event) {
+	st := out.observer
+
+	contents := make([]*beat.Event, len(events))
+	for i := range events {
+		contents[i] = &events[i].Content
+	}
+
+	begin := time.Now()
+	written, err := out.columnar.Write(contents)
+	if err != nil {
+		st.WriteError(err)
+		out.log.Errorf("Writing events to file failed with: %+v", err)
+		st.Dropped(len(events) - written)
+		st.Acked(written)
+		return
+	}
+
+	st.ReportLatency(time.Since(begin))
+	st.Acked(len(events))
+}
+
 func (out *fileOutput) String() string {
 	return "file(" + out.filePath + ")"
 }
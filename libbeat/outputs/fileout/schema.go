@@ -0,0 +1,374 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+
+	"github.com/elastic/beats/v7/libbeat/asset"
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/mapping"
+)
+
+// columnType is the type of the values of a column of the columnar formats.
+type columnType int
+
+const (
+	columnString columnType = iota
+	columnLong
+	columnDouble
+	columnBoolean
+	columnDate
+)
+
+// columnTypes maps field types of fields.yml and of the schema configuration
+// to column types. Values of object-like fields are written as JSON strings.
+var columnTypes = map[string]columnType{
+	"":                 columnString,
+	"string":           columnString,
+	"keyword":          columnString,
+	"constant_keyword": columnString,
+	"wildcard":         columnString,
+	"text":             columnString,
+	"match_only_text":  columnString,
+	"ip":               columnString,
+	"version":          columnString,
+	"object":           columnString,
+	"flattened":        columnString,
+	"nested":           columnString,
+	"geo_point":        columnString,
+	"long":             columnLong,
+	"integer":          columnLong,
+	"short":            columnLong,
+	"byte":             columnLong,
+	"unsigned_long":    columnLong,
+	"double":           columnDouble,
+	"float":            columnDouble,
+	"half_float":       columnDouble,
+	"scaled_float":     columnDouble,
+	"boolean":          columnBoolean,
+	"date":             columnDate,
+	"date_nanos":       columnDate,
+}
+
+func columnTypeOf(typ string) (columnType, error) {
+	t, ok := columnTypes[typ]
+	if !ok {
+		return 0, fmt.Errorf("unsupported type %q", typ)
+	}
+	return t, nil
+}
+
+func (t columnType) arrowType() arrow.DataType {
+	switch t {
+	case columnLong:
+		return arrow.PrimitiveTypes.Int64
+	case columnDouble:
+		return arrow.PrimitiveTypes.Float64
+	case columnBoolean:
+		return arrow.FixedWidthTypes.Boolean
+	case columnDate:
+		return arrow.FixedWidthTypes.Timestamp_us
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// column is a column of the columnar formats, filled from the event field
+// with the same name.
+type column struct {
+	name string
+	typ  columnType
+}
+
+// buildColumns returns the columns selected by the schema configuration.
+// The types of the fields in include_fields are looked up in fields.yml,
+// fields given explicitly are added or override the included ones.
+func buildColumns(beatName string, cfg schemaConfig) ([]column, error) {
+	var columns []column
+	index := map[string]int{}
+	add := func(c column) {
+		if i, ok := index[c.name]; ok {
+			columns[i] = c
+			return
+		}
+		index[c.name] = len(columns)
+		columns = append(columns, c)
+	}
+
+	if len(cfg.IncludeFields) > 0 {
+		fields, err := loadSchemaFields(beatName, cfg.FieldsYml)
+		if err != nil {
+			return nil, err
+		}
+		for _, pattern := range cfg.IncludeFields {
+			matched := false
+			for _, c := range fields {
+				if ok, err := path.Match(pattern, c.name); err != nil {
+					return nil, fmt.Errorf("invalid include_fields pattern %q: %w", pattern, err)
+				} else if ok {
+					add(c)
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("include_fields pattern %q does not match any field", pattern)
+			}
+		}
+	}
+
+	for _, f := range cfg.Fields {
+		typ, err := columnTypeOf(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type of schema field %q: %w", f.Name, err)
+		}
+		add(column{name: f.Name, typ: typ})
+	}
+
+	return columns, nil
+}
+
+// loadSchemaFields reads the fields of fields.yml at fieldsYml, or of the Beat
+// if fieldsYml is empty, as columns in the order of their definition.
+func loadSchemaFields(beatName, fieldsYml string) ([]column, error) {
+	var fields mapping.Fields
+	var err error
+	if fieldsYml != "" {
+		fields, err = mapping.LoadFieldsYaml(fieldsYml)
+	} else {
+		var data []byte
+		data, err = asset.GetFields(beatName)
+		if err == nil {
+			fields, err = mapping.LoadFields(data)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fields for the schema: %w", err)
+	}
+
+	var columns []column
+	seen := map[string]bool{}
+	var collect func(fields mapping.Fields, prefix string)
+	collect = func(fields mapping.Fields, prefix string) {
+		for _, f := range fields {
+			name := f.Name
+			if prefix != "" {
+				name = prefix + "." + f.Name
+			}
+			if len(f.Fields) > 0 {
+				collect(f.Fields, name)
+				continue
+			}
+			typ, err := columnTypeOf(f.Type)
+			if err != nil || seen[name] {
+				// Aliases, groups without fields and other types that
+				// have no value of their own are not columns.
+				continue
+			}
+			seen[name] = true
+			columns = append(columns, column{name: name, typ: typ})
+		}
+	}
+	collect(fields, "")
+	return columns, nil
+}
+
+func arrowSchema(columns []column) *arrow.Schema {
+	fields := make([]arrow.Field, len(columns))
+	for i, c := range columns {
+		fields[i] = arrow.Field{Name: c.name, Type: c.typ.arrowType(), Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// buildRecord converts events to a record of the schema. Missing fields and
+// values that can't be converted to the type of their column, including
+// numbers out of the range of a long column, are null.
+func buildRecord(mem memory.Allocator, schema *arrow.Schema, columns []column, events []*beat.Event) arrow.Record {
+	builder := array.NewRecordBuilder(mem, schema)
+	defer builder.Release()
+	builder.Reserve(len(events))
+
+	for i, c := range columns {
+		fb := builder.Field(i)
+		for _, event := range events {
+			v, err := event.GetValue(c.name)
+			if err != nil || v == nil {
+				fb.AppendNull()
+				continue
+			}
+			appendValue(fb, c.typ, v)
+		}
+	}
+	return builder.NewRecord()
+}
+
+func appendValue(b array.Builder, typ columnType, v interface{}) {
+	switch typ {
+	case columnLong:
+		if n, ok := toInt64(v); ok {
+			b.(*array.Int64Builder).Append(n)
+			return
+		}
+	case columnDouble:
+		if f, ok := toFloat64(v); ok {
+			b.(*array.Float64Builder).Append(f)
+			return
+		}
+	case columnBoolean:
+		if t, ok := toBool(v); ok {
+			b.(*array.BooleanBuilder).Append(t)
+			return
+		}
+	case columnDate:
+		if t, ok := toTime(v); ok {
+			b.(*array.TimestampBuilder).AppendTime(t)
+			return
+		}
+	default:
+		if s, ok := toString(v); ok {
+			b.(*array.StringBuilder).Append(s)
+			return
+		}
+	}
+	b.AppendNull()
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return toInt64(uint64(n))
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		if n > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(n), true
+	case float32:
+		return toInt64(float64(n))
+	case float64:
+		// float64(math.MaxInt64) rounds up to 2^63, which is out of range.
+		if math.IsNaN(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(n), true
+	case json.Number:
+		return toInt64(n.String())
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return i, true
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case uint:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+func toBool(v interface{}) (bool, bool) {
+	switch b := v.(type) {
+	case bool:
+		return b, true
+	case string:
+		t, err := strconv.ParseBool(b)
+		return t, err == nil
+	}
+	return false, false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case common.Time:
+		return time.Time(t), true
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
+
+func toString(v interface{}) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case []byte:
+		return string(s), true
+	case time.Time:
+		return s.UTC().Format(time.RFC3339Nano), true
+	case common.Time:
+		return time.Time(s).UTC().Format(time.RFC3339Nano), true
+	case fmt.Stringer:
+		return s.String(), true
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(s), true
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
@@ -0,0 +1,274 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+// maxResponseSize limits the amount of the response body read for error
+// reporting.
+const maxResponseSize = 4 * 1024
+
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	url      string
+	index    string
+	codec    codec.Codec
+	config   *httpConfig
+	retryOn  map[int]bool
+
+	http *http.Client
+	buf  bytes.Buffer
+}
+
+func newClient(
+	log *logp.Logger,
+	observer outputs.Observer,
+	url, index string,
+	enc codec.Codec,
+	config *httpConfig,
+) *client {
+	retryOn := make(map[int]bool, len(config.RetryOn))
+	for _, code := range config.RetryOn {
+		retryOn[code] = true
+	}
+
+	return &client{
+		log:      log,
+		observer: observer,
+		url:      url,
+		index:    index,
+		codec:    enc,
+		config:   config,
+		retryOn:  retryOn,
+	}
+}
+
+// Connect creates the HTTP client. No connection is established until the
+// first batch is published.
+func (c *client) Connect() error {
+	httpClient, err := c.config.Transport.Client(
+		httpcommon.WithLogger(c.log),
+		httpcommon.WithIOStats(c.observer),
+		httpcommon.WithKeepaliveSettings{IdleConnTimeout: c.config.Transport.IdleConnTimeout},
+	)
+	if err != nil {
+		return err
+	}
+
+	if oauth := c.config.OAuth2; oauth != nil {
+		creds := clientcredentials.Config{
+			ClientID:       oauth.ClientID,
+			ClientSecret:   oauth.ClientSecret,
+			TokenURL:       oauth.TokenURL,
+			Scopes:         oauth.Scopes,
+			EndpointParams: oauth.EndpointParams,
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+		httpClient = creds.Client(ctx)
+	}
+
+	c.http = httpClient
+	return nil
+}
+
+func (c *client) Close() error {
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (c *client) String() string {
+	return "http(" + c.url + ")"
+}
+
+// Publish encodes the batch using the configured codec and sends it in a
+// single request. Events that can not be encoded are dropped. Depending on the
+// response status the batch is acknowledged, retried, split or dropped.
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	body, ok := c.encode(events)
+	encoded, dropped := len(ok), len(events)-len(ok)
+	c.observer.Dropped(dropped)
+	if encoded == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	begin := time.Now()
+	status, err := c.send(ctx, body)
+	c.observer.ReportLatency(time.Since(begin))
+
+	switch {
+	case err != nil:
+		c.observer.WriteError(err)
+		c.retry(batch, ok, dropped)
+		return err
+
+	case status >= 200 && status < 300:
+		batch.ACK()
+		c.observer.Acked(encoded)
+		return nil
+
+	case status == http.StatusRequestEntityTooLarge:
+		if batch.SplitRetry() {
+			c.observer.Split()
+		} else {
+			c.log.Errorf("dropping %d events, request too large for %s", encoded, c.url)
+			batch.Drop()
+			c.observer.Dropped(encoded)
+		}
+		return nil
+
+	case c.retryOn[status]:
+		if status == http.StatusTooManyRequests {
+			c.observer.ErrTooMany(encoded)
+		}
+		c.retry(batch, ok, dropped)
+		return fmt.Errorf("%s responded with status %d", c.url, status)
+
+	default:
+		c.log.Errorf("dropping %d events, %s responded with status %d", encoded, c.url, status)
+		batch.Drop()
+		c.observer.Dropped(encoded)
+		return nil
+	}
+}
+
+// retry returns the encoded events to the pipeline. Events dropped due to
+// encoding errors are not retried.
+func (c *client) retry(batch publisher.Batch, events []publisher.Event, dropped int) {
+	if dropped == 0 {
+		batch.Retry()
+	} else {
+		batch.RetryEvents(events)
+	}
+	c.observer.Failed(len(events))
+}
+
+func (c *client) encode(events []publisher.Event) ([]byte, []publisher.Event) {
+	c.buf.Reset()
+	if c.config.BatchFormat == batchFormatJSONArray {
+		c.buf.WriteByte('[')
+	}
+
+	encoded := make([]publisher.Event, 0, len(events))
+	for i := range events {
+		event := &events[i].Content
+		serialized, err := c.codec.Encode(c.index, event)
+		if err != nil {
+			c.log.Errorf("failed to serialize the event, dropping it: %v", err)
+			c.log.Debugf("failed event: %v", event)
+			continue
+		}
+
+		if len(encoded) > 0 && c.config.BatchFormat == batchFormatJSONArray {
+			c.buf.WriteByte(',')
+		}
+		c.buf.Write(bytes.TrimRight(serialized, "\n"))
+		if c.config.BatchFormat == batchFormatNDJSON {
+			c.buf.WriteByte('\n')
+		}
+		encoded = append(encoded, events[i])
+	}
+
+	if c.config.BatchFormat == batchFormatJSONArray {
+		c.buf.WriteByte(']')
+	}
+	return c.buf.Bytes(), encoded
+}
+
+func (c *client) send(ctx context.Context, body []byte) (int, error) {
+	if c.http == nil {
+		return 0, errors.New("client is not connected")
+	}
+
+	var reader io.Reader = bytes.NewReader(body)
+	if level := c.config.CompressionLevel; level > 0 {
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := w.Write(body); err != nil {
+			return 0, err
+		}
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		reader = &buf
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.config.Method, c.url, reader)
+	if err != nil {
+		return 0, err
+	}
+
+	contentType := "application/x-ndjson"
+	if c.config.BatchFormat == batchFormatJSONArray {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.config.CompressionLevel > 0 {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	switch {
+	case c.config.Username != "" || c.config.Password != "":
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	case c.config.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.config.BearerToken)
+	}
+	for k, v := range c.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		c.log.Debugf("%s responded with status %d: %s", c.url, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
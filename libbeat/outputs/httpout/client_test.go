@@ -0,0 +1,260 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"compress/gzip"
+	"context"
+	stdjson "encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/format"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestPublishBody(t *testing.T) {
+	cases := map[string]struct {
+		configure func(*httpConfig)
+		codec     codec.Codec
+		check     func(t *testing.T, r *http.Request, body string)
+	}{
+		"ndjson": {
+			check: func(t *testing.T, r *http.Request, body string) {
+				assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+				lines := strings.Split(strings.TrimSpace(body), "\n")
+				require.Len(t, lines, 2)
+				assert.Contains(t, lines[0], `"message":"a"`)
+				assert.Contains(t, lines[1], `"message":"b"`)
+			},
+		},
+		"json array": {
+			configure: func(c *httpConfig) { c.BatchFormat = batchFormatJSONArray },
+			check: func(t *testing.T, r *http.Request, body string) {
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				var docs []mapstr.M
+				require.NoError(t, stdjson.Unmarshal([]byte(body), &docs))
+				require.Len(t, docs, 2)
+				assert.Equal(t, "b", docs[1]["message"])
+			},
+		},
+		"format codec": {
+			codec: format.New(fmtstr.MustCompileEvent("msg=%{[message]}")),
+			check: func(t *testing.T, r *http.Request, body string) {
+				assert.Equal(t, "msg=a\nmsg=b\n", body)
+			},
+		},
+		"gzip and headers": {
+			configure: func(c *httpConfig) {
+				c.CompressionLevel = 5
+				c.Method = http.MethodPut
+				c.Headers = map[string]string{"X-Custom": "value"}
+			},
+			check: func(t *testing.T, r *http.Request, body string) {
+				assert.Equal(t, http.MethodPut, r.Method)
+				assert.Equal(t, "value", r.Header.Get("X-Custom"))
+				assert.Equal(t, 2, strings.Count(body, "\n"))
+			},
+		},
+		"basic auth": {
+			configure: func(c *httpConfig) { c.Username, c.Password = "user", "pass" },
+			check: func(t *testing.T, r *http.Request, _ string) {
+				user, pass, ok := r.BasicAuth()
+				assert.True(t, ok)
+				assert.Equal(t, "user", user)
+				assert.Equal(t, "pass", pass)
+			},
+		},
+		"bearer token": {
+			configure: func(c *httpConfig) { c.BearerToken = "token" },
+			check: func(t *testing.T, r *http.Request, _ string) {
+				assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			called := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				test.check(t, r, readBody(t, r))
+			}))
+			defer server.Close()
+
+			config := defaultConfig()
+			if test.configure != nil {
+				test.configure(&config)
+			}
+			client := newTestClient(t, server.URL, test.codec, &config)
+
+			batch := testBatch()
+			require.NoError(t, client.Publish(context.Background(), batch))
+			assert.True(t, called)
+			assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, signalTags(batch))
+		})
+	}
+}
+
+func TestPublishStatusPolicy(t *testing.T) {
+	cases := map[string]struct {
+		status  int
+		retryOn []int
+		signals []outest.BatchSignalTag
+		err     bool
+	}{
+		"accepted":            {status: http.StatusAccepted, signals: []outest.BatchSignalTag{outest.BatchACK}},
+		"service unavailable": {status: http.StatusServiceUnavailable, signals: []outest.BatchSignalTag{outest.BatchRetry}, err: true},
+		"bad request":         {status: http.StatusBadRequest, signals: []outest.BatchSignalTag{outest.BatchDrop}},
+		"custom retry":        {status: http.StatusConflict, retryOn: []int{http.StatusConflict}, signals: []outest.BatchSignalTag{outest.BatchRetry}, err: true},
+		"custom no retry":     {status: http.StatusInternalServerError, retryOn: []int{http.StatusConflict}, signals: []outest.BatchSignalTag{outest.BatchDrop}},
+		"too large":           {status: http.StatusRequestEntityTooLarge, signals: []outest.BatchSignalTag{outest.BatchSplitRetry}},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			config := defaultConfig()
+			if test.retryOn != nil {
+				config.RetryOn = test.retryOn
+			}
+			client := newTestClient(t, server.URL, nil, &config)
+
+			batch := testBatch()
+			err := client.Publish(context.Background(), batch)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.signals, signalTags(batch))
+		})
+	}
+}
+
+func TestPublishOAuth2(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"oauth-token","token_type":"Bearer","expires_in":3600}`))
+	})
+	called := false
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		assert.Equal(t, "Bearer oauth-token", r.Header.Get("Authorization"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	config := defaultConfig()
+	config.OAuth2 = &oauth2Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		TokenURL:     server.URL + "/token",
+	}
+	client := newTestClient(t, server.URL+"/events", nil, &config)
+
+	batch := testBatch()
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assert.True(t, called)
+}
+
+func TestConfigValidate(t *testing.T) {
+	cases := map[string]func(*httpConfig){
+		"invalid method":       func(c *httpConfig) { c.Method = http.MethodGet },
+		"invalid batch format": func(c *httpConfig) { c.BatchFormat = "xml" },
+		"multiple auth":        func(c *httpConfig) { c.Username, c.BearerToken = "user", "token" },
+		"invalid status":       func(c *httpConfig) { c.RetryOn = []int{42} },
+		"json array with format codec": func(c *httpConfig) {
+			c.BatchFormat = batchFormatJSONArray
+			require.NoError(t, config.MustNewConfigFrom(mapstr.M{"format.string": "%{[message]}"}).Unpack(&c.Codec))
+		},
+	}
+
+	for name, configure := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := defaultConfig()
+			configure(&config)
+			assert.Error(t, config.Validate())
+		})
+	}
+
+	t.Run("json array with json codec", func(t *testing.T) {
+		c := defaultConfig()
+		c.BatchFormat = batchFormatJSONArray
+		require.NoError(t, config.MustNewConfigFrom(mapstr.M{"json.pretty": true}).Unpack(&c.Codec))
+		assert.NoError(t, c.Validate())
+	})
+}
+
+func newTestClient(t *testing.T, url string, enc codec.Codec, config *httpConfig) *client {
+	if enc == nil {
+		enc = json.New("1.2.3", json.Config{})
+	}
+	client := newClient(logp.NewLogger("http"), outputs.NewNilObserver(), url, "test", enc, config)
+	require.NoError(t, client.Connect())
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func testBatch() *outest.Batch {
+	return outest.NewBatch(
+		beat.Event{Fields: mapstr.M{"message": "a"}},
+		beat.Event{Fields: mapstr.M{"message": "b"}},
+	)
+}
+
+func readBody(t *testing.T, r *http.Request) string {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		reader = gz
+	}
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func signalTags(batch *outest.Batch) []outest.BatchSignalTag {
+	tags := make([]outest.BatchSignalTag, len(batch.Signals))
+	for i, sig := range batch.Signals {
+		tags[i] = sig.Tag
+	}
+	return tags
+}
@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	batchFormatNDJSON    = "ndjson"
+	batchFormatJSONArray = "json_array"
+)
+
+type httpConfig struct {
+	Method           string            `config:"method"`
+	Headers          map[string]string `config:"headers"`
+	BatchFormat      string            `config:"batch_format"`
+	Username         string            `config:"username"`
+	Password         string            `config:"password"`
+	BearerToken      string            `config:"bearer_token"`
+	OAuth2           *oauth2Config     `config:"oauth2"`
+	CompressionLevel int               `config:"compression_level" validate:"min=0, max=9"`
+	LoadBalance      bool              `config:"loadbalance"`
+	BulkMaxSize      int               `config:"bulk_max_size"`
+	MaxRetries       int               `config:"max_retries" validate:"min=-1"`
+	RetryOn          []int             `config:"retry_on_status"`
+	Backoff          backoffConfig     `config:"backoff"`
+	Codec            codec.Config      `config:"codec"`
+	Queue            config.Namespace  `config:"queue"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+// oauth2Config configures the OAuth2 client credentials flow.
+type oauth2Config struct {
+	ClientID       string              `config:"client.id" validate:"required"`
+	ClientSecret   string              `config:"client.secret" validate:"required"`
+	TokenURL       string              `config:"token_url" validate:"required"`
+	Scopes         []string            `config:"scopes"`
+	EndpointParams map[string][]string `config:"endpoint_params"`
+}
+
+type backoffConfig struct {
+	Init time.Duration `config:"init" validate:"nonzero"`
+	Max  time.Duration `config:"max" validate:"nonzero"`
+}
+
+func defaultConfig() httpConfig {
+	return httpConfig{
+		Method:           http.MethodPost,
+		BatchFormat:      batchFormatNDJSON,
+		CompressionLevel: 0,
+		LoadBalance:      true,
+		BulkMaxSize:      1600,
+		MaxRetries:       3,
+		RetryOn: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		Backoff: backoffConfig{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+		Transport: httpcommon.DefaultHTTPTransportSettings(),
+	}
+}
+
+func (c *httpConfig) Validate() error {
+	switch c.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("http method '%v' not supported", c.Method)
+	}
+
+	switch c.BatchFormat {
+	case batchFormatNDJSON:
+	case batchFormatJSONArray:
+		// the elements of the array must be JSON documents
+		if name := c.Codec.Namespace.Name(); name != "" && name != "json" {
+			return fmt.Errorf("batch_format '%v' requires the json codec, not '%v'", c.BatchFormat, name)
+		}
+	default:
+		return fmt.Errorf("batch_format '%v' not supported", c.BatchFormat)
+	}
+
+	auth := 0
+	if c.Username != "" || c.Password != "" {
+		auth++
+	}
+	if c.BearerToken != "" {
+		auth++
+	}
+	if c.OAuth2 != nil {
+		auth++
+	}
+	if auth > 1 {
+		return errors.New("only one of username/password, bearer_token or oauth2 can be configured")
+	}
+
+	for _, code := range c.RetryOn {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid HTTP status code %v in retry_on_status", code)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+type client struct {
+	log        *logp.Logger
+	observer   outputs.Observer
+	translator *translator
+	exporter   exporter
+	endpoint   string
+	timeout    time.Duration
+}
+
+func newClient(
+	log *logp.Logger,
+	observer outputs.Observer,
+	translator *translator,
+	exporter exporter,
+	endpoint string,
+	timeout time.Duration,
+) *client {
+	return &client{
+		log:        log,
+		observer:   observer,
+		translator: translator,
+		exporter:   exporter,
+		endpoint:   endpoint,
+		timeout:    timeout,
+	}
+}
+
+// Connect establishes the connection to the OTLP endpoint and implements
+// `outputs.Connectable`.
+func (c *client) Connect() error {
+	c.log.Debugf("connecting to %s", c.endpoint)
+	if err := c.exporter.connect(context.Background()); err != nil {
+		return fmt.Errorf("otlp connection to %s failed: %w", c.endpoint, err)
+	}
+	return nil
+}
+
+func (c *client) Close() error {
+	return c.exporter.close()
+}
+
+func (c *client) String() string {
+	return "otlp(" + c.endpoint + ")"
+}
+
+// Publish sends the batch as OTLP logs and metrics. Events that failed with a
+// retryable error are returned to the pipeline, while events rejected by the
+// endpoint are dropped. An error is returned if events need to be retried, so
+// the connection is re-established after backoff.
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	req := c.translator.translate(events)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	begin := time.Now()
+	var (
+		failed  []publisher.Event
+		dropped int
+		sent    bool
+		lastErr error
+	)
+	signals := []struct {
+		name   string
+		events []publisher.Event
+		items  int
+		export func() (int64, error)
+	}{
+		{"logs", req.logEvents, len(req.logEvents), func() (int64, error) { return c.exporter.exportLogs(ctx, req.logs) }},
+		{"metrics", req.metricEvents, req.metricPoints, func() (int64, error) { return c.exporter.exportMetrics(ctx, req.metrics) }},
+	}
+	for _, signal := range signals {
+		if len(signal.events) == 0 {
+			continue
+		}
+
+		rejected, err := signal.export()
+		if err == nil {
+			sent = true
+			if rejected > 0 {
+				// The rejected items are not sent again. The response
+				// doesn't tell which items were rejected, so events are
+				// only reported as dropped if all their items were
+				// rejected.
+				c.log.Warnf("%d of %d %s items have been rejected by %s", rejected, signal.items, signal.name, c.endpoint)
+				switch {
+				case rejected >= int64(signal.items):
+					dropped += len(signal.events)
+				case signal.items == len(signal.events):
+					// every event is a single item
+					dropped += int(rejected)
+				}
+			}
+			continue
+		}
+
+		switch kindOf(err) {
+		case errTooLarge:
+			// Splitting is only possible as long as no other signal has
+			// been sent, as all events of the split batches are published
+			// again.
+			if !sent && batch.SplitRetry() {
+				c.observer.Split()
+				return nil
+			}
+			c.log.Errorf("dropping %d events because the %s request is too large: %v", len(signal.events), signal.name, err)
+			dropped += len(signal.events)
+		case errRetryable:
+			failed = append(failed, signal.events...)
+			lastErr = err
+		default:
+			c.log.Errorf("dropping %d events rejected by %s: %v", len(signal.events), c.endpoint, err)
+			dropped += len(signal.events)
+		}
+	}
+	c.observer.ReportLatency(time.Since(begin))
+
+	if len(failed) > 0 {
+		if len(failed) == len(events) {
+			batch.Retry()
+		} else {
+			batch.RetryEvents(failed)
+		}
+		c.observer.Failed(len(failed))
+		c.observer.Dropped(dropped)
+		c.observer.Acked(len(events) - len(failed) - dropped)
+		return fmt.Errorf("failed to publish %d events to %s: %w", len(failed), c.endpoint, lastErr)
+	}
+
+	if dropped == len(events) {
+		batch.Drop()
+	} else {
+		batch.ACK()
+	}
+	c.observer.Dropped(dropped)
+	c.observer.Acked(len(events) - dropped)
+	return nil
+}
@@ -0,0 +1,289 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestHTTPPublish(t *testing.T) {
+	cases := map[string]struct {
+		status  int
+		signals []outest.BatchSignalTag
+		err     bool
+	}{
+		"success":             {status: http.StatusOK, signals: []outest.BatchSignalTag{outest.BatchACK}},
+		"service unavailable": {status: http.StatusServiceUnavailable, signals: []outest.BatchSignalTag{outest.BatchRetry}, err: true},
+		"too many requests":   {status: http.StatusTooManyRequests, signals: []outest.BatchSignalTag{outest.BatchRetry}, err: true},
+		"bad request":         {status: http.StatusBadRequest, signals: []outest.BatchSignalTag{outest.BatchDrop}},
+		"too large":           {status: http.StatusRequestEntityTooLarge, signals: []outest.BatchSignalTag{outest.BatchSplitRetry}},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			var received *collogspb.ExportLogsServiceRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v1/logs", r.URL.Path)
+				assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+				assert.Equal(t, "secret", r.Header.Get("Authorization"))
+
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				received = &collogspb.ExportLogsServiceRequest{}
+				require.NoError(t, proto.Unmarshal(body, received))
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			config := defaultConfig()
+			config.Protocol = protocolHTTP
+			config.Compression = compressionNone
+			config.Headers = map[string]string{"Authorization": "secret"}
+
+			exp, err := newHTTPExporter(server.URL, &config, outputs.NewNilObserver())
+			require.NoError(t, err)
+			client := newTestClient(exp)
+			require.NoError(t, client.Connect())
+			defer client.Close()
+
+			batch := outest.NewBatch(
+				beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "a"}},
+				beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "b"}},
+			)
+			err = client.Publish(context.Background(), batch)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.signals, signalTags(batch))
+			require.NotNil(t, received)
+			assert.Len(t, received.ResourceLogs[0].ScopeLogs[0].LogRecords, 2)
+		})
+	}
+}
+
+type logsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	err      error
+	rejected int64
+	received chan *collogspb.ExportLogsServiceRequest
+}
+
+func (s *logsServer) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.received <- req
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if s.rejected > 0 {
+		resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{RejectedLogRecords: s.rejected}
+	}
+	return resp, nil
+}
+
+func TestGRPCPublish(t *testing.T) {
+	cases := map[string]struct {
+		err     error
+		signals []outest.BatchSignalTag
+		fail    bool
+	}{
+		"success":          {signals: []outest.BatchSignalTag{outest.BatchACK}},
+		"unavailable":      {err: status.Error(codes.Unavailable, "unavailable"), signals: []outest.BatchSignalTag{outest.BatchRetry}, fail: true},
+		"invalid argument": {err: status.Error(codes.InvalidArgument, "invalid"), signals: []outest.BatchSignalTag{outest.BatchDrop}},
+		"too large":        {err: status.Error(codes.ResourceExhausted, "too large"), signals: []outest.BatchSignalTag{outest.BatchSplitRetry}},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			srv := &logsServer{err: test.err, received: make(chan *collogspb.ExportLogsServiceRequest, 1)}
+			server := grpc.NewServer()
+			collogspb.RegisterLogsServiceServer(server, srv)
+			go func() { _ = server.Serve(listener) }()
+			defer server.Stop()
+
+			config := defaultConfig()
+			client := newTestClient(newGRPCExporter(listener.Addr().String(), &config, nil))
+			require.NoError(t, client.Connect())
+			defer client.Close()
+
+			batch := outest.NewBatch(
+				beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "a"}},
+				beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "b"}},
+			)
+			err = client.Publish(context.Background(), batch)
+			if test.fail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.signals, signalTags(batch))
+
+			if test.err == nil {
+				req := <-srv.received
+				assert.Len(t, req.ResourceLogs[0].ScopeLogs[0].LogRecords, 2)
+			}
+		})
+	}
+}
+
+type countingObserver struct {
+	outputs.Observer
+	acked, dropped int
+}
+
+func (o *countingObserver) Acked(n int)   { o.acked += n }
+func (o *countingObserver) Dropped(n int) { o.dropped += n }
+
+func TestPartialSuccess(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &logsServer{rejected: 1, received: make(chan *collogspb.ExportLogsServiceRequest, 1)}
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, srv)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	config := defaultConfig()
+	observer := &countingObserver{Observer: outputs.NewNilObserver()}
+	tr := newTranslator(beat.Info{Beat: "test"}, true)
+	client := newClient(logp.NewLogger("otlp"), observer, tr, newGRPCExporter(listener.Addr().String(), &config, nil), "test", 5*time.Second)
+	require.NoError(t, client.Connect())
+	defer client.Close()
+
+	batch := outest.NewBatch(
+		beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "a"}},
+		beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"message": "b"}},
+	)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, signalTags(batch))
+	assert.Equal(t, 1, observer.acked)
+	assert.Equal(t, 1, observer.dropped)
+}
+
+type partialSuccessExporter struct {
+	rejectedPoints int64
+}
+
+func (e *partialSuccessExporter) connect(context.Context) error { return nil }
+func (e *partialSuccessExporter) close() error                  { return nil }
+
+func (e *partialSuccessExporter) exportLogs(context.Context, *collogspb.ExportLogsServiceRequest) (int64, error) {
+	return 0, nil
+}
+
+func (e *partialSuccessExporter) exportMetrics(context.Context, *colmetricspb.ExportMetricsServiceRequest) (int64, error) {
+	return e.rejectedPoints, nil
+}
+
+func TestPartialSuccessMetrics(t *testing.T) {
+	cases := map[string]struct {
+		rejected int64
+		acked    int
+		dropped  int
+	}{
+		// the rejected point may belong to either event
+		"some points rejected": {rejected: 1, acked: 2},
+		"all points rejected":  {rejected: 4, dropped: 2},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			observer := &countingObserver{Observer: outputs.NewNilObserver()}
+			tr := newTranslator(beat.Info{Beat: "test"}, true)
+			client := newClient(logp.NewLogger("otlp"), observer, tr, &partialSuccessExporter{rejectedPoints: test.rejected}, "test", 5*time.Second)
+
+			// each event is converted into two data points
+			event := beat.Event{Timestamp: time.Now(), Fields: mapstr.M{
+				"event":     mapstr.M{"module": "system"},
+				"metricset": mapstr.M{"name": "cpu"},
+				"system":    mapstr.M{"cpu": mapstr.M{"user": 1, "system": 2}},
+			}}
+			batch := outest.NewBatch(event, event)
+			require.NoError(t, client.Publish(context.Background(), batch))
+			assert.Equal(t, test.acked, observer.acked)
+			assert.Equal(t, test.dropped, observer.dropped)
+		})
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	grpcCases := map[string]string{
+		"localhost":             "localhost:4317",
+		"localhost:1234":        "localhost:1234",
+		"https://collector:443": "collector:443",
+	}
+	for host, expected := range grpcCases {
+		actual, err := grpcEndpoint(host)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, host)
+	}
+
+	httpCases := map[string]struct {
+		tls      bool
+		expected string
+	}{
+		"localhost":                  {expected: "http://localhost:4318"},
+		"localhost:1234":             {expected: "http://localhost:1234"},
+		"collector":                  {tls: true, expected: "https://collector:4318"},
+		"https://collector:443/otlp": {expected: "https://collector:443/otlp"},
+	}
+	for host, test := range httpCases {
+		actual, err := httpEndpoint(host, test.tls)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, actual, host)
+	}
+}
+
+func newTestClient(exp exporter) *client {
+	tr := newTranslator(beat.Info{Beat: "test"}, true)
+	return newClient(logp.NewLogger("otlp"), outputs.NewNilObserver(), tr, exp, "test", 5*time.Second)
+}
+
+func signalTags(batch *outest.Batch) []outest.BatchSignalTag {
+	tags := make([]outest.BatchSignalTag, len(batch.Signals))
+	for i, sig := range batch.Signals {
+		tags[i] = sig.Tag
+	}
+	return tags
+}
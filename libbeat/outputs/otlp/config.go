@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http"
+
+	compressionNone = "none"
+	compressionGzip = "gzip"
+)
+
+type otlpConfig struct {
+	// Protocol selects the OTLP transport, either `grpc` or `http`.
+	Protocol    string            `config:"protocol"`
+	Headers     map[string]string `config:"headers"`
+	Compression string            `config:"compression"`
+	TLS         *tlscommon.Config `config:"ssl"`
+	Timeout     time.Duration     `config:"timeout" validate:"min=1"`
+	LoadBalance bool              `config:"loadbalance"`
+	BulkMaxSize int               `config:"bulk_max_size"`
+	MaxRetries  int               `config:"max_retries" validate:"min=-1"`
+	Backoff     backoffConfig     `config:"backoff"`
+	Queue       config.Namespace  `config:"queue"`
+
+	// LogsPath and MetricsPath are the URL paths used by the `http` protocol.
+	LogsPath    string `config:"logs_path"`
+	MetricsPath string `config:"metrics_path"`
+
+	Metrics metricsConfig `config:"metrics"`
+}
+
+type metricsConfig struct {
+	// Enabled maps events created by Metricbeat metricsets to OTLP metrics.
+	// If disabled, all events are sent as OTLP logs.
+	Enabled bool `config:"enabled"`
+}
+
+type backoffConfig struct {
+	Init time.Duration `config:"init" validate:"nonzero"`
+	Max  time.Duration `config:"max" validate:"nonzero"`
+}
+
+func defaultConfig() otlpConfig {
+	return otlpConfig{
+		Protocol:    protocolGRPC,
+		Compression: compressionGzip,
+		Timeout:     30 * time.Second,
+		LoadBalance: false,
+		BulkMaxSize: 1600,
+		MaxRetries:  3,
+		LogsPath:    "/v1/logs",
+		MetricsPath: "/v1/metrics",
+		Metrics:     metricsConfig{Enabled: true},
+		Backoff: backoffConfig{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+}
+
+func (c *otlpConfig) Validate() error {
+	switch c.Protocol {
+	case protocolGRPC, protocolHTTP:
+	default:
+		return fmt.Errorf("otlp protocol '%v' not supported", c.Protocol)
+	}
+
+	switch c.Compression {
+	case compressionNone, compressionGzip:
+	default:
+		return fmt.Errorf("otlp compression '%v' not supported", c.Compression)
+	}
+
+	if c.Backoff.Max < c.Backoff.Init {
+		return errors.New("backoff.max must not be smaller than backoff.init")
+	}
+	return nil
+}
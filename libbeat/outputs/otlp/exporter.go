@@ -0,0 +1,298 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// exporter sends OTLP export requests to a single endpoint. It returns the
+// number of items rejected by the endpoint on partial success.
+type exporter interface {
+	connect(ctx context.Context) error
+	close() error
+	exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error)
+	exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (int64, error)
+}
+
+// errorKind classifies export errors, following the retry rules of the OTLP
+// specification.
+type errorKind uint8
+
+const (
+	// errPermanent errors will fail again if the request is retried.
+	errPermanent errorKind = iota
+	// errRetryable errors are caused by the endpoint or network being
+	// unavailable and may succeed when retried.
+	errRetryable
+	// errTooLarge errors indicate the request exceeded the endpoint's
+	// size limit. The request may succeed if it is split.
+	errTooLarge
+)
+
+var errNotConnected = errors.New("connection is not established")
+
+type exportError struct {
+	kind errorKind
+	err  error
+}
+
+func (e *exportError) Error() string { return e.err.Error() }
+func (e *exportError) Unwrap() error { return e.err }
+
+func kindOf(err error) errorKind {
+	var exportErr *exportError
+	if errors.As(err, &exportErr) {
+		return exportErr.kind
+	}
+	return errRetryable
+}
+
+type grpcExporter struct {
+	host    string
+	config  *otlpConfig
+	tls     *tlscommon.TLSConfig
+	headers metadata.MD
+
+	conn    *grpc.ClientConn
+	logs    collogspb.LogsServiceClient
+	metrics colmetricspb.MetricsServiceClient
+}
+
+func newGRPCExporter(host string, config *otlpConfig, tls *tlscommon.TLSConfig) *grpcExporter {
+	return &grpcExporter{
+		host:    host,
+		config:  config,
+		tls:     tls,
+		headers: metadata.New(config.Headers),
+	}
+}
+
+func (e *grpcExporter) connect(ctx context.Context) error {
+	var creds credentials.TransportCredentials
+	if e.tls != nil {
+		creds = credentials.NewTLS(e.tls.BuildModuleClientConfig(hostname(e.host)))
+	} else {
+		creds = insecure.NewCredentials()
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithTransportCredentials(creds),
+	}
+	if e.config.Compression == compressionGzip {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(grpcgzip.Name)))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.config.Timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, e.host, opts...)
+	if err != nil {
+		return err
+	}
+
+	e.conn = conn
+	e.logs = collogspb.NewLogsServiceClient(conn)
+	e.metrics = colmetricspb.NewMetricsServiceClient(conn)
+	return nil
+}
+
+func (e *grpcExporter) close() error {
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn, e.logs, e.metrics = nil, nil, nil
+	return err
+}
+
+func (e *grpcExporter) exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error) {
+	if e.conn == nil {
+		return 0, errNotConnected
+	}
+	resp, err := e.logs.Export(metadata.NewOutgoingContext(ctx, e.headers), req)
+	if err != nil {
+		return 0, grpcError(err)
+	}
+	return resp.GetPartialSuccess().GetRejectedLogRecords(), nil
+}
+
+func (e *grpcExporter) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (int64, error) {
+	if e.conn == nil {
+		return 0, errNotConnected
+	}
+	resp, err := e.metrics.Export(metadata.NewOutgoingContext(ctx, e.headers), req)
+	if err != nil {
+		return 0, grpcError(err)
+	}
+	return resp.GetPartialSuccess().GetRejectedDataPoints(), nil
+}
+
+func grpcError(err error) error {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+		codes.Unavailable, codes.DataLoss:
+		return &exportError{kind: errRetryable, err: err}
+	case codes.ResourceExhausted:
+		// The server signals throttling by adding retry information. Without
+		// it, the error is most likely caused by the request exceeding the
+		// maximum message size.
+		for _, detail := range st.Details() {
+			if _, ok := detail.(*errdetails.RetryInfo); ok {
+				return &exportError{kind: errRetryable, err: err}
+			}
+		}
+		return &exportError{kind: errTooLarge, err: err}
+	}
+	return &exportError{kind: errPermanent, err: err}
+}
+
+type httpExporter struct {
+	url      string
+	config   *otlpConfig
+	observer outputs.Observer
+	client   *http.Client
+}
+
+func newHTTPExporter(url string, config *otlpConfig, observer outputs.Observer) (*httpExporter, error) {
+	transport := httpcommon.DefaultHTTPTransportSettings()
+	transport.TLS = config.TLS
+	transport.Timeout = config.Timeout
+
+	client, err := transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	return &httpExporter{
+		url:      strings.TrimSuffix(url, "/"),
+		config:   config,
+		observer: observer,
+		client:   client,
+	}, nil
+}
+
+func (e *httpExporter) connect(context.Context) error {
+	return nil
+}
+
+func (e *httpExporter) close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func (e *httpExporter) exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (int64, error) {
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if err := e.export(ctx, e.config.LogsPath, req, resp); err != nil {
+		return 0, err
+	}
+	return resp.GetPartialSuccess().GetRejectedLogRecords(), nil
+}
+
+func (e *httpExporter) exportMetrics(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (int64, error) {
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if err := e.export(ctx, e.config.MetricsPath, req, resp); err != nil {
+		return 0, err
+	}
+	return resp.GetPartialSuccess().GetRejectedDataPoints(), nil
+}
+
+func (e *httpExporter) export(ctx context.Context, path string, req, resp proto.Message) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return &exportError{kind: errPermanent, err: err}
+	}
+
+	if e.config.Compression == compressionGzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return &exportError{kind: errPermanent, err: err}
+		}
+		if err := w.Close(); err != nil {
+			return &exportError{kind: errPermanent, err: err}
+		}
+		body = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url+path, bytes.NewReader(body))
+	if err != nil {
+		return &exportError{kind: errPermanent, err: err}
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	if e.config.Compression == compressionGzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.config.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	httpResp, err := e.client.Do(httpReq)
+	if err != nil {
+		e.observer.WriteError(err)
+		return &exportError{kind: errRetryable, err: err}
+	}
+	defer httpResp.Body.Close()
+	e.observer.WriteBytes(len(body))
+
+	respBody, err := io.ReadAll(io.LimitReader(httpResp.Body, 64*1024))
+	if err != nil {
+		e.observer.ReadError(err)
+		return &exportError{kind: errRetryable, err: err}
+	}
+	e.observer.ReadBytes(len(respBody))
+
+	if httpResp.StatusCode >= 200 && httpResp.StatusCode < 300 {
+		// The response only carries partial success information. The data has
+		// been accepted, even if the response can not be parsed.
+		_ = proto.Unmarshal(respBody, resp)
+		return nil
+	}
+
+	err = fmt.Errorf("%s returned status %d: %s", e.url+path, httpResp.StatusCode, strings.TrimSpace(string(respBody)))
+	switch httpResp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusRequestTimeout, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &exportError{kind: errRetryable, err: err}
+	case http.StatusRequestEntityTooLarge:
+		return &exportError{kind: errTooLarge, err: err}
+	}
+	return &exportError{kind: errPermanent, err: err}
+}
@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	defaultGRPCPort = 4317
+	defaultHTTPPort = 4318
+)
+
+func init() {
+	outputs.RegisterType("otlp", makeOTLP)
+}
+
+func makeOTLP(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	tls, err := tlscommon.LoadTLSConfig(config.TLS)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	log := logp.NewLogger("otlp")
+	translator := newTranslator(beat, config.Metrics.Enabled)
+
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		var exp exporter
+		var endpoint string
+		switch config.Protocol {
+		case protocolGRPC:
+			endpoint, err = grpcEndpoint(host)
+			if err != nil {
+				return outputs.Fail(err)
+			}
+			exp = newGRPCExporter(endpoint, &config, tls)
+		case protocolHTTP:
+			endpoint, err = httpEndpoint(host, tls != nil)
+			if err != nil {
+				return outputs.Fail(err)
+			}
+			exp, err = newHTTPExporter(endpoint, &config, observer)
+			if err != nil {
+				return outputs.Fail(err)
+			}
+		}
+
+		client := newClient(log, observer, translator, exp, endpoint, config.Timeout)
+		clients[i] = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+	}
+
+	return outputs.SuccessNet(config.Queue, config.LoadBalance, config.BulkMaxSize, config.MaxRetries, nil, clients)
+}
+
+// grpcEndpoint normalizes a host to the host:port format expected by gRPC.
+func grpcEndpoint(host string) (string, error) {
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil {
+			return "", fmt.Errorf("invalid otlp host '%v': %w", host, err)
+		}
+		host = u.Host
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, fmt.Sprint(defaultGRPCPort))
+	}
+	return host, nil
+}
+
+// httpEndpoint normalizes a host to a base URL. The scheme defaults to https
+// if TLS is configured.
+func httpEndpoint(host string, tls bool) (string, error) {
+	if !strings.Contains(host, "://") {
+		scheme := "http"
+		if tls {
+			scheme = "https"
+		}
+		host = scheme + "://" + host
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid otlp host '%v': %w", host, err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid otlp host '%v'", host)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), fmt.Sprint(defaultHTTPPort))
+	}
+	return u.String(), nil
+}
+
+func hostname(endpoint string) string {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return host
+}
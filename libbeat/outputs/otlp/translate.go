@@ -0,0 +1,323 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const scopeName = "github.com/elastic/beats/v7/libbeat/outputs/otlp"
+
+// translator converts beat events into OTLP export requests.
+type translator struct {
+	resource *resourcepb.Resource
+	scope    *commonpb.InstrumentationScope
+	metrics  bool
+	now      func() time.Time
+}
+
+// request holds the export requests for a batch, together with the events
+// that have been converted into each request. Events are tracked per signal
+// so they can be retried individually. Each log event is a single log record,
+// while a metric event is converted into one data point per metric.
+type request struct {
+	logs         *collogspb.ExportLogsServiceRequest
+	logEvents    []publisher.Event
+	metrics      *colmetricspb.ExportMetricsServiceRequest
+	metricEvents []publisher.Event
+	metricPoints int
+}
+
+func newTranslator(info beat.Info, metrics bool) *translator {
+	attrs := []*commonpb.KeyValue{
+		stringAttr("service.name", info.Beat),
+		stringAttr("service.version", info.Version),
+		stringAttr("service.instance.id", info.ID.String()),
+	}
+	if info.Hostname != "" {
+		attrs = append(attrs, stringAttr("host.name", info.Hostname))
+	}
+
+	return &translator{
+		resource: &resourcepb.Resource{Attributes: attrs},
+		scope:    &commonpb.InstrumentationScope{Name: scopeName, Version: info.Version},
+		metrics:  metrics,
+		now:      time.Now,
+	}
+}
+
+func (t *translator) translate(events []publisher.Event) request {
+	var (
+		req     request
+		records []*logspb.LogRecord
+		metrics []*metricspb.Metric
+		now     = uint64(t.now().UnixNano())
+	)
+
+	for _, event := range events {
+		content := &event.Content
+		if t.metrics {
+			if m := t.toMetrics(content); len(m) > 0 {
+				metrics = append(metrics, m...)
+				req.metricEvents = append(req.metricEvents, event)
+				req.metricPoints += len(m)
+				continue
+			}
+		}
+
+		records = append(records, toLogRecord(content, now))
+		req.logEvents = append(req.logEvents, event)
+	}
+
+	if len(records) > 0 {
+		req.logs = &collogspb.ExportLogsServiceRequest{
+			ResourceLogs: []*logspb.ResourceLogs{{
+				Resource: t.resource,
+				ScopeLogs: []*logspb.ScopeLogs{{
+					Scope:      t.scope,
+					LogRecords: records,
+				}},
+			}},
+		}
+	}
+	if len(metrics) > 0 {
+		req.metrics = &colmetricspb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metricspb.ResourceMetrics{{
+				Resource: t.resource,
+				ScopeMetrics: []*metricspb.ScopeMetrics{{
+					Scope:   t.scope,
+					Metrics: metrics,
+				}},
+			}},
+		}
+	}
+	return req
+}
+
+// toLogRecord maps an event to a log record. The `message` field becomes the
+// log body, all other fields are added as attributes using their flattened
+// key.
+func toLogRecord(event *beat.Event, observed uint64) *logspb.LogRecord {
+	record := &logspb.LogRecord{
+		TimeUnixNano:         timestamp(event.Timestamp),
+		ObservedTimeUnixNano: observed,
+	}
+
+	flat := event.Fields.Flatten()
+	if msg, ok := flat["message"]; ok {
+		record.Body = toAnyValue(msg)
+		delete(flat, "message")
+	}
+	if level, ok := flat["log.level"].(string); ok {
+		record.SeverityText = level
+		record.SeverityNumber = severity(level)
+	}
+	if id, ok := flat["trace.id"].(string); ok {
+		record.TraceId = decodeID(id, 16)
+	}
+	if id, ok := flat["span.id"].(string); ok {
+		record.SpanId = decodeID(id, 8)
+	}
+
+	record.Attributes = toAttributes(flat)
+	return record
+}
+
+// toMetrics maps events created by a Metricbeat metricset to gauges. Numeric
+// fields within the module namespace (e.g. `system.cpu.*`) are reported as
+// data points, all other fields are added as data point attributes. Events
+// that do not contain metrics return nil.
+func (t *translator) toMetrics(event *beat.Event) []*metricspb.Metric {
+	if ok, _ := event.Fields.HasKey("metricset.name"); !ok {
+		return nil
+	}
+	module, _ := event.Fields.GetValue("event.module")
+	prefix, _ := module.(string)
+	if prefix == "" {
+		return nil
+	}
+	prefix += "."
+
+	flat := event.Fields.Flatten()
+	values := map[string]*metricspb.NumberDataPoint{}
+	for k, v := range flat {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if point := toDataPoint(v); point != nil {
+			values[k] = point
+			delete(flat, k)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	attrs := toAttributes(flat)
+	ts := timestamp(event.Timestamp)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := make([]*metricspb.Metric, 0, len(values))
+	for _, name := range names {
+		point := values[name]
+		point.TimeUnixNano = ts
+		point.Attributes = attrs
+		metrics = append(metrics, &metricspb.Metric{
+			Name: name,
+			Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{point},
+			}},
+		})
+	}
+	return metrics
+}
+
+func toDataPoint(v interface{}) *metricspb.NumberDataPoint {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &metricspb.NumberDataPoint{Value: &metricspb.NumberDataPoint_AsInt{AsInt: rv.Int()}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &metricspb.NumberDataPoint{Value: &metricspb.NumberDataPoint_AsInt{AsInt: int64(rv.Uint())}}
+	case reflect.Float32, reflect.Float64:
+		return &metricspb.NumberDataPoint{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: rv.Float()}}
+	}
+	return nil
+}
+
+func toAttributes(flat mapstr.M) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, &commonpb.KeyValue{Key: k, Value: toAnyValue(flat[k])})
+	}
+	return attrs
+}
+
+func toAnyValue(v interface{}) *commonpb.AnyValue {
+	switch val := v.(type) {
+	case nil:
+		return &commonpb.AnyValue{}
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: val}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: val}}
+	case []byte:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: val}}
+	case time.Time:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: val.UTC().Format(time.RFC3339Nano)}}
+	case common.Time:
+		return toAnyValue(time.Time(val))
+	case mapstr.M:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+			Values: toAttributes(val.Flatten()),
+		}}}
+	case map[string]interface{}:
+		return toAnyValue(mapstr.M(val))
+	case fmt.Stringer:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: val.String()}}
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: rv.Int()}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(rv.Uint())}}
+	case reflect.Float32, reflect.Float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: rv.Float()}}
+	case reflect.String:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: rv.String()}}
+	case reflect.Slice, reflect.Array:
+		values := make([]*commonpb.AnyValue, rv.Len())
+		for i := range values {
+			values[i] = toAnyValue(rv.Index(i).Interface())
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return &commonpb.AnyValue{}
+		}
+		return toAnyValue(rv.Elem().Interface())
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+}
+
+// severity maps common log level names to OTLP severity numbers.
+func severity(level string) logspb.SeverityNumber {
+	switch strings.ToLower(level) {
+	case "trace":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_TRACE
+	case "debug":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case "info", "informational", "notice":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case "warn", "warning":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case "error", "err":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case "critical", "crit", "alert", "emergency", "emerg", "fatal":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	}
+	return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+}
+
+func decodeID(id string, size int) []byte {
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != size {
+		return nil
+	}
+	return b
+}
+
+func timestamp(ts time.Time) uint64 {
+	if ts.IsZero() {
+		return 0
+	}
+	return uint64(ts.UnixNano())
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
@@ -0,0 +1,122 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestTranslateLogs(t *testing.T) {
+	ts := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	tr := newTranslator(beat.Info{Beat: "filebeat", Version: "8.0.0"}, true)
+	tr.now = func() time.Time { return ts.Add(time.Second) }
+
+	batch := outest.NewBatch(beat.Event{
+		Timestamp: ts,
+		Fields: mapstr.M{
+			"message": "hello world",
+			"log":     mapstr.M{"level": "WARN", "offset": 42},
+			"trace":   mapstr.M{"id": "0102030405060708090a0b0c0d0e0f10"},
+			"tags":    []string{"a"},
+		},
+	})
+
+	req := tr.translate(batch.Events())
+	require.Nil(t, req.metrics)
+	require.Len(t, req.logEvents, 1)
+	require.Len(t, req.logs.ResourceLogs, 1)
+
+	resource := req.logs.ResourceLogs[0]
+	assert.Equal(t, "service.name", resource.Resource.Attributes[0].Key)
+	assert.Equal(t, "filebeat", resource.Resource.Attributes[0].Value.GetStringValue())
+
+	records := resource.ScopeLogs[0].LogRecords
+	require.Len(t, records, 1)
+	record := records[0]
+	assert.Equal(t, uint64(ts.UnixNano()), record.TimeUnixNano)
+	assert.Equal(t, uint64(ts.Add(time.Second).UnixNano()), record.ObservedTimeUnixNano)
+	assert.Equal(t, "hello world", record.Body.GetStringValue())
+	assert.Equal(t, "WARN", record.SeverityText)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, record.SeverityNumber)
+	assert.Len(t, record.TraceId, 16)
+
+	attrs := map[string]*commonpb.AnyValue{}
+	for _, kv := range record.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.NotContains(t, attrs, "message")
+	assert.Equal(t, int64(42), attrs["log.offset"].GetIntValue())
+	assert.Equal(t, "a", attrs["tags"].GetArrayValue().Values[0].GetStringValue())
+}
+
+func TestTranslateMetrics(t *testing.T) {
+	ts := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	metricEvent := beat.Event{
+		Timestamp: ts,
+		Fields: mapstr.M{
+			"event":     mapstr.M{"module": "system", "duration": 100},
+			"metricset": mapstr.M{"name": "filesystem"},
+			"system": mapstr.M{"filesystem": mapstr.M{
+				"device_name": "/dev/sda1",
+				"used":        mapstr.M{"bytes": uint64(1024), "pct": 0.5},
+			}},
+		},
+	}
+	logEvent := beat.Event{Timestamp: ts, Fields: mapstr.M{"message": "hello"}}
+
+	t.Run("metrics enabled", func(t *testing.T) {
+		tr := newTranslator(beat.Info{Beat: "metricbeat"}, true)
+		req := tr.translate(outest.NewBatch(metricEvent, logEvent).Events())
+
+		require.Len(t, req.metricEvents, 1)
+		require.Len(t, req.logEvents, 1)
+
+		metrics := req.metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics
+		require.Len(t, metrics, 2)
+		assert.Equal(t, "system.filesystem.used.bytes", metrics[0].Name)
+		assert.Equal(t, int64(1024), metrics[0].GetGauge().DataPoints[0].GetAsInt())
+		assert.Equal(t, "system.filesystem.used.pct", metrics[1].Name)
+		assert.Equal(t, 0.5, metrics[1].GetGauge().DataPoints[0].GetAsDouble())
+
+		point := metrics[0].GetGauge().DataPoints[0]
+		assert.Equal(t, uint64(ts.UnixNano()), point.TimeUnixNano)
+		keys := []string{}
+		for _, kv := range point.Attributes {
+			keys = append(keys, kv.Key)
+		}
+		assert.Equal(t, []string{"event.duration", "event.module", "metricset.name", "system.filesystem.device_name"}, keys)
+	})
+
+	t.Run("metrics disabled", func(t *testing.T) {
+		tr := newTranslator(beat.Info{Beat: "metricbeat"}, false)
+		req := tr.translate(outest.NewBatch(metricEvent, logEvent).Events())
+
+		assert.Nil(t, req.metrics)
+		assert.Len(t, req.logEvents, 2)
+	})
+}
@@ -109,6 +109,23 @@ func getStoreFor(cfg config, log *logp.Logger) (Store, context.CancelFunc, error
 	}
 }
 
+// OpenFileStore returns the shared file-backed store with the given ID, the
+// same store used by cache processors with a `backend.file.id` of id. It
+// allows other processors to keep state across restarts. Entries expire ttl
+// after they were last put and, if capacity is positive, at most capacity
+// entries are kept. The state is written to disk every writeInterval, if
+// positive, and when the store is released. The returned context.CancelFunc
+// releases the store and must be called when it is no longer required.
+func OpenFileStore(id string, ttl time.Duration, capacity int, writeInterval time.Duration, log *logp.Logger) (Store, context.CancelFunc, error) {
+	return getStoreFor(config{
+		Put: &putConfig{TTL: &ttl},
+		Store: &storeConfig{
+			File:     &fileConfig{ID: id, WriteOutEvery: writeInterval},
+			Capacity: capacity,
+		},
+	}, log)
+}
+
 // noop is a no-op context.CancelFunc.
 func noop() {}
 
@@ -0,0 +1,88 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+)
+
+// config defines the configuration options for the deduplicate processor.
+// The fingerprint settings (fields, method, ignore_missing) are read by the
+// fingerprint package from the same configuration.
+type config struct {
+	Window      time.Duration    `config:"window" validate:"positive"`
+	Action      action           `config:"action"`
+	TargetField string           `config:"target_field"`
+	MaxEntries  int              `config:"max_entries" validate:"min=1"`
+	MaxMemory   cfgtype.ByteSize `config:"max_memory"`
+	Backend     *backendConfig   `config:"backend"`
+}
+
+// backendConfig defines where the state is persisted across restarts.
+type backendConfig struct {
+	File *fileConfig `config:"file" validate:"required"`
+}
+
+type fileConfig struct {
+	ID            string        `config:"id" validate:"required"`
+	WriteInterval time.Duration `config:"write_interval"`
+}
+
+func defaultConfig() config {
+	return config{
+		Window:      time.Minute,
+		Action:      actionDrop,
+		TargetField: "event.duplicates",
+		MaxEntries:  10000,
+		MaxMemory:   10 * 1024 * 1024,
+	}
+}
+
+// action defines what is done with duplicate events.
+type action uint8
+
+const (
+	actionDrop action = iota
+	actionCount
+)
+
+var actionNames = map[action]string{
+	actionDrop:  "drop",
+	actionCount: "count",
+}
+
+func (a action) String() string {
+	return actionNames[a]
+}
+
+// Unpack unpacks a string to an action.
+func (a *action) Unpack(v string) error {
+	switch strings.ToLower(v) {
+	case "", "drop":
+		*a = actionDrop
+	case "count":
+		*a = actionCount
+	default:
+		return fmt.Errorf("invalid deduplicate action '%v' (valid values are: drop, count)", v)
+	}
+	return nil
+}
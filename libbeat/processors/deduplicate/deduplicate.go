@@ -0,0 +1,267 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/cache"
+	"github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const (
+	procName = "deduplicate"
+	logName  = "processor." + procName
+
+	// entryOverhead is the approximate memory used by an entry in addition
+	// to its key: the list element, the map slot and the entry itself.
+	entryOverhead = 128
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	// We cannot use this as a JS plugin as it is stateful and includes a Close method.
+	processors.RegisterPlugin(procName, New)
+}
+
+// entry is the state kept for a fingerprint.
+type entry struct {
+	windowEnd  time.Time
+	duplicates int
+}
+
+type processor struct {
+	config
+	fingerprinter *fingerprint.Fingerprinter
+	log           *logp.Logger
+	now           func() time.Time
+
+	mu     sync.Mutex
+	seen   *simplelru.LRU
+	memory int64
+
+	// store persists the entries across restarts, it is nil unless a
+	// backend is configured.
+	store       cache.Store
+	cancelStore func()
+
+	metricsName string
+	duplicates  *monitoring.Int
+	evictions   *monitoring.Int
+}
+
+// New constructs a new deduplicate processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v processor configuration: %w", procName, err)
+	}
+	fingerprinter, err := fingerprint.NewFingerprinter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id          = int(instanceID.Inc())
+		log         = logp.NewLogger(logName).With("instance_id", id)
+		metricsName = logName + "." + strconv.Itoa(id)
+		metrics     = monitoring.Default.NewRegistry(metricsName, monitoring.DoNotReport)
+	)
+
+	p := &processor{
+		config:        c,
+		fingerprinter: fingerprinter,
+		log:           log,
+		now:           time.Now,
+		cancelStore:   func() {},
+		metricsName:   metricsName,
+		duplicates:    monitoring.NewInt(metrics, "duplicates"),
+		evictions:     monitoring.NewInt(metrics, "evictions"),
+	}
+	p.seen, err = simplelru.NewLRU(c.MaxEntries, p.onEvict)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	if c.Backend != nil {
+		p.store, p.cancelStore, err = cache.OpenFileStore(c.Backend.File.ID, c.Window,
+			c.MaxEntries, c.Backend.File.WriteInterval, log)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("failed to open the %v state store: %w", procName, err)
+		}
+	}
+
+	return p, nil
+}
+
+// Run drops the event, or adds the number of previous occurrences to it, if
+// an event with the same fingerprint was seen within the window.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	key, err := p.fingerprinter.Fingerprint(event)
+	if err != nil {
+		return event, err
+	}
+
+	duplicates := p.observe(key)
+	if duplicates == 0 {
+		return event, nil
+	}
+
+	p.duplicates.Inc()
+	if p.Action == actionDrop {
+		return nil, nil
+	}
+	if _, err := event.PutValue(p.TargetField, duplicates); err != nil {
+		return event, fmt.Errorf("failed to write the duplicates count to [%v]: %w", p.TargetField, err)
+	}
+	return event, nil
+}
+
+// observe records an occurrence of key and returns the number of previous
+// occurrences within the current window, 0 if this is the first one. A new
+// window starts with the first occurrence after the previous one ended.
+func (p *processor) observe(key string) int {
+	now := p.now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := p.lookup(key)
+	if e == nil || !now.Before(e.windowEnd) {
+		e = &entry{windowEnd: now.Add(p.Window)}
+		p.add(key, e)
+	} else {
+		e.duplicates++
+	}
+	p.persist(key, e)
+	return e.duplicates
+}
+
+// lookup returns the entry for key from memory or, when it was evicted or
+// the processor restarted, from the persistent store.
+func (p *processor) lookup(key string) *entry {
+	if v, ok := p.seen.Get(key); ok {
+		return v.(*entry)
+	}
+	if p.store == nil {
+		return nil
+	}
+	v, err := p.store.Get(key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNoData) {
+			p.log.Warnw("failed to read deduplication state", "error", err)
+		}
+		return nil
+	}
+	e, err := entryFromStore(v)
+	if err != nil {
+		p.log.Warnw("ignoring invalid deduplication state", "error", err)
+		return nil
+	}
+	p.add(key, e)
+	return e
+}
+
+// add inserts an entry and evicts the least recently used entries until the
+// memory limit is respected.
+func (p *processor) add(key string, e *entry) {
+	if !p.seen.Contains(key) {
+		p.memory += entrySize(key)
+	}
+	p.seen.Add(key, e)
+	for p.MaxMemory > 0 && p.memory > int64(p.MaxMemory) && p.seen.Len() > 1 {
+		p.seen.RemoveOldest()
+	}
+}
+
+func (p *processor) onEvict(key, _ interface{}) {
+	p.memory -= entrySize(key.(string))
+	p.evictions.Inc()
+}
+
+func entrySize(key string) int64 {
+	return int64(len(key)) + entryOverhead
+}
+
+// persist writes the entry to the persistent store, if configured.
+func (p *processor) persist(key string, e *entry) {
+	if p.store == nil {
+		return
+	}
+	err := p.store.Put(key, map[string]interface{}{
+		"window_end": e.windowEnd.Format(time.RFC3339Nano),
+		"duplicates": e.duplicates,
+	})
+	if err != nil {
+		p.log.Warnw("failed to write deduplication state", "error", err)
+	}
+}
+
+// entryFromStore decodes an entry written by persist. Values read back from
+// the state file have been through JSON, so numbers are float64.
+func entryFromStore(v interface{}) (*entry, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected state type %T", v)
+	}
+	s, _ := m["window_end"].(string)
+	windowEnd, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window_end: %w", err)
+	}
+	e := &entry{windowEnd: windowEnd}
+	switch n := m["duplicates"].(type) {
+	case int:
+		e.duplicates = n
+	case float64:
+		e.duplicates = int(n)
+	default:
+		return nil, fmt.Errorf("invalid duplicates type %T", n)
+	}
+	return e, nil
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("%v=[window=%v, action=%v, max_entries=%v, max_memory=%v]",
+		procName, p.Window, p.Action, p.MaxEntries, p.MaxMemory)
+}
+
+// Close releases the persistent store, writing its final state to disk, and
+// removes the metrics of the processor.
+func (p *processor) Close() error {
+	p.cancelStore()
+	monitoring.Default.Remove(p.metricsName)
+	return nil
+}
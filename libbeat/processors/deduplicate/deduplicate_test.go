@@ -0,0 +1,220 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+func TestDeduplicateDrop(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"fields": []string{"message", "host.name"},
+		"window": "10s",
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	clock := &testClock{now: time.Now()}
+	p.(*processor).now = clock.Now
+
+	assertKept(t, p, "hello", "a")
+	assertDropped(t, p, "hello", "a")
+	assertKept(t, p, "hello", "b")
+	assertKept(t, p, "bye", "a")
+
+	// Duplicates do not extend the window.
+	clock.advance(9 * time.Second)
+	assertDropped(t, p, "hello", "a")
+	clock.advance(time.Second)
+	assertKept(t, p, "hello", "a")
+	assertDropped(t, p, "hello", "a")
+
+	assert.EqualValues(t, 3, p.(*processor).duplicates.Get())
+}
+
+func TestDeduplicateCount(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"fields": []string{"message"},
+		"action": "count",
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	for want := 0; want < 3; want++ {
+		event, err := p.Run(newEvent("hello", "a"))
+		require.NoError(t, err)
+		require.NotNil(t, event)
+
+		duplicates, err := event.GetValue("event.duplicates")
+		if want == 0 {
+			assert.ErrorIs(t, err, mapstr.ErrKeyNotFound)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, want, duplicates)
+	}
+}
+
+func TestDeduplicateMissingField(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"fields": []string{"message", "missing"},
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	_, err = p.Run(newEvent("hello", "a"))
+	assert.Error(t, err)
+
+	p, err = New(conf.MustNewConfigFrom(mapstr.M{
+		"fields":         []string{"message", "missing"},
+		"ignore_missing": true,
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	assertKept(t, p, "hello", "a")
+	assertDropped(t, p, "hello", "a")
+}
+
+func TestDeduplicateMaxEntries(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"fields":      []string{"message"},
+		"max_entries": 2,
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	assertKept(t, p, "a", "")
+	assertKept(t, p, "b", "")
+	assertDropped(t, p, "a", "")
+	// "b" is the least recently used entry and gets evicted.
+	assertKept(t, p, "c", "")
+	assertDropped(t, p, "a", "")
+	assertKept(t, p, "b", "")
+
+	dp := p.(*processor)
+	assert.Equal(t, 2, dp.seen.Len())
+	assert.EqualValues(t, 2, dp.evictions.Get())
+}
+
+func TestDeduplicateMaxMemory(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"fields":     []string{"message"},
+		"max_memory": 3 * (64 + entryOverhead),
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	for _, msg := range []string{"a", "b", "c", "d", "e"} {
+		assertKept(t, p, msg, "")
+	}
+	// sha256 fingerprints are 64 hex characters long.
+	dp := p.(*processor)
+	assert.Equal(t, 3, dp.seen.Len())
+	assert.LessOrEqual(t, dp.memory, int64(3*(64+entryOverhead)))
+	assertKept(t, p, "a", "")
+	assertDropped(t, p, "e", "")
+}
+
+func TestDeduplicatePersistence(t *testing.T) {
+	origDataPath := paths.Paths.Data
+	t.Cleanup(func() { paths.Paths.Data = origDataPath })
+	paths.Paths.Data = t.TempDir()
+
+	c := map[string]interface{}{
+		"fields":  []string{"message"},
+		"window":  "1h",
+		"action":  "count",
+		"backend": map[string]interface{}{"file": map[string]interface{}{"id": "dedup_test"}},
+	}
+
+	cfg, err := conf.NewConfigFrom(c)
+	require.NoError(t, err)
+	first, err := New(cfg)
+	require.NoError(t, err)
+	assertKept(t, first, "hello", "")
+	_, err = first.Run(newEvent("hello", ""))
+	require.NoError(t, err)
+	require.NoError(t, first.(*processor).Close())
+
+	// A new instance reads the state written when the first one was closed.
+	p, err := New(cfg)
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	event, err := p.Run(newEvent("hello", ""))
+	require.NoError(t, err)
+	duplicates, err := event.GetValue("event.duplicates")
+	require.NoError(t, err)
+	assert.Equal(t, 2, duplicates)
+	assertKept(t, p, "other", "")
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no fields":          {"window": "1m"},
+		"invalid window":     {"fields": []string{"message"}, "window": "-1s"},
+		"invalid action":     {"fields": []string{"message"}, "action": "tag"},
+		"invalid method":     {"fields": []string{"message"}, "method": "crc"},
+		"invalid entries":    {"fields": []string{"message"}, "max_entries": 0},
+		"backend without id": {"fields": []string{"message"}, "backend": map[string]interface{}{"file": map[string]interface{}{"write_interval": "1m"}}},
+	}
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := conf.NewConfigFrom(c)
+			require.NoError(t, err)
+			_, err = New(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time          { return c.now }
+func (c *testClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newEvent(message, host string) *beat.Event {
+	return &beat.Event{Fields: mapstr.M{
+		"message": message,
+		"host":    mapstr.M{"name": host},
+	}}
+}
+
+func assertKept(t *testing.T, p beat.Processor, message, host string) {
+	t.Helper()
+	event, err := p.Run(newEvent(message, host))
+	require.NoError(t, err)
+	assert.NotNil(t, event, "event %q/%q should be kept", message, host)
+}
+
+func assertDropped(t *testing.T, p beat.Processor, message, host string) {
+	t.Helper()
+	event, err := p.Run(newEvent(message, host))
+	require.NoError(t, err)
+	assert.Nil(t, event, "event %q/%q should be dropped", message, host)
+}
@@ -41,9 +41,8 @@ func init() {
 }
 
 type fingerprint struct {
-	config Config
-	fields []string
-	hash   hashMethod
+	config        Config
+	fingerprinter *Fingerprinter
 }
 
 // New constructs a new fingerprint processor.
@@ -53,15 +52,9 @@ func New(cfg *config.C) (beat.Processor, error) {
 		return nil, makeErrConfigUnpack(err)
 	}
 
-	// The fields array must be sorted, to guarantee that we always
-	// get the same hash for a similar set of configured keys.
-	// The call `ToSlice` always returns a sorted slice.
-	fields := common.MakeStringSet(config.Fields...).ToSlice()
-
 	p := &fingerprint{
-		config: config,
-		hash:   config.Method.Hash,
-		fields: fields,
+		config:        config,
+		fingerprinter: newFingerprinter(config),
 	}
 
 	return p, nil
@@ -69,14 +62,11 @@ func New(cfg *config.C) (beat.Processor, error) {
 
 // Run enriches the given event with a fingerprint.
 func (p *fingerprint) Run(event *beat.Event) (*beat.Event, error) {
-	hashFn := p.hash()
-
-	if err := p.writeFields(hashFn, event); err != nil {
-		return nil, makeErrComputeFingerprint(err)
+	encodedHash, err := p.fingerprinter.Fingerprint(event)
+	if err != nil {
+		return nil, err
 	}
 
-	encodedHash := p.config.Encoding.Encode(hashFn.Sum(nil))
-
 	if _, err := event.PutValue(p.config.TargetField, encodedHash); err != nil {
 		return nil, makeErrComputeFingerprint(err)
 	}
@@ -89,11 +79,55 @@ func (p *fingerprint) String() string {
 	return procName + "=" + string(json)
 }
 
-func (p *fingerprint) writeFields(to io.Writer, event *beat.Event) error {
-	for _, k := range p.fields {
+// Fingerprinter computes the fingerprint of events from a set of fields.
+// It is used by the fingerprint processor and by other processors that need
+// to identify events by their content.
+type Fingerprinter struct {
+	fields        []string
+	hash          hashMethod
+	encoding      encodingMethod
+	ignoreMissing bool
+}
+
+// NewFingerprinter returns a Fingerprinter configured with the `fields`,
+// `method`, `encoding` and `ignore_missing` settings of the fingerprint
+// processor found in cfg.
+func NewFingerprinter(cfg *config.C) (*Fingerprinter, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, makeErrConfigUnpack(err)
+	}
+	return newFingerprinter(config), nil
+}
+
+func newFingerprinter(config Config) *Fingerprinter {
+	// The fields array must be sorted, to guarantee that we always
+	// get the same hash for a similar set of configured keys.
+	// The call `ToSlice` always returns a sorted slice.
+	return &Fingerprinter{
+		fields:        common.MakeStringSet(config.Fields...).ToSlice(),
+		hash:          config.Method.Hash,
+		encoding:      config.Encoding.Encode,
+		ignoreMissing: config.IgnoreMissing,
+	}
+}
+
+// Fingerprint returns the encoded fingerprint of the given event.
+func (f *Fingerprinter) Fingerprint(event *beat.Event) (string, error) {
+	hashFn := f.hash()
+
+	if err := f.writeFields(hashFn, event); err != nil {
+		return "", makeErrComputeFingerprint(err)
+	}
+
+	return f.encoding(hashFn.Sum(nil)), nil
+}
+
+func (f *Fingerprinter) writeFields(to io.Writer, event *beat.Event) error {
+	for _, k := range f.fields {
 		v, err := event.GetValue(k)
 		if err != nil {
-			if p.config.IgnoreMissing {
+			if f.ignoreMissing {
 				continue
 			}
 			return makeErrMissingField(k, err)
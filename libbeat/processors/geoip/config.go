@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// config defines the configuration options for the geoip processor.
+type config struct {
+	Database     string        `config:"database"`                       // Path to a City or Country database.
+	ASNDatabase  string        `config:"asn_database"`                   // Path to an ASN database.
+	Fields       mapstr.M      `config:"fields"`                         // Mapping of source IP fields to target fields.
+	TagOnFailure []string      `config:"tag_on_failure"`                 // Tags to append when a failure occurs.
+	ReloadPeriod time.Duration `config:"reload_period" validate:"min=0"` // How often the databases are checked for changes.
+	CacheSize    int           `config:"cache_size" validate:"min=0"`    // Number of lookup results to keep in memory.
+	reverseFlat  map[string]string
+}
+
+// defaultFields is the mapping used when no fields are configured.
+var defaultFields = map[string]string{
+	"source.ip":      "source",
+	"destination.ip": "destination",
+	"client.ip":      "client",
+	"server.ip":      "server",
+}
+
+func defaultConfig() config {
+	return config{
+		TagOnFailure: []string{"_geoip_lookup_failure"},
+		ReloadPeriod: time.Minute,
+		CacheSize:    10000,
+	}
+}
+
+// Validate validates the data contained in the config.
+func (c *config) Validate() error {
+	if c.Database == "" && c.ASNDatabase == "" {
+		return errors.New("at least one of database or asn_database must be set")
+	}
+
+	if len(c.Fields) == 0 {
+		c.reverseFlat = defaultFields
+		return nil
+	}
+
+	// Flatten the mapping of source fields to target fields.
+	c.reverseFlat = map[string]string{}
+	for k, v := range c.Fields.Flatten() {
+		target, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("target field for geoip lookup of %v "+
+				"must be a string but got %T", k, v)
+		}
+		c.reverseFlat[k] = target
+	}
+	return nil
+}
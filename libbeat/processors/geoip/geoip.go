@@ -0,0 +1,333 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	libatomic "github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const logName = "processor.geoip"
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = libatomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin("geoip", New)
+	jsprocessor.RegisterPlugin("GeoIP", New)
+}
+
+// lookupResult holds the ECS geo and as objects found for an IP. Either may
+// be nil when the corresponding database has no record for the IP.
+type lookupResult struct {
+	geo mapstr.M
+	as  mapstr.M
+}
+
+type processor struct {
+	config
+	geoDB *database
+	asnDB *database
+	cache *lru.Cache
+	log   *logp.Logger
+
+	// nextReload is the Unix time in nanoseconds of the next check for
+	// database changes.
+	nextReload atomic.Int64
+
+	metricsName string
+	hits        *monitoring.Int
+	misses      *monitoring.Int
+	reloads     *monitoring.Int
+}
+
+// New constructs a new geoip processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the geoip configuration: %w", err)
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id          = int(instanceID.Inc())
+		log         = logp.NewLogger(logName).With("instance_id", id)
+		metricsName = logName + "." + strconv.Itoa(id)
+		metrics     = monitoring.Default.NewRegistry(metricsName, monitoring.DoNotReport)
+	)
+
+	p := &processor{
+		config:      c,
+		log:         log,
+		metricsName: metricsName,
+		hits:        monitoring.NewInt(metrics, "cache.hits"),
+		misses:      monitoring.NewInt(metrics, "cache.misses"),
+		reloads:     monitoring.NewInt(metrics, "reloads"),
+	}
+
+	var err error
+	if c.Database != "" {
+		p.geoDB, err = openTypedDatabase(c.Database, "City", "Country")
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	if c.ASNDatabase != "" {
+		p.asnDB, err = openTypedDatabase(c.ASNDatabase, "ASN")
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	if c.CacheSize > 0 {
+		p.cache, err = lru.New(c.CacheSize)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	p.nextReload.Store(time.Now().Add(c.ReloadPeriod).UnixNano())
+
+	return p, nil
+}
+
+// openTypedDatabase opens the database at path, relative paths being resolved
+// against the configuration path, and checks that its type contains one of
+// the given kinds.
+func openTypedDatabase(path string, kinds ...string) (*database, error) {
+	db, err := openDatabase(paths.Resolve(paths.Config, path))
+	if err != nil {
+		return nil, err
+	}
+	dbType := db.databaseType()
+	for _, kind := range kinds {
+		if strings.Contains(dbType, kind) {
+			return db, nil
+		}
+	}
+	db.Close()
+	return nil, fmt.Errorf("geoip database %s has type %q, expected one of %v", path, dbType, kinds)
+}
+
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	p.maybeReload()
+
+	tagged := false
+	for field, target := range p.reverseFlat {
+		if err := p.processField(field, target, event); err != nil {
+			p.log.Debugf("GeoIP processor failed: %v", err)
+			if !tagged {
+				_ = mapstr.AddTags(event.Fields, p.TagOnFailure)
+				tagged = true
+			}
+		}
+	}
+	return event, nil
+}
+
+func (p *processor) processField(source, target string, event *beat.Event) error {
+	v, err := event.GetValue(source)
+	if err != nil {
+		//nolint:nilerr // an empty source field isn't considered an error for this processor
+		return nil
+	}
+
+	strVal, ok := v.(string)
+	if !ok {
+		return nil
+	}
+
+	result, err := p.lookup(strVal)
+	if err != nil {
+		return fmt.Errorf("geoip lookup of %s value '%s' failed: %w", source, strVal, err)
+	}
+
+	// Cached results are shared, so each event gets its own copy.
+	if result.geo != nil {
+		if _, err := event.PutValue(target+".geo", result.geo.Clone()); err != nil {
+			return err
+		}
+	}
+	if result.as != nil {
+		if _, err := event.PutValue(target+".as", result.as.Clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *processor) lookup(value string) (lookupResult, error) {
+	if p.cache != nil {
+		if cached, found := p.cache.Get(value); found {
+			p.hits.Inc()
+			return cached.(lookupResult), nil
+		}
+		p.misses.Inc()
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return lookupResult{}, errors.New("invalid IP address")
+	}
+
+	var result lookupResult
+	if p.geoDB != nil {
+		var rec geoRecord
+		found, err := p.geoDB.lookup(ip, &rec)
+		if err != nil {
+			return lookupResult{}, err
+		}
+		if found {
+			result.geo = rec.toECS()
+		}
+	}
+	if p.asnDB != nil {
+		var rec asnRecord
+		found, err := p.asnDB.lookup(ip, &rec)
+		if err != nil {
+			return lookupResult{}, err
+		}
+		if found {
+			result.as = rec.toECS()
+		}
+	}
+
+	if p.cache != nil {
+		p.cache.Add(value, result)
+	}
+	return result, nil
+}
+
+// maybeReload checks the databases for changes once per reload period and
+// purges the cache when one of them was reloaded. Only one caller performs
+// the check, concurrent events continue using the current databases.
+func (p *processor) maybeReload() {
+	if p.ReloadPeriod <= 0 {
+		return
+	}
+	now := time.Now()
+	next := p.nextReload.Load()
+	if now.UnixNano() < next || !p.nextReload.CompareAndSwap(next, now.Add(p.ReloadPeriod).UnixNano()) {
+		return
+	}
+
+	reloaded := false
+	for _, db := range []*database{p.geoDB, p.asnDB} {
+		if db == nil {
+			continue
+		}
+		changed, err := db.reload()
+		if err != nil {
+			p.log.Warnf("Failed to reload geoip database, the previous version is still in use: %v", err)
+			continue
+		}
+		if changed {
+			p.log.Infof("Reloaded geoip database %s", db.path)
+			reloaded = true
+		}
+	}
+	if reloaded {
+		p.reloads.Inc()
+		if p.cache != nil {
+			p.cache.Purge()
+		}
+	}
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("geoip=[database=%v, asn_database=%v, fields=%v]",
+		p.Database, p.ASNDatabase, p.reverseFlat)
+}
+
+// Close closes the databases and removes the metrics of the processor.
+func (p *processor) Close() error {
+	var errs []error
+	for _, db := range []*database{p.geoDB, p.asnDB} {
+		if db != nil {
+			errs = append(errs, db.Close())
+		}
+	}
+	monitoring.Default.Remove(p.metricsName)
+	return errors.Join(errs...)
+}
+
+func (r *geoRecord) toECS() mapstr.M {
+	geo := mapstr.M{}
+	putString(geo, "continent_code", r.Continent.Code)
+	putString(geo, "continent_name", r.Continent.Names["en"])
+	putString(geo, "country_iso_code", r.Country.IsoCode)
+	putString(geo, "country_name", r.Country.Names["en"])
+	if len(r.Subdivisions) > 0 {
+		region := r.Subdivisions[0]
+		if region.IsoCode != "" && r.Country.IsoCode != "" {
+			geo["region_iso_code"] = r.Country.IsoCode + "-" + region.IsoCode
+		}
+		putString(geo, "region_name", region.Names["en"])
+	}
+	putString(geo, "city_name", r.City.Names["en"])
+	putString(geo, "postal_code", r.Postal.Code)
+	putString(geo, "timezone", r.Location.TimeZone)
+	if r.Location.Latitude != nil && r.Location.Longitude != nil {
+		geo["location"] = mapstr.M{
+			"lat": *r.Location.Latitude,
+			"lon": *r.Location.Longitude,
+		}
+	}
+	if len(geo) == 0 {
+		return nil
+	}
+	return geo
+}
+
+func (r *asnRecord) toECS() mapstr.M {
+	as := mapstr.M{}
+	if r.Number != 0 {
+		as["number"] = r.Number
+	}
+	if r.Organization != "" {
+		as["organization"] = mapstr.M{"name": r.Organization}
+	}
+	if len(as) == 0 {
+		return nil
+	}
+	return as
+}
+
+func putString(m mapstr.M, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
@@ -0,0 +1,208 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var (
+	cityDB    = filepath.Join("..", "..", "..", "testing", "environments", "GeoLite2-City.mmdb")
+	countryDB = filepath.Join("..", "..", "..", "testing", "environments", "GeoLite2-Country.mmdb")
+	asnDB     = filepath.Join("..", "..", "..", "testing", "environments", "GeoLite2-ASN.mmdb")
+)
+
+var linkopingGeo = mapstr.M{
+	"continent_code":   "EU",
+	"continent_name":   "Europe",
+	"country_iso_code": "SE",
+	"country_name":     "Sweden",
+	"region_iso_code":  "SE-E",
+	"region_name":      "Östergötland County",
+	"city_name":        "Linköping",
+	"timezone":         "Europe/Stockholm",
+	"location":         mapstr.M{"lat": 58.4167, "lon": 15.6167},
+}
+
+func TestGeoIP(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"database":     cityDB,
+		"asn_database": asnDB,
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"source":      mapstr.M{"ip": "89.160.20.128"},
+		"destination": mapstr.M{"ip": "10.1.1.1"},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, mapstr.M{
+		"source": mapstr.M{
+			"ip":  "89.160.20.128",
+			"geo": linkopingGeo,
+			"as": mapstr.M{
+				"number":       uint32(29518),
+				"organization": mapstr.M{"name": "Bredband2 AB"},
+			},
+		},
+		"destination": mapstr.M{"ip": "10.1.1.1"},
+	}, event.Fields)
+}
+
+func TestGeoIPCountryDatabase(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"database": countryDB,
+		"fields":   map[string]interface{}{"host.ip": "host"},
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"host":   mapstr.M{"ip": "89.160.20.128"},
+		"source": mapstr.M{"ip": "89.160.20.128"},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, mapstr.M{
+		"host": mapstr.M{
+			"ip": "89.160.20.128",
+			"geo": mapstr.M{
+				"continent_code":   "EU",
+				"continent_name":   "Europe",
+				"country_iso_code": "SE",
+				"country_name":     "Sweden",
+			},
+		},
+		"source": mapstr.M{"ip": "89.160.20.128"},
+	}, event.Fields)
+}
+
+func TestGeoIPInvalidIP(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"database": cityDB,
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"source":      mapstr.M{"ip": "not an ip"},
+		"destination": mapstr.M{"ip": "invalid"},
+	}})
+	require.NoError(t, err)
+
+	tags, err := event.GetValue("tags")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_geoip_lookup_failure"}, tags)
+}
+
+func TestGeoIPCache(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"database": cityDB,
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	for i := 0; i < 3; i++ {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{
+			"source": mapstr.M{"ip": "89.160.20.128"},
+		}})
+		require.NoError(t, err)
+
+		// Modifying the event must not modify the cached result.
+		_, err = event.PutValue("source.geo.city_name", "modified")
+		require.NoError(t, err)
+	}
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"source": mapstr.M{"ip": "89.160.20.128"},
+	}})
+	require.NoError(t, err)
+	city, _ := event.GetValue("source.geo.city_name")
+	assert.Equal(t, "Linköping", city)
+
+	gp := p.(*processor)
+	assert.EqualValues(t, 1, gp.misses.Get())
+	assert.EqualValues(t, 3, gp.hits.Get())
+}
+
+func TestGeoIPReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.mmdb")
+	copyFile(t, cityDB, path)
+
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"database":      path,
+		"reload_period": "1ms",
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+	lookupCity := func() interface{} {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{
+			"source": mapstr.M{"ip": "89.160.20.128"},
+		}})
+		require.NoError(t, err)
+		city, _ := event.GetValue("source.geo.city_name")
+		return city
+	}
+
+	assert.Equal(t, "Linköping", lookupCity())
+
+	// Atomically replace the database with a Country database that has no
+	// city names.
+	copyFile(t, countryDB, path+".tmp")
+	require.NoError(t, os.Rename(path+".tmp", path))
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Nil(t, lookupCity())
+	assert.EqualValues(t, 1, p.(*processor).reloads.Get())
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no database":         {"cache_size": 10},
+		"missing database":    {"database": filepath.Join(t.TempDir(), "missing.mmdb")},
+		"wrong database type": {"asn_database": cityDB},
+		"invalid fields":      {"database": cityDB, "fields": map[string]interface{}{"source.ip": 1}},
+	}
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := conf.NewConfigFrom(c)
+			require.NoError(t, err)
+			_, err = New(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dst, data, 0o600))
+}
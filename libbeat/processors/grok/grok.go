@@ -0,0 +1,137 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gogrok "github.com/elastic/go-grok"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+// matcher holds the compiled grok expressions in the order in which they
+// are tried against a value.
+type matcher struct {
+	patterns []string
+	exprs    []*gogrok.Grok
+}
+
+// newMatcher compiles each pattern using the bundled pattern library
+// extended with the given definitions. Only named captures are extracted.
+func newMatcher(patterns []string, definitions map[string]string) (*matcher, error) {
+	m := &matcher{patterns: patterns}
+	for i, pattern := range patterns {
+		g, err := gogrok.NewComplete(definitions)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.Compile(pattern, true); err != nil {
+			return nil, fmt.Errorf("failed to compile pattern %d (%q): %w", i, pattern, err)
+		}
+		m.exprs = append(m.exprs, g)
+	}
+	return m, nil
+}
+
+// match applies the patterns in order and returns the captures of the first
+// one that matches together with its index. The index is -1 if none matched.
+func (m *matcher) match(s string) (mapstr.M, int, error) {
+	for i, g := range m.exprs {
+		captures, err := g.ParseTypedString(s)
+		if err != nil {
+			return nil, i, fmt.Errorf("failed to convert captures of pattern %d: %w", i, err)
+		}
+		// An empty result is returned both when the pattern does not match
+		// and when it matches without capturing anything.
+		if len(captures) == 0 && !g.MatchString(s) {
+			continue
+		}
+		return mapstr.M(captures), i, nil
+	}
+	return nil, -1, nil
+}
+
+// loadPatternsFiles reads pattern definitions from the files matching the
+// given globs. Relative paths are resolved against the configuration path.
+// Files use the Logstash format: one "NAME pattern" definition per line,
+// with empty lines and lines starting with '#' being ignored.
+func loadPatternsFiles(globs []string) (map[string]string, error) {
+	definitions := map[string]string{}
+	for _, glob := range globs {
+		if !filepath.IsAbs(glob) {
+			glob = paths.Resolve(paths.Config, glob)
+		}
+		files, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid patterns_files glob %q: %w", glob, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no patterns files found matching %q", glob)
+		}
+		for _, file := range files {
+			if err := readPatternsFile(file, definitions); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return definitions, nil
+}
+
+func readPatternsFile(path string, definitions map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open patterns file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sep := strings.IndexAny(text, " \t")
+		if sep < 0 {
+			return fmt.Errorf("invalid pattern definition in %s at line %d: %q", path, line, text)
+		}
+		name, pattern := text[:sep], strings.TrimSpace(text[sep:])
+		definitions[name] = pattern
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read patterns file %s: %w", path, err)
+	}
+	return nil
+}
+
+// mergeDefinitions returns the union of the given definitions. Later maps
+// take precedence over earlier ones.
+func mergeDefinitions(defs ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, d := range defs {
+		for name, pattern := range d {
+			merged[name] = pattern
+		}
+	}
+	return merged
+}
@@ -0,0 +1,242 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      map[string]interface{}
+		fields mapstr.M
+		want   mapstr.M
+	}{
+		{
+			name: "bundled patterns",
+			c: map[string]interface{}{
+				"patterns":      []string{`%{IPORHOST:client.ip} %{WORD:http.request.method} %{URIPATHPARAM:url.original}`},
+				"target_prefix": "",
+			},
+			fields: mapstr.M{"message": "10.0.0.1 GET /index.html?q=1"},
+			want: mapstr.M{
+				"message": "10.0.0.1 GET /index.html?q=1",
+				"client":  mapstr.M{"ip": "10.0.0.1"},
+				"http":    mapstr.M{"request": mapstr.M{"method": "GET"}},
+				"url":     mapstr.M{"original": "/index.html?q=1"},
+			},
+		},
+		{
+			name: "type conversion",
+			c: map[string]interface{}{
+				"patterns":      []string{`%{NUMBER:duration:float} %{INT:bytes:int} %{WORD:ok:boolean}`},
+				"target_prefix": "grok",
+			},
+			fields: mapstr.M{"message": "1.5 512 true"},
+			want: mapstr.M{
+				"message": "1.5 512 true",
+				"grok":    mapstr.M{"duration": 1.5, "bytes": 512, "ok": true},
+			},
+		},
+		{
+			name: "first matching pattern wins",
+			c: map[string]interface{}{
+				"patterns": []string{
+					`^%{INT:number}$`,
+					`^%{WORD:word}$`,
+					`^%{NOTSPACE:any}$`,
+				},
+				"target_prefix": "grok",
+			},
+			fields: mapstr.M{"message": "hello"},
+			want: mapstr.M{
+				"message": "hello",
+				"grok":    mapstr.M{"word": "hello"},
+			},
+		},
+		{
+			name: "custom pattern definitions",
+			c: map[string]interface{}{
+				"patterns":            []string{`%{SERVICE:service.name}-%{INT:service.id}`},
+				"pattern_definitions": map[string]string{"SERVICE": `[a-z]+`},
+				"target_prefix":       "",
+			},
+			fields: mapstr.M{"message": "web-42"},
+			want: mapstr.M{
+				"message": "web-42",
+				"service": mapstr.M{"name": "web", "id": "42"},
+			},
+		},
+		{
+			name: "specific field",
+			c: map[string]interface{}{
+				"patterns":      []string{`%{WORD:word}`},
+				"field":         "event.original",
+				"target_prefix": "parsed",
+			},
+			fields: mapstr.M{"event": mapstr.M{"original": "hello"}},
+			want: mapstr.M{
+				"event":  mapstr.M{"original": "hello"},
+				"parsed": mapstr.M{"word": "hello"},
+			},
+		},
+		{
+			name: "overwrite keys",
+			c: map[string]interface{}{
+				"patterns":       []string{`%{WORD:level}: %{GREEDYDATA:message}`},
+				"overwrite_keys": true,
+			},
+			fields: mapstr.M{"message": "ERROR: disk full"},
+			want: mapstr.M{
+				"message": "disk full",
+				"level":   "ERROR",
+			},
+		},
+		{
+			name: "ignore missing",
+			c: map[string]interface{}{
+				"patterns":       []string{`%{WORD:word}`},
+				"ignore_missing": true,
+			},
+			fields: mapstr.M{"other": "hello"},
+			want:   mapstr.M{"other": "hello"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := conf.NewConfigFrom(test.c)
+			require.NoError(t, err)
+
+			p, err := NewProcessor(c)
+			require.NoError(t, err)
+
+			e, err := p.Run(&beat.Event{Fields: test.fields})
+			require.NoError(t, err)
+			assert.Equal(t, test.want, e.Fields)
+		})
+	}
+}
+
+func TestProcessorFailure(t *testing.T) {
+	newEvent := func() *beat.Event {
+		return &beat.Event{Fields: mapstr.M{"message": "hello world"}}
+	}
+
+	t.Run("tags the event when no pattern matches", func(t *testing.T) {
+		p, err := NewProcessor(conf.MustNewConfigFrom(mapstr.M{
+			"patterns": []string{`^%{INT:a}$`, `^%{IP:b}$`},
+		}))
+		require.NoError(t, err)
+
+		e, err := p.Run(newEvent())
+		assert.ErrorIs(t, err, errNoMatch)
+		assert.Equal(t, mapstr.M{
+			"message": "hello world",
+			"log":     mapstr.M{"flags": []string{flagParsingError}},
+		}, e.Fields)
+	})
+
+	t.Run("ignore failure", func(t *testing.T) {
+		p, err := NewProcessor(conf.MustNewConfigFrom(mapstr.M{
+			"patterns":       []string{`^%{INT:a}$`},
+			"ignore_failure": true,
+		}))
+		require.NoError(t, err)
+
+		e, err := p.Run(newEvent())
+		assert.NoError(t, err)
+		flags, err := e.GetValue(beat.FlagField)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{flagParsingError}, flags)
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		p, err := NewProcessor(conf.MustNewConfigFrom(mapstr.M{
+			"patterns": []string{`%{WORD:word}`},
+			"field":    "other",
+		}))
+		require.NoError(t, err)
+
+		_, err = p.Run(newEvent())
+		assert.ErrorIs(t, err, mapstr.ErrKeyNotFound)
+	})
+
+	t.Run("existing key is not overwritten", func(t *testing.T) {
+		p, err := NewProcessor(conf.MustNewConfigFrom(mapstr.M{
+			"patterns": []string{`%{WORD:message} %{WORD:other}`},
+		}))
+		require.NoError(t, err)
+
+		e, err := p.Run(newEvent())
+		assert.Error(t, err)
+		assert.Equal(t, mapstr.M{"message": "hello world"}, e.Fields)
+	})
+}
+
+func TestProcessorPatternsFiles(t *testing.T) {
+	p, err := NewProcessor(conf.MustNewConfigFrom(mapstr.M{
+		"patterns":       []string{`%{APP_LINE}`},
+		"patterns_files": []string{filepath.Join("testdata", "*")},
+		"overwrite_keys": true,
+	}))
+	require.NoError(t, err)
+
+	e, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"message": "2024-05-01T10:00:00Z WARN\tlow disk space",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{
+		"timestamp": "2024-05-01T10:00:00Z",
+		"log":       mapstr.M{"level": "WARN"},
+		"message":   "low disk space",
+	}, e.Fields)
+}
+
+func TestNewProcessorErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalidFile := filepath.Join(dir, "invalid")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("NO_PATTERN\n"), 0o600))
+
+	tests := map[string]map[string]interface{}{
+		"no patterns":       {"field": "message"},
+		"empty pattern":     {"patterns": []string{""}},
+		"unknown pattern":   {"patterns": []string{`%{DOES_NOT_EXIST:a}`}},
+		"invalid regexp":    {"patterns": []string{`(?<=a)%{WORD:a}`}},
+		"missing file":      {"patterns": []string{`%{WORD:a}`}, "patterns_files": []string{filepath.Join(dir, "missing")}},
+		"invalid file line": {"patterns": []string{`%{WORD:a}`}, "patterns_files": []string{invalidFile}},
+	}
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := conf.NewConfigFrom(c)
+			require.NoError(t, err)
+			_, err = NewProcessor(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
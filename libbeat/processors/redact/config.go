@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// config defines the configuration options for the redact processor.
+type config struct {
+	Fields  []string     `config:"fields"`                    // Fields to scan.
+	Rules   []ruleConfig `config:"rules" validate:"required"` // Rules applied in order to each field.
+	HMACKey string       `config:"hmac_key"`                  // Secret used by the hash action.
+}
+
+// ruleConfig defines what a rule detects and how matches are redacted.
+type ruleConfig struct {
+	Name        string       `config:"name"`
+	Detector    detectorType `config:"detector" validate:"required"`
+	Pattern     string       `config:"pattern"`
+	Action      actionType   `config:"action"`
+	Replacement *string      `config:"replacement"`
+	Mask        maskConfig   `config:"mask"`
+}
+
+// maskConfig defines how many characters the mask action keeps visible.
+type maskConfig struct {
+	KeepFirst int    `config:"keep_first" validate:"min=0"`
+	KeepLast  int    `config:"keep_last"  validate:"min=0"`
+	Char      string `config:"char"`
+}
+
+var validRuleName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func defaultConfig() config {
+	return config{
+		Fields: []string{"message"},
+	}
+}
+
+// Validate validates the data contained in the config and sets the rule
+// defaults.
+func (c *config) Validate() error {
+	names := map[string]bool{}
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			r.Name = r.Detector.String()
+		}
+		if !validRuleName.MatchString(r.Name) {
+			return fmt.Errorf("invalid rule name '%v', only letters, digits, '_' and '-' are allowed", r.Name)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("duplicate rule name '%v', set a unique name on each rule", r.Name)
+		}
+		names[r.Name] = true
+
+		if r.Detector == detectorRegex {
+			if r.Pattern == "" {
+				return fmt.Errorf("rule '%v' uses the regex detector but has no pattern", r.Name)
+			}
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				return fmt.Errorf("invalid pattern in rule '%v': %w", r.Name, err)
+			}
+		} else if r.Pattern != "" {
+			return fmt.Errorf("rule '%v' sets a pattern but uses the %v detector", r.Name, r.Detector)
+		}
+
+		if r.Action == actionHash && c.HMACKey == "" {
+			return fmt.Errorf("rule '%v' uses the hash action but no hmac_key is set", r.Name)
+		}
+		if r.Replacement == nil {
+			replacement := "[REDACTED]"
+			r.Replacement = &replacement
+		}
+		if r.Mask.Char == "" {
+			r.Mask.Char = "*"
+		}
+	}
+	return nil
+}
+
+// detectorType identifies a built-in detector.
+type detectorType uint8
+
+const (
+	detectorEmail detectorType = iota + 1
+	detectorCreditCard
+	detectorIBAN
+	detectorIP
+	detectorIPv4
+	detectorIPv6
+	detectorJWT
+	detectorRegex
+)
+
+var detectorNames = map[detectorType]string{
+	detectorEmail:      "email",
+	detectorCreditCard: "credit_card",
+	detectorIBAN:       "iban",
+	detectorIP:         "ip",
+	detectorIPv4:       "ipv4",
+	detectorIPv6:       "ipv6",
+	detectorJWT:        "jwt",
+	detectorRegex:      "regex",
+}
+
+func (d detectorType) String() string {
+	return detectorNames[d]
+}
+
+// Unpack unpacks a string to a detectorType.
+func (d *detectorType) Unpack(v string) error {
+	v = strings.ToLower(v)
+	for t, name := range detectorNames {
+		if name == v {
+			*d = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid redact detector '%v' (valid values are: "+
+		"email, credit_card, iban, ip, ipv4, ipv6, jwt, regex)", v)
+}
+
+// actionType defines what is done with the matches of a rule.
+type actionType uint8
+
+const (
+	actionReplace actionType = iota
+	actionHash
+	actionMask
+	actionDrop
+)
+
+var actionNames = map[actionType]string{
+	actionReplace: "replace",
+	actionHash:    "hash",
+	actionMask:    "mask",
+	actionDrop:    "drop",
+}
+
+func (a actionType) String() string {
+	return actionNames[a]
+}
+
+// Unpack unpacks a string to an actionType.
+func (a *actionType) Unpack(v string) error {
+	switch strings.ToLower(v) {
+	case "", "replace":
+		*a = actionReplace
+	case "hash":
+		*a = actionHash
+	case "mask":
+		*a = actionMask
+	case "drop":
+		*a = actionDrop
+	default:
+		return fmt.Errorf("invalid redact action '%v' (valid values are: replace, hash, mask, drop)", v)
+	}
+	return nil
+}
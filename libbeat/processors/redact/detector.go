@@ -0,0 +1,222 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// detector finds the sensitive values in a string. Candidates found by the
+// regular expression are checked by the optional validate function, which
+// returns the start and end offsets of the accepted part of the candidate,
+// or an empty span to reject it.
+type detector struct {
+	re       *regexp.Regexp
+	validate func(candidate string) (start, end int)
+}
+
+var (
+	emailPattern      = `(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`
+	creditCardPattern = `\b\d(?:[ -]?\d){12,18}\b`
+	ibanPattern       = `\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`
+	ipv4Pattern       = `\b(?:\d{1,3}\.){3}\d{1,3}\b`
+	ipv6Pattern       = `[\w:.]*:[\w:.]*`
+	jwtPattern        = `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`
+
+	ipv4Regexp = regexp.MustCompile(ipv4Pattern)
+)
+
+func newDetector(t detectorType, pattern string) *detector {
+	switch t {
+	case detectorEmail:
+		return &detector{re: regexp.MustCompile(emailPattern)}
+	case detectorCreditCard:
+		return &detector{re: regexp.MustCompile(creditCardPattern), validate: validCreditCard}
+	case detectorIBAN:
+		return &detector{re: regexp.MustCompile(ibanPattern), validate: validIBAN}
+	case detectorIP:
+		return &detector{re: regexp.MustCompile(ipv6Pattern + "|" + ipv4Pattern), validate: validIP}
+	case detectorIPv4:
+		return &detector{re: regexp.MustCompile(ipv4Pattern), validate: validIP}
+	case detectorIPv6:
+		return &detector{re: regexp.MustCompile(ipv6Pattern), validate: validIPv6}
+	case detectorJWT:
+		return &detector{re: regexp.MustCompile(jwtPattern)}
+	default:
+		// The pattern was compiled during config validation.
+		return &detector{re: regexp.MustCompile(pattern)}
+	}
+}
+
+// find returns the start and end offsets of the sensitive values in s.
+func (d *detector) find(s string) [][]int {
+	matches := d.re.FindAllStringIndex(s, -1)
+	if d.validate == nil {
+		return matches
+	}
+
+	valid := matches[:0]
+	for _, m := range matches {
+		if start, end := d.validate(s[m[0]:m[1]]); end > start {
+			valid = append(valid, []int{m[0] + start, m[0] + end})
+		}
+	}
+	return valid
+}
+
+// validCreditCard accepts card numbers of 13 to 19 digits, optionally
+// grouped with spaces or dashes, with a valid Luhn check digit.
+func validCreditCard(candidate string) (start, end int) {
+	return longestValidSpan(candidate, " -", func(s string) bool {
+		digits := onlyDigits(s)
+		return len(digits) >= 13 && len(digits) <= 19 && luhnValid(digits)
+	})
+}
+
+// longestValidSpan returns the longest run of groups of candidate, delimited
+// by one of seps, that passes check. The leftmost one wins between runs of
+// the same length. This lets a number surrounded by unrelated digits, as in
+// "4111 1111 1111 1111 12" or "qty 2 4111 1111 1111 1111", still be
+// detected.
+func longestValidSpan(candidate, seps string, check func(string) bool) (start, end int) {
+	starts := []int{0}
+	var ends []int
+	for i, r := range candidate {
+		if strings.ContainsRune(seps, r) {
+			ends = append(ends, i)
+			starts = append(starts, i+1)
+		}
+	}
+	ends = append(ends, len(candidate))
+
+	for n := len(starts); n > 0; n-- {
+		for first := 0; first+n <= len(starts); first++ {
+			start, end = starts[first], ends[first+n-1]
+			if check(candidate[start:end]) {
+				return start, end
+			}
+		}
+	}
+	return 0, 0
+}
+
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// validIBAN accepts IBANs, optionally grouped with spaces, that pass the
+// ISO 7064 mod 97 check.
+func validIBAN(candidate string) (start, end int) {
+	return longestValidSpan(candidate, " ", func(s string) bool {
+		iban := strings.ReplaceAll(s, " ", "")
+		if len(iban) < 15 || len(iban) > 34 {
+			return false
+		}
+
+		// Move the country code and check digits to the end, replace each
+		// letter with two digits (A = 10, ..., Z = 35) and compute the
+		// remainder of the resulting number digit by digit.
+		rem := 0
+		for _, r := range iban[4:] + iban[:4] {
+			switch {
+			case r >= '0' && r <= '9':
+				rem = (rem*10 + int(r-'0')) % 97
+			case r >= 'A' && r <= 'Z':
+				rem = (rem*100 + int(r-'A') + 10) % 97
+			default:
+				return false
+			}
+		}
+		return rem == 1
+	})
+}
+
+// validIP accepts IPv4 and IPv6 addresses. Trailing colons and dots, as in
+// "connecting to 10.0.0.1: timeout", are not part of the address. Candidates
+// that are not an IPv6 address, as "10.0.0.1:8080" matched by the IPv6
+// pattern, are searched for an IPv4 address.
+func validIP(candidate string) (start, end int) {
+	if trimmed := trimAddress(candidate); isIPv6(trimmed) {
+		return 0, len(trimmed)
+	}
+	for _, m := range ipv4Regexp.FindAllStringIndex(candidate, -1) {
+		if net.ParseIP(candidate[m[0]:m[1]]) != nil {
+			return m[0], m[1]
+		}
+	}
+	return 0, 0
+}
+
+// validIPv6 accepts IPv6 addresses, including IPv4-mapped ones written in
+// IPv6 notation.
+func validIPv6(candidate string) (start, end int) {
+	trimmed := trimAddress(candidate)
+	if !isIPv6(trimmed) {
+		return 0, 0
+	}
+	return 0, len(trimmed)
+}
+
+// isIPv6 reports whether s is an IPv6 address with at least two groups, or
+// a compressed address starting with "::" as "::1". The IPv6 pattern matches
+// whole words, so namespaces as "ActiveRecord::Base" are rejected by
+// net.ParseIP, and requiring two groups rejects the "::" and "d::" left of
+// namespaces made only of hex digits.
+func isIPv6(s string) bool {
+	if !strings.Contains(s, ":") || net.ParseIP(s) == nil {
+		return false
+	}
+	groups := 0
+	for _, group := range strings.Split(s, ":") {
+		if group != "" {
+			groups++
+		}
+	}
+	return groups >= 2 || (groups == 1 && strings.HasPrefix(s, "::"))
+}
+
+func trimAddress(s string) string {
+	if strings.HasSuffix(s, "::") {
+		return strings.TrimRight(s, ".")
+	}
+	return strings.TrimRight(s, ".:")
+}
@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/atomic"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const logName = "processor.redact"
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID = atomic.MakeUint32(0)
+
+func init() {
+	processors.RegisterPlugin("redact", New)
+	jsprocessor.RegisterPlugin("Redact", New)
+}
+
+type processor struct {
+	config
+	rules       []*rule
+	log         *logp.Logger
+	metricsName string
+}
+
+// rule is a configured rule with its detector and match counter.
+type rule struct {
+	ruleConfig
+	detector *detector
+	hmacKey  []byte
+	matches  *monitoring.Int
+}
+
+// New constructs a new redact processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the redact configuration: %w", err)
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id          = int(instanceID.Inc())
+		log         = logp.NewLogger(logName).With("instance_id", id)
+		metricsName = logName + "." + strconv.Itoa(id)
+		metrics     = monitoring.Default.NewRegistry(metricsName, monitoring.DoNotReport)
+		rulesReg    = metrics.NewRegistry("rules")
+	)
+
+	p := &processor{config: c, log: log, metricsName: metricsName}
+	for _, rc := range c.Rules {
+		p.rules = append(p.rules, &rule{
+			ruleConfig: rc,
+			detector:   newDetector(rc.Detector, rc.Pattern),
+			hmacKey:    []byte(c.HMACKey),
+			matches:    monitoring.NewInt(rulesReg.NewRegistry(rc.Name), "matches"),
+		})
+	}
+	return p, nil
+}
+
+// Run applies the rules in order to each configured field. Fields that are
+// missing or do not contain a string are left untouched.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	for _, field := range p.Fields {
+		v, err := event.GetValue(field)
+		if err != nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+
+		redacted, drop := p.redact(s)
+		switch {
+		case drop:
+			if err := event.Delete(field); err != nil {
+				return event, fmt.Errorf("failed to drop field [%v]: %w", field, err)
+			}
+		case redacted != s:
+			if _, err := event.PutValue(field, redacted); err != nil {
+				return event, fmt.Errorf("failed to write redacted value to field [%v]: %w", field, err)
+			}
+		}
+	}
+	return event, nil
+}
+
+// redact returns s with the matches of all rules redacted. It reports whether
+// a rule with the drop action matched, in which case the field must be removed.
+func (p *processor) redact(s string) (string, bool) {
+	for _, r := range p.rules {
+		matches := r.detector.find(s)
+		if len(matches) == 0 {
+			continue
+		}
+		r.matches.Add(int64(len(matches)))
+		if r.Action == actionDrop {
+			return "", true
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			b.WriteString(s[last:m[0]])
+			b.WriteString(r.apply(s[m[0]:m[1]]))
+			last = m[1]
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s, false
+}
+
+// apply returns the redacted form of a single match.
+func (r *rule) apply(match string) string {
+	switch r.Action {
+	case actionHash:
+		mac := hmac.New(sha256.New, r.hmacKey)
+		mac.Write([]byte(match))
+		return hex.EncodeToString(mac.Sum(nil))
+	case actionMask:
+		return mask(match, r.Mask)
+	default:
+		return *r.Replacement
+	}
+}
+
+// mask replaces the letters and digits of s with the mask character, except
+// for the first and last characters the configuration keeps. Separators such
+// as spaces, dashes or dots are preserved.
+func mask(s string, c maskConfig) string {
+	maskChar := []rune(c.Char)[0]
+	runes := []rune(s)
+	for i, r := range runes {
+		if i < c.KeepFirst || i >= len(runes)-c.KeepLast {
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			runes[i] = maskChar
+		}
+	}
+	return string(runes)
+}
+
+func (p *processor) String() string {
+	names := make([]string, 0, len(p.rules))
+	for _, r := range p.rules {
+		names = append(names, r.Name+":"+r.Detector.String()+":"+r.Action.String())
+	}
+	return fmt.Sprintf("redact=[fields=%v, rules=[%v]]", p.Fields, strings.Join(names, ", "))
+}
+
+// Close removes the metrics of the processor.
+func (p *processor) Close() error {
+	monitoring.Default.Remove(p.metricsName)
+	return nil
+}
@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      map[string]interface{}
+		fields mapstr.M
+		want   mapstr.M
+	}{
+		{
+			name: "replace",
+			c: map[string]interface{}{
+				"rules": []map[string]interface{}{{"detector": "email"}},
+			},
+			fields: mapstr.M{"message": "mail from alice@example.com"},
+			want:   mapstr.M{"message": "mail from [REDACTED]"},
+		},
+		{
+			name: "custom replacement",
+			c: map[string]interface{}{
+				"rules": []map[string]interface{}{{"detector": "ipv4", "replacement": "<ip>"}},
+			},
+			fields: mapstr.M{"message": "from 10.0.0.1 to 10.0.0.2"},
+			want:   mapstr.M{"message": "from <ip> to <ip>"},
+		},
+		{
+			name: "mask",
+			c: map[string]interface{}{
+				"rules": []map[string]interface{}{{
+					"detector": "credit_card",
+					"action":   "mask",
+					"mask":     map[string]interface{}{"keep_last": 4},
+				}},
+			},
+			fields: mapstr.M{"message": "card 4111 1111 1111 1111"},
+			want:   mapstr.M{"message": "card **** **** **** 1111"},
+		},
+		{
+			name: "mask keep first with custom char",
+			c: map[string]interface{}{
+				"rules": []map[string]interface{}{{
+					"detector": "iban",
+					"action":   "mask",
+					"mask":     map[string]interface{}{"keep_first": 4, "char": "#"},
+				}},
+			},
+			fields: mapstr.M{"message": "iban GB82 WEST 1234 5698 7654 32"},
+			want:   mapstr.M{"message": "iban GB82 #### #### #### #### ##"},
+		},
+		{
+			name: "drop field",
+			c: map[string]interface{}{
+				"fields": []string{"message", "user.name"},
+				"rules":  []map[string]interface{}{{"detector": "jwt", "action": "drop"}},
+			},
+			fields: mapstr.M{
+				"message": "token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.abc",
+				"user":    mapstr.M{"name": "alice"},
+			},
+			want: mapstr.M{"user": mapstr.M{"name": "alice"}},
+		},
+		{
+			name: "rules applied in order to multiple fields",
+			c: map[string]interface{}{
+				"fields": []string{"message", "user.email", "missing", "count"},
+				"rules": []map[string]interface{}{
+					{"detector": "email"},
+					{"name": "secrets", "detector": "regex", "pattern": `secret=\S+`, "replacement": "secret=***"},
+				},
+			},
+			fields: mapstr.M{
+				"message": "login bob@example.org secret=hunter2",
+				"user":    mapstr.M{"email": "bob@example.org"},
+				"count":   3,
+			},
+			want: mapstr.M{
+				"message": "login [REDACTED] secret=***",
+				"user":    mapstr.M{"email": "[REDACTED]"},
+				"count":   3,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(test.c))
+			require.NoError(t, err)
+			defer p.(*processor).Close()
+
+			event, err := p.Run(&beat.Event{Fields: test.fields})
+			require.NoError(t, err)
+			assert.Equal(t, test.want, event.Fields)
+		})
+	}
+}
+
+func TestRedactHash(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"hmac_key": "secret",
+		"rules":    []map[string]interface{}{{"detector": "email", "action": "hash"}},
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("alice@example.com"))
+	want := hex.EncodeToString(mac.Sum(nil))
+
+	for _, msg := range []string{"from alice@example.com", "to alice@example.com"} {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"message": msg}})
+		require.NoError(t, err)
+		msg, _ := event.GetValue("message")
+		assert.Contains(t, msg, want)
+		assert.NotContains(t, msg, "alice")
+	}
+}
+
+func TestRedactMetrics(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"rules": []map[string]interface{}{
+			{"detector": "email"},
+			{"detector": "ip"},
+		},
+	}))
+	require.NoError(t, err)
+	defer p.(*processor).Close()
+
+	_, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "a@example.com b@example.com from 10.0.0.1"}})
+	require.NoError(t, err)
+	_, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "nothing here"}})
+	require.NoError(t, err)
+
+	rp := p.(*processor)
+	snapshot := monitoring.CollectStructSnapshot(monitoring.Default.GetRegistry(rp.metricsName), monitoring.Full, false)
+	assert.Equal(t, map[string]interface{}{
+		"rules": map[string]interface{}{
+			"email": map[string]interface{}{"matches": int64(2)},
+			"ip":    map[string]interface{}{"matches": int64(1)},
+		},
+	}, snapshot)
+
+	require.NoError(t, rp.Close())
+	assert.Nil(t, monitoring.Default.GetRegistry(rp.metricsName))
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no rules":          {"fields": []string{"message"}},
+		"unknown detector":  {"rules": []map[string]interface{}{{"detector": "phone"}}},
+		"unknown action":    {"rules": []map[string]interface{}{{"detector": "email", "action": "encrypt"}}},
+		"regex no pattern":  {"rules": []map[string]interface{}{{"detector": "regex"}}},
+		"invalid pattern":   {"rules": []map[string]interface{}{{"detector": "regex", "pattern": "("}}},
+		"pattern unneeded":  {"rules": []map[string]interface{}{{"detector": "email", "pattern": "x"}}},
+		"duplicate names":   {"rules": []map[string]interface{}{{"detector": "email"}, {"detector": "email"}}},
+		"invalid name":      {"rules": []map[string]interface{}{{"name": "a.b", "detector": "email"}}},
+		"hash without key":  {"rules": []map[string]interface{}{{"detector": "email", "action": "hash"}}},
+		"negative mask len": {"rules": []map[string]interface{}{{"detector": "email", "action": "mask", "mask": map[string]interface{}{"keep_last": -1}}}},
+	}
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := conf.NewConfigFrom(c)
+			require.NoError(t, err)
+			_, err = New(cfg)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ua-parser/uap-go/uaparser"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const (
+	procName = "user_agent"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName, New)
+	jsprocessor.RegisterPlugin("UserAgent", New)
+}
+
+type processor struct {
+	config
+	parser *uaparser.Parser
+	cache  *lru.Cache
+	log    *logp.Logger
+}
+
+// New constructs a new processor built from ucfg config.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v processor configuration: %w", procName, err)
+	}
+
+	return newUserAgent(c)
+}
+
+func newUserAgent(c config) (*processor, error) {
+	log := logp.NewLogger(logName)
+	if c.ID != "" {
+		log = log.With("instance_id", c.ID)
+	}
+
+	parser, err := newParser(c.RegexFile)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &processor{config: c, parser: parser, log: log}
+	if c.CacheSize > 0 {
+		p.cache, err = lru.New(c.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// bundledParser is shared by all instances using the bundled regexes, as
+// compiling them is expensive.
+var bundledParser = sync.OnceValue(uaparser.NewFromSaved)
+
+// newParser returns a parser using the uap-core regexes bundled with the
+// library, or the ones read from regexFile when it is set.
+func newParser(regexFile string) (*uaparser.Parser, error) {
+	if regexFile == "" {
+		return bundledParser(), nil
+	}
+
+	data, err := os.ReadFile(paths.Resolve(paths.Config, regexFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user_agent regex file: %w", err)
+	}
+	parser, err := uaparser.NewFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse user_agent regex file %s: %w", regexFile, err)
+	}
+	return parser, nil
+}
+
+func (p *processor) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
+
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.Field)
+	if err != nil {
+		if p.IgnoreMissing || p.IgnoreFailure {
+			return event, nil
+		}
+		return event, fmt.Errorf("user_agent source field [%v] not found: %w", p.Field, err)
+	}
+
+	original, ok := v.(string)
+	if !ok {
+		if p.IgnoreFailure {
+			return event, nil
+		}
+		return event, fmt.Errorf("user_agent source field [%v] is not a string", p.Field)
+	}
+
+	// Cached results are shared, so each event gets its own copy.
+	for k, v := range p.parse(original).Clone() {
+		if _, err := event.PutValue(p.TargetField+"."+k, v); err != nil {
+			if p.IgnoreFailure {
+				return event, nil
+			}
+			return event, fmt.Errorf("failed to write user agent to target field [%v]: %w", p.TargetField, err)
+		}
+	}
+
+	return event, nil
+}
+
+// parse returns the ECS user_agent fields for the given user agent string.
+func (p *processor) parse(original string) mapstr.M {
+	if p.cache != nil {
+		if cached, found := p.cache.Get(original); found {
+			return cached.(mapstr.M)
+		}
+	}
+
+	client := p.parser.Parse(original)
+	ua := mapstr.M{
+		"original": original,
+		"name":     client.UserAgent.Family,
+	}
+	if version := joinVersion(client.UserAgent.Major, client.UserAgent.Minor, client.UserAgent.Patch); version != "" {
+		ua["version"] = version
+	}
+
+	if client.Os.Family != "Other" {
+		osFields := mapstr.M{"name": client.Os.Family, "full": client.Os.Family}
+		if version := joinVersion(client.Os.Major, client.Os.Minor, client.Os.Patch, client.Os.PatchMinor); version != "" {
+			osFields["version"] = version
+			osFields["full"] = client.Os.Family + " " + version
+		}
+		ua["os"] = osFields
+	}
+
+	ua["device"] = mapstr.M{"name": client.Device.Family}
+
+	if p.cache != nil {
+		p.cache.Add(original, ua)
+	}
+	return ua
+}
+
+// joinVersion joins the leading non-empty version components with dots.
+func joinVersion(parts ...string) string {
+	for i, part := range parts {
+		if part == "" {
+			parts = parts[:i]
+			break
+		}
+	}
+	return strings.Join(parts, ".")
+}
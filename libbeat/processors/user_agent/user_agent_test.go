@@ -0,0 +1,151 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const chromeMac = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.103 Safari/537.36"
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      map[string]interface{}
+		fields mapstr.M
+		want   mapstr.M
+	}{
+		{
+			name:   "bundled regexes",
+			fields: mapstr.M{"user_agent": mapstr.M{"original": chromeMac}},
+			want: mapstr.M{"user_agent": mapstr.M{
+				"original": chromeMac,
+				"name":     "Chrome",
+				"version":  "51.0.2704",
+				"os": mapstr.M{
+					"name":    "Mac OS X",
+					"version": "10.12.5",
+					"full":    "Mac OS X 10.12.5",
+				},
+				"device": mapstr.M{"name": "Mac"},
+			}},
+		},
+		{
+			name:   "unknown user agent",
+			fields: mapstr.M{"user_agent": mapstr.M{"original": "something"}},
+			want: mapstr.M{"user_agent": mapstr.M{
+				"original": "something",
+				"name":     "Other",
+				"device":   mapstr.M{"name": "Other"},
+			}},
+		},
+		{
+			name: "custom field and regex file",
+			c: map[string]interface{}{
+				"field":        "http.request.headers.user_agent",
+				"target_field": "client.user_agent",
+				"regex_file":   "testdata/regexes.yaml",
+			},
+			fields: mapstr.M{"http": mapstr.M{"request": mapstr.M{"headers": mapstr.M{
+				"user_agent": "InventoryAgent/2.7 (RouterOS 6.48; model=RB4011)",
+			}}}},
+			want: mapstr.M{
+				"http": mapstr.M{"request": mapstr.M{"headers": mapstr.M{
+					"user_agent": "InventoryAgent/2.7 (RouterOS 6.48; model=RB4011)",
+				}}},
+				"client": mapstr.M{"user_agent": mapstr.M{
+					"original": "InventoryAgent/2.7 (RouterOS 6.48; model=RB4011)",
+					"name":     "InventoryAgent",
+					"version":  "2.7",
+					"os": mapstr.M{
+						"name":    "RouterOS",
+						"version": "6.48",
+						"full":    "RouterOS 6.48",
+					},
+					"device": mapstr.M{"name": "RB4011"},
+				}},
+			},
+		},
+		{
+			name:   "ignore missing",
+			c:      map[string]interface{}{"ignore_missing": true},
+			fields: mapstr.M{"message": "hello"},
+			want:   mapstr.M{"message": "hello"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(test.c))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: test.fields})
+			require.NoError(t, err)
+			assert.Equal(t, test.want, event.Fields)
+		})
+	}
+}
+
+func TestUserAgentErrors(t *testing.T) {
+	p, err := New(conf.NewConfig())
+	require.NoError(t, err)
+
+	_, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "hello"}})
+	assert.ErrorIs(t, err, mapstr.ErrKeyNotFound)
+
+	_, err = p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": 1}}})
+	assert.Error(t, err)
+
+	c, err := conf.NewConfigFrom(map[string]interface{}{"regex_file": "testdata/missing.yaml"})
+	require.NoError(t, err)
+	_, err = New(c)
+	assert.Error(t, err)
+}
+
+func TestUserAgentCache(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{"cache_size": 1}))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": chromeMac}}})
+		require.NoError(t, err)
+
+		// Modifying the event must not modify the cached result.
+		_, err = event.PutValue("user_agent.os.name", "modified")
+		require.NoError(t, err)
+	}
+
+	cached, found := p.(*processor).cache.Get(chromeMac)
+	require.True(t, found)
+	name, err := cached.(mapstr.M).GetValue("os.name")
+	require.NoError(t, err)
+	assert.Equal(t, "Mac OS X", name)
+}
+
+func TestJoinVersion(t *testing.T) {
+	assert.Equal(t, "", joinVersion("", "1"))
+	assert.Equal(t, "1", joinVersion("1", "", "3"))
+	assert.Equal(t, "1.2.3", joinVersion("1", "2", "3"))
+}
@@ -281,6 +281,7 @@ func (c *outputController) createQueueIfNeeded(outGrp outputs.Group) {
 	}
 	maxEvents := c.queue.BufferConfig().MaxEvents
 	c.observer.queueMaxEvents(maxEvents)
+	c.observer.queueCreated(c.queue)
 
 	// Now that we've created a queue, go through and unblock any callers
 	// that are waiting for a producer.
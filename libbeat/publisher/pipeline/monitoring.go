@@ -17,7 +17,10 @@
 
 package pipeline
 
-import "github.com/elastic/elastic-agent-libs/monitoring"
+import (
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
 
 type observer interface {
 	pipelineObserver
@@ -44,6 +47,7 @@ type outputObserver interface {
 	eventsRetry(int)
 	queueACKed(n int)
 	queueMaxEvents(n int)
+	queueCreated(q queue.Queue)
 }
 
 // metricsObserver is used by many component in the publisher pipeline, to report
@@ -155,6 +159,31 @@ func (o *metricsObserver) queueMaxEvents(n int) {
 	o.vars.queueMaxEvents.Set(uint64(n))
 }
 
+// (queue) the queue in use was created. Queues that discard events on
+// their own, like the disk queue's overflow policy, report the dropped
+// totals in their metrics.
+func (o *metricsObserver) queueCreated(q queue.Queue) {
+	reg := o.metrics.GetRegistry("pipeline")
+	if reg == nil {
+		return
+	}
+	monitoring.NewFunc(reg, "queue.dropped", func(_ monitoring.Mode, V monitoring.Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+
+		metrics, err := q.Metrics()
+		if err != nil {
+			return
+		}
+		if metrics.DroppedEvents.Exists() {
+			monitoring.ReportInt(V, "events", int64(metrics.DroppedEvents.ValueOr(0)))
+		}
+		if metrics.DroppedBytes.Exists() {
+			monitoring.ReportInt(V, "bytes", int64(metrics.DroppedBytes.ValueOr(0)))
+		}
+	}, monitoring.Report)
+}
+
 //
 // pipeline output events
 //
@@ -173,14 +202,15 @@ type emptyObserver struct{}
 
 var nilObserver observer = (*emptyObserver)(nil)
 
-func (*emptyObserver) cleanup()            {}
-func (*emptyObserver) clientConnected()    {}
-func (*emptyObserver) clientClosed()       {}
-func (*emptyObserver) newEvent()           {}
-func (*emptyObserver) filteredEvent()      {}
-func (*emptyObserver) publishedEvent()     {}
-func (*emptyObserver) failedPublishEvent() {}
-func (*emptyObserver) queueACKed(n int)    {}
-func (*emptyObserver) queueMaxEvents(int)  {}
-func (*emptyObserver) eventsDropped(int)   {}
-func (*emptyObserver) eventsRetry(int)     {}
+func (*emptyObserver) cleanup()                 {}
+func (*emptyObserver) clientConnected()         {}
+func (*emptyObserver) clientClosed()            {}
+func (*emptyObserver) newEvent()                {}
+func (*emptyObserver) filteredEvent()           {}
+func (*emptyObserver) publishedEvent()          {}
+func (*emptyObserver) failedPublishEvent()      {}
+func (*emptyObserver) queueACKed(n int)         {}
+func (*emptyObserver) queueMaxEvents(int)       {}
+func (*emptyObserver) queueCreated(queue.Queue) {}
+func (*emptyObserver) eventsDropped(int)        {}
+func (*emptyObserver) eventsRetry(int)          {}
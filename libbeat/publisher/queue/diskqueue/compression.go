@@ -18,62 +18,156 @@
 package diskqueue
 
 import (
+	"fmt"
 	"io"
+	"strings"
 
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
 	lz4V4 "github.com/pierrec/lz4/v4"
 )
 
-// CompressionReader allows reading a stream compressed with LZ4
+// CompressionAlgorithm selects how segment data is compressed.  The
+// numeric value is stored in the segment header (schema version 3),
+// so existing values must never be renumbered.
+type CompressionAlgorithm uint8
+
+const (
+	CompressionNone CompressionAlgorithm = iota
+	CompressionLZ4
+	CompressionZstd
+	CompressionSnappy
+)
+
+var compressionAlgorithmNames = map[CompressionAlgorithm]string{
+	CompressionNone:   "none",
+	CompressionLZ4:    "lz4",
+	CompressionZstd:   "zstd",
+	CompressionSnappy: "snappy",
+}
+
+func (a CompressionAlgorithm) String() string {
+	if name, ok := compressionAlgorithmNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(a))
+}
+
+// Unpack parses the algorithm name used in the beats yml file.
+func (a *CompressionAlgorithm) Unpack(s string) error {
+	for algorithm, name := range compressionAlgorithmNames {
+		if strings.EqualFold(s, name) {
+			*a = algorithm
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown disk queue compression algorithm '%s'", s)
+}
+
+func (a CompressionAlgorithm) valid() bool {
+	_, ok := compressionAlgorithmNames[a]
+	return ok
+}
+
+// decompressor is the common interface of the stream decoders.
+type decompressor interface {
+	io.Reader
+	Reset(r io.Reader) error
+	Close()
+}
+
+// compressor is the common interface of the stream encoders.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// CompressionReader allows reading a compressed stream
 type CompressionReader struct {
-	src        io.ReadCloser
-	pLZ4Reader *lz4V4.Reader
+	src io.ReadCloser
+	dec decompressor
 }
 
-// NewCompressionReader returns a new LZ4 frame decoder
-func NewCompressionReader(r io.ReadCloser) *CompressionReader {
-	zr := lz4V4.NewReader(r)
-	return &CompressionReader{
-		src:        r,
-		pLZ4Reader: zr,
+// NewCompressionReader returns a new frame decoder for the given
+// algorithm
+func NewCompressionReader(r io.ReadCloser, algorithm CompressionAlgorithm) (*CompressionReader, error) {
+	var dec decompressor
+	switch algorithm {
+	case CompressionLZ4:
+		dec = lz4Decompressor{lz4V4.NewReader(r)}
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create zstd decoder: %w", err)
+		}
+		dec = zr
+	case CompressionSnappy:
+		dec = snappyDecompressor{snappy.NewReader(r)}
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %v", algorithm)
 	}
+	return &CompressionReader{
+		src: r,
+		dec: dec,
+	}, nil
 }
 
 func (r *CompressionReader) Read(buf []byte) (int, error) {
-	return r.pLZ4Reader.Read(buf)
+	return r.dec.Read(buf)
 }
 
 func (r *CompressionReader) Close() error {
+	r.dec.Close()
 	return r.src.Close()
 }
 
 // Reset Sets up compression again, assumes that caller has already set
 // the src to the correct position
 func (r *CompressionReader) Reset() error {
-	r.pLZ4Reader.Reset(r.src)
-	return nil
+	return r.dec.Reset(r.src)
 }
 
-// CompressionWriter allows writing an LZ4 stream
+// CompressionWriter allows writing a compressed stream
 type CompressionWriter struct {
-	dst        WriteCloseSyncer
-	pLZ4Writer *lz4V4.Writer
+	dst WriteCloseSyncer
+	enc compressor
 }
 
-// NewCompressionWriter returns a new LZ4 frame encoder
-func NewCompressionWriter(w WriteCloseSyncer) *CompressionWriter {
-	zw := lz4V4.NewWriter(w)
-	return &CompressionWriter{
-		dst:        w,
-		pLZ4Writer: zw,
+// NewCompressionWriter returns a new frame encoder for the given
+// algorithm.  level is only used by zstd, where 0 selects the
+// library default.
+func NewCompressionWriter(w WriteCloseSyncer, algorithm CompressionAlgorithm, level int) (*CompressionWriter, error) {
+	var enc compressor
+	switch algorithm {
+	case CompressionLZ4:
+		enc = lz4V4.NewWriter(w)
+	case CompressionZstd:
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		zw, err := zstd.NewWriter(w, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create zstd encoder: %w", err)
+		}
+		enc = zw
+	case CompressionSnappy:
+		enc = snappy.NewBufferedWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm %v", algorithm)
 	}
+	return &CompressionWriter{
+		dst: w,
+		enc: enc,
+	}, nil
 }
 
 func (w *CompressionWriter) Write(p []byte) (int, error) {
-	return w.pLZ4Writer.Write(p)
+	return w.enc.Write(p)
 }
 
 func (w *CompressionWriter) Close() error {
-	err := w.pLZ4Writer.Close()
+	err := w.enc.Close()
 	if err != nil {
 		return err
 	}
@@ -81,6 +175,33 @@ func (w *CompressionWriter) Close() error {
 }
 
 func (w *CompressionWriter) Sync() error {
-	w.pLZ4Writer.Flush()
+	if err := w.enc.Flush(); err != nil {
+		return err
+	}
 	return w.dst.Sync()
 }
+
+// lz4Decompressor adapts the LZ4 reader to the decompressor interface.
+type lz4Decompressor struct {
+	*lz4V4.Reader
+}
+
+func (d lz4Decompressor) Reset(r io.Reader) error {
+	d.Reader.Reset(r)
+	return nil
+}
+
+func (d lz4Decompressor) Close() {}
+
+// snappyDecompressor adapts the snappy framed reader to the
+// decompressor interface.
+type snappyDecompressor struct {
+	*snappy.Reader
+}
+
+func (d snappyDecompressor) Reset(r io.Reader) error {
+	d.Reader.Reset(r)
+	return nil
+}
+
+func (d snappyDecompressor) Close() {}
@@ -34,6 +34,12 @@ func NopWriteCloser(w io.Writer) io.WriteCloser {
 }
 func (nopWriteCloser) Close() error { return nil }
 
+var compressionAlgorithms = []CompressionAlgorithm{
+	CompressionLZ4,
+	CompressionZstd,
+	CompressionSnappy,
+}
+
 func TestCompressionReader(t *testing.T) {
 	tests := map[string]struct {
 		plaintext  []byte
@@ -64,7 +70,8 @@ func TestCompressionReader(t *testing.T) {
 	for name, tc := range tests {
 		dst := make([]byte, len(tc.plaintext))
 		src := bytes.NewReader(tc.compressed)
-		cr := NewCompressionReader(io.NopCloser(src))
+		cr, err := NewCompressionReader(io.NopCloser(src), CompressionLZ4)
+		assert.Nil(t, err, name)
 		n, err := cr.Read(dst)
 		assert.Nil(t, err, name)
 		assert.Equal(t, len(tc.plaintext), n, name)
@@ -91,7 +98,8 @@ func TestCompressionWriter(t *testing.T) {
 
 	for name, tc := range tests {
 		var dst bytes.Buffer
-		cw := NewCompressionWriter(NopWriteCloseSyncer(NopWriteCloser(&dst)))
+		cw, err := NewCompressionWriter(NopWriteCloseSyncer(NopWriteCloser(&dst)), CompressionLZ4, 0)
+		assert.Nil(t, err, name)
 		n, err := cw.Write(tc.plaintext)
 		cw.Close()
 		assert.Nil(t, err, name)
@@ -107,22 +115,27 @@ func TestCompressionRoundTrip(t *testing.T) {
 		"no repeat":  {plaintext: []byte("abcdefghijklmnopqrstuvwxzy01234567890ABCDEFGHIJKLMNOPQRSTUVWXYZ")},
 		"256 repeat": {plaintext: []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")},
 	}
-	for name, tc := range tests {
-		pr, pw := io.Pipe()
-		src := bytes.NewReader(tc.plaintext)
-		var dst bytes.Buffer
+	for _, algorithm := range compressionAlgorithms {
+		for name, tc := range tests {
+			name := algorithm.String() + " " + name
+			pr, pw := io.Pipe()
+			src := bytes.NewReader(tc.plaintext)
+			var dst bytes.Buffer
 
-		go func() {
-			cw := NewCompressionWriter(NopWriteCloseSyncer(pw))
-			_, err := io.Copy(cw, src)
-			assert.Nil(t, err, name)
-			cw.Close()
-		}()
+			go func() {
+				cw, err := NewCompressionWriter(NopWriteCloseSyncer(pw), algorithm, 0)
+				assert.Nil(t, err, name)
+				_, err = io.Copy(cw, src)
+				assert.Nil(t, err, name)
+				cw.Close()
+			}()
 
-		cr := NewCompressionReader(pr)
-		_, err := io.Copy(&dst, cr)
-		assert.Nil(t, err, name)
-		assert.Equal(t, tc.plaintext, dst.Bytes(), name)
+			cr, err := NewCompressionReader(pr, algorithm)
+			assert.Nil(t, err, name)
+			_, err = io.Copy(&dst, cr)
+			assert.Nil(t, err, name)
+			assert.Equal(t, tc.plaintext, dst.Bytes(), name)
+		}
 	}
 }
 
@@ -133,28 +146,64 @@ func TestCompressionSync(t *testing.T) {
 		"no repeat":  {plaintext: []byte("abcdefghijklmnopqrstuvwxzy01234567890ABCDEFGHIJKLMNOPQRSTUVWXYZ")},
 		"256 repeat": {plaintext: []byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")},
 	}
-	for name, tc := range tests {
-		pr, pw := io.Pipe()
-		var dst bytes.Buffer
-		go func() {
-			cw := NewCompressionWriter(NopWriteCloseSyncer(pw))
-			src1 := bytes.NewReader(tc.plaintext)
-			_, err := io.Copy(cw, src1)
+	for _, algorithm := range compressionAlgorithms {
+		for name, tc := range tests {
+			name := algorithm.String() + " " + name
+			pr, pw := io.Pipe()
+			var dst bytes.Buffer
+			go func() {
+				cw, err := NewCompressionWriter(NopWriteCloseSyncer(pw), algorithm, 0)
+				assert.Nil(t, err, name)
+				src1 := bytes.NewReader(tc.plaintext)
+				_, err = io.Copy(cw, src1)
+				assert.Nil(t, err, name)
+				//prior to v4.1.15 of pierrec/lz4 there was a
+				// bug that prevented writing after a Flush.
+				// The call to Sync here exercises Flush.
+				err = cw.Sync()
+				assert.Nil(t, err, name)
+				src2 := bytes.NewReader(tc.plaintext)
+				_, err = io.Copy(cw, src2)
+				assert.Nil(t, err, name)
+				cw.Close()
+			}()
+			cr, err := NewCompressionReader(pr, algorithm)
 			assert.Nil(t, err, name)
-			//prior to v4.1.15 of pierrec/lz4 there was a
-			// bug that prevented writing after a Flush.
-			// The call to Sync here exercises Flush.
-			err = cw.Sync()
+			_, err = io.Copy(&dst, cr)
 			assert.Nil(t, err, name)
-			src2 := bytes.NewReader(tc.plaintext)
-			_, err = io.Copy(cw, src2)
-			assert.Nil(t, err, name)
-			cw.Close()
-		}()
-		cr := NewCompressionReader(pr)
-		_, err := io.Copy(&dst, cr)
-		assert.Nil(t, err, name)
-		assert.Equal(t, tc.plaintext, dst.Bytes()[:len(tc.plaintext)], name)
-		assert.Equal(t, tc.plaintext, dst.Bytes()[len(tc.plaintext):], name)
+			assert.Equal(t, tc.plaintext, dst.Bytes()[:len(tc.plaintext)], name)
+			assert.Equal(t, tc.plaintext, dst.Bytes()[len(tc.plaintext):], name)
+		}
+	}
+}
+
+func TestCompressionLevel(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz"), 64)
+	for _, level := range []int{1, 3, 9, 19} {
+		var dst bytes.Buffer
+		cw, err := NewCompressionWriter(NopWriteCloseSyncer(NopWriteCloser(&dst)), CompressionZstd, level)
+		assert.Nil(t, err)
+		_, err = cw.Write(plaintext)
+		assert.Nil(t, err)
+		cw.Close()
+
+		cr, err := NewCompressionReader(io.NopCloser(&dst), CompressionZstd)
+		assert.Nil(t, err)
+		decompressed, err := io.ReadAll(cr)
+		assert.Nil(t, err)
+		assert.Equal(t, plaintext, decompressed, "level %d", level)
+	}
+}
+
+func TestCompressionAlgorithmUnpack(t *testing.T) {
+	for _, algorithm := range compressionAlgorithms {
+		var a CompressionAlgorithm
+		assert.Nil(t, a.Unpack(algorithm.String()))
+		assert.Equal(t, algorithm, a)
 	}
+
+	var a CompressionAlgorithm
+	assert.Nil(t, a.Unpack("ZSTD"))
+	assert.Equal(t, CompressionZstd, a)
+	assert.NotNil(t, a.Unpack("brotli"))
 }
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
@@ -67,11 +68,83 @@ type Settings struct {
 	// EncryptionKey is used to encrypt data if SchemaVersion 2 is used.
 	EncryptionKey []byte
 
-	// UseCompression enables or disables LZ4 compression
+	// EncryptionKeys is the keyring used to decrypt segments, indexed by
+	// the key ID recorded in their header. A key must stay in the keyring
+	// until all segments encrypted with it have been deleted.
+	EncryptionKeys map[EncryptionKeyID][]byte
+
+	// EncryptionKeyID selects the key from EncryptionKeys that new
+	// segments are encrypted with. If it is 0, EncryptionKey is used.
+	EncryptionKeyID EncryptionKeyID
+
+	// UseCompression enables or disables LZ4 compression.  It is kept
+	// for compatibility, Compression takes precedence when set.
 	UseCompression bool
 
+	// Compression selects the algorithm used to compress new segments.
+	// Existing segments are always read with the algorithm recorded in
+	// their header.
+	Compression CompressionAlgorithm
+
+	// CompressionLevel is the zstd compression level, 0 selects the
+	// library default.
+	CompressionLevel int
+
 	// UseProtobuf enables protobuf serialization instead of CBOR
 	UseProtobuf bool
+
+	// OverflowPolicy decides what happens to new events once the queue
+	// has reached MaxBufferSize.
+	OverflowPolicy OverflowPolicy
+
+	// MaxAge is the maximum time data may stay in the queue. Segments
+	// whose most recent write is older than MaxAge are deleted without
+	// being sent. A value of 0 disables age-based deletion.
+	MaxAge time.Duration
+
+	// DropCallback, if set, is called by the queue with the number of
+	// unread events it discarded with their segment because of the
+	// drop_oldest overflow policy or MaxAge.
+	DropCallback func(eventCount int)
+}
+
+// OverflowPolicy selects how the queue behaves when it is full.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock blocks producers until there is space in the queue.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest deletes the oldest unread segments to make
+	// room for new events.
+	OverflowDropOldest
+
+	// OverflowDropNewest rejects new events while the queue is full.
+	OverflowDropNewest
+)
+
+var overflowPolicyNames = map[OverflowPolicy]string{
+	OverflowBlock:      "block",
+	OverflowDropOldest: "drop_oldest",
+	OverflowDropNewest: "drop_newest",
+}
+
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(p))
+}
+
+// Unpack parses the overflow policy name used in the beats yml file.
+func (p *OverflowPolicy) Unpack(s string) error {
+	for policy, name := range overflowPolicyNames {
+		if strings.EqualFold(s, name) {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown disk queue overflow_policy '%s'", s)
 }
 
 // userConfig holds the parameters for a disk queue that are configurable
@@ -86,6 +159,62 @@ type userConfig struct {
 
 	RetryInterval    *time.Duration `config:"retry_interval" validate:"positive"`
 	MaxRetryInterval *time.Duration `config:"max_retry_interval" validate:"positive"`
+
+	Compression      *CompressionAlgorithm `config:"compression"`
+	CompressionLevel int                   `config:"compression_level"`
+
+	OverflowPolicy *OverflowPolicy `config:"overflow_policy"`
+	MaxAge         *time.Duration  `config:"max_age" validate:"positive"`
+
+	Encryption *encryptionConfig `config:"encryption"`
+}
+
+// encryptionConfig holds the encryption keyring. Key values are usually
+// references to the beats keystore, e.g. "${DISKQUEUE_KEY_2}".
+type encryptionConfig struct {
+	// CurrentKey is the ID of the key used for new segments. If unset, the
+	// last key in Keys is used.
+	CurrentKey *EncryptionKeyID      `config:"current_key"`
+	Keys       []encryptionKeyConfig `config:"keys" validate:"required"`
+}
+
+type encryptionKeyConfig struct {
+	ID  EncryptionKeyID `config:"id" validate:"required"`
+	Key string          `config:"key" validate:"required"`
+}
+
+func (c *encryptionConfig) Validate() error {
+	ids := map[EncryptionKeyID]bool{}
+	for _, key := range c.Keys {
+		if ids[key.ID] {
+			return fmt.Errorf("disk queue encryption key id %d is used more than once", key.ID)
+		}
+		ids[key.ID] = true
+		if _, err := decodeEncryptionKey(key.Key); err != nil {
+			return fmt.Errorf("invalid disk queue encryption key %d: %w", key.ID, err)
+		}
+	}
+	if c.CurrentKey != nil && !ids[*c.CurrentKey] {
+		return fmt.Errorf("disk queue encryption current_key %d is not in the keyring", *c.CurrentKey)
+	}
+	return nil
+}
+
+// keyring returns the decoded keys and the ID of the current key.
+func (c *encryptionConfig) keyring() (map[EncryptionKeyID][]byte, EncryptionKeyID, error) {
+	keys := make(map[EncryptionKeyID][]byte, len(c.Keys))
+	for _, key := range c.Keys {
+		decoded, err := decodeEncryptionKey(key.Key)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid disk queue encryption key %d: %w", key.ID, err)
+		}
+		keys[key.ID] = decoded
+	}
+	current := c.Keys[len(c.Keys)-1].ID
+	if c.CurrentKey != nil {
+		current = *c.CurrentKey
+	}
+	return keys, current, nil
 }
 
 func (c *userConfig) Validate() error {
@@ -118,6 +247,17 @@ func (c *userConfig) Validate() error {
 			*c.MaxRetryInterval, *c.RetryInterval)
 	}
 
+	if c.CompressionLevel != 0 {
+		if c.Compression == nil || *c.Compression != CompressionZstd {
+			return errors.New(
+				"disk queue compression_level can only be used with zstd compression")
+		}
+		if c.CompressionLevel < 1 || c.CompressionLevel > 22 {
+			return fmt.Errorf(
+				"disk queue compression_level (%d) must be between 1 and 22", c.CompressionLevel)
+		}
+	}
+
 	return nil
 }
 
@@ -140,7 +280,8 @@ func DefaultSettings() Settings {
 // end-user-configurable settings in the given config tree.
 func SettingsForUserConfig(config *config.C) (Settings, error) {
 	userConfig := userConfig{}
-	if err := config.Unpack(&userConfig); err != nil {
+	err := config.Unpack(&userConfig)
+	if err != nil {
 		return Settings{}, fmt.Errorf("couldn't unpack disk queue config: %w", err)
 	}
 	settings := DefaultSettings()
@@ -169,6 +310,25 @@ func SettingsForUserConfig(config *config.C) (Settings, error) {
 		settings.MaxRetryInterval = *userConfig.MaxRetryInterval
 	}
 
+	if userConfig.Compression != nil {
+		settings.Compression = *userConfig.Compression
+	}
+	settings.CompressionLevel = userConfig.CompressionLevel
+
+	if userConfig.OverflowPolicy != nil {
+		settings.OverflowPolicy = *userConfig.OverflowPolicy
+	}
+	if userConfig.MaxAge != nil {
+		settings.MaxAge = *userConfig.MaxAge
+	}
+
+	if userConfig.Encryption != nil {
+		settings.EncryptionKeys, settings.EncryptionKeyID, err = userConfig.Encryption.keyring()
+		if err != nil {
+			return Settings{}, err
+		}
+	}
+
 	return settings, nil
 }
 
@@ -193,6 +353,52 @@ func (settings Settings) segmentPath(segmentID segmentID) string {
 		fmt.Sprintf("%v.seg", segmentID))
 }
 
+// compressionAlgorithm returns the algorithm that new segments are
+// compressed with.
+func (settings Settings) compressionAlgorithm() CompressionAlgorithm {
+	if settings.Compression != CompressionNone {
+		return settings.Compression
+	}
+	if settings.UseCompression {
+		return CompressionLZ4
+	}
+	return CompressionNone
+}
+
+// currentEncryptionKey returns the key that new segments are encrypted
+// with and its ID. The key is nil if encryption is disabled.
+func (settings Settings) currentEncryptionKey() (EncryptionKeyID, []byte) {
+	if settings.EncryptionKeyID != 0 {
+		return settings.EncryptionKeyID, settings.EncryptionKeys[settings.EncryptionKeyID]
+	}
+	return 0, settings.EncryptionKey
+}
+
+// encryptionKey returns the key with the given ID from the keyring.
+func (settings Settings) encryptionKey(id EncryptionKeyID) ([]byte, error) {
+	if id == 0 {
+		return settings.EncryptionKey, nil
+	}
+	key, ok := settings.EncryptionKeys[id]
+	if !ok {
+		return nil, fmt.Errorf("encryption key %d is not in the keyring", id)
+	}
+	return key, nil
+}
+
+// maxAgeCheckInterval returns how often the core loop checks for
+// segments older than MaxAge.
+func (settings Settings) maxAgeCheckInterval() time.Duration {
+	interval := settings.MaxAge / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	return interval
+}
+
 // maxValidFrameSize returns the size of the largest possible frame that
 // can be stored with the current queue settings.
 func (settings Settings) maxValidFrameSize() uint64 {
@@ -17,7 +17,10 @@
 
 package diskqueue
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // This file contains the queue's "core loop" -- the central goroutine
 // that owns all queue state that is not encapsulated in one of the
@@ -31,6 +34,12 @@ func (dq *diskQueue) run() {
 	dq.maybeReadPending()
 	dq.maybeDeleteACKed()
 
+	// maxAgeChan stays nil, and is never selected, if MaxAge is disabled.
+	var maxAgeChan <-chan time.Time
+	if dq.maxAgeTicker != nil {
+		maxAgeChan = dq.maxAgeTicker.C
+	}
+
 	for {
 		select {
 		// Endpoints used by the producer / consumer API implementation.
@@ -87,6 +96,14 @@ func (dq *diskQueue) run() {
 
 		case metricsReq := <-dq.metricsRequestChan:
 			dq.handleMetricsRequest(metricsReq)
+
+		case now := <-maxAgeChan:
+			dq.dropExpiredSegments(now)
+
+			// Expired segments are deleted by the deleter loop, which may
+			// free enough space for blocked producers.
+			dq.maybeDeleteACKed()
+			dq.maybeUnblockProducers()
 		}
 	}
 }
@@ -94,7 +111,9 @@ func (dq *diskQueue) run() {
 // handleMetricsRequest responds to an event on the metricsRequestChan chan
 func (dq *diskQueue) handleMetricsRequest(request metricsRequest) {
 	resp := metricsRequestResponse{
-		sizeOnDisk: dq.segments.sizeOnDisk(),
+		sizeOnDisk:    dq.segments.sizeOnDisk(),
+		droppedEvents: dq.droppedEvents,
+		droppedBytes:  dq.droppedBytes,
 	}
 	request.response <- resp
 }
@@ -124,6 +143,23 @@ func (dq *diskQueue) handleProducerWriteRequest(request producerWriteRequest) {
 		dq.enqueueWriteFrame(request.frame)
 		request.responseChan <- true
 	} else {
+		if !dq.hasSpaceForFrameOfSize(frameSize) {
+			switch dq.settings.OverflowPolicy {
+			case OverflowDropNewest:
+				// The queue is at its size limit, discard the new event
+				// instead of waiting for space.
+				dq.droppedEvents++
+				dq.droppedBytes += frameSize
+				request.responseChan <- false
+				return
+			case OverflowDropOldest:
+				// Schedule enough old segments for deletion to make room.
+				// The space is only available once the deleter loop is done,
+				// so the request still waits below.
+				dq.dropOldestSegments(frameSize)
+				dq.maybeDeleteACKed()
+			}
+		}
 		// The queue is too full. Either add the request to blockedProducers,
 		// or send an immediate reject.
 		if request.shouldBlock {
@@ -144,6 +180,9 @@ func (dq *diskQueue) handleWriterLoopResponse(response writerLoopResponse) {
 		// Update the segment with its new size.
 		dq.segments.writing[index].byteCount += segmentEntry.bytesWritten
 		dq.segments.writing[index].frameCount += segmentEntry.framesWritten
+		if segmentEntry.bytesWritten > 0 {
+			dq.segments.writing[index].lastWriteTime = time.Now()
+		}
 	}
 
 	// If there is more than one segment in the response, then all but the
@@ -266,6 +305,10 @@ func (dq *diskQueue) handleShutdown() {
 		dq.handleDeleterLoopResponse(response)
 	}
 
+	if dq.maxAgeTicker != nil {
+		dq.maxAgeTicker.Stop()
+	}
+
 	// If there are any blocked producers still hoping for space to open up
 	// in the queue, send them the bad news.
 	for _, request := range dq.blockedProducers {
@@ -415,7 +458,25 @@ func (dq *diskQueue) maybeDeleteACKed() {
 func (dq *diskQueue) maybeUnblockProducers() {
 	unblockedCount := 0
 	for _, request := range dq.blockedProducers {
-		if !dq.canAcceptFrameOfSize(request.frame.sizeOnDisk()) {
+		frameSize := request.frame.sizeOnDisk()
+		if !dq.canAcceptFrameOfSize(frameSize) {
+			if !dq.hasSpaceForFrameOfSize(frameSize) {
+				switch dq.settings.OverflowPolicy {
+				case OverflowDropNewest:
+					// The queue filled up while this request was waiting
+					// on the WriteAheadLimit, discard it.
+					dq.droppedEvents++
+					dq.droppedBytes += frameSize
+					request.responseChan <- false
+					unblockedCount++
+					continue
+				case OverflowDropOldest:
+					// More segments may have become eligible since the
+					// request was blocked.
+					dq.dropOldestSegments(frameSize)
+					dq.maybeDeleteACKed()
+				}
+			}
 			// Not enough space for this frame, we're done.
 			break
 		}
@@ -474,14 +535,28 @@ func (dq *diskQueue) canAcceptFrameOfSize(frameSize uint64) bool {
 		return false
 	}
 
+	return dq.hasSpaceForFrameOfSize(frameSize)
+}
+
+// hasSpaceForFrameOfSize checks whether settings.MaxBufferSize leaves
+// enough room for a new frame with the given size. Unlike
+// canAcceptFrameOfSize it ignores the WriteAheadLimit, so it tells whether
+// the queue is actually full rather than just busy.
+func (dq *diskQueue) hasSpaceForFrameOfSize(frameSize uint64) bool {
 	// If the queue size is unbounded (max == 0), we accept.
 	if dq.settings.MaxBufferSize == 0 {
 		return true
 	}
 
-	// Compute the current queue size. We accept if there is enough capacity
-	// left in the queue after accounting for the existing segments and the
-	// pending writes that were already accepted.
+	// We accept if there is enough capacity left in the queue after
+	// accounting for the existing segments and the pending writes that
+	// were already accepted.
+	return dq.currentSize()+frameSize <= dq.settings.MaxBufferSize
+}
+
+// currentSize returns the size of the queue on disk including the
+// pending writes that were already accepted.
+func (dq *diskQueue) currentSize() uint64 {
 	pendingBytes := uint64(0)
 	for _, sf := range dq.pendingFrames {
 		pendingBytes += sf.frame.sizeOnDisk()
@@ -490,7 +565,82 @@ func (dq *diskQueue) canAcceptFrameOfSize(frameSize uint64) bool {
 	if dq.writing {
 		pendingBytes += dq.writeRequestSize
 	}
-	currentSize := pendingBytes + dq.segments.sizeOnDisk()
+	return pendingBytes + dq.segments.sizeOnDisk()
+}
+
+// droppableSegmentIndex returns the index in the reading list of the
+// oldest segment that can be discarded without being sent, or -1 if
+// there is none. The first reading segment can only be discarded if
+// the reader loop hasn't started on it yet; segments that are still
+// being written, or that were already read, are never discarded.
+func (dq *diskQueue) droppableSegmentIndex() int {
+	reading := dq.segments.reading
+	if len(reading) == 0 {
+		return -1
+	}
+	if dq.reading || dq.segments.nextReadPosition != 0 {
+		if len(reading) < 2 {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
 
-	return currentSize+frameSize <= dq.settings.MaxBufferSize
+// dropSegment removes the reading segment at the given index without
+// sending its events and schedules it for deletion.
+func (dq *diskQueue) dropSegment(index int, reason string) {
+	segment := dq.segments.reading[index]
+	dq.segments.reading = append(
+		dq.segments.reading[:index:index], dq.segments.reading[index+1:]...)
+	dq.segments.acked = append(dq.segments.acked, segment)
+
+	dq.droppedEvents += uint64(segment.frameCount)
+	dq.droppedBytes += segment.byteCount
+	dq.logger.Warnf(
+		"Dropping segment %d with %d events (%d bytes): %s",
+		segment.id, segment.frameCount, segment.byteCount, reason)
+	if dq.settings.DropCallback != nil {
+		dq.settings.DropCallback(int(segment.frameCount))
+	}
+}
+
+// dropOldestSegments discards unread segments, oldest first, until the
+// queue would have room for a frame of the given size once the
+// deleter loop has removed them.
+func (dq *diskQueue) dropOldestSegments(frameSize uint64) {
+	if dq.settings.MaxBufferSize == 0 {
+		return
+	}
+	// Segments in the acked list are already waiting for deletion, and
+	// will free their space without us dropping anything else.
+	pendingDeletion := uint64(0)
+	for _, segment := range dq.segments.acked {
+		pendingDeletion += segment.byteCount
+	}
+	for dq.currentSize()+frameSize > dq.settings.MaxBufferSize+pendingDeletion {
+		index := dq.droppableSegmentIndex()
+		if index < 0 {
+			return
+		}
+		pendingDeletion += dq.segments.reading[index].byteCount
+		dq.dropSegment(index, "disk queue is full")
+	}
+}
+
+// dropExpiredSegments discards unread segments whose most recent write
+// is older than settings.MaxAge.
+func (dq *diskQueue) dropExpiredSegments(now time.Time) {
+	for {
+		index := dq.droppableSegmentIndex()
+		if index < 0 {
+			return
+		}
+		segment := dq.segments.reading[index]
+		if now.Sub(segment.lastWriteTime) <= dq.settings.MaxAge {
+			return
+		}
+		dq.dropSegment(index, fmt.Sprintf(
+			"data is older than max_age (%v)", dq.settings.MaxAge))
+	}
 }
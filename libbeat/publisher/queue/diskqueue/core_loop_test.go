@@ -20,6 +20,7 @@ package diskqueue
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/elastic/elastic-agent-libs/logp"
 )
@@ -949,6 +950,207 @@ func TestCanAcceptFrameOfSize(t *testing.T) {
 	}
 }
 
+func TestOverflowPolicyDropNewest(t *testing.T) {
+	// With OverflowDropNewest, a producer write request that doesn't fit in
+	// MaxBufferSize should be rejected immediately even if it would block,
+	// and the dropped frame should be counted in the metrics.
+	settings := DefaultSettings()
+	settings.MaxBufferSize = 1000
+	settings.OverflowPolicy = OverflowDropNewest
+	dq := &diskQueue{
+		logger:   logp.L(),
+		settings: settings,
+		segments: diskQueueSegments{
+			reading: []*queueSegment{segmentWithSize(900)},
+		},
+	}
+
+	request := producerWriteRequest{
+		frame:        makeWriteFrameWithSize(200),
+		shouldBlock:  true,
+		responseChan: make(chan bool, 1),
+	}
+	dq.handleProducerWriteRequest(request)
+	select {
+	case response := <-request.responseChan:
+		if response {
+			t.Errorf("Expected the request to be rejected")
+		}
+	default:
+		t.Fatalf("Expected an immediate response")
+	}
+	if len(dq.blockedProducers) != 0 || len(dq.pendingFrames) != 0 {
+		t.Errorf("Dropped request shouldn't be blocked or pending")
+	}
+	if dq.droppedEvents != 1 || dq.droppedBytes != 200 {
+		t.Errorf("Expected 1 dropped event of 200 bytes, got %v events of %v bytes",
+			dq.droppedEvents, dq.droppedBytes)
+	}
+
+	// A blocked producer that no longer fits is dropped when the queue
+	// tries to unblock it.
+	blocked := producerWriteRequest{
+		frame:        makeWriteFrameWithSize(200),
+		shouldBlock:  true,
+		responseChan: make(chan bool, 1),
+	}
+	dq.blockedProducers = []producerWriteRequest{blocked}
+	dq.maybeUnblockProducers()
+	if len(dq.blockedProducers) != 0 {
+		t.Errorf("Expected blocked producer to be dropped")
+	}
+	if response := <-blocked.responseChan; response {
+		t.Errorf("Expected the blocked request to be rejected")
+	}
+	if dq.droppedEvents != 2 {
+		t.Errorf("Expected 2 dropped events, got %v", dq.droppedEvents)
+	}
+}
+
+func TestOverflowPolicyDropOldest(t *testing.T) {
+	// With OverflowDropOldest, a producer write request that doesn't fit in
+	// MaxBufferSize should move enough unread segments to the acked list
+	// for the deleter loop to free the space it needs.
+	testCases := map[string]struct {
+		segments diskQueueSegments
+		reading  bool
+
+		// The size of the frame that needs to fit in the queue
+		frameSize int
+
+		// The ids of the segments expected to be dropped
+		expectedDropped []segmentID
+	}{
+		"drop the oldest segment": {
+			segments: diskQueueSegments{
+				reading: []*queueSegment{
+					{id: 1, byteCount: 300, frameCount: 3},
+					{id: 2, byteCount: 300, frameCount: 3},
+				},
+				writing: []*queueSegment{{id: 3, byteCount: 300}},
+			},
+			frameSize:       200,
+			expectedDropped: []segmentID{1},
+		},
+		"drop as many segments as needed": {
+			segments: diskQueueSegments{
+				reading: []*queueSegment{
+					{id: 1, byteCount: 300, frameCount: 3},
+					{id: 2, byteCount: 300, frameCount: 3},
+				},
+				writing: []*queueSegment{{id: 3, byteCount: 300}},
+			},
+			frameSize:       500,
+			expectedDropped: []segmentID{1, 2},
+		},
+		"don't drop the segment being read": {
+			segments: diskQueueSegments{
+				reading: []*queueSegment{
+					{id: 1, byteCount: 300, frameCount: 3},
+					{id: 2, byteCount: 300, frameCount: 3},
+				},
+				writing: []*queueSegment{{id: 3, byteCount: 300}},
+			},
+			reading:         true,
+			frameSize:       200,
+			expectedDropped: []segmentID{2},
+		},
+		"don't drop a partially read segment": {
+			segments: diskQueueSegments{
+				reading: []*queueSegment{
+					{id: 1, byteCount: 300, frameCount: 3},
+				},
+				writing:          []*queueSegment{{id: 2, byteCount: 600}},
+				nextReadPosition: 100,
+			},
+			frameSize: 200,
+		},
+		"segments waiting for deletion count as free space": {
+			segments: diskQueueSegments{
+				reading: []*queueSegment{
+					{id: 2, byteCount: 300, frameCount: 3},
+				},
+				writing: []*queueSegment{{id: 3, byteCount: 300}},
+				acked:   []*queueSegment{{id: 1, byteCount: 300}},
+			},
+			frameSize: 200,
+		},
+	}
+
+	settings := DefaultSettings()
+	settings.MaxBufferSize = 1000
+	settings.OverflowPolicy = OverflowDropOldest
+	for description, test := range testCases {
+		dq := &diskQueue{
+			logger:   logp.L(),
+			settings: settings,
+			segments: test.segments,
+			reading:  test.reading,
+		}
+		initialAcked := len(dq.segments.acked)
+		dq.dropOldestSegments(uint64(test.frameSize))
+
+		dropped := []segmentID{}
+		for _, segment := range dq.segments.acked[initialAcked:] {
+			dropped = append(dropped, segment.id)
+		}
+		if fmt.Sprint(dropped) != fmt.Sprint(test.expectedDropped) {
+			t.Errorf("%s: expected dropped segments %v, got %v",
+				description, test.expectedDropped, dropped)
+		}
+		expectedEvents := uint64(3 * len(test.expectedDropped))
+		if dq.droppedEvents != expectedEvents {
+			t.Errorf("%s: expected %v dropped events, got %v",
+				description, expectedEvents, dq.droppedEvents)
+		}
+		for _, segment := range dq.segments.reading {
+			for _, id := range dropped {
+				if segment.id == id {
+					t.Errorf("%s: dropped segment %v still in reading list",
+						description, id)
+				}
+			}
+		}
+	}
+}
+
+func TestDropExpiredSegments(t *testing.T) {
+	// dropExpiredSegments should discard unread segments, oldest first,
+	// whose last write is older than MaxAge.
+	now := time.Now()
+	settings := DefaultSettings()
+	settings.MaxAge = time.Hour
+	dq := &diskQueue{
+		logger:   logp.L(),
+		settings: settings,
+		segments: diskQueueSegments{
+			reading: []*queueSegment{
+				{id: 1, byteCount: 100, frameCount: 1, lastWriteTime: now.Add(-3 * time.Hour)},
+				{id: 2, byteCount: 100, frameCount: 2, lastWriteTime: now.Add(-2 * time.Hour)},
+				{id: 3, byteCount: 100, frameCount: 4, lastWriteTime: now.Add(-time.Minute)},
+			},
+			writing: []*queueSegment{
+				{id: 4, byteCount: 100, frameCount: 8, lastWriteTime: now.Add(-4 * time.Hour)},
+			},
+		},
+	}
+	dq.dropExpiredSegments(now)
+	if len(dq.segments.acked) != 2 ||
+		dq.segments.acked[0].id != 1 || dq.segments.acked[1].id != 2 {
+		t.Fatalf("Expected segments 1 and 2 to be dropped, got %v", dq.segments.acked)
+	}
+	if len(dq.segments.reading) != 1 || dq.segments.reading[0].id != 3 {
+		t.Errorf("Expected segment 3 to remain in the reading list")
+	}
+	if len(dq.segments.writing) != 1 {
+		t.Errorf("Writing segments should never be dropped")
+	}
+	if dq.droppedEvents != 3 || dq.droppedBytes != 200 {
+		t.Errorf("Expected 3 dropped events of 200 bytes, got %v events of %v bytes",
+			dq.droppedEvents, dq.droppedBytes)
+	}
+}
+
 func boolRef(b bool) *bool {
 	return &b
 }
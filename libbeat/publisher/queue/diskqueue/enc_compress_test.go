@@ -47,7 +47,8 @@ func TestEncryptionCompressionRoundTrip(t *testing.T) {
 		go func() {
 			ew, err := NewEncryptionWriter(NopWriteCloseSyncer(pw), key)
 			assert.Nil(t, err, name)
-			cw := NewCompressionWriter(ew)
+			cw, err := NewCompressionWriter(ew, CompressionLZ4, 0)
+			assert.Nil(t, err, name)
 			_, err = io.Copy(cw, src)
 			assert.Nil(t, err, name)
 			err = cw.Close()
@@ -60,7 +61,8 @@ func TestEncryptionCompressionRoundTrip(t *testing.T) {
 
 		tcr := io.TeeReader(er, &tCompBuf)
 
-		cr := NewCompressionReader(io.NopCloser(tcr))
+		cr, err := NewCompressionReader(io.NopCloser(tcr), CompressionLZ4)
+		assert.Nil(t, err, name)
 
 		_, err = io.Copy(&dst, cr)
 		assert.Nil(t, err, name)
@@ -22,6 +22,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
 )
@@ -31,6 +32,24 @@ const (
 	KeySize = 16
 )
 
+// EncryptionKeyID identifies a key in the encryption keyring. The ID of
+// the key a segment was encrypted with is recorded in the segment header,
+// so the key can be rotated while older segments are still in the queue.
+// ID 0 refers to the single key in Settings.EncryptionKey.
+type EncryptionKeyID uint8
+
+// decodeEncryptionKey parses a hex-encoded encryption key.
+func decodeEncryptionKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("key must be hex encoded: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes (%d hex characters) long", KeySize, 2*KeySize)
+	}
+	return key, nil
+}
+
 // EncryptionReader allows reading from a AES-128-CTR stream
 type EncryptionReader struct {
 	src        io.ReadCloser
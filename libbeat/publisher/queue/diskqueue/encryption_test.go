@@ -24,6 +24,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
 )
 
 func NopWriteCloseSyncer(w io.WriteCloser) WriteCloseSyncer {
@@ -73,3 +76,91 @@ func TestEncryptionRoundTrip(t *testing.T) {
 		assert.NotEqual(t, tc.plaintext, teeBuf.Bytes()[aes.BlockSize:], name)
 	}
 }
+
+func TestEncryptionKeyring(t *testing.T) {
+	cfg := config.MustNewConfigFrom(`
+max_size: 100MB
+encryption:
+  keys:
+    - id: 1
+      key: 6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b
+    - id: 2
+      key: 6c6c6c6c6c6c6c6c6c6c6c6c6c6c6c6c
+`)
+	settings, err := SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, EncryptionKeyID(2), settings.EncryptionKeyID)
+	assert.Equal(t, []byte("kkkkkkkkkkkkkkkk"), settings.EncryptionKeys[1])
+	assert.Equal(t, []byte("llllllllllllllll"), settings.EncryptionKeys[2])
+
+	id, key := settings.currentEncryptionKey()
+	assert.Equal(t, EncryptionKeyID(2), id)
+	assert.Equal(t, []byte("llllllllllllllll"), key)
+}
+
+func TestEncryptionKeyringValidation(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    string
+	}{
+		"current key": {
+			config: `
+encryption:
+  current_key: 1
+  keys:
+    - id: 1
+      key: 6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b
+    - id: 2
+      key: 6c6c6c6c6c6c6c6c6c6c6c6c6c6c6c6c
+`,
+		},
+		"unknown current key": {
+			config: `
+encryption:
+  current_key: 3
+  keys:
+    - id: 1
+      key: 6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b
+`,
+			err: "current_key 3 is not in the keyring",
+		},
+		"duplicate id": {
+			config: `
+encryption:
+  keys:
+    - id: 1
+      key: 6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b6b
+    - id: 1
+      key: 6c6c6c6c6c6c6c6c6c6c6c6c6c6c6c6c
+`,
+			err: "id 1 is used more than once",
+		},
+		"short key": {
+			config: `
+encryption:
+  keys:
+    - id: 1
+      key: 6b6b
+`,
+			err: "key must be 16 bytes",
+		},
+		"not hex": {
+			config: `
+encryption:
+  keys:
+    - id: 1
+      key: kkkkkkkkkkkkkkkkkkkkkkkkkkkkkkkk
+`,
+			err: "key must be hex encoded",
+		},
+	}
+	for name, tc := range tests {
+		cfg := config.MustNewConfigFrom("max_size: 100MB\n" + tc.config)
+		_, err := SettingsForUserConfig(cfg)
+		if tc.err == "" {
+			assert.NoError(t, err, name)
+		} else {
+			assert.ErrorContains(t, err, tc.err, name)
+		}
+	}
+}
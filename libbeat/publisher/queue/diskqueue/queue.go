@@ -23,6 +23,7 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -88,6 +89,19 @@ type diskQueue struct {
 	// waiting for free space in the queue.
 	blockedProducers []producerWriteRequest
 
+	// The number of events and bytes discarded because of the overflow
+	// policy or MaxAge, reported through Metrics().
+	droppedEvents uint64
+	droppedBytes  uint64
+
+	// If MaxAge is set, maxAgeTicker periodically wakes up the core loop
+	// to check for expired segments.
+	maxAgeTicker *time.Ticker
+
+	// The number of events that were waiting on disk when the queue was
+	// opened, see InitialEventCount.
+	initialEventCount int
+
 	// The channel to signal our goroutines to shut down.
 	done chan struct{}
 }
@@ -99,7 +113,9 @@ type metricsRequest struct {
 
 // metrics response from the disk queue
 type metricsRequestResponse struct {
-	sizeOnDisk uint64
+	sizeOnDisk    uint64
+	droppedEvents uint64
+	droppedBytes  uint64
 }
 
 // FactoryForSettings is a simple wrapper around NewQueue so a concrete
@@ -212,6 +228,9 @@ func NewQueue(
 		activeFrameCount += int(segment.frameCount)
 	}
 	activeFrameCount -= int(nextReadPosition.frameIndex)
+	if activeFrameCount < 0 {
+		activeFrameCount = 0
+	}
 	logger.Infof("Found %d existing events on queue start", activeFrameCount)
 
 	var encoder queue.Encoder
@@ -240,6 +259,11 @@ func NewQueue(
 		metricsRequestChan:       make(chan metricsRequest),
 
 		done: make(chan struct{}),
+
+		initialEventCount: activeFrameCount,
+	}
+	if settings.MaxAge > 0 {
+		queue.maxAgeTicker = time.NewTicker(settings.maxAgeCheckInterval())
 	}
 
 	// We wait for four goroutines on shutdown: core loop, reader loop,
@@ -280,6 +304,13 @@ func (dq *diskQueue) Close() error {
 	return nil
 }
 
+// InitialEventCount returns the number of events that were already
+// stored on disk from a previous session when the queue was opened.
+// They are the first events returned by Get.
+func (dq *diskQueue) InitialEventCount() int {
+	return dq.initialEventCount
+}
+
 func (dq *diskQueue) QueueType() string {
 	return QueueType
 }
@@ -326,5 +357,8 @@ func (dq *diskQueue) Metrics() (queue.Metrics, error) {
 	return queue.Metrics{
 		ByteLimit: opt.UintWith(maxSize),
 		ByteCount: opt.UintWith(resp.sizeOnDisk),
+
+		DroppedEvents: opt.UintWith(resp.droppedEvents),
+		DroppedBytes:  opt.UintWith(resp.droppedBytes),
 	}, nil
 }
@@ -28,6 +28,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/elastic/elastic-agent-libs/logp"
 )
@@ -123,10 +124,15 @@ type queueSegment struct {
 	//
 	// Used to count how many frames still need to be acknowledged by consumers.
 	framesRead uint64
+
+	// The time of the most recent write to this segment. Segments loaded
+	// from a previous session use the file's modification time. This is
+	// used to delete segments older than Settings.MaxAge.
+	lastWriteTime time.Time
 }
 
 type segmentHeader struct {
-	// The schema version for this segment file. Current schema version is 2.
+	// The schema version for this segment file. Current schema version is 3.
 	version uint32
 
 	// If the segment file has been completely written, this field contains
@@ -146,7 +152,7 @@ type WriteCloseSyncer interface {
 	Sync() error
 }
 
-const currentSegmentVersion = 2
+const currentSegmentVersion = 3
 
 // Segment headers are currently a 4-byte version, a 4-byte frame count and 1-byte options.
 // In contexts where the segment may have been created by an earlier version,
@@ -160,6 +166,56 @@ const (
 	ENABLE_PROTOBUF                       // 0x4
 )
 
+// Starting with schema version 3 the second byte of the options holds
+// the CompressionAlgorithm used for the segment.  Version 2 segments
+// with ENABLE_COMPRESSION set are always LZ4.
+const (
+	compressionAlgorithmShift        = 8
+	compressionAlgorithmMask  uint32 = 0xff << compressionAlgorithmShift
+)
+
+// Starting with schema version 3 the third byte of the options holds
+// the EncryptionKeyID of the key the segment was encrypted with.  Segments
+// encrypted with key 0 (Settings.EncryptionKey) leave it zero.
+const (
+	encryptionKeyIDShift        = 16
+	encryptionKeyIDMask  uint32 = 0xff << encryptionKeyIDShift
+)
+
+// segmentVersionForOptions returns the schema version to write for a
+// segment with the given options.  Segments that use LZ4 or no compression
+// and no keyring key are still written as version 2, so they stay
+// readable by releases that don't know about version 3.
+func segmentVersionForOptions(options uint32) uint32 {
+	if options&(compressionAlgorithmMask|encryptionKeyIDMask) != 0 {
+		return 3
+	}
+	return 2
+}
+
+// compressionAlgorithm returns the algorithm the segment data was
+// compressed with.  ENABLE_COMPRESSION without an algorithm means LZ4,
+// whatever the version.
+func (header *segmentHeader) compressionAlgorithm() CompressionAlgorithm {
+	if (header.options & ENABLE_COMPRESSION) != ENABLE_COMPRESSION {
+		return CompressionNone
+	}
+	algorithm := CompressionAlgorithm((header.options & compressionAlgorithmMask) >> compressionAlgorithmShift)
+	if header.version < 3 || algorithm == CompressionNone {
+		return CompressionLZ4
+	}
+	return algorithm
+}
+
+// encryptionKeyID returns the ID of the key the segment data was
+// encrypted with.
+func (header *segmentHeader) encryptionKeyID() EncryptionKeyID {
+	if header.version < 3 {
+		return 0
+	}
+	return EncryptionKeyID((header.options & encryptionKeyIDMask) >> encryptionKeyIDShift)
+}
+
 // Sort order: we store loaded segments in ascending order by their id.
 type bySegmentID []*queueSegment
 
@@ -201,6 +257,7 @@ func scanExistingSegments(logger *logp.Logger, pathStr string) ([]*queueSegment,
 					schemaVersion: &header.version,
 					frameCount:    header.frameCount,
 					byteCount:     uint64(file.Size()),
+					lastWriteTime: file.ModTime(),
 				})
 			}
 		}
@@ -259,17 +316,27 @@ func (segment *queueSegment) getReader(queueSettings Settings) (*segmentReader,
 	}
 
 	if (header.options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
-		sr.er, err = NewEncryptionReader(sr.src, queueSettings.EncryptionKey)
+		var key []byte
+		key, err = queueSettings.encryptionKey(header.encryptionKeyID())
+		if err != nil {
+			sr.src.Close()
+			return nil, fmt.Errorf("couldn't decrypt segment %d: %w", segment.id, err)
+		}
+		sr.er, err = NewEncryptionReader(sr.src, key)
 		if err != nil {
 			sr.src.Close()
 			return nil, fmt.Errorf("couldn't create encryption reader: %w", err)
 		}
 	}
-	if (header.options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
+	if algorithm := header.compressionAlgorithm(); algorithm != CompressionNone {
 		if sr.er != nil {
-			sr.cr = NewCompressionReader(sr.er)
+			sr.cr, err = NewCompressionReader(sr.er, algorithm)
 		} else {
-			sr.cr = NewCompressionReader(sr.src)
+			sr.cr, err = NewCompressionReader(sr.src, algorithm)
+		}
+		if err != nil {
+			sr.src.Close()
+			return nil, fmt.Errorf("couldn't create compression reader: %w", err)
 		}
 	}
 	return sr, nil
@@ -289,12 +356,19 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 		return nil, err
 	}
 
-	if len(queueSettings.EncryptionKey) > 0 {
-		options = options | ENABLE_ENCRYPTION
+	keyID, key := queueSettings.currentEncryptionKey()
+	if len(key) > 0 {
+		options = options | ENABLE_ENCRYPTION | uint32(keyID)<<encryptionKeyIDShift
 	}
 
-	if queueSettings.UseCompression {
+	algorithm := queueSettings.compressionAlgorithm()
+	if algorithm != CompressionNone {
 		options = options | ENABLE_COMPRESSION
+		// LZ4 segments only record the algorithm when they are version 3
+		// anyway, otherwise they are written as version 2.
+		if algorithm != CompressionLZ4 || keyID != 0 {
+			options = options | uint32(algorithm)<<compressionAlgorithmShift
+		}
 	}
 
 	if queueSettings.UseProtobuf {
@@ -309,7 +383,7 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 	}
 
 	if (options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
-		sw.ew, err = NewEncryptionWriter(sw.dst, queueSettings.EncryptionKey)
+		sw.ew, err = NewEncryptionWriter(sw.dst, key)
 		if err != nil {
 			sw.dst.Close()
 			return nil, fmt.Errorf("couldn't create encryption writer: %w", err)
@@ -318,9 +392,13 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 
 	if (options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
 		if sw.ew != nil {
-			sw.cw = NewCompressionWriter(sw.ew)
+			sw.cw, err = NewCompressionWriter(sw.ew, algorithm, queueSettings.CompressionLevel)
 		} else {
-			sw.cw = NewCompressionWriter(sw.dst)
+			sw.cw, err = NewCompressionWriter(sw.dst, algorithm, queueSettings.CompressionLevel)
+		}
+		if err != nil {
+			sw.dst.Close()
+			return nil, fmt.Errorf("couldn't create compression writer: %w", err)
 		}
 	}
 
@@ -447,6 +525,11 @@ func readSegmentHeader(in io.Reader) (*segmentHeader, error) {
 			return nil, fmt.Errorf("could not read segment options: %w", err)
 		}
 	}
+	if header.version >= 3 {
+		if algorithm := header.compressionAlgorithm(); !algorithm.valid() {
+			return nil, fmt.Errorf("unrecognized compression algorithm %v", algorithm)
+		}
+	}
 
 	return header, nil
 }
@@ -472,7 +555,7 @@ func (segments *diskQueueSegments) sizeOnDisk() uint64 {
 
 // segmentReader handles reading of segments.  getReader sets up the
 // reader and handles setting up the Reader to deal with the different
-// schema version.  With Schema version 2 there is the option for
+// schema version.  Since Schema version 2 there is the option for
 // plain data, encrypted data, compressed data and encrypted
 // compressed data.  If compression is enabled operations go through
 // the CompressionReader because compressing encrypted data defeats
@@ -542,7 +625,7 @@ func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
 	return r.src.Seek(offset, whence)
 }
 
-// segmentWriter handles writing of segments.  With Schema version 2
+// segmentWriter handles writing of segments.  Since Schema version 2
 // there is the option for plain data, encrypted data, compressed data
 // and encrypted compressed data.  getWriter sets up the segmentWriter
 // to handle these options.  If compression is enabled operations go
@@ -592,7 +675,7 @@ func (w *segmentWriter) WriteHeader(options uint32) error {
 	}
 
 	//write version
-	err = binary.Write(w.dst, binary.LittleEndian, uint32(2))
+	err = binary.Write(w.dst, binary.LittleEndian, segmentVersionForOptions(options))
 	if err != nil {
 		return fmt.Errorf("could not write version to segment: %w", err)
 	}
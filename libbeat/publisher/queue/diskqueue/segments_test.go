@@ -18,7 +18,10 @@
 package diskqueue
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -28,33 +31,60 @@ func TestSegmentsRoundTrip(t *testing.T) {
 	tests := map[string]struct {
 		id        segmentID
 		encrypt   bool
-		compress  bool
+		keyID     EncryptionKeyID
+		compress  CompressionAlgorithm
 		plaintext []byte
 	}{
 		"No Encryption or Compression": {
 			id:        0,
 			encrypt:   false,
-			compress:  false,
+			compress:  CompressionNone,
 			plaintext: []byte("no encryption or compression"),
 		},
 		"Encryption Only": {
 			id:        1,
 			encrypt:   true,
-			compress:  false,
+			compress:  CompressionNone,
 			plaintext: []byte("encryption only"),
 		},
 		"Compression Only": {
 			id:        2,
 			encrypt:   false,
-			compress:  true,
+			compress:  CompressionLZ4,
 			plaintext: []byte("compression only"),
 		},
 		"Encryption and Compression": {
 			id:        3,
 			encrypt:   true,
-			compress:  true,
+			compress:  CompressionLZ4,
 			plaintext: []byte("encryption and compression"),
 		},
+		"Zstd Compression": {
+			id:        4,
+			encrypt:   false,
+			compress:  CompressionZstd,
+			plaintext: []byte("zstd compression"),
+		},
+		"Encryption and Snappy Compression": {
+			id:        5,
+			encrypt:   true,
+			compress:  CompressionSnappy,
+			plaintext: []byte("encryption and snappy compression"),
+		},
+		"Keyring Encryption and Compression": {
+			id:        6,
+			encrypt:   true,
+			keyID:     1,
+			compress:  CompressionLZ4,
+			plaintext: []byte("keyring encryption and compression"),
+		},
+		"Keyring Encryption and Zstd Compression": {
+			id:        7,
+			encrypt:   true,
+			keyID:     2,
+			compress:  CompressionZstd,
+			plaintext: []byte("keyring encryption and zstd compression"),
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
@@ -64,7 +94,11 @@ func TestSegmentsRoundTrip(t *testing.T) {
 		if tc.encrypt {
 			settings.EncryptionKey = []byte("keykeykeykeykeyk")
 		}
-		settings.UseCompression = tc.compress
+		if tc.keyID != 0 {
+			settings.EncryptionKeys = map[EncryptionKeyID][]byte{tc.keyID: []byte("ringkeyringkeyri")}
+			settings.EncryptionKeyID = tc.keyID
+		}
+		settings.Compression = tc.compress
 		qs := &queueSegment{
 			id: tc.id,
 		}
@@ -102,31 +136,43 @@ func TestSegmentReaderSeek(t *testing.T) {
 	tests := map[string]struct {
 		id         segmentID
 		encrypt    bool
-		compress   bool
+		compress   CompressionAlgorithm
 		plaintexts [][]byte
 	}{
 		"No Encryption or compression": {
 			id:         0,
 			encrypt:    false,
-			compress:   false,
+			compress:   CompressionNone,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 		},
 		"Encryption Only": {
 			id:         1,
 			encrypt:    true,
-			compress:   false,
+			compress:   CompressionNone,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 		},
 		"Compression Only": {
 			id:         2,
 			encrypt:    false,
-			compress:   true,
+			compress:   CompressionLZ4,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 		},
 		"Encryption and Compression": {
 			id:         3,
 			encrypt:    true,
-			compress:   true,
+			compress:   CompressionLZ4,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
+		"Encryption and Zstd Compression": {
+			id:         4,
+			encrypt:    true,
+			compress:   CompressionZstd,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
+		"Snappy Compression": {
+			id:         5,
+			encrypt:    false,
+			compress:   CompressionSnappy,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 		},
 	}
@@ -137,7 +183,7 @@ func TestSegmentReaderSeek(t *testing.T) {
 		if tc.encrypt {
 			settings.EncryptionKey = []byte("keykeykeykeykeyk")
 		}
-		settings.UseCompression = tc.compress
+		settings.Compression = tc.compress
 
 		qs := &queueSegment{
 			id: tc.id,
@@ -172,35 +218,35 @@ func TestSegmentReaderSeekLocations(t *testing.T) {
 	tests := map[string]struct {
 		id         segmentID
 		encrypt    bool
-		compress   bool
+		compress   CompressionAlgorithm
 		plaintexts [][]byte
 		location   int64
 	}{
 		"No Encryption or Compression": {
 			id:         0,
 			encrypt:    false,
-			compress:   false,
+			compress:   CompressionNone,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 			location:   -1,
 		},
 		"Encryption": {
 			id:         1,
 			encrypt:    true,
-			compress:   false,
+			compress:   CompressionNone,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 			location:   2,
 		},
 		"Compression": {
 			id:         1,
 			encrypt:    false,
-			compress:   true,
+			compress:   CompressionLZ4,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 			location:   2,
 		},
 		"Encryption and Compression": {
 			id:         1,
 			encrypt:    true,
-			compress:   true,
+			compress:   CompressionLZ4,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 			location:   2,
 		},
@@ -212,7 +258,7 @@ func TestSegmentReaderSeekLocations(t *testing.T) {
 		if tc.encrypt {
 			settings.EncryptionKey = []byte("keykeykeykeykeyk")
 		}
-		settings.UseCompression = tc.compress
+		settings.Compression = tc.compress
 		qs := &queueSegment{
 			id: tc.id,
 		}
@@ -231,3 +277,144 @@ func TestSegmentReaderSeekLocations(t *testing.T) {
 		assert.NotNil(t, err, name)
 	}
 }
+
+func TestSegmentHeaderCompression(t *testing.T) {
+	tests := map[string]struct {
+		useCompression bool
+		compress       CompressionAlgorithm
+		version        uint32
+		algorithm      CompressionAlgorithm
+	}{
+		"No Compression": {
+			version:   2,
+			algorithm: CompressionNone,
+		},
+		"Legacy LZ4 Compression": {
+			useCompression: true,
+			version:        2,
+			algorithm:      CompressionLZ4,
+		},
+		"LZ4 Compression": {
+			compress:  CompressionLZ4,
+			version:   2,
+			algorithm: CompressionLZ4,
+		},
+		"Zstd Compression": {
+			compress:  CompressionZstd,
+			version:   3,
+			algorithm: CompressionZstd,
+		},
+		"Snappy Compression": {
+			useCompression: true,
+			compress:       CompressionSnappy,
+			version:        3,
+			algorithm:      CompressionSnappy,
+		},
+	}
+	dir := t.TempDir()
+	for name, tc := range tests {
+		plaintext := []byte(name)
+		settings := DefaultSettings()
+		settings.Path = dir
+		settings.UseCompression = tc.useCompression
+		settings.Compression = tc.compress
+		qs := &queueSegment{id: 0}
+
+		sw, err := qs.getWriter(settings)
+		assert.Nil(t, err, name)
+		_, err = sw.Write(plaintext)
+		assert.Nil(t, err, name)
+		assert.Nil(t, sw.Close(), name)
+
+		f, err := os.Open(settings.segmentPath(qs.id))
+		assert.Nil(t, err, name)
+		header, err := readSegmentHeader(f)
+		assert.Nil(t, err, name)
+		f.Close()
+		assert.Equal(t, tc.version, header.version, name)
+		assert.Equal(t, tc.algorithm, header.compressionAlgorithm(), name)
+
+		// Segments must be readable after the configured algorithm
+		// changed, the header decides how they are decoded.
+		settings.UseCompression = false
+		settings.Compression = CompressionSnappy
+		sr, err := qs.getReader(settings)
+		assert.Nil(t, err, name)
+		dst := make([]byte, len(plaintext))
+		_, err = io.ReadFull(sr, dst)
+		assert.Nil(t, err, name)
+		assert.Equal(t, plaintext, dst, name)
+		assert.Nil(t, sr.Close(), name)
+	}
+}
+
+func TestSegmentHeaderUnknownCompression(t *testing.T) {
+	var buf bytes.Buffer
+	options := ENABLE_COMPRESSION | 0x7f<<compressionAlgorithmShift
+	for _, v := range []uint32{3, 1, options} {
+		assert.Nil(t, binary.Write(&buf, binary.LittleEndian, v))
+	}
+	_, err := readSegmentHeader(&buf)
+	assert.ErrorContains(t, err, "unrecognized compression algorithm")
+}
+
+func TestSegmentEncryptionKeyRotation(t *testing.T) {
+	for _, compress := range []CompressionAlgorithm{CompressionNone, CompressionLZ4, CompressionZstd} {
+		t.Run(compress.String(), func(t *testing.T) {
+			testSegmentEncryptionKeyRotation(t, compress)
+		})
+	}
+}
+
+func testSegmentEncryptionKeyRotation(t *testing.T, compress CompressionAlgorithm) {
+	oldKey := []byte("oldkeyoldkeyoldk")
+	newKey := []byte("newkeynewkeynewk")
+	plaintext := []byte("written with the old key")
+
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.Compression = compress
+	settings.EncryptionKeys = map[EncryptionKeyID][]byte{1: oldKey}
+	settings.EncryptionKeyID = 1
+
+	oldSegment := &queueSegment{id: 0}
+	sw, err := oldSegment.getWriter(settings)
+	assert.Nil(t, err)
+	_, err = sw.Write(plaintext)
+	assert.Nil(t, err)
+	assert.Nil(t, sw.Close())
+
+	// Rotate the key: new segments use key 2, the old segment must
+	// still be readable with key 1.
+	settings.EncryptionKeys = map[EncryptionKeyID][]byte{1: oldKey, 2: newKey}
+	settings.EncryptionKeyID = 2
+
+	newSegment := &queueSegment{id: 1}
+	sw, err = newSegment.getWriter(settings)
+	assert.Nil(t, err)
+	assert.Nil(t, sw.Close())
+
+	for segment, keyID := range map[*queueSegment]EncryptionKeyID{oldSegment: 1, newSegment: 2} {
+		file, err := os.Open(settings.segmentPath(segment.id))
+		assert.Nil(t, err)
+		header, err := readSegmentHeader(file)
+		file.Close()
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(3), header.version)
+		assert.Equal(t, keyID, header.encryptionKeyID())
+		assert.Equal(t, compress, header.compressionAlgorithm())
+	}
+
+	sr, err := oldSegment.getReader(settings)
+	assert.Nil(t, err)
+	dst := make([]byte, len(plaintext))
+	_, err = io.ReadFull(sr, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, dst)
+	assert.Nil(t, sr.Close())
+
+	// Without the old key the segment can't be read.
+	delete(settings.EncryptionKeys, 1)
+	_, err = oldSegment.getReader(settings)
+	assert.ErrorContains(t, err, "encryption key 1 is not in the keyring")
+}
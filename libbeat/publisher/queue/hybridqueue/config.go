@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Settings contains the configuration fields to create a new hybrid queue.
+type Settings struct {
+	// Memory holds the settings of the in-memory buffer that is used while
+	// the outputs keep up with the incoming events.
+	Memory memqueue.Settings
+
+	// Disk holds the settings of the disk buffer events spill over to
+	// when the memory buffer is full.
+	Disk diskqueue.Settings
+}
+
+// userConfig holds the parameters for a hybrid queue that are configurable
+// by the end user in the beats yml file. The sub-configurations are passed
+// on to the memory and disk queues.
+type userConfig struct {
+	Mem  *config.C `config:"mem"`
+	Disk *config.C `config:"disk"`
+}
+
+// SettingsForUserConfig returns a Settings struct initialized with the
+// end-user-configurable settings in the given config tree.
+func SettingsForUserConfig(cfg *config.C) (Settings, error) {
+	userConfig := userConfig{}
+	if cfg != nil {
+		if err := cfg.Unpack(&userConfig); err != nil {
+			return Settings{}, fmt.Errorf("couldn't unpack hybrid queue config: %w", err)
+		}
+	}
+	if userConfig.Disk == nil {
+		return Settings{}, errors.New("hybrid queue requires a disk configuration")
+	}
+
+	memSettings, err := memqueue.SettingsForUserConfig(userConfig.Mem)
+	if err != nil {
+		return Settings{}, fmt.Errorf("invalid hybrid queue memory settings: %w", err)
+	}
+	diskSettings, err := diskqueue.SettingsForUserConfig(userConfig.Disk)
+	if err != nil {
+		return Settings{}, fmt.Errorf("invalid hybrid queue disk settings: %w", err)
+	}
+	return Settings{
+		Memory: memSettings,
+		Disk:   diskSettings,
+	}, nil
+}
@@ -0,0 +1,49 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestSettingsForUserConfig(t *testing.T) {
+	cfg := config.MustNewConfigFrom(`
+mem:
+  events: 4096
+disk:
+  max_size: 1GB
+`)
+	settings, err := SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 4096, settings.Memory.Events)
+	assert.Equal(t, uint64(1e9), settings.Disk.MaxBufferSize)
+}
+
+func TestSettingsForUserConfigRequiresDisk(t *testing.T) {
+	cfg := config.MustNewConfigFrom(`
+mem:
+  events: 4096
+`)
+	_, err := SettingsForUserConfig(cfg)
+	require.Error(t, err)
+}
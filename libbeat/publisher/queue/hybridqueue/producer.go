@@ -0,0 +1,213 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// producer sends events to the memory or disk producer, depending on the
+// queue's state. Like the producers of the other queues, it must not be
+// used from multiple goroutines at once.
+type producer struct {
+	queue *hybridQueue
+
+	memory queue.Producer
+	disk   queue.Producer
+
+	// acks is nil if the producer wasn't configured with an ACK callback.
+	acks *producerACKs
+
+	// mutex serializes Cancel with events being sent to the memory
+	// buffer. An event is counted in the memory buffer before it is
+	// published, so its publication must not fail because the producer
+	// was cancelled in between.
+	mutex     sync.Mutex
+	cancelled bool
+}
+
+func newProducer(q *hybridQueue, cfg queue.ProducerConfig) *producer {
+	p := &producer{queue: q}
+
+	// Events can't be removed from the disk queue once they are written,
+	// so DropOnCancel is not supported.
+	memCfg := queue.ProducerConfig{OnDrop: cfg.OnDrop}
+	diskCfg := queue.ProducerConfig{OnDrop: cfg.OnDrop}
+	if cfg.ACK != nil {
+		p.acks = &producerACKs{callback: cfg.ACK}
+		memCfg.ACK = func(count int) { p.acks.ack(false, count) }
+		diskCfg.ACK = func(count int) { p.acks.ack(true, count) }
+	}
+	p.memory = q.memory.Producer(memCfg)
+	p.disk = q.disk.Producer(diskCfg)
+	return p
+}
+
+func (p *producer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	return 0, p.publish(entry, true)
+}
+
+func (p *producer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return 0, p.publish(entry, false)
+}
+
+func (p *producer) publish(entry queue.Entry, shouldBlock bool) bool {
+	p.mutex.Lock()
+	if p.cancelled {
+		p.mutex.Unlock()
+		return false
+	}
+	toDisk, ok := p.queue.reserve()
+	if !ok {
+		p.mutex.Unlock()
+		return false
+	}
+	if p.acks != nil {
+		p.acks.add(toDisk)
+	}
+	if !toDisk {
+		// reserve only picks the memory buffer if it has room for the
+		// event, so this doesn't block for long.
+		_, ok = p.memory.Publish(entry)
+		p.mutex.Unlock()
+		if !ok {
+			p.failed(toDisk)
+		}
+		return ok
+	}
+	p.mutex.Unlock()
+
+	if shouldBlock {
+		_, ok = p.disk.Publish(entry)
+	} else {
+		_, ok = p.disk.TryPublish(entry)
+	}
+	if !ok {
+		p.failed(toDisk)
+		return false
+	}
+	p.queue.published()
+	return true
+}
+
+// failed undoes the bookkeeping for an event that couldn't be published.
+func (p *producer) failed(toDisk bool) {
+	if p.acks != nil {
+		p.acks.remove()
+	}
+	p.queue.release(toDisk)
+}
+
+func (p *producer) Cancel() int {
+	p.mutex.Lock()
+	p.cancelled = true
+	p.memory.Cancel()
+	p.mutex.Unlock()
+
+	// The disk producer is cancelled without holding the mutex, to unblock
+	// a pending Publish call.
+	p.disk.Cancel()
+	return 0
+}
+
+// producerACKs forwards the ACKs of the memory and disk producers to the
+// producer's ACK callback in publish order. The two buffers acknowledge
+// events independently, so an ACK from one of them is held back until
+// all earlier events from the other one have been acknowledged.
+type producerACKs struct {
+	mutex    sync.Mutex
+	callback func(count int)
+
+	// runs holds the buffers of the unacknowledged events in publish order,
+	// with consecutive events of the same buffer merged into one run.
+	runs []ackRun
+
+	// The number of events each buffer acknowledged that haven't been
+	// released to the callback yet.
+	memoryACKed int
+	diskACKed   int
+}
+
+type ackRun struct {
+	disk  bool
+	count int
+}
+
+// add records a new event sent to the given buffer.
+func (a *producerACKs) add(disk bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if n := len(a.runs); n > 0 && a.runs[n-1].disk == disk {
+		a.runs[n-1].count++
+		return
+	}
+	a.runs = append(a.runs, ackRun{disk: disk, count: 1})
+}
+
+// remove forgets the event recorded by the last call to add.
+func (a *producerACKs) remove() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	n := len(a.runs)
+	if n == 0 {
+		return
+	}
+	a.runs[n-1].count--
+	if a.runs[n-1].count == 0 {
+		a.runs = a.runs[:n-1]
+	}
+}
+
+// ack records acknowledged events from one of the buffers and passes on
+// the ones that are now acknowledged in publish order. The callback is
+// invoked with the mutex held, so it is never called concurrently even
+// though the buffers acknowledge events from different goroutines.
+func (a *producerACKs) ack(disk bool, count int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if disk {
+		a.diskACKed += count
+	} else {
+		a.memoryACKed += count
+	}
+
+	released := 0
+	for len(a.runs) > 0 {
+		run := &a.runs[0]
+		acked := &a.memoryACKed
+		if run.disk {
+			acked = &a.diskACKed
+		}
+		n := min(run.count, *acked)
+		if n == 0 {
+			break
+		}
+		run.count -= n
+		*acked -= n
+		released += n
+		if run.count > 0 {
+			break
+		}
+		a.runs = a.runs[1:]
+	}
+	if released > 0 {
+		a.callback(released)
+	}
+}
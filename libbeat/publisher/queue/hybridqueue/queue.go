@@ -0,0 +1,331 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/opt"
+)
+
+// The string used to specify this queue in beats configurations.
+const QueueType = "hybrid"
+
+// hybridQueue is a queue.Queue that keeps events in a memory queue while
+// the consumers keep up, and spills them to a disk queue once the memory
+// buffer is full.
+//
+// Ordering is preserved by never using both buffers for new events at the
+// same time: once an event has been spilled, all later events also go to
+// disk until every spilled event has been read back. Consumers always
+// drain the memory buffer before reading from disk, since everything in
+// memory is older than what was spilled.
+type hybridQueue struct {
+	logger *logp.Logger
+
+	memory queue.Queue
+	disk   queue.Queue
+
+	// mutex protects the fields below. cond is signalled when events are
+	// added to either buffer, or when the queue is closed, to wake up
+	// consumers waiting in Get.
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	// spilling is true while new events are sent to the disk queue. It is
+	// set when the memory queue can't accept an event, and cleared once all
+	// events written to disk have been read back.
+	spilling bool
+
+	// The number of events added to each buffer that haven't been returned
+	// by Get yet.
+	memoryCount int
+	diskCount   int
+
+	// The number of events producers are currently writing to disk. The
+	// queue doesn't leave the spilling state while it is positive.
+	diskPending int
+
+	// diskReading is true while a consumer waits for events from the disk
+	// queue in Get. The queue doesn't leave the spilling state while it is
+	// set, since the events the consumer waits for may have been dropped
+	// by the disk queue, and only a new spilled event will wake it up.
+	diskReading bool
+
+	// The number of events added to the memory buffer that haven't been
+	// acknowledged yet, and the number of events it can hold. The memory
+	// queue's producers block instead of failing when its buffer is full,
+	// so the hybrid queue keeps track of the occupancy itself.
+	memoryUnacked int
+	memoryLimit   int
+
+	closed bool
+}
+
+// FactoryForSettings is a simple wrapper around NewQueue so a concrete
+// Settings object can be wrapped in a queue-agnostic interface for
+// later use by the pipeline.
+func FactoryForSettings(settings Settings) queue.QueueFactory {
+	return func(
+		logger *logp.Logger,
+		ackCallback func(eventCount int),
+		inputQueueSize int,
+		encoderFactory queue.EncoderFactory,
+	) (queue.Queue, error) {
+		return NewQueue(logger, ackCallback, settings, inputQueueSize, encoderFactory)
+	}
+}
+
+// NewQueue returns a hybrid queue with the given settings. Events that
+// are still stored in the disk queue from a previous session are
+// delivered before any new event.
+func NewQueue(
+	logger *logp.Logger,
+	ackCallback func(eventCount int),
+	settings Settings,
+	inputQueueSize int,
+	encoderFactory queue.EncoderFactory,
+) (*hybridQueue, error) {
+	if logger == nil {
+		logger = logp.NewLogger("hybridqueue")
+	} else {
+		logger = logger.Named("hybridqueue")
+	}
+
+	q := &hybridQueue{
+		logger:      logger,
+		memoryLimit: settings.Memory.Events,
+	}
+	q.cond = sync.NewCond(&q.mutex)
+
+	// Events dropped by the disk queue are never returned by Get. The
+	// mutex is held until the initial event count is set, so that drops
+	// reported in the meantime are subtracted from it.
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	settings.Disk.DropCallback = q.diskDropped
+	disk, err := diskqueue.NewQueue(logger, ackCallback, settings.Disk, encoderFactory)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create disk buffer: %w", err)
+	}
+	q.disk = disk
+	q.diskCount = disk.InitialEventCount()
+
+	q.memory = memqueue.NewQueue(logger, func(eventCount int) {
+		q.memoryACKed(eventCount)
+		if ackCallback != nil {
+			ackCallback(eventCount)
+		}
+	}, settings.Memory, inputQueueSize, encoderFactory)
+	if q.diskCount > 0 {
+		q.logger.Infof(
+			"Draining %d events spilled to disk by a previous session", q.diskCount)
+		q.spilling = true
+	}
+	return q, nil
+}
+
+func (q *hybridQueue) Close() error {
+	q.mutex.Lock()
+	if q.closed {
+		q.mutex.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+
+	memErr := q.memory.Close()
+	diskErr := q.disk.Close()
+	if memErr != nil {
+		return memErr
+	}
+	return diskErr
+}
+
+func (q *hybridQueue) QueueType() string {
+	return QueueType
+}
+
+func (q *hybridQueue) BufferConfig() queue.BufferConfig {
+	// Like the disk queue, the number of events the queue can hold
+	// depends on their size.
+	return queue.BufferConfig{MaxEvents: 0}
+}
+
+func (q *hybridQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
+	return newProducer(q, cfg)
+}
+
+func (q *hybridQueue) Get(eventCount int) (queue.Batch, error) {
+	q.mutex.Lock()
+	for !q.closed && q.memoryCount == 0 && q.diskCount == 0 {
+		q.cond.Wait()
+	}
+	if q.closed {
+		q.mutex.Unlock()
+		return nil, io.EOF
+	}
+	fromMemory := q.memoryCount > 0
+	q.diskReading = !fromMemory
+	q.mutex.Unlock()
+
+	if fromMemory {
+		batch, err := q.memory.Get(eventCount)
+		if err != nil {
+			return nil, err
+		}
+		q.mutex.Lock()
+		q.memoryCount -= batch.Count()
+		q.mutex.Unlock()
+		return batch, nil
+	}
+
+	batch, err := q.disk.Get(eventCount)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.diskReading = false
+	if err != nil {
+		q.maybeStopSpilling()
+		return nil, err
+	}
+	q.removeDiskEvents(batch.Count())
+	return batch, nil
+}
+
+// Metrics returns the combined metrics of the memory and disk buffers.
+func (q *hybridQueue) Metrics() (queue.Metrics, error) {
+	memMetrics, err := q.memory.Metrics()
+	if err != nil {
+		return queue.Metrics{}, err
+	}
+	diskMetrics, err := q.disk.Metrics()
+	if err != nil {
+		return queue.Metrics{}, err
+	}
+
+	q.mutex.Lock()
+	diskCount := q.diskCount
+	q.mutex.Unlock()
+
+	return queue.Metrics{
+		EventCount:            opt.UintWith(memMetrics.EventCount.ValueOr(0) + uint64(diskCount)),
+		EventLimit:            memMetrics.EventLimit,
+		ByteCount:             diskMetrics.ByteCount,
+		ByteLimit:             diskMetrics.ByteLimit,
+		UnackedConsumedEvents: memMetrics.UnackedConsumedEvents,
+		OldestEntryID:         memMetrics.OldestEntryID,
+
+		DroppedEvents: diskMetrics.DroppedEvents,
+		DroppedBytes:  diskMetrics.DroppedBytes,
+	}, nil
+}
+
+// reserve picks the buffer for the next event and counts the event as
+// added to it. It returns false if the queue is closed.
+//
+// Events sent to memory are counted before they are published, since the
+// memory queue can hand them to a consumer before Publish returns. Events
+// sent to disk are counted as pending until the write is confirmed, so a
+// consumer never waits on the disk queue for an event that may not come.
+func (q *hybridQueue) reserve() (toDisk bool, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return false, false
+	}
+	if !q.spilling && q.memoryUnacked >= q.memoryLimit {
+		q.logger.Info("Memory buffer is full, spilling new events to disk")
+		q.spilling = true
+	}
+	if q.spilling {
+		q.diskPending++
+		return true, true
+	}
+	q.memoryUnacked++
+	q.memoryCount++
+	q.cond.Signal()
+	return false, true
+}
+
+// published records an event reserved for the disk buffer as written,
+// and wakes up a consumer waiting for it.
+func (q *hybridQueue) published() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.diskPending--
+	q.diskCount++
+	q.cond.Signal()
+}
+
+// release undoes a reserve call for an event that couldn't be published.
+func (q *hybridQueue) release(toDisk bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if toDisk {
+		q.diskPending--
+		q.maybeStopSpilling()
+	} else {
+		q.memoryUnacked--
+		q.memoryCount--
+	}
+}
+
+// diskDropped is called by the disk queue when it discards unread events
+// because of its overflow policy or max_age.
+func (q *hybridQueue) diskDropped(eventCount int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.logger.Warnf("%d events spilled to disk have been dropped", eventCount)
+	q.removeDiskEvents(eventCount)
+}
+
+// removeDiskEvents removes events that have been read from or dropped by
+// the disk queue from the disk backlog. Must be called with the mutex
+// held.
+func (q *hybridQueue) removeDiskEvents(eventCount int) {
+	q.diskCount -= eventCount
+	if q.diskCount <= 0 {
+		// The event count from a previous session is only an estimate,
+		// don't let it go negative.
+		q.diskCount = 0
+		q.maybeStopSpilling()
+	}
+}
+
+// maybeStopSpilling sends new events back to the memory buffer once all
+// events written to disk have been read. Must be called with the mutex
+// held.
+func (q *hybridQueue) maybeStopSpilling() {
+	if q.spilling && q.diskCount == 0 && q.diskPending == 0 && !q.diskReading {
+		q.logger.Info("Disk backlog drained, buffering new events in memory")
+		q.spilling = false
+	}
+}
+
+func (q *hybridQueue) memoryACKed(eventCount int) {
+	q.mutex.Lock()
+	q.memoryUnacked -= eventCount
+	q.mutex.Unlock()
+}
@@ -0,0 +1,249 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/queuetest"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var seed int64
+
+func init() {
+	flag.Int64Var(&seed, "seed", time.Now().UnixNano(), "test random seed")
+}
+
+func TestProduceConsumer(t *testing.T) {
+	maxEvents := 1024
+	minEvents := 32
+
+	rand.Seed(seed)
+	events := rand.Intn(maxEvents-minEvents) + minEvents
+	batchSize := rand.Intn(events-8) + 4
+
+	t.Log("seed: ", seed)
+	t.Log("events: ", events)
+	t.Log("batchSize: ", batchSize)
+
+	testWith := func(factory queuetest.QueueFactory) func(t *testing.T) {
+		return func(t *testing.T) {
+			t.Run("single", func(t *testing.T) {
+				t.Parallel()
+				queuetest.TestSingleProducerConsumer(t, events, batchSize, factory)
+			})
+			t.Run("multi", func(t *testing.T) {
+				t.Parallel()
+				queuetest.TestMultiProducerConsumer(t, events, batchSize, factory)
+			})
+		}
+	}
+
+	// A memory buffer smaller than the event count makes the queue spill
+	// to disk while the consumer is behind.
+	t.Run("spilling", testWith(makeTestQueue(32)))
+	t.Run("memory", testWith(makeTestQueue(maxEvents)))
+}
+
+func TestSpillPreservesOrder(t *testing.T) {
+	q := newTestQueue(t, 32)
+
+	eventCount := 200
+	producer := q.Producer(queue.ProducerConfig{})
+	for i := 0; i < eventCount; i++ {
+		_, ok := producer.Publish(queuetest.MakeEvent(mapstr.M{"count": i}))
+		require.True(t, ok, "event %d should be published", i)
+	}
+
+	q.mutex.Lock()
+	assert.True(t, q.spilling, "queue should spill once the memory buffer is full")
+	assert.Equal(t, 32, q.memoryCount)
+	assert.Equal(t, eventCount-32, q.diskCount)
+	q.mutex.Unlock()
+
+	received := readEvents(t, q, eventCount)
+	for i, count := range received {
+		require.Equal(t, i, count, "events should be read in publish order")
+	}
+
+	q.mutex.Lock()
+	assert.False(t, q.spilling, "queue should stop spilling once the disk backlog is drained")
+	q.mutex.Unlock()
+
+	// Once the memory buffer has been acknowledged, new events go back to
+	// it.
+	require.Eventually(t, func() bool {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		return q.memoryUnacked == 0
+	}, time.Second, time.Millisecond)
+	_, ok := producer.Publish(queuetest.MakeEvent(mapstr.M{"count": eventCount}))
+	require.True(t, ok)
+	q.mutex.Lock()
+	assert.Equal(t, 1, q.memoryCount)
+	assert.Zero(t, q.diskCount)
+	q.mutex.Unlock()
+}
+
+func TestDroppedSegmentsStopSpilling(t *testing.T) {
+	q := newTestQueue(t, 32, func(settings *diskqueue.Settings) {
+		// Small segments that aren't read ahead, so that the segments
+		// not being read yet can be dropped once they are older than
+		// max_age.
+		settings.MaxSegmentSize = 1000
+		settings.ReadAheadLimit = 1
+		settings.MaxAge = 50 * time.Millisecond
+	})
+
+	eventCount := 200
+	producer := q.Producer(queue.ProducerConfig{})
+	for i := 0; i < eventCount; i++ {
+		_, ok := producer.Publish(queuetest.MakeEvent(mapstr.M{"count": i}))
+		require.True(t, ok, "event %d should be published", i)
+	}
+
+	require.Eventually(t, func() bool {
+		metrics, err := q.disk.Metrics()
+		require.NoError(t, err)
+		return metrics.DroppedEvents.ValueOr(0) > 0
+	}, 5*time.Second, 10*time.Millisecond, "segments should be dropped")
+	// Wait for the remaining segments to expire.
+	time.Sleep(200 * time.Millisecond)
+
+	metrics, err := q.Metrics()
+	require.NoError(t, err)
+	dropped := int(metrics.DroppedEvents.ValueOr(0))
+	q.mutex.Lock()
+	remaining := q.memoryCount + q.diskCount
+	q.mutex.Unlock()
+	require.Equal(t, eventCount-dropped, remaining)
+
+	received := readEvents(t, q, remaining)
+	require.Len(t, received, remaining)
+
+	q.mutex.Lock()
+	assert.Zero(t, q.diskCount)
+	assert.False(t, q.spilling, "queue should stop spilling once the remaining events are read")
+	q.mutex.Unlock()
+
+	require.Eventually(t, func() bool {
+		metrics, err := q.Metrics()
+		require.NoError(t, err)
+		return metrics.EventCount.ValueOr(0) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestProducerACKOrder(t *testing.T) {
+	acks := &producerACKs{}
+	var released []int
+	acks.callback = func(count int) { released = append(released, count) }
+
+	// Two events to memory, three to disk, one to memory.
+	acks.add(false)
+	acks.add(false)
+	acks.add(true)
+	acks.add(true)
+	acks.add(true)
+	acks.add(false)
+
+	// Disk ACKs are held back until the earlier memory events are acked.
+	acks.ack(true, 3)
+	assert.Empty(t, released)
+
+	acks.ack(false, 1)
+	assert.Equal(t, []int{1}, released)
+
+	// Releasing the second memory event also releases the disk events,
+	// but not the last memory event.
+	acks.ack(false, 1)
+	assert.Equal(t, []int{1, 4}, released)
+
+	acks.ack(false, 1)
+	assert.Equal(t, []int{1, 4, 1}, released)
+	assert.Empty(t, acks.runs)
+}
+
+func TestProducerACKRemove(t *testing.T) {
+	acks := &producerACKs{callback: func(int) {}}
+	acks.add(false)
+	acks.add(true)
+	acks.remove()
+	require.Equal(t, []ackRun{{disk: false, count: 1}}, acks.runs)
+}
+
+func readEvents(t *testing.T, q queue.Queue, count int) []int {
+	t.Helper()
+	var result []int
+	for len(result) < count {
+		batch, err := q.Get(count - len(result))
+		require.NoError(t, err)
+		for i := 0; i < batch.Count(); i++ {
+			event, ok := batch.Entry(i).(publisher.Event)
+			require.True(t, ok)
+			value, err := event.Content.Fields.GetValue("count")
+			require.NoError(t, err)
+			// Events read from disk are decoded with the smallest
+			// fitting integer type.
+			n, err := strconv.Atoi(fmt.Sprint(value))
+			require.NoError(t, err)
+			result = append(result, n)
+		}
+		batch.Done()
+	}
+	return result
+}
+
+func newTestQueue(t *testing.T, memoryEvents int, options ...func(*diskqueue.Settings)) *hybridQueue {
+	t.Helper()
+	settings := Settings{
+		Memory: memqueue.Settings{
+			Events:        memoryEvents,
+			MaxGetRequest: memoryEvents,
+			FlushTimeout:  0,
+		},
+		Disk: diskqueue.DefaultSettings(),
+	}
+	settings.Disk.Path = t.TempDir()
+	for _, option := range options {
+		option(&settings.Disk)
+	}
+	q, err := NewQueue(logp.NewLogger("test"), nil, settings, 0, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func makeTestQueue(memoryEvents int) queuetest.QueueFactory {
+	return func(t *testing.T) queue.Queue {
+		return newTestQueue(t, memoryEvents)
+	}
+}
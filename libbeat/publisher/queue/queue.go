@@ -45,6 +45,11 @@ type Metrics struct {
 	//UnackedConsumedEvents is the count of events that an output consumer has read, but not yet ack'ed
 	UnackedConsumedEvents opt.Uint
 
+	//DroppedEvents is the total number of events the queue discarded to stay within its limits
+	DroppedEvents opt.Uint
+	//DroppedBytes is the total byte size of the events the queue discarded
+	DroppedBytes opt.Uint
+
 	//OldestActiveTimestamp is the timestamp of the oldest item in the queue.
 	OldestActiveTimestamp common.Time
 
@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logfmt
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Config holds the options of the logfmt parser.
+type Config struct {
+	Target              string `config:"target"`
+	MessageKey          string `config:"message_key"`
+	OverwriteKeys       bool   `config:"overwrite_keys"`
+	AddErrorKey         bool   `config:"add_error_key"`
+	IgnoreDecodingError bool   `config:"ignore_decoding_error"`
+	ExpandKeys          bool   `config:"expand_keys"`
+}
+
+func DefaultConfig() Config {
+	return Config{}
+}
+
+// Parser decodes logfmt formatted lines (key=value pairs separated by
+// spaces) into fields of the message.
+type Parser struct {
+	r      reader.Reader
+	cfg    *Config
+	logger *logp.Logger
+}
+
+func NewParser(r reader.Reader, cfg *Config) *Parser {
+	return &Parser{
+		r:      r,
+		cfg:    cfg,
+		logger: logp.NewLogger("parser_logfmt"),
+	}
+}
+
+// Next decodes the next line and returns the message with the decoded fields.
+func (p *Parser) Next() (reader.Message, error) {
+	message, err := p.r.Next()
+	if err != nil {
+		return message, err
+	}
+
+	var (
+		fields mapstr.M
+		failed bool
+	)
+	message.Content, fields, failed = p.decode(message.Content)
+
+	if len(fields) == 0 {
+		return message, nil
+	}
+	if message.Fields == nil {
+		message.Fields = mapstr.M{}
+	}
+
+	// The message key might have been modified by multiline
+	if len(p.cfg.MessageKey) > 0 && len(message.Content) > 0 {
+		fields[p.cfg.MessageKey] = string(message.Content)
+	}
+
+	// keep the original line if it could not be decoded and only
+	// the error is reported
+	if failed {
+		message.Fields["message"] = string(message.Content)
+	}
+
+	if p.cfg.Target == "" {
+		event := &beat.Event{
+			Timestamp: message.Ts,
+			Meta:      message.Meta,
+			Fields:    message.Fields,
+		}
+		jsontransform.WriteJSONKeys(event, fields, p.cfg.ExpandKeys, p.cfg.OverwriteKeys, p.cfg.AddErrorKey)
+		message.Ts = event.Timestamp
+		message.Fields = event.Fields
+		message.Meta = event.Meta
+	} else {
+		target := mapstr.M{}
+		target.Put(p.cfg.Target, fields)
+		message.AddFields(target)
+	}
+
+	return message, nil
+}
+
+// decode parses the key-value pairs of text and returns the new text
+// column if one was requested. failed is true if text could not be
+// decoded.
+func (p *Parser) decode(text []byte) (newText []byte, fields mapstr.M, failed bool) {
+	fields, err := decode(text)
+	if err != nil {
+		if !p.cfg.IgnoreDecodingError {
+			p.logger.Errorf("Error decoding logfmt: %v", err)
+		}
+		if p.cfg.AddErrorKey {
+			fields = mapstr.M{"error": createError(fmt.Sprintf("Error decoding logfmt: %v", err))}
+		}
+		return text, fields, true
+	}
+
+	if len(p.cfg.MessageKey) == 0 {
+		return []byte(""), fields, false
+	}
+
+	value, ok := fields[p.cfg.MessageKey]
+	if !ok {
+		if p.cfg.AddErrorKey {
+			fields["error"] = createError(fmt.Sprintf("Key '%s' not found", p.cfg.MessageKey))
+		}
+		return []byte(""), fields, false
+	}
+
+	// keys without a value cannot be used as message
+	textString, ok := value.(string)
+	if !ok {
+		if p.cfg.AddErrorKey {
+			fields["error"] = createError(fmt.Sprintf("Value of key '%s' is not a string", p.cfg.MessageKey))
+		}
+		return []byte(""), fields, false
+	}
+
+	return []byte(textString), fields, false
+}
+
+// decode reads all key-value pairs of text. Values are kept as strings,
+// keys without a value are set to true. If a key is repeated, the last
+// value wins.
+func decode(text []byte) (mapstr.M, error) {
+	fields := mapstr.M{}
+	i := 0
+	for {
+		i = skipSpaces(text, i)
+		if i >= len(text) {
+			break
+		}
+
+		start := i
+		for i < len(text) && !isSpace(text[i]) && text[i] != '=' && text[i] != '"' {
+			i++
+		}
+		if i == start {
+			return nil, fmt.Errorf("unexpected '%c' at position %d", text[i], i)
+		}
+		key := string(text[start:i])
+
+		if i >= len(text) || isSpace(text[i]) {
+			fields[key] = true
+			continue
+		}
+		if text[i] == '"' {
+			return nil, fmt.Errorf("unexpected '\"' at position %d", i)
+		}
+
+		// skip '='
+		i++
+		if i < len(text) && text[i] == '"' {
+			value, end, err := unquote(text, i)
+			if err != nil {
+				return nil, err
+			}
+			fields[key] = value
+			i = end
+			continue
+		}
+
+		start = i
+		for i < len(text) && !isSpace(text[i]) {
+			i++
+		}
+		fields[key] = string(text[start:i])
+	}
+
+	if len(fields) == 0 {
+		return nil, errors.New("no key-value pairs found")
+	}
+	return fields, nil
+}
+
+// unquote reads the quoted value starting at text[start] and returns it
+// together with the position following the closing quote.
+func unquote(text []byte, start int) (string, int, error) {
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(string(text[start : i+1]))
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid quoted value at position %d: %w", start, err)
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted value at position %d", start)
+}
+
+func skipSpaces(text []byte, i int) int {
+	for i < len(text) && isSpace(text[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func createError(message string) mapstr.M {
+	return mapstr.M{"message": message, "type": "logfmt"}
+}
+
+func (p *Parser) Close() error {
+	return p.r.Close()
+}
@@ -0,0 +1,205 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logfmt
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDecode(t *testing.T) {
+	tests := map[string]struct {
+		text     string
+		expected mapstr.M
+		err      string
+	}{
+		"simple pairs": {
+			text:     `level=info method=GET status=200`,
+			expected: mapstr.M{"level": "info", "method": "GET", "status": "200"},
+		},
+		"quoted values": {
+			text:     `msg="request \"done\"" path="/a b" empty=""`,
+			expected: mapstr.M{"msg": `request "done"`, "path": "/a b", "empty": ""},
+		},
+		"keys without value": {
+			text:     `debug cached=true err=`,
+			expected: mapstr.M{"debug": true, "cached": "true", "err": ""},
+		},
+		"values containing equal signs": {
+			text:     `token=YWJj== at=info`,
+			expected: mapstr.M{"token": "YWJj==", "at": "info"},
+		},
+		"repeated keys keep the last value": {
+			text:     "a=1  a=2\tb=3",
+			expected: mapstr.M{"a": "2", "b": "3"},
+		},
+		"unterminated quoted value": {
+			text: `msg="request done`,
+			err:  "unterminated quoted value at position 4",
+		},
+		"missing key": {
+			text: `=value`,
+			err:  "unexpected '=' at position 0",
+		},
+		"empty line": {
+			text: "   ",
+			err:  "no key-value pairs found",
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			fields, err := decode([]byte(test.text))
+			if test.err != "" {
+				require.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, fields)
+		})
+	}
+}
+
+func TestParser(t *testing.T) {
+	ts := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := map[string]struct {
+		config          map[string]interface{}
+		content         string
+		fields          mapstr.M
+		expectedContent string
+		expectedFields  mapstr.M
+	}{
+		"keys under root": {
+			content:        `level=info msg="user logged in"`,
+			fields:         mapstr.M{"log": mapstr.M{"offset": 0}},
+			expectedFields: mapstr.M{"log": mapstr.M{"offset": 0}, "level": "info", "msg": "user logged in"},
+		},
+		"message key": {
+			config:          map[string]interface{}{"message_key": "msg"},
+			content:         `level=info msg="user logged in"`,
+			expectedContent: "user logged in",
+			expectedFields:  mapstr.M{"level": "info", "msg": "user logged in"},
+		},
+		"target": {
+			config:         map[string]interface{}{"target": "kv"},
+			content:        `level=info msg="user logged in"`,
+			expectedFields: mapstr.M{"kv": mapstr.M{"level": "info", "msg": "user logged in"}},
+		},
+		"existing keys are kept": {
+			content:        `level=info log=custom`,
+			fields:         mapstr.M{"log": mapstr.M{"offset": 0}},
+			expectedFields: mapstr.M{"log": mapstr.M{"offset": 0}, "level": "info"},
+		},
+		"overwrite keys": {
+			config:         map[string]interface{}{"overwrite_keys": true},
+			content:        `level=info log=custom`,
+			fields:         mapstr.M{"log": mapstr.M{"offset": 0}},
+			expectedFields: mapstr.M{"log": "custom", "level": "info"},
+		},
+		"expand keys": {
+			config:         map[string]interface{}{"expand_keys": true},
+			content:        `http.method=GET http.status=200`,
+			expectedFields: mapstr.M{"http": mapstr.M{"method": "GET", "status": "200"}},
+		},
+		"error key in the line": {
+			config:         map[string]interface{}{"add_error_key": true},
+			content:        `error=timeout`,
+			fields:         mapstr.M{"log": mapstr.M{"offset": 0}},
+			expectedFields: mapstr.M{"log": mapstr.M{"offset": 0}, "error": "timeout"},
+		},
+		"decoding error with error key": {
+			config:          map[string]interface{}{"add_error_key": true},
+			content:         `msg="broken`,
+			expectedContent: `msg="broken`,
+			expectedFields: mapstr.M{
+				"message": `msg="broken`,
+				"error": mapstr.M{
+					"message": "Error decoding logfmt: unterminated quoted value at position 4",
+					"type":    "logfmt",
+				},
+			},
+		},
+		"decoding error without error key": {
+			content:         `msg="broken`,
+			fields:          mapstr.M{},
+			expectedContent: `msg="broken`,
+			expectedFields:  mapstr.M{},
+		},
+		"missing message key": {
+			config:  map[string]interface{}{"message_key": "msg", "add_error_key": true},
+			content: `level=info`,
+			expectedFields: mapstr.M{
+				"level": "info",
+				"error": mapstr.M{
+					"message": "Key 'msg' not found",
+					"type":    "logfmt",
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			c := DefaultConfig()
+			require.NoError(t, config.MustNewConfigFrom(test.config).Unpack(&c))
+
+			p := NewParser(&testReader{msgs: []reader.Message{{
+				Ts:      ts,
+				Content: []byte(test.content),
+				Fields:  test.fields,
+			}}}, &c)
+			defer p.Close()
+
+			msg, err := p.Next()
+			require.NoError(t, err)
+			require.Equal(t, test.expectedContent, string(msg.Content))
+			require.Equal(t, test.expectedFields, msg.Fields)
+			require.Equal(t, ts, msg.Ts)
+
+			_, err = p.Next()
+			require.ErrorIs(t, err, io.EOF)
+		})
+	}
+}
+
+type testReader struct {
+	msgs []reader.Message
+}
+
+func (r *testReader) Next() (reader.Message, error) {
+	if len(r.msgs) == 0 {
+		return reader.Message{}, io.EOF
+	}
+	msg := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	return msg, nil
+}
+
+func (r *testReader) Close() error {
+	return nil
+}
@@ -31,10 +31,12 @@ const (
 	patternMode multilineType = iota
 	countMode
 	whilePatternMode
+	stacktraceMode
 
 	patternStr      = "pattern"
 	countStr        = "count"
 	whilePatternStr = "while_pattern"
+	stacktraceStr   = "stacktrace"
 )
 
 var (
@@ -42,6 +44,7 @@ var (
 		patternStr:      patternMode,
 		countStr:        countMode,
 		whilePatternStr: whilePatternMode,
+		stacktraceStr:   stacktraceMode,
 	}
 
 	ErrMissingPattern = errors.New("multiline.pattern cannot be empty when pattern based matching is selected")
@@ -61,6 +64,8 @@ type Config struct {
 
 	LinesCount  int  `config:"count_lines" validate:"positive"`
 	SkipNewLine bool `config:"skip_newline"`
+
+	Languages []string `config:"languages"`
 }
 
 // Validate validates the Config option for multiline reader.
@@ -80,6 +85,12 @@ func (c *Config) Validate() error {
 		if c.Pattern == nil {
 			return ErrMissingPattern
 		}
+	} else if c.Type == stacktraceMode {
+		for _, lang := range c.Languages {
+			if _, ok := stacktraceDetectors[lang]; !ok && lang != languageAuto {
+				return fmt.Errorf("unknown stacktrace language: %s", lang)
+			}
+		}
 	} else {
 		return fmt.Errorf("unknown multiline type %d", c.Type)
 	}
@@ -284,6 +284,98 @@ func TestMultilineWhilePattern(t *testing.T) {
 	)
 }
 
+func TestMultilineStacktrace(t *testing.T) {
+	javaTrace := "2023-06-01 12:00:00 ERROR failed to process request\n" +
+		"java.lang.IllegalStateException: A book has a null property\n" +
+		"\tat com.example.myproject.Author.getBookIds(Author.java:38)\n" +
+		"\tat com.example.myproject.Bootstrap.main(Bootstrap.java:14)\n" +
+		"Caused by: java.lang.NullPointerException\n" +
+		"\tat com.example.myproject.Book.getId(Book.java:22)\n" +
+		"\t... 1 more\n"
+	pythonTrace := "Traceback (most recent call last):\n" +
+		"  File \"/app/main.py\", line 10, in <module>\n" +
+		"    main()\n" +
+		"  File \"/app/main.py\", line 7, in main\n" +
+		"    raise ValueError(\"invalid value\")\n" +
+		"ValueError: invalid value\n"
+	goTrace := "panic: runtime error: index out of range [5] with length 3\n" +
+		"\n" +
+		"goroutine 1 [running]:\n" +
+		"main.lookup(...)\n" +
+		"\t/app/main.go:12\n" +
+		"main.main()\n" +
+		"\t/app/main.go:8 +0x1d\n" +
+		"exit status 2\n"
+	dotnetTrace := "Unhandled exception. System.InvalidOperationException: Operation is not valid\n" +
+		" ---> System.ArgumentNullException: Value cannot be null. (Parameter 'key')\n" +
+		"   at System.Collections.Generic.Dictionary`2.FindValue(TKey key)\n" +
+		"   --- End of inner exception stack trace ---\n" +
+		"   at Program.Main(String[] args) in /app/Program.cs:line 12\n"
+
+	testCases := map[string]struct {
+		languages []string
+		lines     []string
+	}{
+		"java": {
+			languages: []string{"java"},
+			lines:     []string{"first line\n", javaTrace, "last line\n"},
+		},
+		"python": {
+			languages: []string{"python"},
+			lines:     []string{"first line\n", pythonTrace, "last line\n"},
+		},
+		"go": {
+			languages: []string{"go"},
+			lines:     []string{"first line\n", goTrace, "last line\n"},
+		},
+		"dotnet": {
+			languages: []string{"dotnet"},
+			lines:     []string{"first line\n", dotnetTrace, "last line\n"},
+		},
+		"auto with mixed languages": {
+			languages: []string{"auto"},
+			lines:     []string{"first line\n", javaTrace, pythonTrace, goTrace, dotnetTrace, "last line\n"},
+		},
+		"defaults to auto": {
+			lines: []string{javaTrace, pythonTrace, goTrace, dotnetTrace},
+		},
+		"consecutive stack traces are not combined": {
+			languages: []string{"java"},
+			lines: []string{
+				"java.lang.NullPointerException\n\tat com.example.Main.main(Main.java:3)\n",
+				"java.lang.IllegalStateException: stopped\n\tat com.example.Main.main(Main.java:5)\n",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			testMultilineOK(t,
+				Config{
+					Type:      stacktraceMode,
+					Languages: tc.languages,
+				},
+				len(tc.lines),
+				tc.lines...,
+			)
+		})
+	}
+
+	// a detector only combines the stack traces of its language
+	testMultilineOK(t,
+		Config{
+			Type:      stacktraceMode,
+			Languages: []string{"java"},
+		},
+		4,
+		"Traceback (most recent call last):\n",
+		"  File \"/app/main.py\", line 10, in <module>\n",
+		"panic: boom\n",
+		"goroutine 1 [running]:\n",
+	)
+}
+
 func testMultilineOK(t *testing.T, cfg Config, events int, expected ...string) {
 	_, buf := createLineBuffer(expected...)
 	r := createMultilineTestReader(t, buf, cfg)
@@ -77,6 +77,19 @@ func newMultilinePatternReader(
 		return nil, err
 	}
 
+	return newMatcherReader(r, separator, maxBytes, config, matcher), nil
+}
+
+// newMatcherReader creates a multiline reader that combines lines for as long
+// as the given matcher reports the current line as a continuation of the
+// multiline event.
+func newMatcherReader(
+	r reader.Reader,
+	separator string,
+	maxBytes int,
+	config *Config,
+	matcher matcher,
+) reader.Reader {
 	maxLines := defaultMaxLines
 	if config.MaxLines != nil {
 		maxLines = *config.MaxLines
@@ -99,7 +112,7 @@ func newMultilinePatternReader(
 		msgBuffer:    newMessageBuffer(maxBytes, maxLines, []byte(separator), config.SkipNewLine),
 		logger:       logp.NewLogger("reader_multiline"),
 	}
-	return pr, nil
+	return pr
 }
 
 func setupPatternMatcher(config *Config) (matcher, error) {
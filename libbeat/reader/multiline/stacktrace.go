@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package multiline
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/reader"
+)
+
+const (
+	languageAuto   = "auto"
+	languageJava   = "java"
+	languagePython = "python"
+	languageGo     = "go"
+	languageDotnet = "dotnet"
+)
+
+// stacktraceDetectors contains the built-in detectors of the stacktrace mode,
+// indexed by the language they recognize. A detector reports whether the
+// current line continues the stack trace the last line belongs to.
+var stacktraceDetectors = map[string]matcher{
+	languageJava:   javaStacktrace,
+	languagePython: pythonStacktrace,
+	languageGo:     goStacktrace,
+	languageDotnet: dotnetStacktrace,
+}
+
+var (
+	atFrame         = match.MustCompile(`^\s+at\s+\S`)
+	javaMoreFrames  = match.MustCompile(`^\s+\.\.\. \d+ (more|common frames omitted)`)
+	javaCause       = match.MustCompile(`^\s*(Caused by|Suppressed): `)
+	javaException   = match.MustCompile(`^([a-zA-Z_$][a-zA-Z0-9_$]*\.)+[a-zA-Z_$][a-zA-Z0-9_$]*(Exception|Error|Throwable)(: .*)?$`)
+	pythonHeader    = match.MustCompile(`^Traceback \(most recent call last\):$`)
+	pythonIndented  = match.MustCompile(`^\s+\S`)
+	pythonException = match.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*\.)*[a-zA-Z_][a-zA-Z0-9_]*(Error|Exception|Warning|Exit|Interrupt|Iteration)(: .*)?$`)
+	goHeader        = match.MustCompile(`^(panic|fatal error): `)
+	goGoroutine     = match.MustCompile(`^goroutine \d+ \[[^\]]*\]:$`)
+	goFileLine      = match.MustCompile(`^\t.+:\d+( \+0x[0-9a-f]+)?$`)
+	goFunction      = match.MustCompile(`^\S+\(.*\)$`)
+	goTrailer       = match.MustCompile(`^(\t(panic|fatal error): |created by |\[signal |exit status \d+$|\.\.\.additional frames elided\.\.\.$)`)
+	dotnetMarker    = match.MustCompile(`^\s*(---> |--- End of .*---$)`)
+	dotnetException = match.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*\.)+[a-zA-Z_][a-zA-Z0-9_]*(Exception|Error)(: .*)?$`)
+)
+
+// newMultilineStacktraceReader creates a multiline reader that combines the
+// lines of stack traces using the built-in detectors of the configured
+// languages.
+func newMultilineStacktraceReader(
+	r reader.Reader,
+	separator string,
+	maxBytes int,
+	config *Config,
+) (reader.Reader, error) {
+	matcher, err := setupStacktraceMatcher(config.Languages)
+	if err != nil {
+		return nil, err
+	}
+	return newMatcherReader(r, separator, maxBytes, config, matcher), nil
+}
+
+// setupStacktraceMatcher combines the detectors of the given languages.
+// If no language is configured or auto is selected, all detectors are used.
+func setupStacktraceMatcher(languages []string) (matcher, error) {
+	var detectors []matcher
+	for _, lang := range languages {
+		if lang == languageAuto {
+			detectors = nil
+			break
+		}
+		d, ok := stacktraceDetectors[lang]
+		if !ok {
+			return nil, fmt.Errorf("unknown stacktrace language: %s", lang)
+		}
+		detectors = append(detectors, d)
+	}
+	if len(detectors) == 0 {
+		// keep the order of the detectors stable
+		for _, lang := range []string{languageJava, languagePython, languageGo, languageDotnet} {
+			detectors = append(detectors, stacktraceDetectors[lang])
+		}
+	}
+
+	return func(last, current []byte) bool {
+		last = bytes.TrimRight(last, "\r\n")
+		current = bytes.TrimRight(current, "\r\n")
+		for _, d := range detectors {
+			if d(last, current) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// javaStacktrace appends frames, causes and suppressed exceptions to the
+// exception. An exception line is appended to the log message it follows.
+func javaStacktrace(last, current []byte) bool {
+	if atFrame.Match(current) || javaMoreFrames.Match(current) || javaCause.Match(current) {
+		return true
+	}
+	return javaException.Match(current) && !isJavaStacktraceLine(last)
+}
+
+func isJavaStacktraceLine(line []byte) bool {
+	return atFrame.Match(line) || javaMoreFrames.Match(line)
+}
+
+// pythonStacktrace appends the indented file and source lines of a traceback
+// to its header and the final exception line to the last source line.
+func pythonStacktrace(last, current []byte) bool {
+	if pythonIndented.Match(current) {
+		return pythonHeader.Match(last) || pythonIndented.Match(last)
+	}
+	// frames of other languages are indented too, but are not followed
+	// by the exception
+	return pythonException.Match(current) && pythonIndented.Match(last) && !atFrame.Match(last)
+}
+
+// goStacktrace appends the goroutine dumps of a panic or fatal error to its
+// header line. Blank lines are only kept between the parts of the dump.
+func goStacktrace(last, current []byte) bool {
+	switch {
+	case len(current) == 0:
+		return goHeader.Match(last) || goFileLine.Match(last)
+	case goGoroutine.Match(current), goFileLine.Match(current), goTrailer.Match(current):
+		return true
+	case goFunction.Match(current):
+		return goGoroutine.Match(last) || goFileLine.Match(last)
+	}
+	return false
+}
+
+// dotnetStacktrace appends frames, inner exceptions and the end of stack trace
+// markers to the exception. An exception line is appended to the log message
+// it follows.
+func dotnetStacktrace(last, current []byte) bool {
+	if atFrame.Match(current) || dotnetMarker.Match(current) {
+		return true
+	}
+	return dotnetException.Match(current) && !atFrame.Match(last) && !dotnetMarker.Match(last)
+}
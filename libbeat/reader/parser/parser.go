@@ -27,7 +27,9 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
 	"github.com/elastic/beats/v7/libbeat/reader"
 	"github.com/elastic/beats/v7/libbeat/reader/filter"
+	"github.com/elastic/beats/v7/libbeat/reader/logfmt"
 	"github.com/elastic/beats/v7/libbeat/reader/multiline"
+	"github.com/elastic/beats/v7/libbeat/reader/readcsv"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile"
 	"github.com/elastic/beats/v7/libbeat/reader/readjson"
 	"github.com/elastic/beats/v7/libbeat/reader/syslog"
@@ -50,6 +52,13 @@ type CommonConfig struct {
 	LineTerminator readfile.LineTerminator `config:"line_terminator"`
 }
 
+// State holds the information parsers collect about the source they read,
+// that must be persisted to continue reading it after a restart.
+type State struct {
+	// CSVHeader is the header line read by the csv parser.
+	CSVHeader []string `json:"csv_header,omitempty" struct:"csv_header,omitempty"`
+}
+
 type Config struct {
 	Suffix string
 
@@ -101,6 +110,27 @@ func NewConfig(pCfg CommonConfig, parsers []config.Namespace) (*Config, error) {
 			if err != nil {
 				return nil, fmt.Errorf("error while parsing ndjson parser config: %w", err)
 			}
+		case "json":
+			var config readjson.ParserConfig
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return nil, fmt.Errorf("error while parsing json parser config: %w", err)
+			}
+		case "logfmt", "kv":
+			config := logfmt.DefaultConfig()
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return nil, fmt.Errorf("error while parsing %s parser config: %w", name, err)
+			}
+		case "csv":
+			config := readcsv.DefaultConfig()
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return nil, fmt.Errorf("error while parsing csv parser config: %w", err)
+			}
 		case "container":
 			config := readjson.DefaultContainerConfig()
 			cfg := ns.Config()
@@ -142,6 +172,12 @@ func NewConfig(pCfg CommonConfig, parsers []config.Namespace) (*Config, error) {
 }
 
 func (c *Config) Create(in reader.Reader) Parser {
+	return c.CreateWithState(in, &State{})
+}
+
+// CreateWithState creates the parsers, continuing from the given state.
+// The parsers update the state while reading, so the caller can persist it.
+func (c *Config) CreateWithState(in reader.Reader, state *State) Parser {
 	p := in
 	for _, ns := range c.parsers {
 		name := ns.Name()
@@ -165,6 +201,30 @@ func (c *Config) Create(in reader.Reader) Parser {
 				return p
 			}
 			p = readjson.NewJSONParser(p, &config)
+		case "json":
+			var config readjson.ParserConfig
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return p
+			}
+			p = readjson.NewJSONParser(readjson.NewDocumentReader(p, int(c.pCfg.MaxBytes)), &config)
+		case "logfmt", "kv":
+			config := logfmt.DefaultConfig()
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return p
+			}
+			p = logfmt.NewParser(p, &config)
+		case "csv":
+			config := readcsv.DefaultConfig()
+			cfg := ns.Config()
+			err := cfg.Unpack(&config)
+			if err != nil {
+				return p
+			}
+			p = readcsv.NewParser(p, &config, &state.CSVHeader)
 		case "container":
 			config := readjson.DefaultContainerConfig()
 			cfg := ns.Config()
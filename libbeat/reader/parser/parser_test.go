@@ -161,6 +161,75 @@ func TestParsersConfigAndReading(t *testing.T) {
 				"[log] In total there should be 3 events\n",
 			},
 		},
+		"logfmt parser with message key": {
+			lines: "level=info msg=\"first message\"\nlevel=warn msg=second\n",
+			parsers: map[string]interface{}{
+				"parsers": []map[string]interface{}{
+					map[string]interface{}{
+						"logfmt": map[string]interface{}{
+							"message_key": "msg",
+						},
+					},
+				},
+			},
+			expectedMessages: []string{"first message", "second"},
+		},
+		"kv parser is an alias of logfmt": {
+			lines: "level=info msg=\"first message\"\nlevel=warn msg=second\n",
+			parsers: map[string]interface{}{
+				"parsers": []map[string]interface{}{
+					map[string]interface{}{
+						"kv": map[string]interface{}{
+							"message_key": "msg",
+						},
+					},
+				},
+			},
+			expectedMessages: []string{"first message", "second"},
+		},
+		"json parser with pretty printed documents": {
+			lines: "{\n  \"msg\": \"first\"\n}\n{\n  \"msg\": \"second\"\n}\n",
+			parsers: map[string]interface{}{
+				"parsers": []map[string]interface{}{
+					map[string]interface{}{
+						"json": map[string]interface{}{
+							"message_key": "msg",
+						},
+					},
+				},
+			},
+			expectedMessages: []string{"first", "second"},
+		},
+		"csv parser": {
+			lines: "name;age\nalice;30\n",
+			parsers: map[string]interface{}{
+				"parsers": []map[string]interface{}{
+					map[string]interface{}{
+						"csv": map[string]interface{}{
+							"separator": ";",
+						},
+					},
+				},
+			},
+			expectedMessages: []string{"", "alice;30\n"},
+		},
+		"stacktrace multiline parser": {
+			lines: "starting\njava.lang.NullPointerException\n\tat com.example.Main.main(Main.java:3)\nstopping\n",
+			parsers: map[string]interface{}{
+				"parsers": []map[string]interface{}{
+					map[string]interface{}{
+						"multiline": map[string]interface{}{
+							"type":      "stacktrace",
+							"languages": []string{"java"},
+						},
+					},
+				},
+			},
+			expectedMessages: []string{
+				"starting\n\njava.lang.NullPointerException\n\n\tat com.example.Main.main(Main.java:3)\n",
+				"stopping\n",
+			},
+		},
 		"non existent parser configuration": {
 			parsers: map[string]interface{}{
 				"parsers": []map[string]interface{}{
@@ -0,0 +1,195 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readcsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Config holds the options of the CSV parser.
+type Config struct {
+	Separator           string   `config:"separator"`
+	Columns             []string `config:"columns"`
+	Target              string   `config:"target"`
+	OverwriteKeys       bool     `config:"overwrite_keys"`
+	TrimLeadingSpace    bool     `config:"trim_leading_space"`
+	AddErrorKey         bool     `config:"add_error_key"`
+	IgnoreDecodingError bool     `config:"ignore_decoding_error"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Separator: ",",
+	}
+}
+
+// Validate validates the Config option for the CSV parser.
+func (c *Config) Validate() error {
+	if utf8.RuneCountInString(c.Separator) != 1 {
+		return fmt.Errorf("separator must be a single character, got %q", c.Separator)
+	}
+	r, _ := utf8.DecodeRuneInString(c.Separator)
+	if r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return fmt.Errorf("invalid separator %q", c.Separator)
+	}
+	return nil
+}
+
+// Parser decodes CSV lines into objects keyed by the column names. Unless
+// the columns are configured, the first line it reads is the header of the
+// file.
+type Parser struct {
+	r      reader.Reader
+	cfg    *Config
+	comma  rune
+	header *[]string
+	logger *logp.Logger
+}
+
+// NewParser creates a CSV parser. The header is shared with the caller,
+// so the header read from the file can be persisted and passed to the next
+// parser reading the same file. If the header is empty, the first line read
+// is used as header. The header is not read if the columns are configured.
+func NewParser(r reader.Reader, cfg *Config, header *[]string) *Parser {
+	if header == nil {
+		header = new([]string)
+	}
+	comma, _ := utf8.DecodeRuneInString(cfg.Separator)
+	return &Parser{
+		r:      r,
+		cfg:    cfg,
+		comma:  comma,
+		header: header,
+		logger: logp.NewLogger("parser_csv"),
+	}
+}
+
+// Next returns the next line as an object keyed by the column names. The
+// header line is returned as an empty message, so the bytes it occupies
+// in the file are still accounted for.
+func (p *Parser) Next() (reader.Message, error) {
+	message, err := p.r.Next()
+	if err != nil {
+		return message, err
+	}
+
+	if len(bytes.TrimSpace(message.Content)) == 0 {
+		return message, nil
+	}
+
+	values, err := p.decode(message.Content)
+	if err == nil && len(p.cfg.Columns) == 0 && len(*p.header) == 0 {
+		*p.header = values
+		p.logger.Debugf("Read CSV header with %d columns", len(values))
+		message.Content = nil
+		message.Fields = nil
+		return message, nil
+	}
+
+	var fields mapstr.M
+	if err == nil {
+		fields, err = p.toFields(values)
+	}
+	if err != nil {
+		if !p.cfg.IgnoreDecodingError {
+			p.logger.Errorf("Error decoding CSV: %v", err)
+		}
+		if !p.cfg.AddErrorKey {
+			return message, nil
+		}
+		fields = mapstr.M{"error": createError(fmt.Sprintf("Error decoding CSV: %v", err))}
+	}
+
+	if message.Fields == nil {
+		message.Fields = mapstr.M{}
+	}
+	if p.cfg.Target == "" {
+		event := &beat.Event{
+			Timestamp: message.Ts,
+			Meta:      message.Meta,
+			Fields:    message.Fields,
+		}
+		jsontransform.WriteJSONKeys(event, fields, false, p.cfg.OverwriteKeys, p.cfg.AddErrorKey)
+		message.Ts = event.Timestamp
+		message.Fields = event.Fields
+		message.Meta = event.Meta
+	} else {
+		target := mapstr.M{}
+		target.Put(p.cfg.Target, fields)
+		message.AddFields(target)
+	}
+
+	return message, nil
+}
+
+// decode reads a single CSV record from text.
+func (p *Parser) decode(text []byte) ([]string, error) {
+	r := csv.NewReader(bytes.NewReader(text))
+	r.Comma = p.comma
+	r.TrimLeadingSpace = p.cfg.TrimLeadingSpace
+	r.FieldsPerRecord = -1
+
+	values, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Read(); err == nil {
+		return nil, errors.New("message contains more than one record")
+	}
+	return values, nil
+}
+
+// toFields maps the values to the column names. Columns without a name are
+// named after their position.
+func (p *Parser) toFields(values []string) (mapstr.M, error) {
+	header := p.cfg.Columns
+	if len(header) == 0 {
+		header = *p.header
+	}
+	if len(values) != len(header) {
+		return nil, fmt.Errorf("expected %d columns, found %d", len(header), len(values))
+	}
+
+	fields := make(mapstr.M, len(values))
+	for i, v := range values {
+		name := header[i]
+		if name == "" {
+			name = fmt.Sprintf("column%d", i+1)
+		}
+		fields[name] = v
+	}
+	return fields, nil
+}
+
+func createError(message string) mapstr.M {
+	return mapstr.M{"message": message, "type": "csv"}
+}
+
+func (p *Parser) Close() error {
+	return p.r.Close()
+}
@@ -0,0 +1,162 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readcsv
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestParser(t *testing.T) {
+	tests := map[string]struct {
+		config         map[string]interface{}
+		header         []string
+		lines          []string
+		expectedFields []mapstr.M
+		expectedHeader []string
+	}{
+		"header line is read": {
+			lines: []string{"name,age", "alice,30", `"smith, bob",41`},
+			expectedFields: []mapstr.M{
+				nil,
+				{"name": "alice", "age": "30"},
+				{"name": "smith, bob", "age": "41"},
+			},
+			expectedHeader: []string{"name", "age"},
+		},
+		"known header is not read again": {
+			header: []string{"name", "age"},
+			lines:  []string{"alice,30"},
+			expectedFields: []mapstr.M{
+				{"name": "alice", "age": "30"},
+			},
+			expectedHeader: []string{"name", "age"},
+		},
+		"configured columns": {
+			config: map[string]interface{}{"columns": []string{"name", "age"}},
+			lines:  []string{"alice,30"},
+			expectedFields: []mapstr.M{
+				{"name": "alice", "age": "30"},
+			},
+		},
+		"tab separated values with target": {
+			config: map[string]interface{}{"separator": "\t", "target": "csv"},
+			lines:  []string{"name\t\tage", "alice\tx\t30"},
+			expectedFields: []mapstr.M{
+				nil,
+				{"csv": mapstr.M{"name": "alice", "column2": "x", "age": "30"}},
+			},
+			expectedHeader: []string{"name", "", "age"},
+		},
+		"trim leading space": {
+			config: map[string]interface{}{"trim_leading_space": true},
+			lines:  []string{"name, age", "alice,  30"},
+			expectedFields: []mapstr.M{
+				nil,
+				{"name": "alice", "age": "30"},
+			},
+			expectedHeader: []string{"name", "age"},
+		},
+		"empty lines are skipped": {
+			lines: []string{"", "name,age", "", "alice,30"},
+			expectedFields: []mapstr.M{
+				nil,
+				nil,
+				nil,
+				{"name": "alice", "age": "30"},
+			},
+			expectedHeader: []string{"name", "age"},
+		},
+		"wrong number of columns": {
+			config: map[string]interface{}{"add_error_key": true},
+			lines:  []string{"name,age", "alice"},
+			expectedFields: []mapstr.M{
+				nil,
+				{"error": mapstr.M{"message": "Error decoding CSV: expected 2 columns, found 1", "type": "csv"}},
+			},
+			expectedHeader: []string{"name", "age"},
+		},
+		"decoding error without error key": {
+			lines: []string{"name,age", `"alice,30`},
+			expectedFields: []mapstr.M{
+				nil,
+				nil,
+			},
+			expectedHeader: []string{"name", "age"},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			c := DefaultConfig()
+			require.NoError(t, config.MustNewConfigFrom(test.config).Unpack(&c))
+
+			var msgs []reader.Message
+			for _, l := range test.lines {
+				msgs = append(msgs, reader.Message{Content: []byte(l), Bytes: len(l) + 1})
+			}
+			header := test.header
+			p := NewParser(&testReader{msgs: msgs}, &c, &header)
+			defer p.Close()
+
+			for i, expected := range test.expectedFields {
+				msg, err := p.Next()
+				require.NoError(t, err)
+				require.Equal(t, len(test.lines[i])+1, msg.Bytes, "bytes of line %d", i)
+				require.Equal(t, expected, msg.Fields, "fields of line %d", i)
+			}
+			_, err := p.Next()
+			require.ErrorIs(t, err, io.EOF)
+			require.Equal(t, test.expectedHeader, header)
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, sep := range []string{"", ";;", `"`, "\n"} {
+		c := DefaultConfig()
+		err := config.MustNewConfigFrom(map[string]interface{}{"separator": sep}).Unpack(&c)
+		require.Error(t, err, "separator %q", sep)
+	}
+	c := DefaultConfig()
+	require.NoError(t, config.MustNewConfigFrom(map[string]interface{}{"separator": ";"}).Unpack(&c))
+}
+
+type testReader struct {
+	msgs []reader.Message
+}
+
+func (r *testReader) Next() (reader.Message, error) {
+	if len(r.msgs) == 0 {
+		return reader.Message{}, io.EOF
+	}
+	msg := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	return msg, nil
+}
+
+func (r *testReader) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Auto is the name of the encoding which is detected from the first bytes
+// of a file. It is not available from FindEncoding, the name returned by
+// Detect must be used instead.
+const Auto = "auto"
+
+// DetectSampleSize is the number of bytes Detect needs to detect an
+// encoding reliably.
+const DetectSampleSize = 4096
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// Detect returns the name of the encoding of sample, the first bytes of a
+// file, and the length of the Byte Order Mark at the beginning of sample.
+// The encoding is read from the Byte Order Mark if sample has one. Otherwise
+// sample is UTF-16 if most of the bytes at either even or odd positions are
+// zero, UTF-8 if it is valid UTF-8 and ISO-8859-1 (Latin-1) if it is not.
+//
+// The encodings returned do not expect a Byte Order Mark, the data must be
+// read from after the Byte Order Mark.
+func Detect(sample []byte) (name string, bomLen int) {
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		return "utf-8", len(bomUTF8)
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		return "utf-16le", len(bomUTF16LE)
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		return "utf-16be", len(bomUTF16BE)
+	}
+
+	if name, ok := detectUTF16(sample); ok {
+		return name, 0
+	}
+	if validUTF8Prefix(sample) {
+		return "utf-8", 0
+	}
+	return "iso8859-1", 0
+}
+
+// detectUTF16 detects UTF-16 without Byte Order Mark from the zero bytes
+// of mostly ASCII text.
+func detectUTF16(sample []byte) (string, bool) {
+	pairs := len(sample) / 2
+	if pairs == 0 {
+		return "", false
+	}
+
+	var zeroEven, zeroOdd int
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			zeroEven++
+		}
+		if sample[i+1] == 0 {
+			zeroOdd++
+		}
+	}
+
+	// at least 40% of the characters are ASCII and at most 10% of the
+	// characters have a zero byte in the other position
+	const minZero, maxOtherZero = 0.4, 0.1
+	switch {
+	case float64(zeroOdd) >= minZero*float64(pairs) && float64(zeroEven) <= maxOtherZero*float64(pairs):
+		return "utf-16le", true
+	case float64(zeroEven) >= minZero*float64(pairs) && float64(zeroOdd) <= maxOtherZero*float64(pairs):
+		return "utf-16be", true
+	}
+	return "", false
+}
+
+// validUTF8Prefix returns true if sample is valid UTF-8, the last character
+// of sample may be incomplete.
+func validUTF8Prefix(sample []byte) bool {
+	// ignore the last character if it is incomplete
+	for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				sample = sample[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(sample)
+}
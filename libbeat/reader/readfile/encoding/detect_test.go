@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestDetect(t *testing.T) {
+	text := "2023-06-01 12:00:00 INFO Démarrage du service ünïcödé\n"
+	mustEncode := func(t *testing.T, e Encoding, s string) []byte {
+		b, err := e.NewEncoder().Bytes([]byte(s))
+		require.NoError(t, err)
+		return b
+	}
+	utf16le := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	utf16be := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+
+	cases := map[string]struct {
+		sample         []byte
+		expectedName   string
+		expectedBOMLen int
+		expectedText   string
+	}{
+		"ascii": {
+			sample:       []byte("only ascii\n"),
+			expectedName: "utf-8",
+			expectedText: "only ascii\n",
+		},
+		"utf-8": {
+			sample:       []byte(text),
+			expectedName: "utf-8",
+			expectedText: text,
+		},
+		"utf-8 with incomplete last character": {
+			sample:       []byte(text[:strings.Index(text, "é")+1]),
+			expectedName: "utf-8",
+		},
+		"utf-8 with BOM": {
+			sample:         append([]byte{0xef, 0xbb, 0xbf}, text...),
+			expectedName:   "utf-8",
+			expectedBOMLen: 3,
+			expectedText:   text,
+		},
+		"utf-16le with BOM": {
+			sample:         append([]byte{0xff, 0xfe}, mustEncode(t, utf16le, text)...),
+			expectedName:   "utf-16le",
+			expectedBOMLen: 2,
+			expectedText:   text,
+		},
+		"utf-16be with BOM": {
+			sample:         append([]byte{0xfe, 0xff}, mustEncode(t, utf16be, text)...),
+			expectedName:   "utf-16be",
+			expectedBOMLen: 2,
+			expectedText:   text,
+		},
+		"utf-16le without BOM": {
+			sample:       mustEncode(t, utf16le, text),
+			expectedName: "utf-16le",
+			expectedText: text,
+		},
+		"utf-16be without BOM": {
+			sample:       mustEncode(t, utf16be, text),
+			expectedName: "utf-16be",
+			expectedText: text,
+		},
+		"latin-1": {
+			sample:       mustEncode(t, charmap.ISO8859_1, text),
+			expectedName: "iso8859-1",
+			expectedText: text,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			detected, bomLen := Detect(tc.sample)
+			assert.Equal(t, tc.expectedName, detected)
+			assert.Equal(t, tc.expectedBOMLen, bomLen)
+
+			if tc.expectedText == "" {
+				return
+			}
+
+			// the detected encoding decodes the sample after the BOM
+			factory, ok := FindEncoding(detected)
+			require.True(t, ok)
+			enc, err := factory(bytes.NewReader(nil))
+			require.NoError(t, err)
+			decoded, err := enc.NewDecoder().Bytes(tc.sample[bomLen:])
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedText, string(decoded))
+		})
+	}
+}
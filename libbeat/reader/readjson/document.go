@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readjson
+
+import (
+	"github.com/elastic/beats/v7/libbeat/reader"
+)
+
+// DocumentReader splits the lines of the underlying reader into complete JSON
+// values, independent of the line breaks. Pretty printed documents spanning
+// multiple lines are combined, and multiple documents on a single line are
+// split. The elements of top-level arrays are returned as separate documents,
+// so arrays growing over time can be read as well.
+//
+// The bytes of the returned messages add up to the bytes read from the
+// underlying reader, so the offset of a message points right after the
+// document it contains. Offsets within a line are exact for UTF-8 and
+// single byte encodings.
+type DocumentReader struct {
+	reader   reader.Reader
+	maxBytes int
+
+	// current line
+	hasLine   bool
+	line      []byte // content of the line not consumed yet
+	lineMsg   reader.Message
+	lineBytes int // bytes of the line not accounted for yet
+
+	// current document
+	inDoc     bool
+	doc       []byte
+	docMsg    reader.Message
+	bytes     int // bytes accounted for the next document
+	truncated bool
+
+	// scanner state of the current document
+	depth    int
+	inString bool
+	escaped  bool
+	scalar   bool
+}
+
+// NewDocumentReader creates a new reader returning one JSON value per message.
+// Documents larger than maxBytes are truncated.
+func NewDocumentReader(r reader.Reader, maxBytes int) *DocumentReader {
+	return &DocumentReader{
+		reader:   r,
+		maxBytes: maxBytes,
+	}
+}
+
+// Next returns the next complete JSON value.
+func (r *DocumentReader) Next() (reader.Message, error) {
+	for {
+		if !r.hasLine {
+			message, err := r.reader.Next()
+			if err != nil {
+				return message, err
+			}
+			r.hasLine = true
+			r.line = message.Content
+			r.lineMsg = message
+			r.lineBytes = message.Bytes
+		}
+
+		if !r.inDoc {
+			r.consume(skipSeparators(r.line))
+			if len(r.line) == 0 {
+				r.endLine()
+				continue
+			}
+			r.startDoc()
+		}
+
+		n, done := r.scan(r.line)
+		r.appendDoc(r.line[:n])
+		r.consume(n)
+		if !done {
+			r.endLine()
+			continue
+		}
+
+		// the rest of the line belongs to the document if it only
+		// contains separators, so the offset points to the next line
+		if skipSeparators(r.line) == len(r.line) {
+			r.inDoc = false
+			r.endLine()
+		}
+		return r.finishDoc(), nil
+	}
+}
+
+// consume marks the first n bytes of the current line as read.
+func (r *DocumentReader) consume(n int) {
+	r.line = r.line[n:]
+	if n > r.lineBytes {
+		n = r.lineBytes
+	}
+	r.bytes += n
+	r.lineBytes -= n
+}
+
+// endLine accounts for the remaining bytes of the current line, including
+// the line terminator.
+func (r *DocumentReader) endLine() {
+	if r.inDoc {
+		r.appendDoc([]byte{'\n'})
+	}
+	r.bytes += r.lineBytes
+	r.lineBytes = 0
+	r.line = nil
+	r.hasLine = false
+}
+
+func (r *DocumentReader) startDoc() {
+	r.inDoc = true
+	r.doc = nil
+	// the fields are modified by the following parsers, documents
+	// read from the same line must not share them
+	r.docMsg = r.lineMsg
+	if r.lineMsg.Fields != nil {
+		r.docMsg.Fields = r.lineMsg.Fields.Clone()
+	}
+	if r.lineMsg.Meta != nil {
+		r.docMsg.Meta = r.lineMsg.Meta.Clone()
+	}
+	r.depth = 0
+	r.inString = false
+	r.escaped = false
+	// objects and strings are scanned until they are closed, everything
+	// else until the next separator
+	r.scalar = r.line[0] != '{' && r.line[0] != '"'
+}
+
+// scan returns the number of bytes of line belonging to the current document
+// and whether the document is complete.
+func (r *DocumentReader) scan(line []byte) (int, bool) {
+	for i, c := range line {
+		if r.scalar {
+			if isSeparator(c) || c == '{' || c == '"' {
+				return i, true
+			}
+			continue
+		}
+
+		if r.inString {
+			switch {
+			case r.escaped:
+				r.escaped = false
+			case c == '\\':
+				r.escaped = true
+			case c == '"':
+				r.inString = false
+				if r.depth == 0 {
+					return i + 1, true
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			r.inString = true
+		case '{', '[':
+			r.depth++
+		case '}', ']':
+			r.depth--
+			if r.depth == 0 {
+				return i + 1, true
+			}
+		}
+	}
+
+	// scalars end at the end of the line
+	return len(line), r.scalar
+}
+
+func (r *DocumentReader) appendDoc(b []byte) {
+	if r.truncated {
+		return
+	}
+	if r.maxBytes > 0 && len(r.doc)+len(b) > r.maxBytes {
+		b = b[:r.maxBytes-len(r.doc)]
+		r.truncated = true
+	}
+	r.doc = append(r.doc, b...)
+}
+
+func (r *DocumentReader) finishDoc() reader.Message {
+	message := r.docMsg
+	message.Content = r.doc
+	message.Bytes = r.bytes
+	if r.truncated {
+		message.AddFlagsWithKey("log.flags", "truncated")
+	}
+
+	r.inDoc = false
+	r.doc = nil
+	r.bytes = 0
+	r.truncated = false
+	return message
+}
+
+// skipSeparators returns the number of whitespace, commas and brackets of
+// top-level arrays at the beginning of b.
+func skipSeparators(b []byte) int {
+	for i, c := range b {
+		if !isSeparator(c) {
+			return i
+		}
+	}
+	return len(b)
+}
+
+func isSeparator(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', ',', '[', ']':
+		return true
+	}
+	return false
+}
+
+func (r *DocumentReader) Close() error {
+	return r.reader.Close()
+}
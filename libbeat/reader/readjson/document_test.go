@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package readjson
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDocumentReader(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		maxBytes int
+		docs     []string
+		bytes    []int
+	}{
+		"one document per line": {
+			input: "{\"a\":1}\n{\"b\":2}\n",
+			docs:  []string{`{"a":1}`, `{"b":2}`},
+			bytes: []int{8, 8},
+		},
+		"pretty printed documents": {
+			input: "{\n  \"a\": 1,\n  \"b\": {\"c\": [1, 2]}\n}\n{\n  \"d\": 2\n}\n",
+			docs:  []string{"{\n  \"a\": 1,\n  \"b\": {\"c\": [1, 2]}\n}", "{\n  \"d\": 2\n}"},
+			bytes: []int{35, 13},
+		},
+		"multiple documents on a line": {
+			input: "{\"a\":1} {\"b\":2}\n",
+			docs:  []string{`{"a":1}`, `{"b":2}`},
+			bytes: []int{7, 9},
+		},
+		"top-level array": {
+			input: "[\n  {\"a\":1},\n  {\"b\":2}\n]\n",
+			docs:  []string{`{"a":1}`, `{"b":2}`},
+			bytes: []int{13, 10},
+		},
+		"braces and quotes in strings": {
+			input: "{\"a\": \"}{\\\"[\",\n\"b\": \"]\"}\n",
+			docs:  []string{"{\"a\": \"}{\\\"[\",\n\"b\": \"]\"}"},
+			bytes: []int{25},
+		},
+		"invalid values are separated": {
+			input: "oops {\"a\":1}\n",
+			docs:  []string{"oops", `{"a":1}`},
+			bytes: []int{4, 9},
+		},
+		"truncated documents": {
+			input:    "{\"a\": \"0123456789\"}\n{\"b\":2}\n",
+			maxBytes: 10,
+			docs:     []string{`{"a": "012`, `{"b":2}`},
+			bytes:    []int{20, 8},
+		},
+	}
+
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			r := NewDocumentReader(newLinesReader(test.input), test.maxBytes)
+
+			var docs []string
+			var bytes []int
+			for {
+				msg, err := r.Next()
+				if err != nil {
+					require.ErrorIs(t, err, io.EOF)
+					break
+				}
+				docs = append(docs, string(msg.Content))
+				bytes = append(bytes, msg.Bytes)
+
+				flags, _ := msg.Fields.GetValue("log.flags")
+				require.Equal(t, test.maxBytes > 0 && len(docs) == 1, flags != nil, "truncated flag of %q", msg.Content)
+			}
+			require.Equal(t, test.docs, docs)
+			require.Equal(t, test.bytes, bytes)
+		})
+	}
+}
+
+func TestDocumentReaderContinuesAfterEOF(t *testing.T) {
+	lines := newLinesReader("[\n{\"a\":\n")
+	r := NewDocumentReader(lines, 0)
+
+	_, err := r.Next()
+	require.ErrorIs(t, err, io.EOF)
+
+	// the rest of the document is written later
+	lines.add("1},\n")
+	msg, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "{\"a\":\n1}", string(msg.Content))
+	require.Equal(t, 12, msg.Bytes)
+	require.Equal(t, mapstr.M{"line": 1}, msg.Fields)
+}
+
+func TestDocumentReaderWithJSONParser(t *testing.T) {
+	r := NewJSONParser(
+		NewDocumentReader(newLinesReader("[{\"a\": 1}, {\"a\": 2,\n\"b\": \"c\"}]\n"), 0),
+		&ParserConfig{Target: "doc"},
+	)
+
+	msg, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, mapstr.M{"line": 0, "doc": mapstr.M{"a": int64(1)}}, msg.Fields)
+
+	msg, err = r.Next()
+	require.NoError(t, err)
+	require.Equal(t, mapstr.M{"line": 0, "doc": mapstr.M{"a": int64(2), "b": "c"}}, msg.Fields)
+}
+
+// linesReader returns the lines of its input like the line reader, without
+// the line terminator. Every line has its number as field.
+type linesReader struct {
+	lines []string
+	n     int
+}
+
+func newLinesReader(input string) *linesReader {
+	r := &linesReader{}
+	r.add(input)
+	return r
+}
+
+func (r *linesReader) add(input string) {
+	r.lines = append(r.lines, strings.SplitAfter(input, "\n")...)
+	if r.lines[len(r.lines)-1] == "" {
+		r.lines = r.lines[:len(r.lines)-1]
+	}
+}
+
+func (r *linesReader) Next() (reader.Message, error) {
+	if r.n >= len(r.lines) {
+		return reader.Message{}, io.EOF
+	}
+	line := r.lines[r.n]
+	msg := reader.Message{
+		Content: []byte(strings.TrimSuffix(line, "\n")),
+		Bytes:   len(line),
+		Fields:  mapstr.M{"line": r.n},
+	}
+	r.n++
+	return msg, nil
+}
+
+func (r *linesReader) Close() error {
+	return nil
+}
@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltstore
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/beats/v7/libbeat/statestore/internal/storecompliance"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func init() {
+	logp.DevelopmentSetup()
+}
+
+func TestCompliance(t *testing.T) {
+	storecompliance.TestBackendCompliance(t, func(testPath string) (backend.Registry, error) {
+		return New(logp.NewLogger("test"), Settings{Root: testPath})
+	})
+}
+
+func TestMigrateMemlog(t *testing.T) {
+	root := t.TempDir()
+
+	memlogRegistry, err := memlog.New(logp.NewLogger("test"), memlog.Settings{Root: root})
+	require.NoError(t, err)
+	memlogStore, err := memlogRegistry.Access("test")
+	require.NoError(t, err)
+	require.NoError(t, memlogStore.Set("a", mapstr.M{"offset": 10, "name": "a.log"}))
+	require.NoError(t, memlogStore.Set("b", mapstr.M{"offset": 20}))
+	require.NoError(t, memlogStore.Set("c", mapstr.M{"offset": 30}))
+	require.NoError(t, memlogStore.Remove("c"))
+	require.NoError(t, memlogStore.Close())
+	require.NoError(t, memlogRegistry.Close())
+
+	registry, err := New(logp.NewLogger("test"), Settings{Root: root, MigrateMemlog: true})
+	require.NoError(t, err)
+	store, err := registry.Access("test")
+	require.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(root, "test.db"))
+	assertEntries(t, store, map[string]int{"a": 10, "b": 20})
+
+	var a struct {
+		Name string `struct:"name"`
+	}
+	require.NoError(t, store.Get("a", &a))
+	assert.Equal(t, "a.log", a.Name)
+
+	// Entries updated after the migration must not be overwritten by the
+	// memlog state when the store is opened again.
+	require.NoError(t, store.Set("b", mapstr.M{"offset": 25}))
+	require.NoError(t, store.Close())
+
+	store, err = registry.Access("test")
+	require.NoError(t, err)
+	assertEntries(t, store, map[string]int{"a": 10, "b": 25})
+	require.NoError(t, store.Close())
+	require.NoError(t, registry.Close())
+}
+
+func TestMigrateMemlogWithoutMemlogStore(t *testing.T) {
+	registry, err := New(logp.NewLogger("test"), Settings{Root: t.TempDir(), MigrateMemlog: true})
+	require.NoError(t, err)
+	store, err := registry.Access("test")
+	require.NoError(t, err)
+	assertEntries(t, store, map[string]int{})
+	require.NoError(t, store.Close())
+}
+
+func assertEntries(t *testing.T, store backend.Store, expected map[string]int) {
+	t.Helper()
+	actual := map[string]int{}
+	err := store.Each(func(key string, dec backend.ValueDecoder) (bool, error) {
+		var value struct {
+			Offset int `struct:"offset"`
+		}
+		if err := dec.Decode(&value); err != nil {
+			return false, err
+		}
+		actual[key] = value.Offset
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestLargeNumbers(t *testing.T) {
+	registry, err := New(logp.NewLogger("test"), Settings{Root: t.TempDir(), SyncInterval: time.Hour})
+	require.NoError(t, err)
+	store, err := registry.Access("test")
+	require.NoError(t, err)
+
+	type state struct {
+		Inode  uint64  `struct:"inode"`
+		Device uint64  `struct:"device"`
+		Offset int64   `struct:"offset"`
+		Ratio  float64 `struct:"ratio"`
+	}
+	expected := state{Inode: math.MaxUint64 - 1, Device: 1<<53 + 1, Offset: -(1<<62 + 1), Ratio: 0.5}
+	require.NoError(t, store.Set("a", expected))
+
+	var actual state
+	require.NoError(t, store.Get("a", &actual))
+	assert.Equal(t, expected, actual)
+
+	// The changes are synced when the store is closed.
+	require.NoError(t, store.Close())
+	store, err = registry.Access("test")
+	require.NoError(t, err)
+	actual = state{}
+	require.NoError(t, store.Get("a", &actual))
+	assert.Equal(t, expected, actual)
+	require.NoError(t, store.Close())
+	require.NoError(t, registry.Close())
+}
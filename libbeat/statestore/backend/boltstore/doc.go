@@ -0,0 +1,40 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package boltstore implements a statestore backend on top of bbolt, an
+// embedded B+tree key-value database.
+//
+// Unlike memlog, boltstore does not keep the key-value pairs in memory.
+// Every store is a single database file, and each Set or Remove operation
+// is committed to it in its own transaction. This keeps memory usage
+// proportional to the working set instead of the number of keys, and
+// avoids the pauses caused by memlog writing full checkpoints of large
+// registries.
+//
+// Syncing every transaction to disk is slow. Like memlog, which only syncs
+// its log file on checkpoints and on close, the store can be configured to
+// sync periodically with Settings.SyncInterval.
+//
+// Values are stored as JSON documents. Like memlog, values are converted
+// to a map[string]interface{} before they are stored, so no references to
+// the structures passed to Set are kept.
+//
+// Stores that were written by memlog can be migrated by enabling
+// Settings.MigrateMemlog. The migration runs once, when the database file
+// of a store is created and the memlog store of the same name exists in
+// the registry root.
+package boltstore
@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltstore
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// memlogMetaFileName is the file that marks a memlog store directory.
+const memlogMetaFileName = "meta.json"
+
+// migrateMemlog copies all key-value pairs of the memlog store with the
+// given name into the store. The memlog files are left untouched, so
+// the memlog backend can still be used to go back to the old state.
+func migrateMemlog(log *logp.Logger, settings Settings, name string, to *store) error {
+	home := filepath.Join(settings.Root, name)
+	if _, err := os.Stat(filepath.Join(home, memlogMetaFileName)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	log.Infof("Migrating memlog store from '%v'", home)
+
+	registry, err := memlog.New(log, memlog.Settings{
+		Root:     settings.Root,
+		FileMode: settings.FileMode,
+	})
+	if err != nil {
+		return err
+	}
+	defer registry.Close()
+
+	from, err := registry.Access(name)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	// The memlog store holds all its entries in memory anyway, so they are
+	// collected and written in a single transaction.
+	entries := map[string]mapstr.M{}
+	err = from.Each(func(key string, dec backend.ValueDecoder) (bool, error) {
+		var value mapstr.M
+		if err := dec.Decode(&value); err != nil {
+			return false, err
+		}
+		entries[key] = value
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := to.setAll(entries); err != nil {
+		return err
+	}
+	log.Infof("Migrated %d entries from memlog store '%v'", len(entries), home)
+	return nil
+}
@@ -0,0 +1,149 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Registry configures access to bbolt based stores.
+type Registry struct {
+	log *logp.Logger
+
+	mu     sync.Mutex
+	active bool
+
+	settings Settings
+}
+
+// Settings configures a new Registry.
+type Settings struct {
+	// Registry root directory. Each store is a single "<name>.db" file in
+	// the root directory.
+	Root string
+
+	// FileMode is used to configure the file mode for new files generated by the
+	// registry.  File mode 0600 will be used if this field is not set.
+	FileMode os.FileMode
+
+	// Timeout is how long Access waits for the file lock of a store that
+	// is used by another process. Defaults to 1s if not set.
+	Timeout time.Duration
+
+	// MigrateMemlog imports the memlog store with the same name from the
+	// registry root when a store's database file is created.
+	MigrateMemlog bool
+
+	// SyncInterval is how often changes are synced to disk. If it is 0,
+	// every change is synced before Set or Remove returns. Otherwise
+	// changes made since the last sync can be lost if the operating system
+	// crashes, but not if only the Beat stops.
+	SyncInterval time.Duration
+}
+
+const defaultFileMode os.FileMode = 0600
+
+const defaultTimeout = time.Second
+
+// New configures a bbolt Registry that can be used to open stores.
+func New(log *logp.Logger, settings Settings) (*Registry, error) {
+	if settings.FileMode == 0 {
+		settings.FileMode = defaultFileMode
+	}
+	if settings.Timeout == 0 {
+		settings.Timeout = defaultTimeout
+	}
+
+	root, err := filepath.Abs(settings.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Root = root
+	return &Registry{
+		log:      log,
+		active:   true,
+		settings: settings,
+	}, nil
+}
+
+// Access creates or opens a store. The registry root directory and the
+// store's database file are created if they don't exist.
+// Returns an error if the database can not be opened.
+func (r *Registry) Access(name string) (backend.Store, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active {
+		return nil, errRegClosed
+	}
+
+	logger := r.log.With("store", name)
+
+	if err := os.MkdirAll(r.settings.Root, os.ModeDir|0770); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(r.settings.Root, name+".db")
+	_, err := os.Stat(path)
+	created := os.IsNotExist(err)
+
+	db, err := bbolt.Open(path, r.settings.FileMode, &bbolt.Options{
+		Timeout: r.settings.Timeout,
+		NoSync:  r.settings.SyncInterval > 0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store '%v': %w", path, err)
+	}
+
+	store, err := openStore(logger, db, r.settings.SyncInterval)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if created && r.settings.MigrateMemlog {
+		if err := migrateMemlog(logger, r.settings, name, store); err != nil {
+			// Remove the incomplete database, so the migration is
+			// attempted again the next time the store is opened.
+			store.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("failed to migrate memlog store '%v': %w", name, err)
+		}
+	}
+
+	return store, nil
+}
+
+// Close closes the registry. No new store can be accessed after close.
+// Stores are closed by the statestore frontend before the registry.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	r.active = false
+	r.mu.Unlock()
+	return nil
+}
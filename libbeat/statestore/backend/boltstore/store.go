@@ -0,0 +1,234 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/common/transform/typeconv"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// bucketName is the bucket holding all key-value pairs of a store.
+var bucketName = []byte("entries")
+
+// errStopIteration stops a bbolt ForEach loop without reporting an error.
+var errStopIteration = errors.New("stop iteration")
+
+// store implements a bbolt based store. bbolt allows one writer and
+// multiple concurrent readers, so the store does not need additional
+// locking.
+type store struct {
+	log *logp.Logger
+	db  *bbolt.DB
+
+	// done stops the goroutine syncing the database file when the
+	// database is opened with NoSync.
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// valueDecoder decodes a JSON document read from the database.
+type valueDecoder struct {
+	raw []byte
+}
+
+// openStore prepares the database for use as a store. If the database was
+// opened with NoSync, the changes are synced to disk every syncInterval.
+func openStore(log *logp.Logger, db *bbolt.DB, syncInterval time.Duration) (*store, error) {
+	err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &store{log: log, db: db, done: make(chan struct{})}
+	if db.NoSync {
+		s.wg.Add(1)
+		go s.syncLoop(syncInterval)
+	}
+	return s, nil
+}
+
+func (s *store) syncLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.db.Sync(); err != nil {
+				s.log.Errorf("Failed to sync the store to disk: %v", err)
+			}
+		}
+	}
+}
+
+// Close syncs pending changes to disk and closes the database file.
+func (s *store) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	var err error
+	if s.db.NoSync {
+		err = s.db.Sync()
+	}
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Has checks if the key is known.
+func (s *store) Has(key string) (bool, error) {
+	var exists bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		exists = tx.Bucket(bucketName).Get([]byte(key)) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// Get retrieves and decodes the key-value pair into to.
+func (s *store) Get(key string, to interface{}) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		raw := tx.Bucket(bucketName).Get([]byte(key))
+		if raw == nil {
+			return errKeyUnknown
+		}
+		return valueDecoder{raw: raw}.Decode(to)
+	})
+}
+
+// Set inserts or overwrites a key-value pair.
+func (s *store) Set(key string, value interface{}) error {
+	raw, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketName).Put([]byte(key), raw)
+	})
+}
+
+// Remove removes a key from the store. The operation does not check if
+// the key exists.
+func (s *store) Remove(key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketName).Delete([]byte(key))
+	})
+}
+
+// Each iterates over all key-value pairs in the store in key order.
+func (s *store) Each(fn func(string, backend.ValueDecoder) (bool, error)) error {
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketName).ForEach(func(k, v []byte) error {
+			cont, err := fn(string(k), valueDecoder{raw: v})
+			if err != nil {
+				return err
+			}
+			if !cont {
+				return errStopIteration
+			}
+			return nil
+		})
+	})
+	if errors.Is(err, errStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// setAll inserts all key-value pairs in a single transaction.
+func (s *store) setAll(entries map[string]mapstr.M) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		for key, value := range entries {
+			raw, err := encodeValue(value)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(key), raw); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func encodeValue(value interface{}) ([]byte, error) {
+	var tmp mapstr.M
+	if err := typeconv.Convert(&tmp, value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(tmp)
+}
+
+// Decode unpacks the JSON document into to. The raw value is only valid
+// during the transaction it was read in, so it is decoded right away.
+// Numbers are decoded as integers when possible, so large values like inode
+// numbers and the encoded timestamps don't lose precision.
+func (d valueDecoder) Decode(to interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(d.raw))
+	dec.UseNumber()
+	var tmp map[string]interface{}
+	if err := dec.Decode(&tmp); err != nil {
+		return err
+	}
+	return typeconv.Convert(to, convertNumbers(tmp))
+}
+
+// convertNumbers replaces the json.Number values in v with int64, uint64 or
+// float64 values.
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = convertNumbers(elem)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = convertNumbers(elem)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}